@@ -1,8 +1,9 @@
 package main
 
 import (
-	_ "github.com/shima-park/nezha/pkg/component/include"
 	"github.com/shima-park/nezha/pkg/cmd"
+	_ "github.com/shima-park/nezha/pkg/component/include"
+	_ "github.com/shima-park/nezha/pkg/processor/include"
 )
 
 func main() {
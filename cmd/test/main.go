@@ -5,8 +5,9 @@ import (
 	"os"
 	"os/signal"
 
-	"github.com/shima-park/lotus/pipeline"
 	_ "github.com/shima-park/nezha/pkg/component/include"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	_ "github.com/shima-park/nezha/pkg/processor/include"
 )
 
 func main() {
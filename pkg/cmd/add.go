@@ -5,7 +5,8 @@ import (
 	"io/ioutil"
 	"os"
 
-	"github.com/shima-park/lotus/pipeline"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/rpc/proto"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
 )
@@ -72,11 +73,17 @@ func NewAddPipelineCmd() *cobra.Command {
 }
 
 func NewAddPluginCmd() *cobra.Command {
+	var sig, name, version string
 	cmd := &cobra.Command{
 		Use:     "plugin (PATH)",
 		Aliases: []string{"plug"},
-		Short:   "Add a plugin to the server",
+		Short:   "Add a plugin(.so, .wasm or gRPC plugin executable) to the server",
 		Run: func(cmd *cobra.Command, args []string) {
+			if (sig != "" || name != "" || version != "") && len(args) != 1 {
+				fmt.Println("--sig, --name and --version can only be used when adding a single plugin")
+				os.Exit(1)
+			}
+
 			for _, path := range args {
 				_, err := os.Lstat(path)
 				if os.IsNotExist(err) {
@@ -90,7 +97,12 @@ func NewAddPluginCmd() *cobra.Command {
 			}
 			c := newClient()
 			for _, path := range args {
-				err := c.Plugin.Add(path)
+				err := c.Plugin.Add(proto.PluginAddRequest{
+					Path:      path,
+					Signature: sig,
+					Name:      name,
+					Version:   version,
+				})
 				if err != nil {
 					fmt.Println(err)
 					os.Exit(1)
@@ -98,6 +110,11 @@ func NewAddPluginCmd() *cobra.Command {
 			}
 		},
 	}
+
+	cmd.Flags().StringVar(&sig, "sig", "", "path to the ed25519 detached signature of the plugin, required if the server has trusted keys")
+	cmd.Flags().StringVar(&name, "name", "", "name of the plugin, defaults to the main module in the plugin's build info")
+	cmd.Flags().StringVar(&version, "version", "", "semantic version of the plugin, defaults to the main module version in the plugin's build info")
+
 	return cmd
 }
 
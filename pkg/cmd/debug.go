@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/rpc/proto"
+	"github.com/spf13/cobra"
+)
+
+var cmdDebug = &cobra.Command{
+	Use:   "debug",
+	Short: "Commands to debug pipeline",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+func NewDebugTapCmd() *cobra.Command {
+	var req proto.PipelineTapRequest
+	var sample string
+	cmd := &cobra.Command{
+		Use:   "tap PIPELINE",
+		Short: "stream sampled request and response of a processor as json lines",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if req.Processor == "" {
+				handleErr(fmt.Errorf("--processor is required"))
+			}
+
+			n, err := parseSample(sample)
+			handleErr(err)
+
+			req.Name = args[0]
+			req.Sample = n
+
+			events, err := newClient().Pipeline.Tap(context.Background(), req)
+			handleErr(err)
+
+			enc := json.NewEncoder(os.Stdout)
+			for event := range events {
+				handleErr(enc.Encode(event))
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&req.Processor, "processor", "", "the processor to tap")
+	cmd.Flags().StringVar(&sample, "sample", "1/1", "sample rate in the form of 1/N")
+	cmd.Flags().IntVar(&req.Limit, "limit", pipeline.DefaultTapLimit,
+		fmt.Sprintf("exit after receiving the number of events, at most %d", pipeline.MaxTapLimit))
+	cmd.Flags().IntVar(&req.MaxFieldLength, "max-field-length", pipeline.DefaultTapMaxFieldLength,
+		"truncate string fields longer than the length")
+
+	return cmd
+}
+
+// parseSample 解析1/N形式的采样率
+func parseSample(s string) (int, error) {
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 || strings.TrimSpace(parts[0]) != "1" {
+		return 0, fmt.Errorf("Invalid sample %s, must be in the form of 1/N", s)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("Invalid sample %s, must be in the form of 1/N", s)
+	}
+	return n, nil
+}
+
+func init() {
+	cmdDebug.AddCommand(NewDebugTapCmd())
+	rootCmd.AddCommand(cmdDebug)
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shima-park/nezha/pkg/rpc/proto"
+	"github.com/spf13/cobra"
+)
+
+func NewDescribeCmd(cmds ...*cobra.Command) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "describe (RESOURCE NAME)",
+		Short: "Show details of a specific resource",
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(cmds...)
+	return cmd
+}
+
+func NewDescribePluginCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "plugin (PATH | NAME[@VERSION])",
+		Aliases: []string{"plug"},
+		Short:   "Show processors and components registered by a plugin, and the pipelines using them",
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			view, err := newClient().Plugin.Find(args[0])
+			handleErr(err)
+
+			fmt.Printf("Path:        %s\n", view.Path)
+			fmt.Printf("Name:        %s\n", view.Name)
+			fmt.Printf("Version:     %s\n", view.Version)
+			fmt.Printf("Current:     %v\n", view.Current)
+			fmt.Printf("Mode:        %s\n", view.Mode)
+			if view.PID > 0 {
+				fmt.Printf("PID:         %d\n", view.PID)
+				fmt.Printf("Restarts:    %d\n", view.Restarts)
+			}
+			fmt.Printf("Open Time:   %s\n", view.OpenTime)
+			fmt.Printf("SHA256:      %s\n", view.SHA256)
+			fmt.Printf("Go Version:  %s\n", view.GoVersion)
+			fmt.Printf("Main Module: %s\n", view.MainModule)
+
+			fmt.Println("\nProcessors:")
+			renderPluginItems(view.Processors)
+			fmt.Println("\nComponents:")
+			renderPluginItems(view.Components)
+		},
+	}
+
+	return cmd
+}
+
+func renderPluginItems(items []proto.PluginItemView) {
+	var rows [][]string
+	for _, e := range items {
+		rows = append(rows, []string{e.Name, e.Description, e.SampleConfig, strings.Join(e.Pipelines, "\n")})
+	}
+	renderTable([]string{"name", "desc", "sample_config", "pipelines"}, rows)
+}
+
+func init() {
+	rootCmd.AddCommand(
+		NewDescribeCmd(
+			NewDescribePluginCmd(),
+		),
+	)
+}
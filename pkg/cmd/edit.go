@@ -9,7 +9,7 @@ import (
 	"os"
 	"strings"
 
-	"github.com/shima-park/lotus/pipeline"
+	"github.com/shima-park/nezha/pkg/pipeline"
 	"github.com/shima-park/nezha/pkg/util/editor"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
@@ -1,8 +1,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"sort"
+	"strings"
 
+	"github.com/shima-park/nezha/pkg/pipeline"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v2"
@@ -39,7 +44,8 @@ func NewGetPipeCmd() *cobra.Command {
 				filters = append(filters, e)
 			}
 
-			if o == "" {
+			switch o {
+			case "":
 				var rows [][]string
 				for _, e := range filters {
 					rows = append(rows, []string{e.Name, e.State, e.Schedule, fmt.Sprint(e.Bootstrap),
@@ -53,7 +59,23 @@ func NewGetPipeCmd() *cobra.Command {
 					},
 					rows,
 				)
-			} else {
+			case "wide":
+				var rows [][]string
+				for _, e := range filters {
+					rows = append(rows, []string{e.Name, e.State, e.Schedule, e.Timezone, e.Jitter,
+						e.ConcurrencyPolicy, e.CatchUpPolicy, strings.Join(e.DependsOn, "\n"),
+						e.RunTimes, e.SkipTimes, e.LastSkipReason, strings.Join(e.NextRunTimes, "\n")})
+				}
+
+				renderTable(
+					[]string{
+						"name", "state", "schedule", "timezone", "jitter", "concurrency_policy",
+						"catch_up_policy", "depends_on", "run_times", "skip_times", "last_skip_reason",
+						"next_run_times",
+					},
+					rows,
+				)
+			default:
 				for _, e := range filters {
 					fmt.Println(string(e.RawConfig))
 				}
@@ -61,7 +83,7 @@ func NewGetPipeCmd() *cobra.Command {
 		},
 	}
 
-	cmd.Flags().StringVarP(&o, "output", "o", "", "Output by yaml format.")
+	cmd.Flags().StringVarP(&o, "output", "o", "", "Output format. One of: wide|yaml.")
 
 	return cmd
 }
@@ -154,6 +176,7 @@ func NewGetProcCmd() *cobra.Command {
 
 func NewGetPluginCmd() *cobra.Command {
 	var p string
+	var o string
 	cmd := &cobra.Command{
 		Use:     "plugin",
 		Aliases: []string{"plug"},
@@ -167,18 +190,32 @@ func NewGetPluginCmd() *cobra.Command {
 				if len(args) > 0 && !stringInSlice(e.Path, args) {
 					continue
 				}
-				rows = append(rows, []string{
-					e.Path, e.Module, e.OpenTime,
-				})
+				var pid string
+				if e.PID > 0 {
+					pid = fmt.Sprint(e.PID)
+				}
+				var current string
+				if e.Current {
+					current = "*"
+				}
+				row := []string{e.Path, e.Name, e.Version, current, e.Module, e.Mode, pid, fmt.Sprint(e.Restarts), e.OpenTime}
+				if o == "wide" {
+					row = append(row, e.SHA256, e.GoVersion, e.MainModule, strings.Join(e.SharedDeps, "\n"))
+				}
+				rows = append(rows, row)
 			}
 
-			header := []string{"path", "module", "open_time"}
+			header := []string{"path", "name", "version", "current", "module", "mode", "pid", "restarts", "open_time"}
+			if o == "wide" {
+				header = append(header, "sha256", "go_version", "main_module", "shared_deps")
+			}
 
 			renderTable(header, rows)
 		},
 	}
 
 	cmd.Flags().StringVar(&p, "p", "", "The pipeline scope for this CLI request")
+	cmd.Flags().StringVarP(&o, "output", "o", "", "Output format. One of: wide.")
 
 	return cmd
 }
@@ -204,11 +241,138 @@ func NewGetServerCmd() *cobra.Command {
 	return cmd
 }
 
+func NewGetRunsCmd() *cobra.Command {
+	var p string
+	var o string
+	cmd := &cobra.Command{
+		Use:     "runs",
+		Aliases: []string{"run"},
+		Short:   "Display run history of a pipeline",
+		Run: func(cmd *cobra.Command, args []string) {
+			if p == "" {
+				handleErr(errors.New("-p {pipeline_name} is required"))
+			}
+
+			list, err := newClient().Pipeline.Runs(p)
+			handleErr(err)
+
+			var rows [][]string
+			for _, e := range list {
+				if len(args) > 0 && !stringInSlice(e.ID, args) {
+					continue
+				}
+
+				row := []string{e.ID, e.Trigger, e.Status, e.StartTime, e.EndTime, e.Elapsed, e.Error}
+				if o == "wide" {
+					var procs []string
+					for _, stat := range e.Processors {
+						procs = append(procs, fmt.Sprintf("%s(%d): %s", stat.Name, stat.Calls, stat.Elapsed))
+					}
+					var params []string
+					for k, v := range e.Params {
+						params = append(params, k+"="+v)
+					}
+					sort.Strings(params)
+					row = append(row, strings.Join(params, "\n"), strings.Join(procs, "\n"))
+				}
+				rows = append(rows, row)
+			}
+
+			header := []string{"id", "trigger", "status", "start_time", "end_time", "elapsed", "error"}
+			if o == "wide" {
+				header = append(header, "params", "processors")
+			}
+
+			renderTable(header, rows)
+		},
+	}
+
+	cmd.Flags().StringVarP(&p, "pipeline", "p", "", "The pipeline scope for this CLI request")
+	cmd.Flags().StringVarP(&o, "output", "o", "", "Output format. One of: wide.")
+
+	return cmd
+}
+
+func NewGetStreamCmd() *cobra.Command {
+	var p string
+	cmd := &cobra.Command{
+		Use:     "streams",
+		Aliases: []string{"stream"},
+		Short:   "Display processing stats of each processor in a pipeline's stream",
+		Run: func(cmd *cobra.Command, args []string) {
+			if p == "" {
+				handleErr(errors.New("-p {pipeline_name} is required"))
+			}
+
+			view, err := newClient().Pipeline.Find(p)
+			handleErr(err)
+
+			var rows [][]string
+			for _, e := range view.Streams {
+				if len(args) > 0 && !stringInSlice(e.Name, args) {
+					continue
+				}
+				rows = append(rows, []string{e.Name, fmt.Sprint(e.Workers), fmt.Sprint(e.BufferSize),
+					e.QueueDepth, e.RateLimit, e.RunTimes, e.SuccessCount, e.ErrorCount,
+					e.DropCount, e.RetryCount, e.TimeoutCount, e.DeadLetterCount, e.DeadLetterError})
+			}
+
+			renderTable(
+				[]string{
+					"name", "workers", "buffer_size", "queue_depth", "rate_limit", "run_times",
+					"success", "error", "drops", "retries", "timeouts", "dead_letters", "dead_letter_errors",
+				},
+				rows,
+			)
+		},
+	}
+
+	cmd.Flags().StringVarP(&p, "pipeline", "p", "", "The pipeline scope for this CLI request")
+
+	return cmd
+}
+
+func NewGetDAGCmd() *cobra.Command {
+	var o string
+	cmd := &cobra.Command{
+		Use:   "dag",
+		Short: "Display dependencies between pipelines",
+		Run: func(cmd *cobra.Command, args []string) {
+			list, err := newClient().Pipeline.DAG()
+			handleErr(err)
+
+			if o == "dot" {
+				var edges []pipeline.DAGEdge
+				for _, e := range list {
+					edges = append(edges, pipeline.DAGEdge{
+						From:      e.From,
+						To:        e.To,
+						Condition: pipeline.DependencyCondition(e.Condition),
+					})
+				}
+				handleErr(pipeline.DAGDotVisualizer(os.Stdout, edges))
+				fmt.Println()
+				return
+			}
+
+			var rows [][]string
+			for _, e := range list {
+				rows = append(rows, []string{e.From, e.To, e.Condition})
+			}
+			renderTable([]string{"upstream", "downstream", "condition"}, rows)
+		},
+	}
+
+	cmd.Flags().StringVarP(&o, "output", "o", "", "Output format. One of: dot.")
+
+	return cmd
+}
+
 func init() {
 	rootCmd.AddCommand(
 		NewGetCmd(
 			NewGetPipeCmd(), NewGetCompCmd(), NewGetProcCmd(), NewGetPluginCmd(),
-			NewGetServerCmd(),
+			NewGetServerCmd(), NewGetRunsCmd(), NewGetDAGCmd(), NewGetStreamCmd(),
 		),
 	)
 }
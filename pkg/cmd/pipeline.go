@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"os"
+
+	"github.com/shima-park/nezha/pkg/pipeline"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
 	"github.com/spf13/cobra"
 )
@@ -41,9 +44,62 @@ var cmdRestartPipe = &cobra.Command{
 	},
 }
 
+var cmdPausePipe = &cobra.Command{
+	Use:   "pause",
+	Short: "stop feeding new items into a pipeline, it is draining until in-flight items finish, components stay connected",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := newClient().Pipeline.Control(proto.ControlCommandPause, args)
+		handleErr(err)
+	},
+}
+
+var cmdResumePipe = &cobra.Command{
+	Use:   "resume",
+	Short: "resume a paused pipeline",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := newClient().Pipeline.Control(proto.ControlCommandResume, args)
+		handleErr(err)
+	},
+}
+
+func NewTriggerPipeCmd() *cobra.Command {
+	var params []string
+	cmd := &cobra.Command{
+		Use:   "trigger NAME",
+		Short: "run a pipeline once immediately, ignoring its schedule",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			kv, err := parseParams(params)
+			handleErr(err)
+
+			req := proto.PipelineTriggerRequest{
+				Name:   args[0],
+				Params: kv,
+			}
+
+			res, err := newClient().Pipeline.Trigger(req)
+			handleErr(err)
+
+			renderTable(
+				[]string{"pipeline", "status", "start_time", "end_time", "elapsed", "error"},
+				[][]string{{res.Pipeline, res.Status, res.StartTime, res.EndTime, res.Elapsed, res.Error}},
+			)
+
+			if res.Status != string(pipeline.RunStatusSucceeded) {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&params, "param", nil, "params injected into the run, in the form of k=v")
+
+	return cmd
+}
+
 func init() {
 	cmdPipeline.AddCommand(
 		cmdStartPipe, cmdStopPipe, cmdRestartPipe,
+		cmdPausePipe, cmdResumePipe, NewTriggerPipeCmd(),
 	)
 	rootCmd.AddCommand(cmdPipeline)
 }
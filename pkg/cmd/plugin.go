@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdPlugin = &cobra.Command{
+	Use:     "plugin",
+	Aliases: []string{"plug"},
+	Short:   "Commands to manage plugins",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var cmdUpgradePlugin = &cobra.Command{
+	Use:   "upgrade NAME VERSION",
+	Short: "switch the unversioned processors and components of a plugin to VERSION and recreate the pipelines using them, roll back if any pipeline fails",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		pipelines, err := newClient().Plugin.Upgrade(args[0], args[1])
+		handleErr(err)
+
+		fmt.Printf("Plugin %s upgraded to %s, recreated pipelines: %v\n", args[0], args[1], pipelines)
+	},
+}
+
+func init() {
+	cmdPlugin.AddCommand(cmdUpgradePlugin)
+	rootCmd.AddCommand(cmdPlugin)
+}
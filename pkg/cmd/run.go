@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/shima-park/nezha/pkg/grpcplugin"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/window"
+	"github.com/shima-park/nezha/pkg/rpc/server"
+	"github.com/shima-park/nezha/pkg/rpc/server/service"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+func NewRunCmd() *cobra.Command {
+	var (
+		file      string
+		plugins   []string
+		params    []string
+		once      bool
+		visualize string
+		stateDir  string
+	)
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "run a pipeline in the foreground without a server, exit with non-zero status if any run failed",
+		Run: func(cmd *cobra.Command, args []string) {
+			if file == "" {
+				handleErr(errors.New("-f {pipeline_config_file} is required"))
+			}
+
+			kv, err := parseParams(params)
+			handleErr(err)
+
+			for _, path := range plugins {
+				handleErr(service.OpenPlugin(path))
+			}
+
+			if stateDir != "" {
+				window.SetStateDir(stateDir)
+			}
+
+			conf, err := loadConfig(file)
+			handleErr(err)
+
+			var failed int32
+			opts := []pipeline.Option{
+				pipeline.WithRunListener(func(res pipeline.RunResult) {
+					if res.Status == pipeline.RunStatusFailed {
+						atomic.AddInt32(&failed, 1)
+						fmt.Fprintf(os.Stderr, "Run %s failed: %s\n", res.ID, res.Error)
+					}
+				}),
+			}
+			if once {
+				// 只运行一次, 不需要调度
+				opts = append(opts, pipeline.WithSchedule(pipeline.NeverSchedule{}))
+			} else if conf.Schedule == "" && len(conf.DependsOn) > 0 {
+				handleErr(fmt.Errorf("Pipeline(%s) is only triggered by upstream pipelines, use --once to run it", conf.Name))
+			}
+
+			p, err := pipeline.NewPipelineByConfig(conf, opts...)
+			handleErr(err)
+
+			switch visualize {
+			case "", "none":
+			case "ascii_table":
+				handleErr(server.ASCIITableVisualizer(os.Stderr, p))
+			default:
+				handleErr(p.Visualize(os.Stderr, visualize))
+				fmt.Fprintln(os.Stderr)
+			}
+
+			handleErr(p.Start())
+
+			if once {
+				res, err := p.Trigger(kv)
+				p.Stop()
+				grpcplugin.CloseAll()
+				window.CloseAll()
+				handleErr(err)
+
+				fmt.Fprintf(os.Stderr, "Run %s %s, elapsed: %s\n", res.ID, res.Status, res.EndTime.Sub(res.StartTime))
+				if res.Status != pipeline.RunStatusSucceeded {
+					os.Exit(1)
+				}
+				return
+			}
+
+			signals := make(chan os.Signal, 1)
+			signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+			<-signals
+
+			p.Stop()
+			grpcplugin.CloseAll()
+			window.CloseAll()
+			if n := atomic.LoadInt32(&failed); n > 0 {
+				fmt.Fprintf(os.Stderr, "%d runs failed\n", n)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "path to the pipeline config file")
+	cmd.Flags().StringArrayVar(&plugins, "plugin", nil, "path to the plugin to load before creating the pipeline, .so, .wasm or gRPC plugin executable")
+	cmd.Flags().BoolVar(&once, "once", false, "run the pipeline once ignoring its schedule, then exit")
+	cmd.Flags().StringArrayVar(&params, "param", nil, "params injected into the run with --once, in the form of k=v")
+	cmd.Flags().StringVar(&stateDir, "state-dir", "", "directory of the local store of window processors")
+	cmd.Flags().StringVar(&visualize, "visualize", "ascii_table", "print the pipeline before running. One of: ascii_table|dot|svg|png|none.")
+
+	return cmd
+}
+
+// loadConfig 从文件中加载pipeline配置, 没有配置name时使用文件名
+func loadConfig(path string) (pipeline.Config, error) {
+	var conf pipeline.Config
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return conf, err
+	}
+
+	if err := yaml.Unmarshal(content, &conf); err != nil {
+		return conf, err
+	}
+
+	if conf.Name == "" {
+		conf.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return conf, nil
+}
+
+func init() {
+	rootCmd.AddCommand(NewRunCmd())
+}
@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	_ "github.com/shima-park/nezha/pkg/processor/script"
+	"gotest.tools/v3/assert"
+)
+
+// runCmdEnv 设置时子进程执行其中的命令行参数, 用于测试以退出码结束的命令
+const runCmdEnv = "NEZHA_TEST_RUN_ARGS"
+
+func runCmd(t *testing.T, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestRunOnce$")
+	cmd.Env = append(os.Environ(), runCmdEnv+"="+strings.Join(args, "\n"))
+	out, err := cmd.CombinedOutput()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return string(out), exitErr.ExitCode()
+	}
+	assert.NilError(t, err)
+	return string(out), 0
+}
+
+func TestRunOnce(t *testing.T) {
+	if args := os.Getenv(runCmdEnv); args != "" {
+		rootCmd.SetArgs(strings.Split(args, "\n"))
+		Execute()
+		os.Exit(0)
+	}
+
+	out, code := runCmd(t, "run", "--once", "--visualize", "none", "-f", "testdata/once.yaml")
+	assert.Equal(t, code, 0, out)
+	assert.Assert(t, strings.Contains(out, "succeeded"), out)
+
+	out, code = runCmd(t, "run", "--once", "--visualize", "none", "-f", "testdata/once.yaml", "--param", "fail=true")
+	assert.Equal(t, code, 1, out)
+	assert.Assert(t, strings.Contains(out, "failed by params"), out)
+
+	out, code = runCmd(t, "run", "--once", "-f", "testdata/not_exists.yaml")
+	assert.Equal(t, code, 1, out)
+	assert.Assert(t, strings.Contains(out, "no such file"), out)
+}
+
+func TestLoadConfig(t *testing.T) {
+	conf, err := loadConfig("testdata/once.yaml")
+	assert.NilError(t, err)
+	assert.Equal(t, conf.Name, "once")
+	assert.Equal(t, conf.Schedule, "@yearly")
+	assert.Equal(t, conf.Stream.Name, "script")
+
+	dir := t.TempDir()
+	path := dir + "/named.yml"
+	assert.NilError(t, ioutil.WriteFile(path, []byte("name: my_pipeline\n"), 0640))
+	conf, err = loadConfig(path)
+	assert.NilError(t, err)
+	assert.Equal(t, conf.Name, "my_pipeline")
+
+	assert.NilError(t, ioutil.WriteFile(path, []byte("name: [\n"), 0640))
+	_, err = loadConfig(path)
+	assert.ErrorContains(t, err, "yaml")
+
+	_, err = loadConfig(dir + "/not_exists.yaml")
+	assert.Assert(t, os.IsNotExist(err))
+}
@@ -19,7 +19,9 @@ func init() {
 	}
 
 	var metaPath string
+	var trustedKeys string
 	var httpAddr string
+	var runHistoryLimit int
 	var cmdRunServer = &cobra.Command{
 		Use:   "run",
 		Short: "run a nezha server",
@@ -27,6 +29,8 @@ func init() {
 			c, err := server.New(
 				server.HTTPAddr(httpAddr),
 				server.MetadataPath(metaPath),
+				server.TrustedKeysPath(trustedKeys),
+				server.RunHistoryLimit(runHistoryLimit),
 			)
 			if err != nil {
 				panic(err)
@@ -44,7 +48,9 @@ func init() {
 		},
 	}
 	cmdRunServer.Flags().StringVar(&metaPath, "meta", "", "path to metadata")
+	cmdRunServer.Flags().StringVar(&trustedKeys, "trusted-keys", "", "path to the ed25519 public keys file, plugins must be signed by one of them if set")
 	cmdRunServer.Flags().StringVar(&httpAddr, "http", "", "listen on address")
+	cmdRunServer.Flags().IntVar(&runHistoryLimit, "run-history-limit", 0, "number of runs kept for each pipeline, use the default 100 if not set")
 
 	cmdServer.AddCommand(cmdRunServer)
 
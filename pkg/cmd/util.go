@@ -3,6 +3,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/shima-park/nezha/pkg/rpc/client"
@@ -27,6 +28,19 @@ func handleErr(err error) {
 	}
 }
 
+// parseParams 解析k=v形式的参数
+func parseParams(params []string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, param := range params {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid param %s, must be in the form of k=v", param)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
+}
+
 func stringInSlice(t string, ss []string) bool {
 	for _, s := range ss {
 		if t == s {
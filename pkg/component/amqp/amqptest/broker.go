@@ -0,0 +1,459 @@
+// Package amqptest 提供进程内的amqp broker, 只用于测试amqp_consumer和amqp_publisher
+package amqptest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	nezhaamqp "github.com/shima-park/nezha/pkg/component/amqp"
+)
+
+// Broker 进程内的amqp broker, 用于在没有rabbitmq的环境中测试amqp_consumer和amqp_publisher,
+// 支持默认exchange和direct绑定, 手动ack, prefetch以及publisher confirm,
+// 连接断开时未ack的消息以Redelivered重新入队
+type Broker struct {
+	lock     sync.Mutex
+	cond     *sync.Cond
+	queues   map[string]*queue
+	bindings map[binding][]string
+	conns    map[*connection]struct{}
+	dialErr  error
+	nack     bool
+	closed   bool
+}
+
+type binding struct {
+	exchange string
+	key      string
+}
+
+type queue struct {
+	ready []amqp.Delivery
+}
+
+func NewBroker() *Broker {
+	b := &Broker{
+		queues:   map[string]*queue{},
+		bindings: map[binding][]string{},
+		conns:    map[*connection]struct{}{},
+	}
+	b.cond = sync.NewCond(&b.lock)
+	return b
+}
+
+// Dial 以amqp.WithDialer传给amqp_consumer, amqp_publisher, 忽略配置中的url连接到当前broker
+func (b *Broker) Dial(url string) (nezhaamqp.Connection, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.closed {
+		return nil, errors.New("Broker is closed")
+	}
+	if b.dialErr != nil {
+		return nil, b.dialErr
+	}
+
+	conn := &connection{broker: b}
+	b.conns[conn] = struct{}{}
+	return conn, nil
+}
+
+// DeclareQueue 声明队列, 默认exchange会将routing key与队列名称相同的消息投递到该队列
+func (b *Broker) DeclareQueue(name string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if _, ok := b.queues[name]; !ok {
+		b.queues[name] = &queue{}
+	}
+}
+
+// Bind 将exchange中routing key为key的消息投递到queue
+func (b *Broker) Bind(exchange, key, queue string) {
+	b.DeclareQueue(queue)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	binding := binding{exchange: exchange, key: key}
+	b.bindings[binding] = append(b.bindings[binding], queue)
+}
+
+// Publish 以生产者的身份发送一条消息
+func (b *Broker) Publish(exchange, key string, msg amqp.Publishing) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.route(exchange, key, msg)
+}
+
+// Messages 返回队列中等待投递的消息
+func (b *Broker) Messages(queue string) []amqp.Delivery {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil
+	}
+	return append([]amqp.Delivery{}, q.ready...)
+}
+
+// Unacked 返回队列中已经投递但还未ack的消息数
+func (b *Broker) Unacked(queue string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var n int
+	for conn := range b.conns {
+		for _, ch := range conn.channels {
+			for _, u := range ch.unacked {
+				if u.queue == queue {
+					n++
+				}
+			}
+		}
+	}
+	return n
+}
+
+// DropConnections 断开所有客户端连接, 模拟broker重启或者网络中断
+func (b *Broker) DropConnections() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for conn := range b.conns {
+		conn.close()
+	}
+}
+
+// SetDialError 设置之后新建连接时返回的错误, 为nil时恢复正常
+func (b *Broker) SetDialError(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.dialErr = err
+}
+
+// SetNack 为true时publisher confirm返回nack
+func (b *Broker) SetNack(nack bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.nack = nack
+}
+
+// Close 断开所有连接, 之后不能再连接该broker
+func (b *Broker) Close() {
+	b.lock.Lock()
+	b.closed = true
+	b.lock.Unlock()
+
+	b.DropConnections()
+}
+
+func (b *Broker) route(exchange, key string, msg amqp.Publishing) {
+	var queues []string
+	if exchange == "" {
+		if _, ok := b.queues[key]; ok {
+			queues = append(queues, key)
+		}
+	} else {
+		queues = b.bindings[binding{exchange: exchange, key: key}]
+	}
+
+	for _, name := range queues {
+		q := b.queues[name]
+		q.ready = append(q.ready, amqp.Delivery{
+			Headers:         msg.Headers,
+			ContentType:     msg.ContentType,
+			ContentEncoding: msg.ContentEncoding,
+			DeliveryMode:    msg.DeliveryMode,
+			Priority:        msg.Priority,
+			CorrelationId:   msg.CorrelationId,
+			ReplyTo:         msg.ReplyTo,
+			Expiration:      msg.Expiration,
+			MessageId:       msg.MessageId,
+			Timestamp:       msg.Timestamp,
+			Type:            msg.Type,
+			UserId:          msg.UserId,
+			AppId:           msg.AppId,
+			Exchange:        exchange,
+			RoutingKey:      key,
+			Body:            msg.Body,
+		})
+	}
+	b.cond.Broadcast()
+}
+
+type connection struct {
+	broker   *Broker
+	closed   bool
+	channels []*channel
+}
+
+func (c *connection) Channel() (nezhaamqp.Channel, error) {
+	c.broker.lock.Lock()
+	defer c.broker.lock.Unlock()
+
+	if c.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	ch := &channel{
+		conn:    c,
+		done:    make(chan struct{}),
+		unacked: map[uint64]pending{},
+	}
+	c.channels = append(c.channels, ch)
+	return ch, nil
+}
+
+func (c *connection) IsClosed() bool {
+	c.broker.lock.Lock()
+	defer c.broker.lock.Unlock()
+	return c.closed
+}
+
+func (c *connection) Close() error {
+	c.broker.lock.Lock()
+	defer c.broker.lock.Unlock()
+
+	if c.closed {
+		return amqp.ErrClosed
+	}
+	c.close()
+	return nil
+}
+
+// close 关闭连接上的所有channel, 需要持有broker的锁
+func (c *connection) close() {
+	c.closed = true
+	for _, ch := range c.channels {
+		ch.close()
+	}
+	delete(c.broker.conns, c)
+}
+
+type pending struct {
+	queue    string
+	delivery amqp.Delivery
+}
+
+type channel struct {
+	conn     *connection
+	done     chan struct{}
+	closed   bool
+	prefetch int
+	confirm  bool
+	tag      uint64
+	unacked  map[uint64]pending
+}
+
+func (ch *channel) broker() *Broker {
+	return ch.conn.broker
+}
+
+func (ch *channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	ch.broker().lock.Lock()
+	defer ch.broker().lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.prefetch = prefetchCount
+	return nil
+}
+
+func (ch *channel) Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	b := ch.broker()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil, &amqp.Error{Code: amqp.NotFound, Reason: fmt.Sprintf("NOT_FOUND - no queue '%s'", queue)}
+	}
+
+	out := make(chan amqp.Delivery)
+	go ch.dispatch(queue, q, autoAck, out)
+	return out, nil
+}
+
+// dispatch 按照prefetch的限制将队列中的消息投递给消费者, channel关闭时关闭out
+func (ch *channel) dispatch(name string, q *queue, autoAck bool, out chan amqp.Delivery) {
+	defer close(out)
+
+	b := ch.broker()
+	for {
+		b.lock.Lock()
+		for !ch.closed && (len(q.ready) == 0 || (ch.prefetch > 0 && len(ch.unacked) >= ch.prefetch)) {
+			b.cond.Wait()
+		}
+		if ch.closed {
+			b.lock.Unlock()
+			return
+		}
+
+		d := q.ready[0]
+		q.ready = q.ready[1:]
+		ch.tag++
+		d.DeliveryTag = ch.tag
+		d.Acknowledger = ch
+		if !autoAck {
+			ch.unacked[d.DeliveryTag] = pending{queue: name, delivery: d}
+		}
+		b.lock.Unlock()
+
+		select {
+		case out <- d:
+		case <-ch.done:
+			// 未投递的消息已经记录在unacked中, 由close重新入队
+			return
+		}
+	}
+}
+
+func (ch *channel) Confirm(noWait bool) error {
+	ch.broker().lock.Lock()
+	defer ch.broker().lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.confirm = true
+	return nil
+}
+
+func (ch *channel) Publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	b := ch.broker()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	b.route(exchange, key, msg)
+	return nil
+}
+
+func (ch *channel) PublishWithConfirm(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (nezhaamqp.Confirmation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	b := ch.broker()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+	if !ch.confirm {
+		return nil, errors.New("Channel is not in confirm mode")
+	}
+
+	if b.nack {
+		return confirmation(false), nil
+	}
+	b.route(exchange, key, msg)
+	return confirmation(true), nil
+}
+
+func (ch *channel) IsClosed() bool {
+	ch.broker().lock.Lock()
+	defer ch.broker().lock.Unlock()
+	return ch.closed
+}
+
+func (ch *channel) Ack(tag uint64, multiple bool) error {
+	return ch.settle(tag, multiple, false)
+}
+
+func (ch *channel) Nack(tag uint64, multiple, requeue bool) error {
+	return ch.settle(tag, multiple, requeue)
+}
+
+func (ch *channel) Reject(tag uint64, requeue bool) error {
+	return ch.settle(tag, false, requeue)
+}
+
+// settle 将消息从unacked中移除, requeue为true时重新放回队列头部
+func (ch *channel) settle(tag uint64, multiple, requeue bool) error {
+	b := ch.broker()
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+
+	var tags []uint64
+	if multiple {
+		for t := range ch.unacked {
+			if t <= tag {
+				tags = append(tags, t)
+			}
+		}
+	} else if _, ok := ch.unacked[tag]; ok {
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return &amqp.Error{Code: amqp.PreconditionFailed, Reason: fmt.Sprintf("PRECONDITION_FAILED - unknown delivery tag %d", tag)}
+	}
+
+	ch.release(tags, requeue)
+	b.cond.Broadcast()
+	return nil
+}
+
+// release 按照投递顺序将消息放回队列头部, 需要持有broker的锁
+func (ch *channel) release(tags []uint64, requeue bool) {
+	sort.Slice(tags, func(i, j int) bool { return tags[i] > tags[j] })
+	for _, t := range tags {
+		u := ch.unacked[t]
+		delete(ch.unacked, t)
+		if !requeue {
+			continue
+		}
+
+		d := u.delivery
+		d.Redelivered = true
+		d.DeliveryTag = 0
+		d.Acknowledger = nil
+		q := ch.broker().queues[u.queue]
+		q.ready = append([]amqp.Delivery{d}, q.ready...)
+	}
+}
+
+// close 关闭channel, 未ack的消息重新入队, 需要持有broker的锁
+func (ch *channel) close() {
+	if ch.closed {
+		return
+	}
+	ch.closed = true
+	close(ch.done)
+
+	var tags []uint64
+	for t := range ch.unacked {
+		tags = append(tags, t)
+	}
+	ch.release(tags, true)
+	ch.broker().cond.Broadcast()
+}
+
+type confirmation bool
+
+func (c confirmation) WaitContext(ctx context.Context) (bool, error) {
+	return bool(c), nil
+}
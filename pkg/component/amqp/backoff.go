@@ -0,0 +1,37 @@
+package amqp
+
+import (
+	"time"
+)
+
+var defaultBackoff = Backoff{
+	Min: time.Second,
+	Max: 30 * time.Second,
+}
+
+// Backoff 断线重连的指数退避配置
+type Backoff struct {
+	Min time.Duration `yaml:"min"`
+	Max time.Duration `yaml:"max"`
+}
+
+// Duration 返回第attempt(从0开始)次重试前需要等待的时间
+func (b Backoff) Duration(attempt int) time.Duration {
+	min, max := b.Min, b.Max
+	if min <= 0 {
+		min = defaultBackoff.Min
+	}
+	if max < min {
+		max = min
+	}
+
+	d := min
+	for i := 0; i < attempt && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		d = max
+	}
+	return d
+}
@@ -0,0 +1,19 @@
+package amqp
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 5 * time.Second}
+	assert.Equal(t, b.Duration(0), time.Second)
+	assert.Equal(t, b.Duration(1), 2*time.Second)
+	assert.Equal(t, b.Duration(2), 4*time.Second)
+	assert.Equal(t, b.Duration(3), 5*time.Second)
+	assert.Equal(t, b.Duration(100), 5*time.Second)
+
+	assert.Equal(t, Backoff{}.Duration(3), defaultBackoff.Min)
+}
@@ -0,0 +1,89 @@
+package amqp
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Connection, Channel 组件使用到的amqp091-go的连接和channel的方法
+type Connection interface {
+	Channel() (Channel, error)
+	IsClosed() bool
+	Close() error
+}
+
+type Channel interface {
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Confirm(noWait bool) error
+	Publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error
+	// PublishWithConfirm 发送消息并返回broker的确认, 需要先开启Confirm
+	PublishWithConfirm(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (Confirmation, error)
+	IsClosed() bool
+}
+
+type Confirmation interface {
+	WaitContext(ctx context.Context) (bool, error)
+}
+
+// Dialer 建立到broker的连接
+type Dialer func(url string) (Connection, error)
+
+// Option amqp_consumer, amqp_publisher的可选项, 只能在代码中创建组件时指定
+type Option func(*options)
+
+type options struct {
+	dial Dialer
+}
+
+// WithDialer 替换建立连接的函数, 用于在没有rabbitmq的环境中测试, 见amqptest.Broker
+func WithDialer(d Dialer) Option {
+	return func(o *options) {
+		o.dial = d
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{dial: dial}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func dial(url string) (Connection, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return amqpConnection{conn}, nil
+}
+
+type amqpConnection struct {
+	*amqp.Connection
+}
+
+func (c amqpConnection) Channel() (Channel, error) {
+	ch, err := c.Connection.Channel()
+	if err != nil {
+		return nil, err
+	}
+	return amqpChannel{ch}, nil
+}
+
+type amqpChannel struct {
+	*amqp.Channel
+}
+
+func (c amqpChannel) Publish(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) error {
+	return c.Channel.PublishWithContext(ctx, exchange, key, mandatory, false, msg)
+}
+
+func (c amqpChannel) PublishWithConfirm(ctx context.Context, exchange, key string, mandatory bool, msg amqp.Publishing) (Confirmation, error) {
+	confirm, err := c.Channel.PublishWithDeferredConfirmWithContext(ctx, exchange, key, mandatory, false, msg)
+	if err != nil {
+		return nil, err
+	}
+	return confirm, nil
+}
@@ -0,0 +1,86 @@
+package amqp_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	nezhaamqp "github.com/shima-park/nezha/pkg/component/amqp"
+	"github.com/shima-park/nezha/pkg/component/amqp/amqptest"
+	"gotest.tools/v3/assert"
+)
+
+func receive(t *testing.T, c *nezhaamqp.Consumer) amqp.Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-c.Deliveries():
+		assert.Assert(t, ok, "deliveries closed")
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for delivery")
+	}
+	return amqp.Delivery{}
+}
+
+func TestConsumer(t *testing.T) {
+	b := amqptest.NewBroker()
+	defer b.Close()
+	b.DeclareQueue("events")
+
+	c, err := nezhaamqp.NewConsumer(`
+queue: events
+prefetch: 1
+reconnect_backoff: {min: 10ms, max: 10ms}`, nezhaamqp.WithDialer(b.Dial))
+	assert.NilError(t, err)
+	assert.NilError(t, c.Start())
+	defer c.Stop()
+
+	b.Publish("", "events", amqp.Publishing{Body: []byte("a")})
+	b.Publish("", "events", amqp.Publishing{Body: []byte("b")})
+
+	// prefetch为1, 第一条ack之前不会投递第二条
+	d := receive(t, c)
+	assert.Equal(t, string(d.Body), "a")
+	assert.Equal(t, b.Unacked("events"), 1)
+	assert.Equal(t, len(b.Messages("events")), 1)
+	assert.NilError(t, d.Ack(false))
+
+	d = receive(t, c)
+	assert.Equal(t, string(d.Body), "b")
+	assert.Assert(t, !d.Redelivered)
+	assert.NilError(t, d.Nack(false, true))
+
+	d = receive(t, c)
+	assert.Equal(t, string(d.Body), "b")
+	assert.Assert(t, d.Redelivered)
+
+	// 断线期间重连失败会按退避重试, 恢复后旧连接上未ack的消息被重新投递
+	b.SetDialError(errors.New("connection refused"))
+	b.DropConnections()
+	assert.Assert(t, errors.Is(d.Ack(false), amqp.ErrClosed))
+	b.SetDialError(nil)
+
+	d = receive(t, c)
+	assert.Equal(t, string(d.Body), "b")
+	assert.Assert(t, d.Redelivered)
+	assert.NilError(t, d.Ack(false))
+	assert.Equal(t, b.Unacked("events"), 0)
+
+	assert.NilError(t, c.Stop())
+	_, ok := <-c.Deliveries()
+	assert.Assert(t, !ok)
+	assert.Equal(t, len(b.Messages("events")), 0)
+}
+
+func TestConsumerStartError(t *testing.T) {
+	b := amqptest.NewBroker()
+	defer b.Close()
+
+	c, err := nezhaamqp.NewConsumer("queue: missing", nezhaamqp.WithDialer(b.Dial))
+	assert.NilError(t, err)
+	assert.ErrorContains(t, c.Start(), "no queue 'missing'")
+
+	_, err = nezhaamqp.NewConsumer("queue: ''")
+	assert.ErrorContains(t, err, "queue cannot be empty")
+}
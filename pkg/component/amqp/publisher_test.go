@@ -0,0 +1,62 @@
+package amqp_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	nezhaamqp "github.com/shima-park/nezha/pkg/component/amqp"
+	"github.com/shima-park/nezha/pkg/component/amqp/amqptest"
+	"gotest.tools/v3/assert"
+)
+
+func TestPublisher(t *testing.T) {
+	b := amqptest.NewBroker()
+	defer b.Close()
+	b.Bind("articles", "created", "events")
+
+	p, err := nezhaamqp.NewPublisher(`
+exchange: articles
+routing_key: created
+confirm: true
+reconnect_backoff: {min: 10ms, max: 10ms}`, nezhaamqp.WithDialer(b.Dial))
+	assert.NilError(t, err)
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	ctx := context.Background()
+	assert.NilError(t, p.Publish(ctx, []byte("hello")))
+
+	msgs := b.Messages("events")
+	assert.Equal(t, len(msgs), 1)
+	assert.Equal(t, string(msgs[0].Body), "hello")
+	assert.Equal(t, msgs[0].Exchange, "articles")
+	assert.Equal(t, msgs[0].RoutingKey, "created")
+	assert.Equal(t, msgs[0].DeliveryMode, amqp.Persistent)
+
+	b.SetNack(true)
+	assert.ErrorContains(t, p.Publish(ctx, []byte("nacked")), "nacked by broker")
+	b.SetNack(false)
+
+	// 连接断开后下一次发送时自动重连
+	b.DropConnections()
+	assert.NilError(t, p.Publish(ctx, []byte("reconnected")))
+	assert.Equal(t, len(b.Messages("events")), 2)
+
+	// 重连失败后在退避时间内直接返回错误, 之后再次重连
+	b.SetDialError(errors.New("connection refused"))
+	b.DropConnections()
+	assert.ErrorContains(t, p.Publish(ctx, []byte("lost")), "connection refused")
+	assert.ErrorContains(t, p.Publish(ctx, []byte("lost")), "is reconnecting")
+	b.SetDialError(nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for err = p.Publish(ctx, []byte("recovered")); err != nil; err = p.Publish(ctx, []byte("recovered")) {
+		assert.ErrorContains(t, err, "is reconnecting")
+		assert.Assert(t, time.Now().Before(deadline), "publisher did not reconnect")
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, len(b.Messages("events")), 3)
+}
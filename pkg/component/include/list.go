@@ -1,9 +1,13 @@
 package include
 
 import (
+	_ "github.com/shima-park/nezha/pkg/component/amqp"
 	_ "github.com/shima-park/nezha/pkg/component/es"
 	_ "github.com/shima-park/nezha/pkg/component/gin"
 	_ "github.com/shima-park/nezha/pkg/component/io"
 	_ "github.com/shima-park/nezha/pkg/component/kafka"
+	_ "github.com/shima-park/nezha/pkg/component/mqtt"
+	_ "github.com/shima-park/nezha/pkg/component/nats"
 	_ "github.com/shima-park/nezha/pkg/component/redis"
+	_ "github.com/shima-park/nezha/pkg/component/s3"
 )
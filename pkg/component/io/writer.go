@@ -79,7 +79,7 @@ func NewWriter(rawConfig string) (*Writer, error) {
 	case "stderr":
 		f = os.Stderr
 	default:
-		file, err := os.Open(conf.Path)
+		file, err := os.OpenFile(conf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 		if err != nil {
 			return nil, errors.Wrap(err, "io_writer")
 		}
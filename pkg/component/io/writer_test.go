@@ -0,0 +1,29 @@
+package io
+
+import (
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWriterAppendsToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+
+	// 文件不存在时创建, 重新打开时追加到末尾
+	for _, line := range []string{"a\n", "b\n"} {
+		w, err := NewWriter("name: MyWriter\npath: " + path)
+		assert.NilError(t, err)
+		assert.NilError(t, w.Start())
+
+		_, err = w.Instance().Interface().(io.Writer).Write([]byte(line))
+		assert.NilError(t, err)
+		assert.NilError(t, w.Stop())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(data), "a\nb\n")
+}
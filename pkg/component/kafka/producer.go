@@ -1,6 +1,7 @@
 package kafka
 
 import (
+	"errors"
 	"reflect"
 
 	"github.com/shima-park/lotus/common/log"
@@ -88,3 +89,16 @@ func (c *Producer) Start() error {
 func (c *Producer) Stop() error {
 	return c.producer.Close()
 }
+
+// WriteDeadLetter 作为pipeline的死信目的地时, 将死信发送到topic中
+func (c *Producer) WriteDeadLetter(topic string, data []byte) error {
+	if topic == "" {
+		return errors.New("kafka_producer: dead letter topic cannot be empty")
+	}
+
+	_, _, err := c.producer.SendMessage(&sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(data),
+	})
+	return err
+}
@@ -0,0 +1,258 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+var (
+	factory       component.Factory   = NewFactory()
+	_             component.Component = &Client{}
+	defaultConfig                     = Config{
+		Name:           "MyMQTTClient",
+		Brokers:        []string{"tcp://127.0.0.1:1883"},
+		ClientID:       "nezha",
+		QoS:            1,
+		CleanSession:   true,
+		KeepAlive:      30 * time.Second,
+		ConnectTimeout: 10 * time.Second,
+		Subscriptions: []Subscription{
+			{Topic: "devices/+/telemetry", QoS: 1},
+		},
+		BufferSize: 100,
+	}
+	description = "mqtt client factory, subscribed messages are delivered by Messages()"
+)
+
+func init() {
+	if err := component.Register("mqtt_client", factory); err != nil {
+		panic(err)
+	}
+}
+
+func NewFactory() component.Factory {
+	return component.NewFactory(
+		defaultConfig,
+		description,
+		func(c string) (component.Component, error) {
+			return NewClient(c)
+		})
+}
+
+type Config struct {
+	Name     string   `yaml:"name"`
+	Brokers  []string `yaml:"brokers"`
+	ClientID string   `yaml:"client_id"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	// Publish使用的QoS
+	QoS            byte           `yaml:"qos"`
+	CleanSession   bool           `yaml:"clean_session"`
+	KeepAlive      time.Duration  `yaml:"keep_alive"`
+	ConnectTimeout time.Duration  `yaml:"connect_timeout"`
+	TLS            *TLSConfig     `yaml:"tls,omitempty"`
+	Subscriptions  []Subscription `yaml:"subscriptions"`
+	BufferSize     int            `yaml:"buffer_size"`
+}
+
+type Subscription struct {
+	Topic string `yaml:"topic"`
+	QoS   byte   `yaml:"qos"`
+}
+
+type TLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`
+	CertFile           string `yaml:"cert_file,omitempty"`
+	KeyFile            string `yaml:"key_file,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+}
+
+func (c TLSConfig) load() (*tls.Config, error) {
+	conf := &tls.Config{
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		ca, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("Failed to parse ca file: %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
+
+func (c Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+type Client struct {
+	config   Config
+	client   mqtt.Client
+	messages chan mqtt.Message
+	done     chan struct{}
+	// 保护messages在Stop关闭后不会再被写入
+	rwlock   sync.RWMutex
+	closed   bool
+	instance component.Instance
+}
+
+func NewClient(rawConfig string) (*Client, error) {
+	conf := defaultConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("MQTT client config: %+v", conf)
+
+	if len(conf.Brokers) == 0 {
+		return nil, errors.New("Component:mqtt_client brokers cannot be empty")
+	}
+
+	if conf.QoS > 2 {
+		return nil, fmt.Errorf("Component:mqtt_client invalid qos: %d", conf.QoS)
+	}
+
+	c := &Client{
+		config:   conf,
+		messages: make(chan mqtt.Message, conf.BufferSize),
+		done:     make(chan struct{}),
+	}
+
+	opts := mqtt.NewClientOptions().
+		SetClientID(conf.ClientID).
+		SetUsername(conf.Username).
+		SetPassword(conf.Password).
+		SetCleanSession(conf.CleanSession).
+		SetKeepAlive(conf.KeepAlive).
+		SetConnectTimeout(conf.ConnectTimeout).
+		SetAutoReconnect(true).
+		SetOrderMatters(true).
+		// 每次(重)连接成功后重新订阅
+		SetOnConnectHandler(c.subscribe).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Warn("MQTT client: %s, Connection lost: %s", conf.Name, err)
+		})
+
+	for _, broker := range conf.Brokers {
+		opts.AddBroker(broker)
+	}
+
+	if conf.TLS != nil {
+		tlsConf, err := conf.TLS.load()
+		if err != nil {
+			return nil, err
+		}
+		opts.SetTLSConfig(tlsConf)
+	}
+
+	c.client = mqtt.NewClient(opts)
+	c.instance = component.NewInstance(
+		conf.Name,
+		reflect.TypeOf(c),
+		reflect.ValueOf(c),
+		c,
+	)
+
+	return c, nil
+}
+
+// Messages 返回订阅到的消息通道, 组件停止后通道会被关闭
+func (c *Client) Messages() <-chan mqtt.Message {
+	return c.messages
+}
+
+// Publish 以配置的QoS发布消息, QoS>0时会等待broker确认
+func (c *Client) Publish(topic string, payload []byte, retained bool) error {
+	token := c.client.Publish(topic, c.config.QoS, retained, payload)
+	if !token.WaitTimeout(c.config.ConnectTimeout) {
+		return fmt.Errorf("Component:mqtt_client publish to %s timeout", topic)
+	}
+	return token.Error()
+}
+
+func (c *Client) subscribe(client mqtt.Client) {
+	if len(c.config.Subscriptions) == 0 {
+		return
+	}
+
+	filters := map[string]byte{}
+	for _, s := range c.config.Subscriptions {
+		filters[s.Topic] = s.QoS
+	}
+
+	token := client.SubscribeMultiple(filters, c.handle)
+	if token.WaitTimeout(c.config.ConnectTimeout) && token.Error() == nil {
+		return
+	}
+	log.Error("MQTT client: %s, Failed to subscribe %v error: %v", c.config.Name, filters, token.Error())
+}
+
+func (c *Client) handle(_ mqtt.Client, msg mqtt.Message) {
+	c.rwlock.RLock()
+	defer c.rwlock.RUnlock()
+
+	if c.closed {
+		return
+	}
+
+	select {
+	case <-c.done:
+	case c.messages <- msg:
+	}
+}
+
+func (c *Client) Instance() component.Instance {
+	return c.instance
+}
+
+func (c *Client) Start() error {
+	token := c.client.Connect()
+	if !token.WaitTimeout(c.config.ConnectTimeout) {
+		return fmt.Errorf("Component:mqtt_client connect to %v timeout", c.config.Brokers)
+	}
+	return token.Error()
+}
+
+func (c *Client) Stop() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+		close(c.done)
+
+		c.client.Disconnect(uint(time.Second / time.Millisecond))
+
+		c.rwlock.Lock()
+		c.closed = true
+		close(c.messages)
+		c.rwlock.Unlock()
+		return nil
+	}
+}
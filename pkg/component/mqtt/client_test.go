@@ -0,0 +1,57 @@
+package mqtt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"gotest.tools/v3/assert"
+)
+
+func runBroker(t *testing.T) string {
+	s := mochi.New(nil)
+	assert.NilError(t, s.AddHook(new(auth.AllowHook), nil))
+
+	l := listeners.NewTCP(listeners.Config{ID: "t1", Address: "127.0.0.1:0"})
+	assert.NilError(t, s.AddListener(l))
+	assert.NilError(t, s.Serve())
+	t.Cleanup(func() { s.Close() })
+
+	return "tcp://" + l.Address()
+}
+
+func TestClient(t *testing.T) {
+	broker := runBroker(t)
+
+	c, err := NewClient(fmt.Sprintf(`
+name: Telemetry
+brokers: [%s]
+client_id: test
+qos: 1
+subscriptions:
+  - topic: devices/+/telemetry
+    qos: 1`, broker))
+	assert.NilError(t, err)
+	assert.NilError(t, c.Start())
+	defer c.Stop()
+
+	// 订阅在连接成功后异步完成, 重复发布直到收到消息
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case m := <-c.Messages():
+			assert.Equal(t, m.Topic(), "devices/d1/telemetry")
+			assert.Equal(t, string(m.Payload()), `{"temp":21}`)
+			return
+		case <-ticker.C:
+			assert.NilError(t, c.Publish("devices/d1/telemetry", []byte(`{"temp":21}`), false))
+		case <-timeout:
+			t.Fatal("timeout waiting for mqtt message")
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package nats
+
+import (
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	connFactory       component.Factory   = NewConnFactory()
+	_                 component.Component = &Conn{}
+	defaultConnConfig                     = ConnConfig{
+		Name:           "MyNatsConn",
+		ConnectOptions: defaultConnectOptions,
+	}
+	defaultConnectOptions = ConnectOptions{
+		URLs:          []string{nats.DefaultURL},
+		MaxReconnects: nats.DefaultMaxReconnect,
+		ReconnectWait: nats.DefaultReconnectWait,
+	}
+	connDescription = "nats connection factory"
+)
+
+func init() {
+	if err := component.Register("nats_conn", connFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewConnFactory() component.Factory {
+	return component.NewFactory(
+		defaultConnConfig,
+		connDescription,
+		func(c string) (component.Component, error) {
+			return NewConn(c)
+		})
+}
+
+// ConnectOptions nats连接相关的公共配置
+type ConnectOptions struct {
+	URLs          []string      `yaml:"urls"`
+	User          string        `yaml:"user,omitempty"`
+	Password      string        `yaml:"password,omitempty"`
+	Token         string        `yaml:"token,omitempty"`
+	MaxReconnects int           `yaml:"max_reconnects"`
+	ReconnectWait time.Duration `yaml:"reconnect_wait"`
+}
+
+func (o ConnectOptions) connect(name string) (*nats.Conn, error) {
+	opts := []nats.Option{
+		nats.Name(name),
+		nats.MaxReconnects(o.MaxReconnects),
+		nats.ReconnectWait(o.ReconnectWait),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Warn("Nats: %s, Disconnected: %s", name, err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Info("Nats: %s, Reconnected to %s", name, nc.ConnectedUrl())
+		}),
+	}
+
+	if o.User != "" {
+		opts = append(opts, nats.UserInfo(o.User, o.Password))
+	}
+
+	if o.Token != "" {
+		opts = append(opts, nats.Token(o.Token))
+	}
+
+	return nats.Connect(strings.Join(o.URLs, ","), opts...)
+}
+
+type ConnConfig struct {
+	Name           string `yaml:"name"`
+	ConnectOptions `yaml:",inline"`
+}
+
+func (c ConnConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+type Conn struct {
+	conn     *nats.Conn
+	instance component.Instance
+}
+
+func NewConn(rawConfig string) (*Conn, error) {
+	conf := defaultConnConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Nats conn config: %+v", conf)
+
+	conn, err := conf.connect(conf.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conn{
+		conn: conn,
+		instance: component.NewInstance(
+			conf.Name,
+			reflect.TypeOf(conn),
+			reflect.ValueOf(conn),
+			conn,
+		),
+	}, nil
+}
+
+func (c *Conn) Instance() component.Instance {
+	return c.instance
+}
+
+func (c *Conn) Start() error {
+	return nil
+}
+
+func (c *Conn) Stop() error {
+	c.conn.Close()
+	return nil
+}
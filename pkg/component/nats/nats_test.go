@@ -0,0 +1,140 @@
+package nats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"gotest.tools/v3/assert"
+)
+
+func runServer(t *testing.T) *server.Server {
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	assert.NilError(t, err)
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server is not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return s
+}
+
+func receive(t *testing.T, s *Subscriber) *nats.Msg {
+	select {
+	case m := <-s.Messages():
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for nats message")
+	}
+	return nil
+}
+
+func TestQueueGroup(t *testing.T) {
+	srv := runServer(t)
+
+	sub, err := NewSubscriber(fmt.Sprintf(`
+name: Articles
+urls: [%s]
+subjects: [articles]
+queue_group: workers`, srv.ClientURL()))
+	assert.NilError(t, err)
+	assert.NilError(t, sub.Start())
+	defer sub.Stop()
+
+	pub, err := NewPublisher(fmt.Sprintf(`
+name: Sentences
+urls: [%s]
+subject: articles`, srv.ClientURL()))
+	assert.NilError(t, err)
+	defer pub.Stop()
+
+	assert.NilError(t, pub.Publish([]byte("hello")))
+	assert.Equal(t, string(receive(t, sub).Data), "hello")
+}
+
+func TestPublisherStopFlushes(t *testing.T) {
+	srv := runServer(t)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	assert.NilError(t, err)
+	defer nc.Close()
+	sub, err := nc.SubscribeSync("articles")
+	assert.NilError(t, err)
+	assert.NilError(t, nc.Flush())
+
+	pub, err := NewPublisher(fmt.Sprintf(`
+name: Sentences
+urls: [%s]
+subject: articles`, srv.ClientURL()))
+	assert.NilError(t, err)
+
+	const n = 1000
+	for i := 0; i < n; i++ {
+		assert.NilError(t, pub.Publish([]byte("hello")))
+	}
+
+	// Stop返回之后缓冲区中的消息已经发送, 连接已经关闭
+	assert.NilError(t, pub.Stop())
+	assert.Assert(t, pub.conn.IsClosed())
+	for i := 0; i < n; i++ {
+		_, err := sub.NextMsg(5 * time.Second)
+		assert.NilError(t, err)
+	}
+}
+
+func TestJetStreamDurable(t *testing.T) {
+	srv := runServer(t)
+
+	nc, err := nats.Connect(srv.ClientURL())
+	assert.NilError(t, err)
+	defer nc.Close()
+	js, err := nc.JetStream()
+	assert.NilError(t, err)
+	_, err = js.AddStream(&nats.StreamConfig{Name: "ARTICLES", Subjects: []string{"articles.>"}})
+	assert.NilError(t, err)
+
+	pub, err := NewPublisher(fmt.Sprintf(`
+name: Sentences
+urls: [%s]
+subject: articles.new
+jetstream: true`, srv.ClientURL()))
+	assert.NilError(t, err)
+	defer pub.Stop()
+	assert.NilError(t, pub.Publish([]byte("first")))
+	assert.NilError(t, pub.Publish([]byte("second")))
+
+	newSubscriber := func() *Subscriber {
+		sub, err := NewSubscriber(fmt.Sprintf(`
+name: Articles
+urls: [%s]
+subjects: [articles.new]
+jetstream:
+  stream: ARTICLES
+  durable: indexer
+  ack_wait: 1s`, srv.ClientURL()))
+		assert.NilError(t, err)
+		assert.NilError(t, sub.Start())
+		return sub
+	}
+
+	sub := newSubscriber()
+	m := receive(t, sub)
+	assert.Equal(t, string(m.Data), "first")
+	assert.NilError(t, m.AckSync())
+	assert.NilError(t, sub.Stop())
+
+	// durable consumer在重启后从未ack的消息继续消费
+	sub = newSubscriber()
+	defer sub.Stop()
+	m = receive(t, sub)
+	assert.Equal(t, string(m.Data), "second")
+	assert.NilError(t, m.Ack())
+}
@@ -0,0 +1,144 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	publisherFactory       component.Factory   = NewPublisherFactory()
+	_                      component.Component = &Publisher{}
+	defaultPublisherConfig                     = PublisherConfig{
+		Name:           "MyNatsPublisher",
+		ConnectOptions: defaultConnectOptions,
+		Subject:        "my_subject",
+	}
+	publisherDescription = "nats publisher factory, publishes to core nats or jetstream"
+)
+
+// 停止时等待缓冲区中的消息发送完毕的时间
+const stopFlushTimeout = 5 * time.Second
+
+func init() {
+	if err := component.Register("nats_publisher", publisherFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewPublisherFactory() component.Factory {
+	return component.NewFactory(
+		defaultPublisherConfig,
+		publisherDescription,
+		func(c string) (component.Component, error) {
+			return NewPublisher(c)
+		})
+}
+
+type PublisherConfig struct {
+	Name           string `yaml:"name"`
+	ConnectOptions `yaml:",inline"`
+
+	// Publish默认发布的subject
+	Subject string `yaml:"subject"`
+	// 为true时通过jetstream发布并等待服务端确认
+	JetStream bool `yaml:"jetstream"`
+}
+
+func (c PublisherConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+type Publisher struct {
+	config   PublisherConfig
+	conn     *nats.Conn
+	js       nats.JetStreamContext
+	instance component.Instance
+}
+
+func NewPublisher(rawConfig string) (*Publisher, error) {
+	conf := defaultPublisherConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Nats publisher config: %+v", conf)
+
+	conn, err := conf.connect(conf.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Publisher{
+		config: conf,
+		conn:   conn,
+	}
+
+	if conf.JetStream {
+		p.js, err = conn.JetStream()
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	p.instance = component.NewInstance(
+		conf.Name,
+		reflect.TypeOf(p),
+		reflect.ValueOf(p),
+		p,
+	)
+
+	return p, nil
+}
+
+// Publish 发布消息到配置的subject
+func (p *Publisher) Publish(data []byte) error {
+	if p.config.Subject == "" {
+		return errors.New("Component:nats_publisher subject is not configured")
+	}
+	return p.PublishTo(p.config.Subject, data)
+}
+
+// PublishTo 发布消息到指定的subject
+func (p *Publisher) PublishTo(subject string, data []byte) error {
+	return p.PublishMsg(&nats.Msg{Subject: subject, Data: data})
+}
+
+// PublishMsg 发布带header的消息, jetstream模式下会等待服务端确认
+func (p *Publisher) PublishMsg(msg *nats.Msg) error {
+	if p.js != nil {
+		_, err := p.js.PublishMsg(msg)
+		return err
+	}
+	return p.conn.PublishMsg(msg)
+}
+
+func (p *Publisher) Instance() component.Instance {
+	return p.instance
+}
+
+func (p *Publisher) Start() error {
+	return nil
+}
+
+func (p *Publisher) Stop() error {
+	defer p.conn.Close()
+
+	// 先Flush确保缓冲区中的消息发送完毕再关闭连接, 不使用Drain, Drain是异步的, 返回时消息可能还没有发送
+	if p.conn.IsClosed() {
+		return nil
+	}
+	if err := p.conn.FlushTimeout(stopFlushTimeout); err != nil {
+		return fmt.Errorf("Component:nats_publisher flush error: %v", err)
+	}
+	return nil
+}
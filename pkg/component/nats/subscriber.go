@@ -0,0 +1,251 @@
+package nats
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	"github.com/nats-io/nats.go"
+)
+
+var (
+	subscriberFactory       component.Factory   = NewSubscriberFactory()
+	_                       component.Component = &Subscriber{}
+	defaultSubscriberConfig                     = SubscriberConfig{
+		Name:           "MyNatsSubscriber",
+		ConnectOptions: defaultConnectOptions,
+		Subjects:       []string{"my_subject"},
+		BufferSize:     100,
+	}
+	subscriberDescription = "nats subscriber factory, supports queue groups and jetstream durable consumers"
+)
+
+func init() {
+	if err := component.Register("nats_subscriber", subscriberFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewSubscriberFactory() component.Factory {
+	return component.NewFactory(
+		defaultSubscriberConfig,
+		subscriberDescription,
+		func(c string) (component.Component, error) {
+			return NewSubscriber(c)
+		})
+}
+
+type SubscriberConfig struct {
+	Name           string `yaml:"name"`
+	ConnectOptions `yaml:",inline"`
+
+	Subjects   []string         `yaml:"subjects"`
+	QueueGroup string           `yaml:"queue_group,omitempty"`
+	BufferSize int              `yaml:"buffer_size"`
+	JetStream  *JetStreamConfig `yaml:"jetstream,omitempty"`
+}
+
+// JetStreamConfig 配置后以jetstream durable consumer的方式订阅, 消息需要显式调用Ack/Nak/Term
+type JetStreamConfig struct {
+	// 为空时根据subject查找stream
+	Stream string `yaml:"stream,omitempty"`
+	// durable consumer名称, 重启后从上次ack的位置继续消费
+	Durable string `yaml:"durable"`
+	// all, new, last
+	DeliverPolicy string        `yaml:"deliver_policy,omitempty"`
+	AckWait       time.Duration `yaml:"ack_wait,omitempty"`
+	MaxDeliver    int           `yaml:"max_deliver,omitempty"`
+	MaxAckPending int           `yaml:"max_ack_pending,omitempty"`
+}
+
+func (c JetStreamConfig) subOpts() ([]nats.SubOpt, error) {
+	opts := []nats.SubOpt{
+		nats.Durable(c.Durable),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+	}
+
+	if c.Stream != "" {
+		opts = append(opts, nats.BindStream(c.Stream))
+	}
+
+	switch c.DeliverPolicy {
+	case "", "all":
+		opts = append(opts, nats.DeliverAll())
+	case "new":
+		opts = append(opts, nats.DeliverNew())
+	case "last":
+		opts = append(opts, nats.DeliverLast())
+	default:
+		return nil, fmt.Errorf("Unsupported jetstream deliver policy: %s", c.DeliverPolicy)
+	}
+
+	if c.AckWait > 0 {
+		opts = append(opts, nats.AckWait(c.AckWait))
+	}
+
+	if c.MaxDeliver > 0 {
+		opts = append(opts, nats.MaxDeliver(c.MaxDeliver))
+	}
+
+	if c.MaxAckPending > 0 {
+		opts = append(opts, nats.MaxAckPending(c.MaxAckPending))
+	}
+
+	return opts, nil
+}
+
+func (c SubscriberConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+type Subscriber struct {
+	config   SubscriberConfig
+	conn     *nats.Conn
+	subs     []*nats.Subscription
+	messages chan *nats.Msg
+	done     chan struct{}
+	// 保护messages在Stop关闭后不会再被写入
+	rwlock   sync.RWMutex
+	closed   bool
+	instance component.Instance
+}
+
+func NewSubscriber(rawConfig string) (*Subscriber, error) {
+	conf := defaultSubscriberConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Nats subscriber config: %+v", conf)
+
+	if len(conf.Subjects) == 0 {
+		return nil, errors.New("Component:nats_subscriber subjects cannot be empty")
+	}
+
+	if conf.JetStream != nil {
+		if conf.JetStream.Durable == "" {
+			return nil, errors.New("Component:nats_subscriber jetstream durable cannot be empty")
+		}
+
+		// 一个durable consumer只能绑定一个filter subject
+		if len(conf.Subjects) > 1 {
+			return nil, errors.New("Component:nats_subscriber jetstream only supports one subject")
+		}
+	}
+
+	conn, err := conf.connect(conf.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscriber{
+		config:   conf,
+		conn:     conn,
+		messages: make(chan *nats.Msg, conf.BufferSize),
+		done:     make(chan struct{}),
+	}
+	s.instance = component.NewInstance(
+		conf.Name,
+		reflect.TypeOf(s),
+		reflect.ValueOf(s),
+		s,
+	)
+
+	return s, nil
+}
+
+// Messages 返回消息通道, jetstream模式下处理完成后需要调用msg.Ack()
+func (s *Subscriber) Messages() <-chan *nats.Msg {
+	return s.messages
+}
+
+func (s *Subscriber) Instance() component.Instance {
+	return s.instance
+}
+
+func (s *Subscriber) Start() error {
+	if s.config.JetStream != nil {
+		return s.subscribeJetStream()
+	}
+
+	for _, subject := range s.config.Subjects {
+		var sub *nats.Subscription
+		var err error
+		if s.config.QueueGroup != "" {
+			sub, err = s.conn.QueueSubscribe(subject, s.config.QueueGroup, s.handle)
+		} else {
+			sub, err = s.conn.Subscribe(subject, s.handle)
+		}
+		if err != nil {
+			return err
+		}
+		s.subs = append(s.subs, sub)
+	}
+	return nil
+}
+
+func (s *Subscriber) subscribeJetStream() error {
+	js, err := s.conn.JetStream()
+	if err != nil {
+		return err
+	}
+
+	opts, err := s.config.JetStream.subOpts()
+	if err != nil {
+		return err
+	}
+
+	subject := s.config.Subjects[0]
+
+	var sub *nats.Subscription
+	if s.config.QueueGroup != "" {
+		sub, err = js.QueueSubscribe(subject, s.config.QueueGroup, s.handle, opts...)
+	} else {
+		sub, err = js.Subscribe(subject, s.handle, opts...)
+	}
+	if err != nil {
+		return err
+	}
+	s.subs = append(s.subs, sub)
+	return nil
+}
+
+func (s *Subscriber) handle(msg *nats.Msg) {
+	s.rwlock.RLock()
+	defer s.rwlock.RUnlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case <-s.done:
+	case s.messages <- msg:
+	}
+}
+
+func (s *Subscriber) Stop() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+		close(s.done)
+
+		// 直接关闭连接而不是Unsubscribe, 避免删除jetstream的durable consumer
+		s.conn.Close()
+
+		s.rwlock.Lock()
+		s.closed = true
+		close(s.messages)
+		s.rwlock.Unlock()
+		return nil
+	}
+}
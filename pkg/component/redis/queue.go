@@ -0,0 +1,203 @@
+package redis
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	queueFactory       component.Factory   = NewQueueFactory()
+	_                  component.Component = &Queue{}
+	defaultQueueConfig                     = QueueConfig{
+		Name:       "MyRedisQueue",
+		Addr:       "127.0.0.1:6379",
+		PoolSize:   5,
+		PopKeys:    []string{"my_queue"},
+		PushKey:    "my_queue",
+		Timeout:    time.Second,
+		BufferSize: 100,
+	}
+	queueDescription = "redis list queue factory(BLPOP/RPUSH)"
+)
+
+func init() {
+	if err := component.Register("redis_queue", queueFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewQueueFactory() component.Factory {
+	return component.NewFactory(
+		defaultQueueConfig,
+		queueDescription,
+		func(c string) (component.Component, error) {
+			return NewQueue(c)
+		})
+}
+
+type QueueConfig struct {
+	Name     string `yaml:"name"`
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	PoolSize int    `yaml:"pool_size"`
+
+	// 通过BLPOP消费的list, 为空时只作为生产者使用
+	PopKeys []string `yaml:"pop_keys"`
+	// Push默认写入的list
+	PushKey    string        `yaml:"push_key"`
+	Timeout    time.Duration `yaml:"timeout"`
+	BufferSize int           `yaml:"buffer_size"`
+}
+
+func (c QueueConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// QueueMessage 从redis list中弹出的消息, BLPOP弹出即删除所以无需ack
+type QueueMessage struct {
+	Key   string
+	Value string
+}
+
+type Queue struct {
+	config   QueueConfig
+	client   *redis.Client
+	messages chan *QueueMessage
+	done     chan struct{}
+	wg       sync.WaitGroup
+	instance component.Instance
+}
+
+func NewQueue(rawConfig string) (*Queue, error) {
+	conf := defaultQueueConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Redis queue config: %+v", conf)
+
+	if len(conf.PopKeys) == 0 && conf.PushKey == "" {
+		return nil, errors.New("Component:redis_queue pop_keys and push_key cannot both be empty")
+	}
+
+	// BLPOP的超时精度为秒, 小于1秒时会被当作0一直阻塞, 导致组件无法停止
+	if conf.Timeout < time.Second {
+		conf.Timeout = defaultQueueConfig.Timeout
+	}
+
+	q := &Queue{
+		config: conf,
+		client: redis.NewClient(&redis.Options{
+			Addr:     conf.Addr,
+			Password: conf.Password,
+			DB:       conf.DB,
+			PoolSize: conf.PoolSize,
+		}),
+		messages: make(chan *QueueMessage, conf.BufferSize),
+		done:     make(chan struct{}),
+	}
+	q.instance = component.NewInstance(
+		conf.Name,
+		reflect.TypeOf(q),
+		reflect.ValueOf(q),
+		q,
+	)
+
+	return q, nil
+}
+
+// Messages 返回消息通道, 组件停止后通道会被关闭
+func (q *Queue) Messages() <-chan *QueueMessage {
+	return q.messages
+}
+
+// Push 将values通过RPUSH写入配置的push_key
+func (q *Queue) Push(values ...interface{}) error {
+	if q.config.PushKey == "" {
+		return errors.New("Component:redis_queue push_key is not configured")
+	}
+	return q.PushTo(q.config.PushKey, values...)
+}
+
+// PushTo 将values通过RPUSH写入指定的list
+func (q *Queue) PushTo(key string, values ...interface{}) error {
+	return q.client.RPush(key, values...).Err()
+}
+
+func (q *Queue) Instance() component.Instance {
+	return q.instance
+}
+
+func (q *Queue) Start() error {
+	if len(q.config.PopKeys) > 0 {
+		q.wg.Add(1)
+		go q.pop()
+	}
+	return nil
+}
+
+func (q *Queue) pop() {
+	defer q.wg.Done()
+
+	for !q.isStopped() {
+		// BLPOP返回[key, value]
+		res, err := q.client.BLPop(q.config.Timeout, q.config.PopKeys...).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Error("Redis queue: %s, Error: %s", q.config.Name, err)
+			q.sleep(time.Second)
+			continue
+		}
+
+		select {
+		case <-q.done:
+			// 已经弹出的消息放回队首, 避免停止时丢失
+			if err := q.client.LPush(res[0], res[1]).Err(); err != nil {
+				log.Error("Redis queue: %s, Failed to requeue message error: %s", q.config.Name, err)
+			}
+			return
+		case q.messages <- &QueueMessage{Key: res[0], Value: res[1]}:
+		}
+	}
+}
+
+func (q *Queue) sleep(d time.Duration) {
+	select {
+	case <-q.done:
+	case <-time.After(d):
+	}
+}
+
+func (q *Queue) isStopped() bool {
+	select {
+	case <-q.done:
+		return true
+	default:
+	}
+	return false
+}
+
+func (q *Queue) Stop() error {
+	select {
+	case <-q.done:
+		return nil
+	default:
+		close(q.done)
+		q.wg.Wait()
+		close(q.messages)
+
+		return q.client.Close()
+	}
+}
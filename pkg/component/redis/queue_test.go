@@ -0,0 +1,36 @@
+package redis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"gotest.tools/v3/assert"
+)
+
+func TestQueue(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	q, err := NewQueue(fmt.Sprintf(`
+name: Jobs
+addr: %s
+pop_keys: [jobs]
+push_key: jobs
+timeout: 1s`, s.Addr()))
+	assert.NilError(t, err)
+	assert.NilError(t, q.Start())
+	defer q.Stop()
+
+	assert.NilError(t, q.Push("a", "b"))
+
+	for _, want := range []string{"a", "b"} {
+		select {
+		case m := <-q.Messages():
+			assert.Equal(t, m.Key, "jobs")
+			assert.Equal(t, m.Value, want)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout waiting for queue message")
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	"github.com/go-redis/redis"
+)
+
+var (
+	streamConsumerFactory       component.Factory   = NewStreamConsumerFactory()
+	_                           component.Component = &StreamConsumer{}
+	defaultStreamConsumerConfig                     = StreamConsumerConfig{
+		Name:          "MyRedisStreamConsumer",
+		Addr:          "127.0.0.1:6379",
+		PoolSize:      5,
+		Streams:       []string{"my_stream"},
+		Group:         "my_consumer_group",
+		Consumer:      "my_consumer",
+		StartID:       "$",
+		Count:         10,
+		Block:         time.Second,
+		ClaimMinIdle:  time.Minute,
+		ClaimInterval: 30 * time.Second,
+		BufferSize:    100,
+	}
+	streamConsumerDescription = "redis stream consumer group factory(XREADGROUP/XACK/XCLAIM)"
+)
+
+func init() {
+	if err := component.Register("redis_stream_consumer", streamConsumerFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewStreamConsumerFactory() component.Factory {
+	return component.NewFactory(
+		defaultStreamConsumerConfig,
+		streamConsumerDescription,
+		func(c string) (component.Component, error) {
+			return NewStreamConsumer(c)
+		})
+}
+
+type StreamConsumerConfig struct {
+	Name     string `yaml:"name"`
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	PoolSize int    `yaml:"pool_size"`
+
+	Streams  []string `yaml:"streams"`
+	Group    string   `yaml:"group"`
+	Consumer string   `yaml:"consumer"`
+	// 消费组不存在时创建消费组的起始ID, $表示只消费新消息, 0表示从头消费
+	StartID string        `yaml:"start_id"`
+	Count   int64         `yaml:"count"`
+	Block   time.Duration `yaml:"block"`
+	// 其他消费者超过ClaimMinIdle仍未ack的消息会被当前消费者认领重新投递, 为0时不认领
+	ClaimMinIdle  time.Duration `yaml:"claim_min_idle"`
+	ClaimInterval time.Duration `yaml:"claim_interval"`
+	BufferSize    int           `yaml:"buffer_size"`
+}
+
+func (c StreamConsumerConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// StreamMessage 从redis stream中读取到的消息, 处理完成后需要调用Ack
+type StreamMessage struct {
+	Stream string
+	ID     string
+	Values map[string]interface{}
+
+	consumer *StreamConsumer
+}
+
+func (m *StreamMessage) Ack() error {
+	return m.consumer.Ack(m)
+}
+
+type StreamConsumer struct {
+	config   StreamConsumerConfig
+	client   *redis.Client
+	messages chan *StreamMessage
+	done     chan struct{}
+	wg       sync.WaitGroup
+	instance component.Instance
+}
+
+func NewStreamConsumer(rawConfig string) (*StreamConsumer, error) {
+	conf := defaultStreamConsumerConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("Redis stream consumer config: %+v", conf)
+
+	if len(conf.Streams) == 0 {
+		return nil, errors.New("Component:redis_stream_consumer streams cannot be empty")
+	}
+
+	if conf.Group == "" || conf.Consumer == "" {
+		return nil, errors.New("Component:redis_stream_consumer group and consumer cannot be empty")
+	}
+
+	// block为0时XREADGROUP会一直阻塞, 导致组件无法停止
+	if conf.Block <= 0 {
+		conf.Block = defaultStreamConsumerConfig.Block
+	}
+
+	if conf.ClaimInterval <= 0 {
+		conf.ClaimInterval = defaultStreamConsumerConfig.ClaimInterval
+	}
+
+	c := &StreamConsumer{
+		config: conf,
+		client: redis.NewClient(&redis.Options{
+			Addr:     conf.Addr,
+			Password: conf.Password,
+			DB:       conf.DB,
+			PoolSize: conf.PoolSize,
+		}),
+		messages: make(chan *StreamMessage, conf.BufferSize),
+		done:     make(chan struct{}),
+	}
+	c.instance = component.NewInstance(
+		conf.Name,
+		reflect.TypeOf(c),
+		reflect.ValueOf(c),
+		c,
+	)
+
+	return c, nil
+}
+
+// Messages 返回消息通道, 组件停止后通道会被关闭
+func (c *StreamConsumer) Messages() <-chan *StreamMessage {
+	return c.messages
+}
+
+// Ack 确认消息已被处理, 将其从消费组的pending列表中移除
+func (c *StreamConsumer) Ack(msgs ...*StreamMessage) error {
+	ids := map[string][]string{}
+	for _, m := range msgs {
+		ids[m.Stream] = append(ids[m.Stream], m.ID)
+	}
+
+	for stream, ids := range ids {
+		if err := c.client.XAck(stream, c.config.Group, ids...).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *StreamConsumer) Instance() component.Instance {
+	return c.instance
+}
+
+func (c *StreamConsumer) Start() error {
+	for _, stream := range c.config.Streams {
+		err := c.client.XGroupCreateMkStream(stream, c.config.Group, c.config.StartID).Err()
+		if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+			return err
+		}
+	}
+
+	c.wg.Add(1)
+	go c.read()
+
+	if c.config.ClaimMinIdle > 0 {
+		c.wg.Add(1)
+		go c.claim()
+	}
+	return nil
+}
+
+func (c *StreamConsumer) read() {
+	defer c.wg.Done()
+
+	if !c.readPending() {
+		return
+	}
+
+	streams := append([]string{}, c.config.Streams...)
+	for range c.config.Streams {
+		streams = append(streams, ">")
+	}
+
+	for !c.isStopped() {
+		res, err := c.client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    c.config.Group,
+			Consumer: c.config.Consumer,
+			Streams:  streams,
+			Count:    c.config.Count,
+			Block:    c.config.Block,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Error("Redis stream consumer: %s, Error: %s", c.config.Name, err)
+			c.sleep(time.Second)
+			continue
+		}
+
+		for _, s := range res {
+			if !c.deliver(s.Stream, s.Messages) {
+				return
+			}
+		}
+	}
+}
+
+// readPending 以ID 0分页读取当前消费者自己未ack的消息重新投递, 例如重启之前已经读取但是没有处理完的消息,
+// 读完之后才开始读取新消息
+func (c *StreamConsumer) readPending() bool {
+	ids := map[string]string{}
+	for _, stream := range c.config.Streams {
+		ids[stream] = "0"
+	}
+
+	for len(ids) > 0 && !c.isStopped() {
+		var streams, starts []string
+		for _, stream := range c.config.Streams {
+			if id, ok := ids[stream]; ok {
+				streams = append(streams, stream)
+				starts = append(starts, id)
+			}
+		}
+
+		res, err := c.client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    c.config.Group,
+			Consumer: c.config.Consumer,
+			Streams:  append(streams, starts...),
+			Count:    c.config.Count,
+			Block:    -1,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			log.Error("Redis stream consumer: %s, Read pending error: %s", c.config.Name, err)
+			c.sleep(time.Second)
+			continue
+		}
+
+		read := map[string]bool{}
+		for _, s := range res {
+			if len(s.Messages) == 0 {
+				continue
+			}
+			read[s.Stream] = true
+			ids[s.Stream] = s.Messages[len(s.Messages)-1].ID
+			if !c.deliver(s.Stream, s.Messages) {
+				return false
+			}
+		}
+		for _, stream := range streams {
+			if !read[stream] {
+				delete(ids, stream)
+			}
+		}
+	}
+	return !c.isStopped()
+}
+
+// claim 定期认领其他(已下线)消费者超时未ack的消息
+func (c *StreamConsumer) claim() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(c.config.ClaimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, stream := range c.config.Streams {
+			msgs, err := c.claimStream(stream)
+			if err != nil {
+				log.Error("Redis stream consumer: %s, Stream: %s, Claim error: %s",
+					c.config.Name, stream, err)
+				continue
+			}
+
+			if !c.deliver(stream, msgs) {
+				return
+			}
+		}
+	}
+}
+
+func (c *StreamConsumer) claimStream(stream string) ([]redis.XMessage, error) {
+	count := c.config.Count
+	if count <= 0 {
+		count = defaultStreamConsumerConfig.Count
+	}
+
+	// 按照ID分页扫描pending列表, 跳过当前消费者自己的消息, 这些消息启动时已经由readPending重新投递
+	var ids []string
+	start := "-"
+	for int64(len(ids)) < count {
+		pendings, err := c.client.XPendingExt(&redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  c.config.Group,
+			Start:  start,
+			End:    "+",
+			Count:  count,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range pendings {
+			if p.Consumer != c.config.Consumer && p.Idle >= c.config.ClaimMinIdle {
+				ids = append(ids, p.Id)
+			}
+		}
+
+		if int64(len(pendings)) < count {
+			break
+		}
+		start, err = nextStreamID(pendings[len(pendings)-1].Id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if int64(len(ids)) > count {
+		ids = ids[:count]
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	return c.client.XClaim(&redis.XClaimArgs{
+		Stream:   stream,
+		Group:    c.config.Group,
+		Consumer: c.config.Consumer,
+		MinIdle:  c.config.ClaimMinIdle,
+		Messages: ids,
+	}).Result()
+}
+
+// nextStreamID 返回比id大的最小的消息ID, 用于XPENDING分页
+func nextStreamID(id string) (string, error) {
+	parts := strings.SplitN(id, "-", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("Invalid stream id: %s", id)
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("Invalid stream id: %s", id)
+	}
+	return parts[0] + "-" + strconv.FormatUint(seq+1, 10), nil
+}
+
+func (c *StreamConsumer) deliver(stream string, msgs []redis.XMessage) bool {
+	for _, m := range msgs {
+		select {
+		case <-c.done:
+			return false
+		case c.messages <- &StreamMessage{
+			Stream:   stream,
+			ID:       m.ID,
+			Values:   m.Values,
+			consumer: c,
+		}:
+		}
+	}
+	return true
+}
+
+func (c *StreamConsumer) sleep(d time.Duration) {
+	select {
+	case <-c.done:
+	case <-time.After(d):
+	}
+}
+
+func (c *StreamConsumer) isStopped() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+	}
+	return false
+}
+
+func (c *StreamConsumer) Stop() error {
+	select {
+	case <-c.done:
+		return nil
+	default:
+		close(c.done)
+		c.wg.Wait()
+		close(c.messages)
+
+		return c.client.Close()
+	}
+}
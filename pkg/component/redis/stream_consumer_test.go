@@ -0,0 +1,165 @@
+package redis
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"gotest.tools/v3/assert"
+)
+
+func TestStreamConsumer(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	c, err := NewStreamConsumer(fmt.Sprintf(`
+name: Events
+addr: %s
+streams: [events]
+group: g1
+consumer: c1
+start_id: "0"
+block: 100ms
+claim_min_idle: 0s`, s.Addr()))
+	assert.NilError(t, err)
+	assert.NilError(t, c.Start())
+	defer c.Stop()
+
+	_, err = s.XAdd("events", "*", []string{"title", "hello"})
+	assert.NilError(t, err)
+
+	select {
+	case m := <-c.Messages():
+		assert.Equal(t, m.Stream, "events")
+		assert.Equal(t, m.Values["title"], "hello")
+
+		pendings, err := c.client.XPending("events", "g1").Result()
+		assert.NilError(t, err)
+		assert.Equal(t, pendings.Count, int64(1))
+
+		assert.NilError(t, m.Ack())
+
+		pendings, err = c.client.XPending("events", "g1").Result()
+		assert.NilError(t, err)
+		assert.Equal(t, pendings.Count, int64(0))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for stream message")
+	}
+}
+
+func TestStreamConsumerClaim(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	// 另一个消费者读取消息后未ack就下线了
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+	assert.NilError(t, client.XGroupCreateMkStream("events", "g1", "0").Err())
+	assert.NilError(t, client.XAdd(&redis.XAddArgs{
+		Stream: "events",
+		Values: map[string]interface{}{"title": "orphan"},
+	}).Err())
+	assert.NilError(t, client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    "g1",
+		Consumer: "dead",
+		Streams:  []string{"events", ">"},
+		Block:    -1,
+	}).Err())
+
+	c, err := NewStreamConsumer(fmt.Sprintf(`
+name: Events
+addr: %s
+streams: [events]
+group: g1
+consumer: c1
+block: 100ms
+claim_min_idle: 1ms
+claim_interval: 50ms`, s.Addr()))
+	assert.NilError(t, err)
+	assert.NilError(t, c.Start())
+	defer c.Stop()
+
+	assert.NilError(t, client.XAdd(&redis.XAddArgs{
+		Stream: "events",
+		Values: map[string]interface{}{"title": "fresh"},
+	}).Err())
+
+	// 认领的消息和自己读取的消息都不ack, 之后的认领不能重复投递自己的消息
+	titles := map[interface{}]int{}
+	timeout := time.After(5 * time.Second)
+	for len(titles) < 2 {
+		select {
+		case m := <-c.Messages():
+			titles[m.Values["title"]]++
+		case <-timeout:
+			t.Fatal("timeout waiting for claimed message")
+		}
+	}
+	assert.DeepEqual(t, titles, map[interface{}]int{"orphan": 1, "fresh": 1})
+
+	select {
+	case m := <-c.Messages():
+		t.Fatalf("message %s is delivered twice", m.Values["title"])
+	case <-time.After(300 * time.Millisecond):
+	}
+}
+
+func TestStreamConsumerPending(t *testing.T) {
+	s := miniredis.RunT(t)
+
+	// 同名的消费者重启之前读取了消息但是没有ack
+	client := redis.NewClient(&redis.Options{Addr: s.Addr()})
+	defer client.Close()
+	assert.NilError(t, client.XGroupCreateMkStream("events", "g1", "0").Err())
+	for _, title := range []string{"a", "b", "c"} {
+		assert.NilError(t, client.XAdd(&redis.XAddArgs{
+			Stream: "events",
+			Values: map[string]interface{}{"title": title},
+		}).Err())
+	}
+	assert.NilError(t, client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    "g1",
+		Consumer: "c1",
+		Streams:  []string{"events", ">"},
+		Block:    -1,
+	}).Err())
+	assert.NilError(t, client.XAdd(&redis.XAddArgs{
+		Stream: "events",
+		Values: map[string]interface{}{"title": "d"},
+	}).Err())
+
+	c, err := NewStreamConsumer(fmt.Sprintf(`
+name: Events
+addr: %s
+streams: [events]
+group: g1
+consumer: c1
+count: 2
+block: 100ms
+claim_min_idle: 0s`, s.Addr()))
+	assert.NilError(t, err)
+	assert.NilError(t, c.Start())
+	defer c.Stop()
+
+	var titles []interface{}
+	timeout := time.After(5 * time.Second)
+	for len(titles) < 4 {
+		select {
+		case m := <-c.Messages():
+			titles = append(titles, m.Values["title"])
+			assert.NilError(t, m.Ack())
+		case <-timeout:
+			t.Fatalf("timeout waiting for pending messages, got %v", titles)
+		}
+	}
+	assert.DeepEqual(t, titles, []interface{}{"a", "b", "c", "d"})
+}
+
+func TestNextStreamID(t *testing.T) {
+	id, err := nextStreamID("1526919030474-55")
+	assert.NilError(t, err)
+	assert.Equal(t, id, "1526919030474-56")
+
+	_, err = nextStreamID("bad")
+	assert.ErrorContains(t, err, "Invalid stream id")
+}
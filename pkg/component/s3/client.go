@@ -0,0 +1,139 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"reflect"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var (
+	clientFactory       component.Factory   = NewClientFactory()
+	_                   component.Component = &Client{}
+	defaultClientConfig                     = ClientConfig{
+		Name:           "MyS3Client",
+		ConnectOptions: defaultConnectOptions,
+	}
+	clientDescription = "s3 compatible object storage client factory(aws s3, minio...)"
+)
+
+func init() {
+	if err := component.Register("s3_client", clientFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewClientFactory() component.Factory {
+	return component.NewFactory(
+		defaultClientConfig,
+		clientDescription,
+		func(c string) (component.Component, error) {
+			return NewClient(c)
+		})
+}
+
+type ClientConfig struct {
+	Name           string `yaml:"name"`
+	ConnectOptions `yaml:",inline"`
+}
+
+func (c ClientConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// Bucket 注入给processor的对象, 内嵌minio.Client的同时提供针对默认bucket的便捷方法
+type Bucket struct {
+	*minio.Client
+	Name string
+}
+
+// Upload 流式上传对象, size未知时传-1
+func (b *Bucket) Upload(ctx context.Context, key string, r io.Reader, size int64, contentType string) (minio.UploadInfo, error) {
+	return b.PutObject(ctx, b.Name, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+}
+
+// Download 返回对象内容的流, 调用方负责Close
+func (b *Bucket) Download(ctx context.Context, key string) (io.ReadCloser, error) {
+	obj, err := b.GetObject(ctx, b.Name, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject是惰性请求, 通过Stat提前暴露对象不存在等错误
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, err
+	}
+	return obj, nil
+}
+
+// List 递归列出prefix下的所有对象
+func (b *Bucket) List(ctx context.Context, prefix string) ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for obj := range b.ListObjects(ctx, b.Name, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+type Client struct {
+	bucket   *Bucket
+	instance component.Instance
+}
+
+func NewClient(rawConfig string) (*Client, error) {
+	conf := defaultClientConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("S3 client config: %+v", conf)
+
+	if conf.Bucket == "" {
+		return nil, errors.New("Component:s3_client bucket cannot be empty")
+	}
+
+	c, err := conf.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bucket{Client: c, Name: conf.Bucket}
+
+	return &Client{
+		bucket: b,
+		instance: component.NewInstance(
+			conf.Name,
+			reflect.TypeOf(b),
+			reflect.ValueOf(b),
+			b,
+		),
+	}, nil
+}
+
+func (c *Client) Instance() component.Instance {
+	return c.instance
+}
+
+func (c *Client) Start() error {
+	return nil
+}
+
+func (c *Client) Stop() error {
+	return nil
+}
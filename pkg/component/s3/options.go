@@ -0,0 +1,43 @@
+package s3
+
+import (
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+var defaultConnectOptions = ConnectOptions{
+	Endpoint:  "127.0.0.1:9000",
+	Region:    "us-east-1",
+	AccessKey: "minioadmin",
+	SecretKey: "minioadmin",
+	PathStyle: true,
+	Bucket:    "my_bucket",
+}
+
+// ConnectOptions s3兼容存储的公共连接配置
+type ConnectOptions struct {
+	// 不带协议的地址, 例如: s3.amazonaws.com, 127.0.0.1:9000
+	Endpoint     string `yaml:"endpoint"`
+	Region       string `yaml:"region"`
+	AccessKey    string `yaml:"access_key"`
+	SecretKey    string `yaml:"secret_key"`
+	SessionToken string `yaml:"session_token,omitempty"`
+	Secure       bool   `yaml:"secure"`
+	// MinIO等自建服务通常需要使用path-style访问bucket
+	PathStyle bool   `yaml:"path_style"`
+	Bucket    string `yaml:"bucket"`
+}
+
+func (o ConnectOptions) newClient() (*minio.Client, error) {
+	lookup := minio.BucketLookupAuto
+	if o.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	return minio.New(o.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(o.AccessKey, o.SecretKey, o.SessionToken),
+		Secure:       o.Secure,
+		Region:       o.Region,
+		BucketLookup: lookup,
+	})
+}
@@ -0,0 +1,97 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"gotest.tools/v3/assert"
+)
+
+func runFakeS3(t *testing.T, bucket string) string {
+	backend := s3mem.New()
+	assert.NilError(t, backend.CreateBucket(bucket))
+
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(ts.Close)
+
+	return strings.TrimPrefix(ts.URL, "http://")
+}
+
+func TestClient(t *testing.T) {
+	endpoint := runFakeS3(t, "articles")
+
+	c, err := NewClient(fmt.Sprintf(`
+name: Archive
+endpoint: %s
+access_key: key
+secret_key: secret
+path_style: true
+bucket: articles`, endpoint))
+	assert.NilError(t, err)
+
+	b := c.Instance().Interface().(*Bucket)
+	ctx := context.Background()
+
+	_, err = b.Upload(ctx, "raw/1.json", strings.NewReader(`{"id":1}`), 8, "application/json")
+	assert.NilError(t, err)
+	_, err = b.Upload(ctx, "other/2.json", strings.NewReader(`{"id":2}`), 8, "application/json")
+	assert.NilError(t, err)
+
+	r, err := b.Download(ctx, "raw/1.json")
+	assert.NilError(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.NilError(t, err)
+	r.Close()
+	assert.Equal(t, string(data), `{"id":1}`)
+
+	_, err = b.Download(ctx, "raw/not_exists.json")
+	assert.Assert(t, err != nil)
+
+	objects, err := b.List(ctx, "raw/")
+	assert.NilError(t, err)
+	assert.Equal(t, len(objects), 1)
+	assert.Equal(t, objects[0].Key, "raw/1.json")
+}
+
+func TestWatcher(t *testing.T) {
+	endpoint := runFakeS3(t, "articles")
+	conf := fmt.Sprintf(`
+name: Incoming
+endpoint: %s
+access_key: key
+secret_key: secret
+path_style: true
+bucket: articles
+prefix: incoming/
+poll_interval: 50ms`, endpoint)
+
+	c, err := NewClient(conf)
+	assert.NilError(t, err)
+	b := c.Instance().Interface().(*Bucket)
+	ctx := context.Background()
+
+	_, err = b.Upload(ctx, "incoming/old.txt", strings.NewReader("old"), 3, "")
+	assert.NilError(t, err)
+
+	w, err := NewWatcher(conf)
+	assert.NilError(t, err)
+	assert.NilError(t, w.Start())
+	defer w.Stop()
+
+	_, err = b.Upload(ctx, "incoming/new.txt", strings.NewReader("new"), 3, "")
+	assert.NilError(t, err)
+
+	select {
+	case obj := <-w.Objects():
+		assert.Equal(t, obj.Key, "incoming/new.txt")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for new object")
+	}
+}
@@ -0,0 +1,213 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"gopkg.in/yaml.v2"
+
+	"github.com/minio/minio-go/v7"
+)
+
+var (
+	watcherFactory       component.Factory   = NewWatcherFactory()
+	_                    component.Component = &Watcher{}
+	defaultWatcherConfig                     = WatcherConfig{
+		Name:           "MyS3Watcher",
+		ConnectOptions: defaultConnectOptions,
+		Prefix:         "incoming/",
+		PollInterval:   30 * time.Second,
+		BufferSize:     100,
+	}
+	watcherDescription = "s3 prefix watcher factory, emits objects newly created under the prefix"
+)
+
+func init() {
+	if err := component.Register("s3_watcher", watcherFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewWatcherFactory() component.Factory {
+	return component.NewFactory(
+		defaultWatcherConfig,
+		watcherDescription,
+		func(c string) (component.Component, error) {
+			return NewWatcher(c)
+		})
+}
+
+type WatcherConfig struct {
+	Name           string `yaml:"name"`
+	ConnectOptions `yaml:",inline"`
+
+	Prefix       string        `yaml:"prefix"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	// 为true时启动时已存在的对象也会被发送, 否则只发送启动后新增/修改的对象
+	FromBeginning bool `yaml:"from_beginning"`
+	BufferSize    int  `yaml:"buffer_size"`
+}
+
+func (c WatcherConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+type Watcher struct {
+	config  WatcherConfig
+	client  *minio.Client
+	objects chan minio.ObjectInfo
+	// key: object key, value: etag, 用于识别新增或被覆盖的对象
+	seen     map[string]string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	instance component.Instance
+}
+
+func NewWatcher(rawConfig string) (*Watcher, error) {
+	conf := defaultWatcherConfig
+	err := yaml.Unmarshal([]byte(rawConfig), &conf)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("S3 watcher config: %+v", conf)
+
+	if conf.Bucket == "" {
+		return nil, errors.New("Component:s3_watcher bucket cannot be empty")
+	}
+
+	if conf.PollInterval <= 0 {
+		conf.PollInterval = defaultWatcherConfig.PollInterval
+	}
+
+	c, err := conf.newClient()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watcher{
+		config:  conf,
+		client:  c,
+		objects: make(chan minio.ObjectInfo, conf.BufferSize),
+		seen:    map[string]string{},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	w.instance = component.NewInstance(
+		conf.Name,
+		reflect.TypeOf(w),
+		reflect.ValueOf(w),
+		w,
+	)
+
+	return w, nil
+}
+
+// Objects 返回新对象的通道, 组件停止后通道会被关闭
+func (w *Watcher) Objects() <-chan minio.ObjectInfo {
+	return w.objects
+}
+
+func (w *Watcher) Instance() component.Instance {
+	return w.instance
+}
+
+func (w *Watcher) Start() error {
+	if !w.config.FromBeginning {
+		objects, err := w.list()
+		if err != nil {
+			return err
+		}
+
+		for _, obj := range objects {
+			w.seen[obj.Key] = obj.ETag
+		}
+	}
+
+	w.wg.Add(1)
+	go w.watch()
+	return nil
+}
+
+func (w *Watcher) watch() {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if !w.poll() {
+			return
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Watcher) poll() bool {
+	objects, err := w.list()
+	if err != nil {
+		log.Error("S3 watcher: %s, List error: %s", w.config.Name, err)
+		return true
+	}
+
+	exists := map[string]struct{}{}
+	for _, obj := range objects {
+		exists[obj.Key] = struct{}{}
+		if etag, ok := w.seen[obj.Key]; ok && etag == obj.ETag {
+			continue
+		}
+
+		select {
+		case <-w.ctx.Done():
+			return false
+		case w.objects <- obj:
+			w.seen[obj.Key] = obj.ETag
+		}
+	}
+
+	// 清理已被删除的对象, 避免seen无限增长
+	for key := range w.seen {
+		if _, ok := exists[key]; !ok {
+			delete(w.seen, key)
+		}
+	}
+	return true
+}
+
+func (w *Watcher) list() ([]minio.ObjectInfo, error) {
+	var objects []minio.ObjectInfo
+	for obj := range w.client.ListObjects(w.ctx, w.config.Bucket, minio.ListObjectsOptions{
+		Prefix:    w.config.Prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+func (w *Watcher) Stop() error {
+	select {
+	case <-w.ctx.Done():
+		return nil
+	default:
+		w.cancel()
+		w.wg.Wait()
+		close(w.objects)
+		return nil
+	}
+}
@@ -0,0 +1,405 @@
+package grpcplugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/lotus/processor"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	handshakeTimeout = 10 * time.Second
+	describeTimeout  = 10 * time.Second
+	stopTimeout      = 5 * time.Second
+
+	minRestartBackoff = 100 * time.Millisecond
+	maxRestartBackoff = 30 * time.Second
+	// 插件进程运行超过这个时间后退出, 重启的退避时间会被重置
+	stableTime = 10 * time.Second
+)
+
+var ErrClosed = errors.New("Plugin is closed")
+
+var (
+	clientsLock sync.RWMutex
+	clients     []*Client
+)
+
+// Client 管理一个插件进程, 插件进程意外退出后会以指数退避的方式重启,
+// 重启后重新创建并启动之前启动过的component, processor会在下一次调用时重新创建
+type Client struct {
+	path     string
+	openTime time.Time
+	info     DescribeResponse
+
+	lock       sync.Mutex
+	cmd        *exec.Cmd
+	stdin      io.Closer
+	conn       *grpc.ClientConn
+	exited     chan struct{}
+	startTime  time.Time
+	generation int
+	restarts   int
+	lastError  string
+	closed     bool
+	done       chan struct{}
+	components map[*Component]struct{}
+}
+
+// Start 启动插件进程, 由调用方通过ProcessorFactory和ComponentFactory将插件注册到lotus中
+func Start(path string) (*Client, error) {
+	log.Info("loading grpc plugin: %s", path)
+
+	c := &Client{
+		path:       path,
+		openTime:   time.Now(),
+		done:       make(chan struct{}),
+		components: map[*Component]struct{}{},
+	}
+
+	if err := c.start(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+	if err := c.invoke(ctx, "Describe", &Empty{}, &c.info); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	go c.supervise()
+
+	clientsLock.Lock()
+	clients = append(clients, c)
+	clientsLock.Unlock()
+	return c, nil
+}
+
+// List 返回所有打开的gRPC插件
+func List() []*Client {
+	clientsLock.RLock()
+	defer clientsLock.RUnlock()
+
+	var res []*Client
+	res = append(res, clients...)
+	return res
+}
+
+// CloseAll 关闭所有gRPC插件进程
+func CloseAll() {
+	for _, c := range List() {
+		c.Close()
+	}
+}
+
+// ProcessorFactory 创建插件进程中的processor的factory
+func (c *Client) ProcessorFactory(info ProcessorInfo) processor.Factory {
+	return processor.NewFactory(info.SampleConfig, info.Description, func(config string) (processor.Processor, error) {
+		return c.newProcessor(info.Name, config)
+	})
+}
+
+// ComponentFactory 创建插件进程中的component的factory
+func (c *Client) ComponentFactory(info ComponentInfo) component.Factory {
+	return component.NewFactory(info.SampleConfig, info.Description, func(config string) (component.Component, error) {
+		return c.newComponent(info.Name, config)
+	})
+}
+
+func (c *Client) start() error {
+	hs := &handshakeWriter{line: make(chan string, 1), out: os.Stdout}
+
+	cmd := exec.Command(c.path)
+	cmd.Env = append(os.Environ(), MagicCookieKey+"="+MagicCookieValue)
+	cmd.Stdout = hs
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		reason := "exit status 0"
+		if err := cmd.Wait(); err != nil {
+			reason = err.Error()
+		}
+		c.lock.Lock()
+		c.lastError = reason
+		c.lock.Unlock()
+		close(exited)
+	}()
+
+	var line string
+	select {
+	case line = <-hs.line:
+	case <-exited:
+		return fmt.Errorf("Plugin(%s) exited before handshake", c.path)
+	case <-time.After(handshakeTimeout):
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("Plugin(%s) handshake timeout after %s", c.path, handshakeTimeout)
+	}
+
+	target, err := parseHandshake(line)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return fmt.Errorf("Plugin(%s): %v", c.path, err)
+	}
+
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(jsonCodec{})),
+	)
+	if err != nil {
+		_ = cmd.Process.Kill()
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		_ = conn.Close()
+		_ = cmd.Process.Kill()
+		return ErrClosed
+	}
+
+	c.cmd = cmd
+	c.stdin = stdin
+	c.conn = conn
+	c.exited = exited
+	c.startTime = time.Now()
+	c.generation++
+	return nil
+}
+
+func parseHandshake(line string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 4 || parts[0] != handshakePrefix {
+		return "", fmt.Errorf("Invalid handshake: %s", line)
+	}
+
+	version, err := strconv.Atoi(parts[1])
+	if err != nil || version != ProtocolVersion {
+		return "", fmt.Errorf("Incompatible plugin protocol version: %s, expected: %d", parts[1], ProtocolVersion)
+	}
+
+	switch parts[2] {
+	case "unix":
+		return "unix://" + parts[3], nil
+	case "tcp":
+		return parts[3], nil
+	default:
+		return "", fmt.Errorf("Unsupported network: %s", parts[2])
+	}
+}
+
+// supervise 插件进程退出后将其重启, 直到插件被关闭
+func (c *Client) supervise() {
+	var failures uint
+	for {
+		c.lock.Lock()
+		exited, startTime := c.exited, c.startTime
+		c.lock.Unlock()
+
+		select {
+		case <-exited:
+		case <-c.done:
+			return
+		}
+
+		c.lock.Lock()
+		if c.closed {
+			c.lock.Unlock()
+			return
+		}
+		_ = c.conn.Close()
+		c.conn = nil
+		lastError := c.lastError
+		c.lock.Unlock()
+
+		if time.Since(startTime) > stableTime {
+			failures = 0
+		}
+
+		for {
+			backoff := minRestartBackoff << failures
+			if backoff > maxRestartBackoff || backoff <= 0 {
+				backoff = maxRestartBackoff
+			} else {
+				failures++
+			}
+
+			log.Error("Plugin(%s) exited: %s, restarting after %s", c.path, lastError, backoff)
+			select {
+			case <-time.After(backoff):
+			case <-c.done:
+				return
+			}
+
+			err := c.start()
+			if err == nil {
+				break
+			}
+			lastError = err.Error()
+		}
+
+		c.lock.Lock()
+		c.restarts++
+		var comps []*Component
+		for comp := range c.components {
+			comps = append(comps, comp)
+		}
+		c.lock.Unlock()
+
+		for _, comp := range comps {
+			if err := comp.restore(); err != nil {
+				log.Error("Plugin(%s) failed to restore component %s: %v", c.path, comp.name, err)
+			}
+		}
+	}
+}
+
+// Close 关闭插件进程的标准输入通知其退出, 超时后强制结束
+func (c *Client) Close() {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return
+	}
+	c.closed = true
+	close(c.done)
+	cmd, stdin, conn, exited := c.cmd, c.stdin, c.conn, c.exited
+	c.lock.Unlock()
+
+	if conn != nil {
+		_ = conn.Close()
+	}
+	if stdin != nil {
+		_ = stdin.Close()
+	}
+
+	if exited != nil {
+		select {
+		case <-exited:
+		case <-time.After(stopTimeout):
+			_ = cmd.Process.Kill()
+			<-exited
+		}
+	}
+
+	clientsLock.Lock()
+	for i, e := range clients {
+		if e == c {
+			clients = append(clients[:i], clients[i+1:]...)
+			break
+		}
+	}
+	clientsLock.Unlock()
+}
+
+// invoke 调用插件进程中的方法, 插件正在重启时直接返回错误
+func (c *Client) invoke(ctx context.Context, method string, req, resp interface{}) error {
+	conn, _, err := c.current()
+	if err != nil {
+		return err
+	}
+	return conn.Invoke(ctx, fullMethod(method), req, resp)
+}
+
+// current 返回当前插件进程的连接和代数, 每次重启代数加一
+func (c *Client) current() (*grpc.ClientConn, int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed {
+		return nil, 0, ErrClosed
+	}
+	if c.conn == nil {
+		return nil, 0, fmt.Errorf("Plugin(%s) is restarting", c.path)
+	}
+	return c.conn, c.generation, nil
+}
+
+func (c *Client) Path() string {
+	return c.path
+}
+
+func (c *Client) OpenTime() time.Time {
+	return c.openTime
+}
+
+func (c *Client) Processors() []ProcessorInfo {
+	return c.info.Processors
+}
+
+func (c *Client) Components() []ComponentInfo {
+	return c.info.Components
+}
+
+// PID 插件进程的pid, 插件正在重启或者已经关闭时返回0
+func (c *Client) PID() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.closed || c.conn == nil {
+		return 0
+	}
+	return c.cmd.Process.Pid
+}
+
+// Restarts 插件进程被重启的次数
+func (c *Client) Restarts() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.restarts
+}
+
+// handshakeWriter 截取插件标准输出的第一行作为握手信息, 之后的输出转发给out
+type handshakeWriter struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+	done bool
+	line chan string
+	out  io.Writer
+}
+
+func (w *handshakeWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.done {
+		return w.out.Write(p)
+	}
+
+	w.buf.Write(p)
+	i := bytes.IndexByte(w.buf.Bytes(), '\n')
+	if i < 0 {
+		return len(p), nil
+	}
+
+	w.done = true
+	w.line <- string(w.buf.Next(i + 1))
+	if w.buf.Len() > 0 {
+		_, _ = w.out.Write(w.buf.Bytes())
+	}
+	return len(p), nil
+}
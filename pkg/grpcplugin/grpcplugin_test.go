@@ -0,0 +1,226 @@
+package grpcplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+// 测试二进制以插件的方式被启动时, 作为插件进程提供服务
+func TestMain(m *testing.M) {
+	if os.Getenv(MagicCookieKey) == MagicCookieValue {
+		if err := Serve(testServeConfig()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	code := m.Run()
+	CloseAll()
+	os.Exit(code)
+}
+
+type upperRequest struct {
+	Ctx     context.Context   `inject:"Context"`
+	Message []byte            `inject:"Message"`
+	Params  map[string]string `inject:"Params"`
+}
+
+type upperResponse struct {
+	Upper string `inject:"Upper"`
+}
+
+type counter struct {
+	lock sync.Mutex
+	n    int
+}
+
+func (c *counter) Add(n int) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.n += n
+	return c.n
+}
+
+type countRequest struct {
+	Counter *counter `inject:"MyCounter"`
+}
+
+type countResponse struct {
+	Count int `inject:"Count"`
+}
+
+func testServeConfig() ServeConfig {
+	return ServeConfig{
+		Processors: map[string]processor.Factory{
+			"grpcplugin_test_upper": processor.NewFactoryWithProcessor("", "upper case the message",
+				func(req upperRequest) (upperResponse, error) {
+					if req.Ctx == nil {
+						return upperResponse{}, errors.New("missing context")
+					}
+					if len(req.Message) == 0 {
+						return upperResponse{}, errors.New("empty message")
+					}
+					return upperResponse{Upper: strings.ToUpper(string(req.Message)) + req.Params["suffix"]}, nil
+				}),
+			"grpcplugin_test_panic": processor.NewFactoryWithProcessor("", "", func(req upperRequest) error {
+				panic("boom")
+			}),
+			"grpcplugin_test_crash": processor.NewFactoryWithProcessor("", "", func(req upperRequest) error {
+				os.Exit(2)
+				return nil
+			}),
+			"grpcplugin_test_count": processor.NewFactoryWithProcessor("", "", func(req countRequest) countResponse {
+				return countResponse{Count: req.Counter.Add(1)}
+			}),
+		},
+		Components: map[string]component.Factory{
+			"grpcplugin_test_counter": component.NewFactory("Name: MyCounter", "counter",
+				func(string) (component.Component, error) {
+					return nezhatest.NewComponent("MyCounter", &counter{}, nil), nil
+				}),
+		},
+	}
+}
+
+var (
+	openOnce   sync.Once
+	testClient *Client
+	openErr    error
+)
+
+func openTestPlugin(t *testing.T) *Client {
+	openOnce.Do(func() {
+		testClient, openErr = Start(os.Args[0])
+		if openErr != nil {
+			return
+		}
+		for _, info := range testClient.Processors() {
+			if openErr = processor.Register(info.Name, testClient.ProcessorFactory(info)); openErr != nil {
+				return
+			}
+		}
+		for _, info := range testClient.Components() {
+			if openErr = component.Register(info.Name, testClient.ComponentFactory(info)); openErr != nil {
+				return
+			}
+		}
+	})
+	assert.NilError(t, openErr)
+	return testClient
+}
+
+func newTestProcessor(t *testing.T, name string) processor.Processor {
+	openTestPlugin(t)
+	f, err := processor.GetFactory(name)
+	assert.NilError(t, err)
+	p, err := f.New("")
+	assert.NilError(t, err)
+	return p
+}
+
+func TestProcess(t *testing.T) {
+	c := openTestPlugin(t)
+	assert.Equal(t, len(c.Processors()), 4)
+	assert.Equal(t, len(c.Components()), 1)
+
+	p := newTestProcessor(t, "grpcplugin_test_upper")
+	h := nezhatest.New(t).WithParams(map[string]string{"suffix": "!"})
+
+	res := h.Run(p, struct {
+		Message []byte `inject:"Message"`
+	}{Message: []byte("hello")})
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.FieldByName("Upper").String(), "HELLO!")
+
+	res = h.Run(p, struct {
+		Message []byte `inject:"Message"`
+	}{})
+	assert.ErrorContains(t, res.Err, "empty message")
+}
+
+func TestRelease(t *testing.T) {
+	p := newTestProcessor(t, "grpcplugin_test_upper")
+	fn, release := pipeline.UnwrapProcessor(p)
+	assert.Assert(t, release != nil)
+
+	// 释放之后插件进程中的实例不再存在
+	assert.NilError(t, release())
+	res := nezhatest.New(t).Run(fn, struct {
+		Message []byte `inject:"Message"`
+	}{Message: []byte("hello")})
+	assert.ErrorContains(t, res.Err, "not found")
+}
+
+func TestPanicIsolation(t *testing.T) {
+	c := openTestPlugin(t)
+	pid := c.PID()
+
+	res := nezhatest.New(t).Run(newTestProcessor(t, "grpcplugin_test_panic"), struct {
+		Message []byte `inject:"Message"`
+	}{Message: []byte("hello")})
+	assert.ErrorContains(t, res.Err, "boom")
+	assert.Equal(t, c.PID(), pid)
+}
+
+func TestRestart(t *testing.T) {
+	c := openTestPlugin(t)
+	restarts := c.Restarts()
+
+	h := nezhatest.New(t)
+	counter := mustNewComponent(t, "grpcplugin_test_counter")
+	h.Use(counter)
+	count := newTestProcessor(t, "grpcplugin_test_count")
+
+	res := h.Run(count)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.FieldByName("Count").Int(), int64(1))
+
+	input := struct {
+		Message []byte `inject:"Message"`
+	}{Message: []byte("hello")}
+	res = h.Run(newTestProcessor(t, "grpcplugin_test_crash"), input)
+	assert.Assert(t, res.Err != nil)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for c.Restarts() == restarts && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, c.Restarts(), restarts+1)
+
+	res = h.Run(newTestProcessor(t, "grpcplugin_test_upper"), input)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.FieldByName("Upper").String(), "HELLO")
+
+	// component在重启后被重新创建, 计数从头开始
+	res = h.Run(count)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.FieldByName("Count").Int(), int64(1))
+
+	var n int
+	assert.NilError(t, counter.(Caller).Call(context.Background(), "Add", 2, &n))
+	assert.Equal(t, n, 3)
+}
+
+func mustNewComponent(t *testing.T, name string) component.Component {
+	openTestPlugin(t)
+	f, err := component.GetFactory(name)
+	assert.NilError(t, err)
+	c, err := f.New("")
+	assert.NilError(t, err)
+	assert.Equal(t, c.Instance().Name(), "MyCounter")
+	assert.Equal(t, c.Instance().Type(), reflect.TypeOf((*Caller)(nil)).Elem())
+	return c
+}
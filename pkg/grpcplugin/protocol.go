@@ -0,0 +1,281 @@
+// Package grpcplugin 以独立进程的方式运行插件中的processor和component, 通过gRPC与nezha通信
+//
+// 与go的.so插件不同, gRPC插件是一个普通的可执行文件, 不要求与nezha使用相同的go版本和依赖版本,
+// 插件进程崩溃后会被nezha重新拉起, 不会影响nezha进程本身. 插件在main函数中调用Serve:
+//
+//	func main() {
+//		err := grpcplugin.Serve(grpcplugin.ServeConfig{
+//			Processors: map[string]processor.Factory{"my_processor": factory},
+//		})
+//		if err != nil {
+//			log.Fatal(err)
+//		}
+//	}
+//
+// processor的inject字段在进程之间以json的形式传递, 因此输入输出必须是可以json序列化的类型.
+// component只在插件进程中存在, 在nezha中以Caller的形式注入, 传递给同一个插件的processor时会还原成原始的实例.
+package grpcplugin
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/shima-park/lotus/common/inject"
+	"google.golang.org/grpc"
+)
+
+const (
+	// ProtocolVersion 插件协议版本, 握手时不一致的插件会被拒绝
+	ProtocolVersion = 1
+
+	// MagicCookieKey MagicCookieValue 由nezha设置到插件进程的环境变量中,
+	// 用于确认插件是被nezha启动的而不是被直接执行
+	MagicCookieKey   = "NEZHA_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "d3f1b0e0-nezha-grpc-plugin"
+
+	// 插件启动后在标准输出打印的第一行: nezha-plugin|协议版本|network|address
+	handshakePrefix = "nezha-plugin"
+
+	serviceName = "nezha.plugin.Plugin"
+)
+
+// Field processor的一个inject字段
+type Field struct {
+	Name string `json:"name"`
+	// go类型, 例如[]uint8, map[string]string
+	Type string `json:"type"`
+}
+
+type ProcessorInfo struct {
+	Name         string `json:"name"`
+	SampleConfig string `json:"sample_config"`
+	Description  string `json:"description"`
+}
+
+type ComponentInfo struct {
+	Name         string `json:"name"`
+	SampleConfig string `json:"sample_config"`
+	Description  string `json:"description"`
+}
+
+type Empty struct{}
+
+type DescribeResponse struct {
+	ProtocolVersion int             `json:"protocol_version"`
+	Processors      []ProcessorInfo `json:"processors"`
+	Components      []ComponentInfo `json:"components"`
+}
+
+type NewRequest struct {
+	Name   string `json:"name"`
+	Config string `json:"config"`
+}
+
+type NewProcessorResponse struct {
+	ID      string  `json:"id"`
+	Inputs  []Field `json:"inputs"`
+	Outputs []Field `json:"outputs"`
+}
+
+type NewComponentResponse struct {
+	ID           string `json:"id"`
+	InstanceName string `json:"instance_name"`
+	InstanceType string `json:"instance_type"`
+}
+
+type HandleRequest struct {
+	ID string `json:"id"`
+}
+
+type ProcessRequest struct {
+	ID     string                     `json:"id"`
+	Inputs map[string]json.RawMessage `json:"inputs"`
+}
+
+type ProcessResponse struct {
+	Outputs map[string]json.RawMessage `json:"outputs"`
+	// processor返回的错误, 与调用失败区分开
+	Error string `json:"error"`
+}
+
+type CallRequest struct {
+	ID     string          `json:"id"`
+	Method string          `json:"method"`
+	Args   json.RawMessage `json:"args"`
+}
+
+type CallResponse struct {
+	Reply json.RawMessage `json:"reply"`
+	Error string          `json:"error"`
+}
+
+// componentRef component实例跨进程传递时的句柄
+type componentRef struct {
+	ID string `json:"$nezha_component"`
+}
+
+// jsonCodec 使用json作为gRPC的编码, 插件不需要依赖protobuf生成的代码
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func fullMethod(method string) string {
+	return "/" + serviceName + "/" + method
+}
+
+func methodDesc(method string, newReq func() interface{},
+	call func(s *server, ctx context.Context, req interface{}) (interface{}, error)) grpc.MethodDesc {
+	return grpc.MethodDesc{
+		MethodName: method,
+		Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+			req := newReq()
+			if err := dec(req); err != nil {
+				return nil, err
+			}
+
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return call(srv.(*server), ctx, req)
+			}
+			if interceptor == nil {
+				return handler(ctx, req)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: fullMethod(method)}
+			return interceptor(ctx, req, info, handler)
+		},
+	}
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*interface{})(nil),
+	Methods: []grpc.MethodDesc{
+		methodDesc("Describe", func() interface{} { return &Empty{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.describe(), nil
+			}),
+		methodDesc("NewProcessor", func() interface{} { return &NewRequest{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.newProcessor(req.(*NewRequest))
+			}),
+		methodDesc("Process", func() interface{} { return &ProcessRequest{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.process(ctx, req.(*ProcessRequest))
+			}),
+		methodDesc("CloseProcessor", func() interface{} { return &HandleRequest{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return &Empty{}, s.closeProcessor(req.(*HandleRequest))
+			}),
+		methodDesc("NewComponent", func() interface{} { return &NewRequest{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.newComponent(req.(*NewRequest))
+			}),
+		methodDesc("StartComponent", func() interface{} { return &HandleRequest{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return &Empty{}, s.startComponent(req.(*HandleRequest))
+			}),
+		methodDesc("StopComponent", func() interface{} { return &HandleRequest{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return &Empty{}, s.stopComponent(req.(*HandleRequest))
+			}),
+		methodDesc("Call", func() interface{} { return &CallRequest{} },
+			func(s *server, ctx context.Context, req interface{}) (interface{}, error) {
+				return s.call(ctx, req.(*CallRequest))
+			}),
+	},
+}
+
+var (
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+	contextType = inject.InterfaceOf((*context.Context)(nil))
+	anyType     = reflect.TypeOf((*interface{})(nil)).Elem()
+	rawType     = reflect.TypeOf(json.RawMessage(nil))
+
+	// 在nezha中可以还原的类型, 其他类型的输入以interface{}注入, 输出以json.RawMessage注入
+	basicTypes = map[string]reflect.Type{}
+)
+
+func init() {
+	for _, v := range []interface{}{
+		"", []byte(nil), false, int(0), int32(0), int64(0), uint(0), uint32(0), uint64(0),
+		float32(0), float64(0), []string(nil), []interface{}(nil),
+		map[string]string(nil), map[string]interface{}(nil),
+		json.RawMessage(nil), time.Time{}, time.Duration(0),
+	} {
+		t := reflect.TypeOf(v)
+		basicTypes[t.String()] = t
+	}
+	basicTypes[contextType.String()] = contextType
+}
+
+type field struct {
+	name string
+	typ  reflect.Type
+}
+
+func isInjectField(f reflect.StructField) bool {
+	return f.Tag == "inject" || f.Tag.Get("inject") != ""
+}
+
+func injectName(f reflect.StructField) string {
+	if name := f.Tag.Get("inject"); name != "" {
+		return name
+	}
+	return f.Name
+}
+
+func structFields(t reflect.Type) []field {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []field
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); isInjectField(f) {
+			fields = append(fields, field{name: injectName(f), typ: f.Type})
+		}
+	}
+	return fields
+}
+
+// inputFields processor参数中需要注入的字段
+func inputFields(fn reflect.Type) []field {
+	var fields []field
+	for i := 0; i < fn.NumIn(); i++ {
+		fields = append(fields, structFields(fn.In(i))...)
+	}
+	return fields
+}
+
+// outputFields processor返回值中会被注入到下游的字段
+func outputFields(fn reflect.Type) []field {
+	var fields []field
+	for i := 0; i < fn.NumOut(); i++ {
+		if fn.Out(i) != errorType {
+			fields = append(fields, structFields(fn.Out(i))...)
+		}
+	}
+	return fields
+}
+
+func toFields(fields []field) []Field {
+	res := make([]Field, 0, len(fields))
+	for _, f := range fields {
+		res = append(res, Field{Name: f.name, Type: f.typ.String()})
+	}
+	return res
+}
@@ -0,0 +1,360 @@
+package grpcplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+)
+
+// Caller 调用插件进程中component实例的方法, gRPC插件的component在nezha中以Caller注入
+type Caller interface {
+	// Call 以json序列化args, 调用实例的method方法并将返回值反序列化到reply中
+	Call(ctx context.Context, method string, args, reply interface{}) error
+}
+
+var callerType = inject.InterfaceOf((*Caller)(nil))
+
+// remoteProcessor nezha中代理插件进程中的processor, 以reflect.MakeFunc生成与插件的processor
+// 注入字段相同的函数, 插件重启之后会在下一次调用时重新创建
+type remoteProcessor struct {
+	client  *Client
+	name    string
+	config  string
+	inputs  []Field
+	outputs []Field
+	out     reflect.Type
+
+	lock       sync.Mutex
+	id         string
+	generation int
+}
+
+func (c *Client) newProcessor(name, config string) (processor.Processor, error) {
+	p := &remoteProcessor{client: c, name: name, config: config}
+
+	p.lock.Lock()
+	resp, err := p.create(context.Background())
+	p.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	p.inputs, p.outputs = resp.Inputs, resp.Outputs
+	in := buildStruct(resp.Inputs, true)
+	p.out = buildStruct(resp.Outputs, false)
+
+	// pipeline停止时释放插件进程中的实例
+	fn := reflect.FuncOf([]reflect.Type{in}, []reflect.Type{p.out, errorType}, false)
+	return pipeline.WithClose(reflect.MakeFunc(fn, p.call).Interface(), p.release), nil
+}
+
+// create 在插件进程中创建processor实例, 调用方需要持有锁
+func (p *remoteProcessor) create(ctx context.Context) (*NewProcessorResponse, error) {
+	conn, generation, err := p.client.current()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp NewProcessorResponse
+	err = conn.Invoke(ctx, fullMethod("NewProcessor"), &NewRequest{Name: p.name, Config: p.config}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	p.id, p.generation = resp.ID, generation
+	return &resp, nil
+}
+
+// handle 返回当前插件进程中的实例id
+func (p *remoteProcessor) handle(ctx context.Context) (string, error) {
+	_, generation, err := p.client.current()
+	if err != nil {
+		return "", err
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.generation == generation {
+		return p.id, nil
+	}
+
+	resp, err := p.create(ctx)
+	if err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+// release 释放插件进程中的实例, 插件已经关闭或者重启之后实例已经不存在, 不需要释放
+func (p *remoteProcessor) release() error {
+	conn, generation, err := p.client.current()
+	if err != nil {
+		return nil
+	}
+
+	p.lock.Lock()
+	id, current := p.id, p.generation == generation
+	p.lock.Unlock()
+	if !current {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	if err := conn.Invoke(ctx, fullMethod("CloseProcessor"), &HandleRequest{ID: id}, &Empty{}); err != nil {
+		return fmt.Errorf("Failed to release processor %s in plugin %s: %v", p.name, p.client.Path(), err)
+	}
+	return nil
+}
+
+func (p *remoteProcessor) call(args []reflect.Value) []reflect.Value {
+	ctx := context.Background()
+	inputs := map[string]json.RawMessage{}
+	for i, f := range p.inputs {
+		v := args[0].Field(i)
+		if v.Type() == contextType {
+			if !v.IsNil() {
+				ctx = v.Interface().(context.Context)
+			}
+			continue
+		}
+
+		data, err := json.Marshal(v.Interface())
+		if err != nil {
+			return p.fail(fmt.Errorf("Failed to encode %s(%s): %v", f.Name, v.Type(), err))
+		}
+		inputs[f.Name] = data
+	}
+
+	outputs, err := p.process(ctx, inputs)
+	if err != nil {
+		return p.fail(err)
+	}
+
+	out := reflect.New(p.out).Elem()
+	for i, f := range p.outputs {
+		raw, ok := outputs[f.Name]
+		if !ok {
+			continue
+		}
+
+		ptr := reflect.New(out.Field(i).Type())
+		if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+			return p.fail(fmt.Errorf("Failed to decode %s(%s): %v", f.Name, f.Type, err))
+		}
+		out.Field(i).Set(ptr.Elem())
+	}
+	return []reflect.Value{out, reflect.Zero(errorType)}
+}
+
+func (p *remoteProcessor) process(ctx context.Context, inputs map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	id, err := p.handle(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ProcessResponse
+	if err := p.client.invoke(ctx, "Process", &ProcessRequest{ID: id, Inputs: inputs}, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+	return resp.Outputs, nil
+}
+
+func (p *remoteProcessor) fail(err error) []reflect.Value {
+	return []reflect.Value{reflect.New(p.out).Elem(), reflect.ValueOf(&err).Elem()}
+}
+
+// buildStruct 根据插件processor的注入字段构造参数或者返回值的结构体
+// 无法在nezha中还原的类型, 作为参数时以interface{}注入, 作为返回值时以json.RawMessage注入
+func buildStruct(fields []Field, input bool) reflect.Type {
+	var sfs []reflect.StructField
+	used := map[string]bool{}
+	for i, f := range fields {
+		t, ok := basicTypes[f.Type]
+		switch {
+		case !ok && input:
+			t = anyType
+		case !ok || t == contextType && !input:
+			t = rawType
+		}
+
+		name := fieldName(f.Name)
+		if used[name] {
+			name += strconv.Itoa(i)
+		}
+		used[name] = true
+
+		sfs = append(sfs, reflect.StructField{
+			Name: name,
+			Type: t,
+			Tag:  reflect.StructTag("inject:" + strconv.Quote(f.Name)),
+		})
+	}
+	return reflect.StructOf(sfs)
+}
+
+// fieldName 将注入名称转换成可导出的字段名, 依赖检查失败时会显示字段名
+func fieldName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "F" + s
+	}
+	r := []rune(s)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// Component nezha中代理插件进程中的component, 插件重启后会被重新创建, 之前启动过的会被重新启动
+type Component struct {
+	client   *Client
+	name     string
+	config   string
+	instance component.Instance
+
+	lock       sync.Mutex
+	id         string
+	generation int
+	started    bool
+}
+
+var (
+	_ component.Component = &Component{}
+	_ Caller              = &Component{}
+)
+
+func (c *Client) newComponent(name, config string) (component.Component, error) {
+	comp := &Component{client: c, name: name, config: config}
+
+	comp.lock.Lock()
+	resp, err := comp.create()
+	comp.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	comp.instance = component.NewInstance(resp.InstanceName, callerType, reflect.ValueOf(comp), comp)
+
+	c.lock.Lock()
+	c.components[comp] = struct{}{}
+	c.lock.Unlock()
+	return comp, nil
+}
+
+// create 在插件进程中创建component实例, 调用方需要持有锁
+func (c *Component) create() (*NewComponentResponse, error) {
+	conn, generation, err := c.client.current()
+	if err != nil {
+		return nil, err
+	}
+
+	var resp NewComponentResponse
+	err = conn.Invoke(context.Background(), fullMethod("NewComponent"), &NewRequest{Name: c.name, Config: c.config}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	c.id, c.generation = resp.ID, generation
+	return &resp, nil
+}
+
+// restore 插件重启后重新创建实例, 之前启动过的会被重新启动
+func (c *Component) restore() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if _, err := c.create(); err != nil {
+		return err
+	}
+
+	if c.started {
+		return c.client.invoke(context.Background(), "StartComponent", &HandleRequest{ID: c.id}, &Empty{})
+	}
+	return nil
+}
+
+func (c *Component) Instance() component.Instance {
+	return c.instance
+}
+
+func (c *Component) Start() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	err := c.client.invoke(context.Background(), "StartComponent", &HandleRequest{ID: c.id}, &Empty{})
+	if err != nil {
+		return err
+	}
+	c.started = true
+	return nil
+}
+
+func (c *Component) Stop() error {
+	c.client.lock.Lock()
+	delete(c.client.components, c)
+	c.client.lock.Unlock()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.started = false
+	return c.client.invoke(context.Background(), "StopComponent", &HandleRequest{ID: c.id}, &Empty{})
+}
+
+func (c *Component) Call(ctx context.Context, method string, args, reply interface{}) error {
+	var data []byte
+	if args != nil {
+		var err error
+		data, err = json.Marshal(args)
+		if err != nil {
+			return err
+		}
+	}
+
+	c.lock.Lock()
+	id := c.id
+	c.lock.Unlock()
+
+	var resp CallResponse
+	err := c.client.invoke(ctx, "Call", &CallRequest{ID: id, Method: method, Args: data}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+
+	if reply != nil && len(resp.Reply) > 0 {
+		return json.Unmarshal(resp.Reply, reply)
+	}
+	return nil
+}
+
+// MarshalJSON 传递给插件的processor时只传递句柄, 在插件进程中还原成原始的实例
+func (c *Component) MarshalJSON() ([]byte, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return json.Marshal(componentRef{ID: c.id})
+}
@@ -0,0 +1,406 @@
+package grpcplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ServeConfig 插件提供的processor和component工厂, key为注册到nezha中的名称
+type ServeConfig struct {
+	Processors map[string]processor.Factory
+	Components map[string]component.Factory
+}
+
+// Serve 启动插件的gRPC服务并阻塞, 直到nezha关闭插件进程的标准输入
+// 返回前会停止所有已经启动的component并关闭所有processor
+func Serve(conf ServeConfig) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return errors.New("This binary is a nezha plugin, it is not meant to be executed directly, " +
+			"please add it to nezha by: nezha add plugin PATH")
+	}
+
+	dir, err := ioutil.TempDir("", "nezha-plugin")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	lis, err := net.Listen("unix", filepath.Join(dir, "plugin.sock"))
+	if err != nil {
+		return err
+	}
+
+	s := newServer(conf)
+	defer s.close()
+
+	srv := grpc.NewServer(
+		grpc.ForceServerCodec(jsonCodec{}),
+		grpc.UnaryInterceptor(recoverInterceptor),
+	)
+	srv.RegisterService(&serviceDesc, s)
+
+	// nezha退出或者关闭插件时会关闭标准输入
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, os.Stdin)
+		srv.Stop()
+	}()
+
+	fmt.Printf("%s|%d|%s|%s\n", handshakePrefix, ProtocolVersion, lis.Addr().Network(), lis.Addr().String())
+
+	return srv.Serve(lis)
+}
+
+// recoverInterceptor 将processor和component中的panic转换成错误返回, 避免插件进程退出
+func recoverInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = status.Errorf(codes.Internal, "%s panic: %v\n%s", info.FullMethod, r, debug.Stack())
+		}
+	}()
+	return handler(ctx, req)
+}
+
+type server struct {
+	conf ServeConfig
+
+	lock       sync.Mutex
+	seq        int64
+	processors map[string]processor.Processor
+	closers    map[string]func() error // processor由pipeline.WithClose创建时的关闭函数
+	components map[string]component.Component
+	started    map[string]bool
+}
+
+func newServer(conf ServeConfig) *server {
+	return &server{
+		conf:       conf,
+		processors: map[string]processor.Processor{},
+		closers:    map[string]func() error{},
+		components: map[string]component.Component{},
+		started:    map[string]bool{},
+	}
+}
+
+func (s *server) nextID() string {
+	s.seq++
+	return strconv.FormatInt(s.seq, 10)
+}
+
+func (s *server) describe() *DescribeResponse {
+	res := &DescribeResponse{ProtocolVersion: ProtocolVersion}
+	for name, f := range s.conf.Processors {
+		res.Processors = append(res.Processors, ProcessorInfo{
+			Name:         name,
+			SampleConfig: f.SampleConfig(),
+			Description:  f.Description(),
+		})
+	}
+	for name, f := range s.conf.Components {
+		res.Components = append(res.Components, ComponentInfo{
+			Name:         name,
+			SampleConfig: f.SampleConfig(),
+			Description:  f.Description(),
+		})
+	}
+	sort.Slice(res.Processors, func(i, j int) bool { return res.Processors[i].Name < res.Processors[j].Name })
+	sort.Slice(res.Components, func(i, j int) bool { return res.Components[i].Name < res.Components[j].Name })
+	return res
+}
+
+func (s *server) newProcessor(req *NewRequest) (*NewProcessorResponse, error) {
+	f, ok := s.conf.Processors[req.Name]
+	if !ok {
+		return nil, fmt.Errorf("No such processor type exist: '%s'", req.Name)
+	}
+
+	p, err := f.New(req.Config)
+	if err != nil {
+		return nil, err
+	}
+	p, closer := pipeline.UnwrapProcessor(p)
+	if err := processor.Validate(p); err != nil {
+		if closer != nil {
+			_ = closer()
+		}
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := s.nextID()
+	s.processors[id] = p
+	if closer != nil {
+		s.closers[id] = closer
+	}
+
+	fn := reflect.TypeOf(p)
+	return &NewProcessorResponse{
+		ID:      id,
+		Inputs:  toFields(inputFields(fn)),
+		Outputs: toFields(outputFields(fn)),
+	}, nil
+}
+
+func (s *server) closeProcessor(req *HandleRequest) error {
+	s.lock.Lock()
+	closer := s.closers[req.ID]
+	delete(s.processors, req.ID)
+	delete(s.closers, req.ID)
+	s.lock.Unlock()
+
+	if closer == nil {
+		return nil
+	}
+	return closer()
+}
+
+func (s *server) process(ctx context.Context, req *ProcessRequest) (*ProcessResponse, error) {
+	s.lock.Lock()
+	p, ok := s.processors[req.ID]
+	s.lock.Unlock()
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Processor(%s) not found", req.ID)
+	}
+
+	inj := inject.New()
+	inj.MapTo(ctx, "Context", (*context.Context)(nil))
+	for _, f := range inputFields(reflect.TypeOf(p)) {
+		raw, ok := req.Inputs[f.name]
+		if !ok {
+			continue
+		}
+
+		v, err := s.decode(raw, f.typ)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode %s(%s): %v", f.name, f.typ, err)
+		}
+		inj.Set(f.typ, f.name, v)
+	}
+
+	results, err := inj.Invoke(p)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ProcessResponse{Outputs: map[string]json.RawMessage{}}
+	for _, result := range results {
+		if result.Type() == errorType {
+			if !result.IsNil() {
+				res.Error = result.Interface().(error).Error()
+			}
+			continue
+		}
+
+		for result.Kind() == reflect.Ptr {
+			if result.IsNil() {
+				break
+			}
+			result = result.Elem()
+		}
+		if result.Kind() != reflect.Struct {
+			continue
+		}
+
+		for i := 0; i < result.NumField(); i++ {
+			sf := result.Type().Field(i)
+			if !isInjectField(sf) {
+				continue
+			}
+
+			data, err := json.Marshal(result.Field(i).Interface())
+			if err != nil {
+				return nil, fmt.Errorf("Failed to encode %s(%s): %v", injectName(sf), sf.Type, err)
+			}
+			res.Outputs[injectName(sf)] = data
+		}
+	}
+	return res, nil
+}
+
+// decode 将json解码成类型t, component的句柄会被还原成插件进程中的实例
+func (s *server) decode(raw json.RawMessage, t reflect.Type) (reflect.Value, error) {
+	var ref componentRef
+	if json.Unmarshal(raw, &ref) == nil && ref.ID != "" {
+		s.lock.Lock()
+		c, ok := s.components[ref.ID]
+		s.lock.Unlock()
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("component(%s) not found", ref.ID)
+		}
+
+		v := c.Instance().Value()
+		if !v.Type().AssignableTo(t) {
+			return reflect.Value{}, fmt.Errorf("component %s(%s) is not assignable", c.Instance().Name(), v.Type())
+		}
+		return v, nil
+	}
+
+	ptr := reflect.New(t)
+	if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr.Elem(), nil
+}
+
+func (s *server) newComponent(req *NewRequest) (*NewComponentResponse, error) {
+	f, ok := s.conf.Components[req.Name]
+	if !ok {
+		return nil, fmt.Errorf("No such component type exist: '%s'", req.Name)
+	}
+
+	c, err := f.New(req.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := s.nextID()
+	s.components[id] = c
+	return &NewComponentResponse{
+		ID:           id,
+		InstanceName: c.Instance().Name(),
+		InstanceType: c.Instance().Type().String(),
+	}, nil
+}
+
+func (s *server) component(id string) (component.Component, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	c, ok := s.components[id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "Component(%s) not found", id)
+	}
+	return c, nil
+}
+
+func (s *server) startComponent(req *HandleRequest) error {
+	c, err := s.component(req.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	s.started[req.ID] = true
+	s.lock.Unlock()
+	return nil
+}
+
+// stopComponent 停止并释放component
+func (s *server) stopComponent(req *HandleRequest) error {
+	c, err := s.component(req.ID)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	started := s.started[req.ID]
+	delete(s.components, req.ID)
+	delete(s.started, req.ID)
+	s.lock.Unlock()
+
+	if !started {
+		return nil
+	}
+	return c.Stop()
+}
+
+// call 通过反射调用component实例的方法, 方法的签名可以是:
+// func([context.Context], [Args]) ([Reply], [error])
+func (s *server) call(ctx context.Context, req *CallRequest) (*CallResponse, error) {
+	c, err := s.component(req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	m := reflect.ValueOf(c.Instance().Interface()).MethodByName(req.Method)
+	if !m.IsValid() {
+		return nil, fmt.Errorf("Component %s has no method %s", c.Instance().Name(), req.Method)
+	}
+
+	mt := m.Type()
+	var in []reflect.Value
+	var args int
+	for i := 0; i < mt.NumIn(); i++ {
+		t := mt.In(i)
+		if t == contextType {
+			in = append(in, reflect.ValueOf(ctx))
+			continue
+		}
+		if args++; args > 1 {
+			return nil, fmt.Errorf("Method %s must have at most one argument besides context.Context", req.Method)
+		}
+
+		arg := reflect.New(t)
+		if len(req.Args) > 0 {
+			if err := json.Unmarshal(req.Args, arg.Interface()); err != nil {
+				return nil, fmt.Errorf("Failed to decode args of %s: %v", req.Method, err)
+			}
+		}
+		in = append(in, arg.Elem())
+	}
+
+	res := &CallResponse{}
+	for _, out := range m.Call(in) {
+		if out.Type() == errorType {
+			if !out.IsNil() {
+				res.Error = out.Interface().(error).Error()
+			}
+			continue
+		}
+
+		res.Reply, err = json.Marshal(out.Interface())
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode reply of %s: %v", req.Method, err)
+		}
+	}
+	return res, nil
+}
+
+// close 停止所有已经启动的component并关闭所有processor
+func (s *server) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for id, closer := range s.closers {
+		if err := closer(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to close processor %s: %v\n", id, err)
+		}
+	}
+	s.closers = map[string]func() error{}
+
+	for id := range s.started {
+		if err := s.components[id].Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to stop component %s: %v\n", s.components[id].Instance().Name(), err)
+		}
+	}
+	s.started = map[string]bool{}
+}
@@ -0,0 +1,61 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/processor"
+)
+
+// closableProcessor 持有需要释放的资源的processor, 由WithClose创建
+type closableProcessor struct {
+	fn    processor.Processor
+	close func() error
+}
+
+// WithClose 包装processor函数fn, pipeline停止时调用close释放fn持有的资源, close只会被调用一次.
+// 用于processor工厂的返回值, 返回值本身不能被调用, 需要先通过UnwrapProcessor取出fn
+func WithClose(fn processor.Processor, close func() error) processor.Processor {
+	var (
+		once sync.Once
+		err  error
+	)
+	return &closableProcessor{
+		fn: fn,
+		close: func() error {
+			once.Do(func() { err = close() })
+			return err
+		},
+	}
+}
+
+// UnwrapProcessor 返回processor函数和它的关闭函数, 不是由WithClose创建时关闭函数为nil
+func UnwrapProcessor(p processor.Processor) (processor.Processor, func() error) {
+	if c, ok := p.(*closableProcessor); ok {
+		return c.fn, c.close
+	}
+	return p, nil
+}
+
+// closeStreams 关闭stream树中所有processor持有的资源
+func closeStreams(pipeName string, stream *Stream) {
+	stream.Walk(func(s *Stream) {
+		if s.closer == nil {
+			return
+		}
+		if err := s.closer(); err != nil {
+			log.Error("Pipeline: %s, Stream: %s, Close processor error: %s", pipeName, s.Name(), err)
+		}
+	})
+}
+
+// closeProcessors 创建pipeline失败时关闭已经创建的processor
+func closeProcessors(processors []Processor) {
+	for _, p := range processors {
+		if _, closer := UnwrapProcessor(p.Processor); closer != nil {
+			if err := closer(); err != nil {
+				log.Error("Processor: %s, Close error: %s", p.Name, err)
+			}
+		}
+	}
+}
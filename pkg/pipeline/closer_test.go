@@ -0,0 +1,49 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCloseOnStop(t *testing.T) {
+	var closed int32
+	var rec joinRecorder
+	root := Processor{Name: "test_close_root", Processor: WithClose(func(r ctxRequest) joinLeft {
+		return joinLeft{Left: "a"}
+	}, func() error {
+		atomic.AddInt32(&closed, 1)
+		return errors.New("close error")
+	})}
+	child := Processor{Name: "test_close_child", Processor: func(r joinLeft) error {
+		rec.add(r.Left)
+		return nil
+	}}
+
+	conf := StreamConfig{Name: root.Name, Childs: []StreamConfig{{Name: child.Name}}}
+	p := newStreamPipeline(t, "test_close", conf, root, child)
+
+	// 对外只暴露processor函数
+	for _, proc := range p.ListProcessors() {
+		assert.Equal(t, reflect.TypeOf(proc.Processor).Kind(), reflect.Func)
+	}
+
+	assert.NilError(t, p.Start())
+	res, err := p.Trigger(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusSucceeded)
+	assert.DeepEqual(t, rec.reset(), []string{"a"})
+	assert.Equal(t, atomic.LoadInt32(&closed), int32(0))
+
+	// 关闭失败只记录日志, 重复停止不会再次关闭
+	p.Stop()
+	p.Stop()
+	assert.Equal(t, atomic.LoadInt32(&closed), int32(1))
+
+	_, closer := UnwrapProcessor(root.Processor)
+	assert.Error(t, closer(), "close error")
+	assert.Equal(t, atomic.LoadInt32(&closed), int32(1))
+}
@@ -0,0 +1,110 @@
+package pipeline
+
+import (
+	"time"
+
+	lotus "github.com/shima-park/lotus/pipeline"
+)
+
+// Config 兼容lotus的pipeline配置, 在此基础上增加了调度相关的策略
+type Config struct {
+	Name     string `yaml:"name"`
+	Schedule string `yaml:"schedule"` // 调度计划，为空时死循环调度，可以传入cron表达式(支持秒)或@every 1m
+	// cron表达式使用的时区, 例如: Asia/Shanghai, 为空时使用本地时区
+	Timezone string `yaml:"timezone,omitempty"`
+	// 每次调度在计划时间的基础上随机延迟[0, jitter), 只能用于cron表达式或者@every
+	Jitter time.Duration `yaml:"jitter,omitempty"`
+	// 上一次运行还未结束时如何处理新的调度: allow, forbid, replace
+	ConcurrencyPolicy ConcurrencyPolicy `yaml:"concurrency_policy,omitempty"`
+	// 服务停机期间错过的调度如何处理: skip, run_once, run_all
+	// 只对bootstrap的pipeline生效, 在进程启动后第一次启动时处理, 手动停止期间错过的调度不会补跑
+	CatchUpPolicy CatchUpPolicy `yaml:"catch_up_policy,omitempty"`
+	// 依赖的上游pipeline, 所有上游运行结束且满足条件后触发本pipeline运行一次
+	// 配置了depends_on且schedule为空时, 只由上游触发
+	DependsOn  []Dependency        `yaml:"depends_on,omitempty"`
+	Bootstrap  bool                `yaml:"bootstrap"`  // 随进程启动而启动
+	Components []map[string]string `yaml:"components"` // key: name, value: rawConfig
+	Processors []map[string]string `yaml:"processors"` // key: name, value: rawConfig
+	Stream     StreamConfig        `yaml:"stream"`     // key: name, value: StreamConfig
+
+	// 组件级别的限流, key: 组件的注入名称, 依赖该组件的所有processor共享同一个令牌桶
+	ComponentRateLimits map[string]RateLimit `yaml:"component_rate_limits,omitempty"`
+}
+
+type DependencyCondition string
+
+const (
+	// 上游运行成功时触发
+	DependencyConditionSuccess DependencyCondition = "success"
+	// 上游运行结束时触发, 不论成功与否
+	DependencyConditionAlways DependencyCondition = "always"
+)
+
+type Dependency struct {
+	Pipeline  string              `yaml:"pipeline"`
+	Condition DependencyCondition `yaml:"condition,omitempty"` // 为空时默认为success
+}
+
+type StreamConfig struct {
+	Name       string         `yaml:"name"`
+	Childs     []StreamConfig `yaml:"childs,omitempty"`
+	Replica    int            `yaml:"replica,omitempty"`     // 节点的worker数, 默认为1
+	BufferSize int            `yaml:"buffer_size,omitempty"` // 节点输入队列的长度, 队列满时上游阻塞等待
+	// 节点的限流, 所有worker共享同一个令牌桶
+	RateLimit *RateLimit `yaml:"rate_limit,omitempty"`
+	// 单次执行的超时时间, 为0时不限制. 超时时取消注入的Context并等待processor返回之后再重试
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// 执行失败时的重试策略, 为空时不重试
+	Retry *RetryPolicy `yaml:"retry,omitempty"`
+	// 重试耗尽后接收失败数据的组件
+	DeadLetter *DeadLetterConfig `yaml:"dead_letter,omitempty"`
+	// 父节点配置了route时, 本节点所属的分支名称, 为空时使用节点的名称
+	Branch string `yaml:"branch,omitempty"`
+	// 条件路由, 每条数据只发送给分支名称匹配的子节点
+	Route *RouteConfig `yaml:"route,omitempty"`
+	// 汇合节点, 等待多个上游节点的数据都到达之后执行一次
+	Join *JoinConfig `yaml:"join,omitempty"`
+}
+
+type RouteConfig struct {
+	// 分支名称的注入名称, 类型为string, 由当前节点或者上游的processor返回, 例如switch processor
+	By string `yaml:"by"`
+	// 分支名称为空或者没有匹配的子节点时使用的分支, 为空时丢弃数据
+	Default string `yaml:"default,omitempty"`
+}
+
+type JoinConfig struct {
+	// 等待的上游节点, 必须包含配置中的父节点, 其他上游节点执行成功后也会将数据发送到本节点
+	From []string `yaml:"from"`
+	// 部分上游的数据不会再到达时(被丢弃, 执行失败或者没有被路由选中),
+	// 为true时以已经到达的数据执行, 否则丢弃已经到达的数据
+	Partial bool `yaml:"partial,omitempty"`
+}
+
+type RetryPolicy struct {
+	MaxAttempts    int           `yaml:"max_attempts"`              // 最大执行次数, 包含第一次执行
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"` // 第一次重试前的等待时间, 默认100ms
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`     // 等待时间的上限, 默认10s
+	Multiplier     float64       `yaml:"multiplier,omitempty"`      // 每次重试等待时间的倍数, 默认2
+	// 可重试错误的正则表达式, 匹配错误信息, 为空时所有错误都重试
+	RetryOn []string `yaml:"retry_on,omitempty"`
+}
+
+// RateLimit 令牌桶限流配置
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`            // 每秒产生的令牌数
+	Burst int     `yaml:"burst,omitempty"` // 令牌桶的容量, 默认为rate向上取整
+}
+
+type DeadLetterConfig struct {
+	Component string `yaml:"component"`       // 组件的注入名称, 例如: kafka_producer, io_writer
+	Topic     string `yaml:"topic,omitempty"` // 写入kafka等需要topic的组件时使用
+}
+
+func (c Config) NewComponents() ([]lotus.Component, error) {
+	return lotus.Config{Components: c.Components}.NewComponents()
+}
+
+func (c Config) NewProcessors() ([]lotus.Processor, error) {
+	return lotus.Config{Processors: c.Processors}.NewProcessors()
+}
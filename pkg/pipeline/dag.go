@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DAGEdge pipeline之间的依赖关系, From运行结束后满足Condition时触发To
+type DAGEdge struct {
+	From      string
+	To        string
+	Condition DependencyCondition
+}
+
+// DependencyEdges 返回configs中所有的依赖关系, 按照From, To排序
+func DependencyEdges(configs []Config) []DAGEdge {
+	var edges []DAGEdge
+	for _, conf := range configs {
+		for _, dep := range conf.DependsOn {
+			edges = append(edges, DAGEdge{
+				From:      dep.Pipeline,
+				To:        conf.Name,
+				Condition: dep.condition(),
+			})
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+func (d Dependency) condition() DependencyCondition {
+	if d.Condition == "" {
+		return DependencyConditionSuccess
+	}
+	return d.Condition
+}
+
+// match 判断上游的运行结果是否满足依赖条件, 被取消的运行不会触发下游
+func (d Dependency) match(res RunResult) bool {
+	switch d.condition() {
+	case DependencyConditionAlways:
+		return res.Status == RunStatusSucceeded || res.Status == RunStatusFailed
+	default:
+		return res.Status == RunStatusSucceeded
+	}
+}
+
+// checkDependencyCycle 检查pipeline之间的依赖是否存在环
+func checkDependencyCycle(configs []Config) error {
+	graph := map[string][]string{} // key: 下游, value: 上游
+	for _, conf := range configs {
+		for _, dep := range conf.DependsOn {
+			graph[conf.Name] = append(graph[conf.Name], dep.Pipeline)
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := map[string]int{}
+
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch states[name] {
+		case visiting:
+			// 截取环的部分用于展示
+			for i, n := range path {
+				if n == name {
+					return fmt.Errorf("Pipeline dependency cycle detected: %s -> %s",
+						strings.Join(path[i:], " -> "), name)
+				}
+			}
+		case visited:
+			return nil
+		}
+
+		states[name] = visiting
+		path = append(path, name)
+		for _, upstream := range graph[name] {
+			if err := visit(upstream); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		states[name] = visited
+		return nil
+	}
+
+	var names []string
+	for name := range graph {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DAGDotVisualizer 以dot格式输出pipeline之间的依赖关系
+func DAGDotVisualizer(w io.Writer, edges []DAGEdge) error {
+	var buffer bytes.Buffer
+	buffer.WriteString("digraph {\n")
+	buffer.WriteString(`node [shape=box fontname="Sans serif"];` + "\n")
+	for _, e := range edges {
+		style := "solid"
+		if e.Condition == DependencyConditionAlways {
+			style = "dashed"
+		}
+		buffer.WriteString(fmt.Sprintf("  %q -> %q [label=%q style=%s];\n",
+			e.From, e.To, string(e.Condition), style))
+	}
+	buffer.WriteString("}")
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
@@ -0,0 +1,121 @@
+package pipeline
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/shima-park/lotus/processor"
+	"gotest.tools/v3/assert"
+)
+
+func init() {
+	_ = processor.Register("test_dag_ok", processor.NewFactoryWithProcessor(
+		nil, "always succeeds", func(r ctxRequest) error { return nil }))
+	_ = processor.Register("test_dag_fail", processor.NewFactoryWithProcessor(
+		nil, "always fails", func(r ctxRequest) error { return errors.New("failed") }))
+}
+
+func dagConfig(name, proc string, deps ...Dependency) Config {
+	return Config{
+		Name:       name,
+		Schedule:   "@yearly",
+		DependsOn:  deps,
+		Processors: []map[string]string{{proc: ""}},
+		Stream:     StreamConfig{Name: proc},
+	}
+}
+
+func TestCheckDependencyCycle(t *testing.T) {
+	assert.NilError(t, checkDependencyCycle([]Config{
+		{Name: "a"},
+		{Name: "b", DependsOn: []Dependency{{Pipeline: "a"}}},
+		{Name: "c", DependsOn: []Dependency{{Pipeline: "a"}, {Pipeline: "b"}}},
+	}))
+
+	err := checkDependencyCycle([]Config{
+		{Name: "a", DependsOn: []Dependency{{Pipeline: "c"}}},
+		{Name: "b", DependsOn: []Dependency{{Pipeline: "a"}}},
+		{Name: "c", DependsOn: []Dependency{{Pipeline: "b"}}},
+	})
+	assert.ErrorContains(t, err, "a -> c -> b -> a")
+
+	err = checkDependencyCycle([]Config{
+		{Name: "a", DependsOn: []Dependency{{Pipeline: "a"}}},
+	})
+	assert.ErrorContains(t, err, "a -> a")
+}
+
+func TestManagerTriggerDownstream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runs")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	pm := NewPipelinerManager(WithRunStore(NewFileRunStore(dir, 0)))
+
+	_, err = pm.AddPipeline(dagConfig("dag_a", "test_dag_ok"))
+	assert.NilError(t, err)
+	_, err = pm.AddPipeline(dagConfig("dag_b", "test_dag_fail"))
+	assert.NilError(t, err)
+	// c只在a成功后运行, d在b结束后运行, e依赖a和c
+	c := dagConfig("dag_c", "test_dag_ok", Dependency{Pipeline: "dag_a"})
+	c.Schedule = ""
+	_, err = pm.AddPipeline(c)
+	assert.NilError(t, err)
+	_, err = pm.AddPipeline(dagConfig("dag_d", "test_dag_ok",
+		Dependency{Pipeline: "dag_b", Condition: DependencyConditionAlways}))
+	assert.NilError(t, err)
+	_, err = pm.AddPipeline(dagConfig("dag_e", "test_dag_ok",
+		Dependency{Pipeline: "dag_a"}, Dependency{Pipeline: "dag_c"}))
+	assert.NilError(t, err)
+
+	// 形成环的重建不影响正在运行的pipeline
+	assert.NilError(t, pm.Start("dag_a"))
+	_, err = pm.RecreatePipeline(dagConfig("dag_a", "test_dag_ok", Dependency{Pipeline: "dag_e"}))
+	assert.ErrorContains(t, err, "cycle")
+	assert.Assert(t, pm.Find("dag_a") != nil)
+	assert.Equal(t, pm.Find("dag_a").State(), Running)
+
+	// 暂停中的pipeline重建之后保持暂停
+	assert.NilError(t, pm.Pause("dag_a"))
+	_, err = pm.RecreatePipeline(dagConfig("dag_a", "test_dag_ok"))
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Find("dag_a").State(), Paused)
+	assert.NilError(t, pm.Resume("dag_a"))
+	assert.Equal(t, pm.Find("dag_a").State(), Running)
+
+	names := []string{"dag_a", "dag_b", "dag_c", "dag_d", "dag_e"}
+	assert.NilError(t, pm.Start(names...))
+	defer func() { _ = pm.Stop(names...) }()
+
+	_, err = pm.Trigger("dag_a", nil)
+	assert.NilError(t, err)
+	_, err = pm.Trigger("dag_b", nil)
+	assert.NilError(t, err)
+
+	waitRuns := func(name string, n int) []RunResult {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			runs, err := pm.Runs(name)
+			assert.NilError(t, err)
+			var finished []RunResult
+			for _, r := range runs {
+				if r.Status != RunStatusRunning {
+					finished = append(finished, r)
+				}
+			}
+			if len(finished) >= n || time.Now().After(deadline) {
+				return finished
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	for _, name := range []string{"dag_c", "dag_d", "dag_e"} {
+		runs := waitRuns(name, 1)
+		assert.Equal(t, len(runs), 1, name)
+		assert.Equal(t, runs[0].Trigger, TriggerUpstream, name)
+	}
+}
@@ -0,0 +1,105 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// DeadLetterWriter 可以作为死信目的地的组件需要实现该接口
+// 组件实例实现了io.Writer时, 死信会按行写入
+type DeadLetterWriter interface {
+	WriteDeadLetter(topic string, data []byte) error
+}
+
+// DeadLetter 重试耗尽后写入死信目的地的数据, 以json格式写入
+type DeadLetter struct {
+	Pipeline  string            `json:"pipeline"`
+	Processor string            `json:"processor"`
+	RunID     string            `json:"run_id"`
+	Attempts  int               `json:"attempts"`
+	Error     string            `json:"error"`
+	Time      time.Time         `json:"time"`
+	Params    map[string]string `json:"params,omitempty"`
+	// 失败processor的输入, 即上游processor的返回值, 根节点没有输入
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+type deadLetterSink struct {
+	writer DeadLetterWriter
+	topic  string
+}
+
+func (d *deadLetterSink) write(dl DeadLetter) error {
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+	return d.writer.WriteDeadLetter(d.topic, data)
+}
+
+// lineWriter 将死信按行写入io.Writer
+type lineWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (l *lineWriter) WriteDeadLetter(topic string, data []byte) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	_, err := l.w.Write(append(data, '\n'))
+	return err
+}
+
+// resolveDeadLetters 为stream中配置了dead_letter的节点绑定对应的组件
+func resolveDeadLetters(stream *Stream, components []Component) error {
+	var err error
+	stream.Walk(func(s *Stream) {
+		conf := s.config.DeadLetter
+		if err != nil || conf == nil {
+			return
+		}
+
+		var comp *Component
+		for i := range components {
+			if components[i].Component.Instance().Name() == conf.Component {
+				comp = &components[i]
+				break
+			}
+		}
+		if comp == nil {
+			err = fmt.Errorf("Stream(%s) dead letter component %s not found", s.Name(), conf.Component)
+			return
+		}
+
+		var writer DeadLetterWriter
+		if w, ok := comp.Component.(DeadLetterWriter); ok {
+			writer = w
+		} else if w, ok := comp.Component.Instance().Interface().(io.Writer); ok {
+			writer = &lineWriter{w: w}
+		} else {
+			err = fmt.Errorf("Stream(%s) component %s can not be used as dead letter, it must implement DeadLetterWriter or io.Writer",
+				s.Name(), conf.Component)
+			return
+		}
+
+		s.deadLetter = &deadLetterSink{writer: writer, topic: conf.Topic}
+	})
+	return err
+}
+
+func marshalPayload(v reflect.Value) json.RawMessage {
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+
+	data, err := json.Marshal(v.Interface())
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("%+v", v.Interface()))
+	}
+	return data
+}
@@ -0,0 +1,164 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/common/monitor"
+)
+
+type deferKey struct{}
+
+// deferTarget 调用processor时写入Context, 记录完成当前数据需要的信息
+type deferTarget struct {
+	c        *execContext
+	s        *Stream
+	moni     monitor.Monitor
+	it       item
+	inj      inject.Injector
+	attempts int
+}
+
+// Deferred 在processor返回之后异步地完成当前数据, 完成之前数据所属的运行不会结束,
+// 用于批次, 窗口等需要缓存数据并在之后由定时器输出的processor
+type Deferred struct {
+	target deferTarget
+	stop   func() bool
+
+	lock    sync.Mutex
+	done    bool
+	onFlush func()
+}
+
+// Defer 在processor中以注入的Context调用, 通常随后返回ErrDrop, 之后通过Resolve将结果发送给下游节点.
+// 运行被取消时以context.Canceled完成, Context不是由pipeline注入时返回false
+func Defer(ctx context.Context) (*Deferred, bool) {
+	t, ok := ctx.Value(deferKey{}).(*deferTarget)
+	if !ok {
+		return nil, false
+	}
+
+	t.it.run.add(1)
+	d := &Deferred{target: *t}
+	t.c.trackDeferred(d, true)
+
+	d.lock.Lock()
+	d.stop = context.AfterFunc(t.it.run.ctx, func() {
+		d.Resolve(reflect.Value{}, context.Canceled)
+	})
+	d.lock.Unlock()
+	return d, true
+}
+
+// Resolve 以processor的返回值完成数据, 处理方式与processor同步返回时相同, 只有第一次调用有效
+func (d *Deferred) Resolve(val reflect.Value, err error) {
+	d.lock.Lock()
+	if d.done {
+		d.lock.Unlock()
+		return
+	}
+	d.done = true
+	stop := d.stop
+	d.lock.Unlock()
+
+	stop()
+	t := d.target
+	t.c.trackDeferred(d, false)
+	if t.it.run.isCanceled() {
+		t.it.run.finish(context.Canceled)
+		return
+	}
+	t.c.complete(t.s, t.moni, t.it, t.inj, val, t.attempts, err)
+}
+
+// Canceled 数据所属的运行是否已经被取消
+func (d *Deferred) Canceled() bool {
+	return d.target.it.run.isCanceled()
+}
+
+// OnFlush 设置pipeline暂停时调用的函数, processor应在其中尽快完成缓存的数据, 否则暂停会一直等待
+func (d *Deferred) OnFlush(fn func()) {
+	d.lock.Lock()
+	d.onFlush = fn
+	d.lock.Unlock()
+}
+
+func (d *Deferred) flush() {
+	d.lock.Lock()
+	fn := d.onFlush
+	if d.done {
+		fn = nil
+	}
+	d.lock.Unlock()
+
+	if fn != nil {
+		fn()
+	}
+}
+
+// Emitter 在processor返回之后以新的运行将结果发送给下游节点, 用于窗口等由定时器产生输出的processor
+type Emitter struct {
+	c    *execContext
+	s    *Stream
+	moni monitor.Monitor
+}
+
+// NewEmitter 在processor中以注入的Context调用, pipeline停止之后Emitter失效,
+// Context不是由pipeline注入时返回false
+func NewEmitter(ctx context.Context) (*Emitter, bool) {
+	t, ok := ctx.Value(deferKey{}).(*deferTarget)
+	if !ok {
+		return nil, false
+	}
+	return &Emitter{c: t.c, s: t.s, moni: t.moni}, true
+}
+
+// Emit 以TriggerTimer触发新的运行, val作为processor的返回值发送给下游节点, 不等待运行结束.
+// pipeline没有在运行时返回错误, 由processor稍后重试
+func (e *Emitter) Emit(val reflect.Value) error {
+	if e.Stopped() {
+		return errors.New("Exec context is stopped")
+	}
+	if e.c.gate != nil && !e.c.gate() {
+		return errors.New("Pipeline is not running")
+	}
+
+	r, inj := e.c.prepare(TriggerTimer, nil)
+	r.add(1)
+	e.c.track(r)
+	e.c.complete(e.s, e.moni, item{run: r, injector: inj}, inj, val, 1, nil)
+	return nil
+}
+
+// Stopped pipeline是否已经停止, 停止之后Emitter不会再可用
+func (e *Emitter) Stopped() bool {
+	return e.c.isStopped()
+}
+
+func (c *execContext) trackDeferred(d *Deferred, add bool) {
+	c.deferLock.Lock()
+	defer c.deferLock.Unlock()
+
+	if add {
+		c.deferred[d] = struct{}{}
+	} else {
+		delete(c.deferred, d)
+	}
+}
+
+// FlushDeferred 通知processor完成所有缓存的数据
+func (c *execContext) FlushDeferred() {
+	c.deferLock.Lock()
+	var ds []*Deferred
+	for d := range c.deferred {
+		ds = append(ds, d)
+	}
+	c.deferLock.Unlock()
+
+	for _, d := range ds {
+		d.flush()
+	}
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// newDeferPipeline 根节点缓存每条数据并返回ErrDrop, 缓存的数据由测试完成
+func newDeferPipeline(t *testing.T, name string, rec *joinRecorder) (Pipeliner, <-chan *Deferred) {
+	deferred := make(chan *Deferred, 1)
+	root := Processor{Name: name + "_root", Processor: func(r ctxRequest) (joinLeft, error) {
+		d, ok := Defer(r.Ctx)
+		if !ok {
+			t.Error("Defer is not available in pipeline")
+		}
+		deferred <- d
+		return joinLeft{}, ErrDrop
+	}}
+	child := Processor{Name: name + "_child", Processor: func(r joinLeft) error {
+		rec.add(r.Left)
+		return nil
+	}}
+
+	conf := StreamConfig{Name: root.Name, Childs: []StreamConfig{{Name: child.Name}}}
+	p := newStreamPipeline(t, name, conf, root, child)
+	assert.NilError(t, p.Start())
+	return p, deferred
+}
+
+func trigger(p Pipeliner) <-chan RunResult {
+	resC := make(chan RunResult, 1)
+	go func() {
+		res, _ := p.Trigger(nil)
+		resC <- res
+	}()
+	return resC
+}
+
+func TestDeferResolve(t *testing.T) {
+	var rec joinRecorder
+	p, deferred := newDeferPipeline(t, "test_defer", &rec)
+	defer p.Stop()
+
+	_, ok := Defer(t.Context())
+	assert.Assert(t, !ok)
+
+	resC := trigger(p)
+	d := <-deferred
+
+	// 完成之前运行不会结束
+	select {
+	case res := <-resC:
+		t.Fatalf("run finished before the deferred item: %+v", res)
+	default:
+	}
+
+	d.Resolve(reflect.ValueOf(joinLeft{Left: "a"}), nil)
+	res := <-resC
+	assert.Equal(t, res.Status, RunStatusSucceeded)
+	assert.DeepEqual(t, rec.reset(), []string{"a"})
+
+	// 重复完成无效
+	d.Resolve(reflect.ValueOf(joinLeft{Left: "b"}), nil)
+	assert.Assert(t, rec.reset() == nil)
+}
+
+func TestDeferFlushOnPause(t *testing.T) {
+	var rec joinRecorder
+	p, deferred := newDeferPipeline(t, "test_defer_pause", &rec)
+	defer p.Stop()
+
+	resC := trigger(p)
+	d := <-deferred
+	d.OnFlush(func() {
+		d.Resolve(reflect.ValueOf(joinLeft{Left: "flushed"}), nil)
+	})
+
+	assert.NilError(t, p.Pause())
+	assert.Equal(t, (<-resC).Status, RunStatusSucceeded)
+	assert.DeepEqual(t, rec.reset(), []string{"flushed"})
+}
+
+func TestDeferCanceledOnStop(t *testing.T) {
+	var rec joinRecorder
+	p, deferred := newDeferPipeline(t, "test_defer_stop", &rec)
+
+	resC := trigger(p)
+	d := <-deferred
+	p.Stop()
+
+	assert.Equal(t, (<-resC).Status, RunStatusCanceled)
+	assert.Assert(t, d.Canceled())
+
+	d.Resolve(reflect.ValueOf(joinLeft{Left: "late"}), nil)
+	assert.Assert(t, rec.reset() == nil)
+}
+
+func TestEmitter(t *testing.T) {
+	emitters := make(chan *Emitter, 1)
+	emitted := make(chan string, 1)
+	root := Processor{Name: "test_emitter_root", Processor: func(r ctxRequest) (joinLeft, error) {
+		e, ok := NewEmitter(r.Ctx)
+		if !ok {
+			t.Error("NewEmitter is not available in pipeline")
+		}
+		emitters <- e
+		return joinLeft{}, ErrDrop
+	}}
+	child := Processor{Name: "test_emitter_child", Processor: func(r joinLeft) error {
+		emitted <- r.Left
+		return nil
+	}}
+
+	conf := StreamConfig{Name: root.Name, Childs: []StreamConfig{{Name: child.Name}}}
+	p := newStreamPipeline(t, "test_emitter", conf, root, child)
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	_, ok := NewEmitter(t.Context())
+	assert.Assert(t, !ok)
+
+	res, err := p.Trigger(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusSucceeded)
+	e := <-emitters
+
+	// 以新的运行发送给下游节点
+	assert.NilError(t, e.Emit(reflect.ValueOf(joinLeft{Left: "timer"})))
+	assert.Equal(t, <-emitted, "timer")
+
+	// 暂停时由processor稍后重试
+	assert.NilError(t, p.Pause())
+	assert.ErrorContains(t, e.Emit(reflect.ValueOf(joinLeft{Left: "paused"})), "not running")
+	assert.NilError(t, p.Resume())
+
+	p.Stop()
+	assert.Assert(t, e.Stopped())
+	assert.ErrorContains(t, e.Emit(reflect.ValueOf(joinLeft{Left: "stopped"})), "stopped")
+}
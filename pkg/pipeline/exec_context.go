@@ -0,0 +1,452 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/common/monitor"
+)
+
+// ErrDrop processor返回ErrDrop或者包装了ErrDrop的错误时丢弃当前数据, 不再执行下游节点,
+// 不会被重试也不计入错误, 本次运行视为成功
+var ErrDrop = errors.New("Item dropped")
+
+// item 在stream节点之间流转的数据, 携带所属的run
+type item struct {
+	run      *run
+	injector inject.Injector
+	payload  reflect.Value // 上游processor的返回值, 写入死信时使用
+	from     string        // 上游节点的名称, 汇合节点以此区分到达的分支
+}
+
+type execContext struct {
+	name     string
+	ctx      context.Context
+	cancel   context.CancelFunc
+	injector inject.Injector
+	stream   *Stream
+	monitor  monitor.Monitor
+
+	// key: stream name, value: 该节点的输入队列
+	inputs map[string]chan item
+	wg     sync.WaitGroup
+
+	lock sync.Mutex
+	runs map[*run]struct{} // 正在进行的运行
+
+	joinLock sync.Mutex
+	// key: 运行, value: 该运行中还在等待其他上游的汇合节点
+	joins map[*run]map[string]*joinState
+
+	deferLock sync.Mutex
+	deferred  map[*Deferred]struct{} // processor返回之后还未完成的数据
+
+	// 每次运行结束时调用
+	onFinish func(RunResult)
+	// 根节点处理新数据之前调用, 返回false时丢弃本次运行
+	gate func() bool
+	// 采样processor的输入输出
+	taps *tapHub
+}
+
+func newExecContext(parent context.Context, name string, injector inject.Injector, stream *Stream, moni monitor.Monitor) *execContext {
+	ctx, cancel := context.WithCancel(parent)
+	c := &execContext{
+		name:     name,
+		ctx:      ctx,
+		cancel:   cancel,
+		injector: injector,
+		stream:   stream,
+		monitor:  moni,
+		inputs:   map[string]chan item{},
+		runs:     map[*run]struct{}{},
+		joins:    map[*run]map[string]*joinState{},
+		deferred: map[*Deferred]struct{}{},
+	}
+
+	stream.Walk(func(s *Stream) {
+		c.inputs[s.Name()] = make(chan item, s.config.BufferSize)
+	})
+	return c
+}
+
+func (c *execContext) Start() error {
+	if c.isStopped() {
+		return errors.New("Exec context is stopped")
+	}
+
+	c.stream.Walk(func(s *Stream) {
+		for i := 0; i < s.config.Replica; i++ {
+			c.runStream(s)
+		}
+	})
+	return nil
+}
+
+// Stop 停止所有节点, 并将队列中未处理的数据标记为取消
+func (c *execContext) Stop() {
+	if c.isStopped() {
+		return
+	}
+
+	c.cancel()
+	c.wg.Wait()
+
+	for _, inputC := range c.inputs {
+	Loop:
+		for {
+			select {
+			case it := <-inputC:
+				it.run.finish(context.Canceled)
+			default:
+				break Loop
+			}
+		}
+	}
+}
+
+func (c *execContext) isStopped() bool {
+	select {
+	case <-c.ctx.Done():
+		return true
+	default:
+	}
+	return false
+}
+
+// Run 提交一次运行, 阻塞直到根节点接收或者执行上下文被停止
+// params会以map[string]string的类型, Params的名称注入到本次运行中
+func (c *execContext) Run(trigger Trigger, params map[string]string) (*run, error) {
+	r, inj := c.prepare(trigger, params)
+	r.add(1)
+	c.track(r)
+	select {
+	case <-c.ctx.Done():
+		r.finish(context.Canceled)
+		return r, errors.New("Exec context is stopped")
+	case c.inputs[c.stream.Name()] <- item{run: r, injector: inj}:
+	}
+	return r, nil
+}
+
+// prepare 创建运行以及注入了Context和Params的injector
+func (c *execContext) prepare(trigger Trigger, params map[string]string) (*run, inject.Injector) {
+	r := newRun(c.ctx, c.name, trigger, params)
+	r.onFinish = func(res RunResult) {
+		if c.onFinish != nil {
+			c.onFinish(res)
+		}
+		c.untrack(r)
+	}
+	r.onStall = func() {
+		go c.flushJoin(r)
+	}
+
+	if params == nil {
+		params = map[string]string{}
+	}
+
+	inj := inject.New()
+	inj.SetParent(c.injector)
+	inj.MapTo(r.ctx, "Context", (*context.Context)(nil))
+	inj.Map(params, "Params")
+	return r, inj
+}
+
+func (c *execContext) track(r *run) {
+	c.lock.Lock()
+	c.runs[r] = struct{}{}
+	c.lock.Unlock()
+}
+
+func (c *execContext) untrack(r *run) {
+	c.lock.Lock()
+	delete(c.runs, r)
+	c.lock.Unlock()
+}
+
+// Running 返回正在进行的运行数
+func (c *execContext) Running() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.runs)
+}
+
+// ListRunning 返回正在进行的运行
+func (c *execContext) ListRunning() []RunResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var res []RunResult
+	for r := range c.runs {
+		res = append(res, r.Result())
+	}
+	return res
+}
+
+// CancelRunning 取消所有正在进行的运行, 并等待它们结束
+func (c *execContext) CancelRunning() {
+	c.lock.Lock()
+	var runs []*run
+	for r := range c.runs {
+		runs = append(runs, r)
+	}
+	c.lock.Unlock()
+
+	for _, r := range runs {
+		r.cancel()
+	}
+
+	for _, r := range runs {
+		select {
+		case <-r.Done():
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// WaitRunning 等待所有正在进行的运行结束
+func (c *execContext) WaitRunning() {
+	c.lock.Lock()
+	var runs []*run
+	for r := range c.runs {
+		runs = append(runs, r)
+	}
+	c.lock.Unlock()
+
+	for _, r := range runs {
+		select {
+		case <-r.Done():
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *execContext) runStream(s *Stream) {
+	moni := c.monitor.With(s.Name())
+	moni.Set(METRICS_KEY_STREAM_BUFFER_SIZE, expvar.Func(func() interface{} { return s.config.BufferSize }))
+	moni.Set(METRICS_KEY_STREAM_REPLICA, expvar.Func(func() interface{} { return s.config.Replica }))
+
+	inputC := c.inputs[s.Name()]
+	moni.Set(METRICS_KEY_STREAM_QUEUE_DEPTH, expvar.Func(func() interface{} { return len(inputC) }))
+
+	c.wg.Add(1)
+	go func() {
+		defer func() {
+			moni.Add(METRICS_KEY_STREAM_RUNNING, -1)
+			moni.Set(METRICS_KEY_STREAM_EXIT_TIME, monitor.Time(time.Now()))
+			c.wg.Done()
+		}()
+
+		moni.Set(METRICS_KEY_STREAM_START_TIME, monitor.Time(time.Now()))
+		moni.Add(METRICS_KEY_STREAM_RUNNING, 1)
+		var elapsed time.Duration
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case it := <-inputC:
+				elapsed += c.process(s, moni, it)
+				moni.Set(METRICS_KEY_STREAM_ELAPSED, monitor.Elapsed(elapsed))
+			}
+		}
+	}()
+}
+
+func (c *execContext) process(s *Stream, moni monitor.Monitor, it item) time.Duration {
+	isRoot := s == c.stream
+	if it.run.isCanceled() || (isRoot && c.gate != nil && !c.gate()) {
+		it.run.finish(context.Canceled)
+		return 0
+	}
+
+	moni.Set(METRICS_KEY_STREAM_LAST_START_TIME, monitor.Time(time.Now()))
+	moni.Add(METRICS_KEY_STREAM_RUN_TIMES, 1)
+
+	startTime := time.Now()
+
+	inj, val, attempts, err := c.invoke(s, moni, it)
+
+	elapsed := time.Since(startTime)
+	it.run.observe(s.Name(), elapsed)
+	if taps := c.taps.sample(s.Name()); len(taps) > 0 {
+		c.taps.emit(taps, func(maxFieldLength int) TapEvent {
+			event := TapEvent{
+				Time:      time.Now(),
+				Pipeline:  c.name,
+				Processor: s.Name(),
+				RunID:     it.run.id,
+				Elapsed:   elapsed.String(),
+				Request:   c.taps.renderRequest(s.processor.Processor, inj, maxFieldLength),
+				Response:  renderResponse(val, maxFieldLength),
+			}
+			if err != nil {
+				event.Error = truncate(err.Error(), maxFieldLength)
+			}
+			return event
+		})
+	}
+	moni.Set(METRICS_KEY_STREAM_LAST_END_TIME, monitor.Time(time.Now()))
+
+	c.complete(s, moni, it, inj, val, attempts, err)
+	return elapsed
+}
+
+// complete 根据processor的返回值将数据发送给子节点, 并结束当前节点
+func (c *execContext) complete(s *Stream, moni monitor.Monitor, it item, inj inject.Injector, val reflect.Value, attempts int, err error) {
+	if errors.Is(err, ErrDrop) {
+		moni.Add(METRICS_KEY_STREAM_DROP_COUNT, 1)
+		it.run.finish(nil)
+		return
+	}
+
+	newInj, err := handleResult(s.Name(), inj, val, err)
+	if err != nil {
+		moni.Add(METRICS_KEY_STREAM_ERROR_COUNT, 1)
+		c.deadLetter(s, moni, it, attempts, err)
+		it.run.finish(err)
+		return
+	}
+	moni.Add(METRICS_KEY_STREAM_SUCCESS_COUNT, 1)
+
+	targets, dropped := s.targets(newInj)
+	if dropped {
+		// 没有匹配的分支, 数据不再发送给任何子节点
+		moni.Add(METRICS_KEY_STREAM_DROP_COUNT, 1)
+	}
+
+	it.run.add(int64(len(targets)))
+	for _, next := range targets {
+		nextItem := item{run: it.run, injector: newInj, payload: val, from: s.Name()}
+		if next.config.Join != nil {
+			c.join(next, nextItem)
+			continue
+		}
+		c.send(next, nextItem)
+	}
+	it.run.finish(nil)
+}
+
+func (c *execContext) send(s *Stream, it item) {
+	select {
+	case <-c.ctx.Done():
+		it.run.finish(context.Canceled)
+	case c.inputs[s.Name()] <- it:
+	}
+}
+
+// invoke 执行processor, 失败时按照stream配置的重试策略重试, 返回最后一次执行的结果和执行次数
+func (c *execContext) invoke(s *Stream, moni monitor.Monitor, it item) (inject.Injector, reflect.Value, int, error) {
+	for attempt := 1; ; attempt++ {
+		inj := inject.New()
+		inj.SetParent(it.injector)
+		inj.MapTo(moni, "Monitor", (*monitor.Monitor)(nil))
+
+		if err := s.wait(it.run.ctx); err != nil {
+			return inj, reflect.Value{}, attempt, context.Canceled
+		}
+
+		// processor可以通过Context找到当前数据, 见Defer
+		ctx := context.WithValue(it.run.ctx, deferKey{}, &deferTarget{
+			c: c, s: s, moni: moni, it: it, inj: inj, attempts: attempt,
+		})
+		inj.MapTo(ctx, "Context", (*context.Context)(nil))
+
+		val, err := c.invokeWithTimeout(ctx, s, moni, inj, it.run)
+		if err == nil || errors.Is(err, ErrDrop) || attempt >= s.retrier.maxAttempts() ||
+			it.run.isCanceled() || !s.retrier.retryable(err) {
+			return inj, val, attempt, err
+		}
+
+		moni.Add(METRICS_KEY_STREAM_RETRY_COUNT, 1)
+		backoff := s.retrier.backoff(attempt)
+		log.Error("Stream: %s, Attempt %d failed: %s, retry after %s", s.Name(), attempt, err, backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-it.run.ctx.Done():
+			timer.Stop()
+			return inj, val, attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// invokeWithTimeout 配置了超时时, 以带有超时的Context替换本次执行注入的Context.
+// 超时后仍然等待processor返回, 避免下一次重试与超时的执行同时进行, processor需要监听Context及时退出,
+// 超时之后processor仍然返回了结果时以该结果为准
+func (c *execContext) invokeWithTimeout(ctx context.Context, s *Stream, moni monitor.Monitor, inj inject.Injector, r *run) (reflect.Value, error) {
+	if s.config.Timeout <= 0 {
+		return s.Invoke(inj)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.config.Timeout)
+	defer cancel()
+	inj.MapTo(ctx, "Context", (*context.Context)(nil))
+
+	val, err := s.Invoke(inj)
+	if err == nil || errors.Is(err, ErrDrop) || ctx.Err() == nil {
+		return val, err
+	}
+	if r.isCanceled() {
+		return reflect.Value{}, context.Canceled
+	}
+	moni.Add(METRICS_KEY_STREAM_TIMEOUT_COUNT, 1)
+	return reflect.Value{}, fmt.Errorf("Stream(%s) timeout after %s: %w", s.Name(), s.config.Timeout, ctx.Err())
+}
+
+// deadLetter 将执行失败的数据写入stream配置的死信目的地, 被取消的运行不会写入
+func (c *execContext) deadLetter(s *Stream, moni monitor.Monitor, it item, attempts int, err error) {
+	if s.deadLetter == nil || it.run.isCanceled() {
+		return
+	}
+
+	dl := DeadLetter{
+		Pipeline:  c.name,
+		Processor: s.Name(),
+		RunID:     it.run.id,
+		Attempts:  attempts,
+		Error:     err.Error(),
+		Time:      time.Now(),
+		Params:    it.run.params,
+		Payload:   marshalPayload(it.payload),
+	}
+
+	if werr := s.deadLetter.write(dl); werr != nil {
+		moni.Add(METRICS_KEY_STREAM_DEAD_LETTER_ERR, 1)
+		log.Error("Stream: %s, Write dead letter error: %s", s.Name(), werr)
+		return
+	}
+	moni.Add(METRICS_KEY_STREAM_DEAD_LETTER, 1)
+}
+
+func handleResult(name string, inj inject.Injector, val reflect.Value, err error) (inject.Injector, error) {
+	if err != nil {
+		log.Error("Stream: %s, Invoke error: %s", name, err)
+		return nil, err
+	}
+
+	if !val.IsValid() {
+		err = fmt.Errorf("Stream: %s Return values is not valid", name)
+		log.Error(err.Error())
+		return nil, err
+	}
+
+	newInj := inject.New()
+	newInj.SetParent(inj)
+	if err := newInj.MapValues(val); err != nil {
+		log.Error("Stream: %s, SetInjector error: %s", name, err)
+		return nil, err
+	}
+
+	return newInj, nil
+}
@@ -0,0 +1,236 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/shima-park/lotus/common/inject"
+)
+
+// resolveStreamGraph 校验路由和汇合节点, 为汇合节点的上游添加到汇合节点的边, 并计算拓扑顺序
+func resolveStreamGraph(root *Stream) error {
+	var err error
+	root.Walk(func(s *Stream) {
+		if err == nil {
+			err = s.resolveRoute()
+		}
+		if err == nil {
+			err = s.resolveJoin(root)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sortStreams(root)
+}
+
+func (s *Stream) resolveJoin(root *Stream) error {
+	join := s.config.Join
+	if join == nil {
+		return nil
+	}
+
+	if s.parent == nil {
+		return fmt.Errorf("Stream(%s) the root stream cannot be a join", s.Name())
+	}
+
+	if len(join.From) < 2 {
+		return fmt.Errorf("Stream(%s) join must wait for at least two upstreams", s.Name())
+	}
+
+	seen := map[string]struct{}{}
+	var hasParent bool
+	for _, name := range join.From {
+		if _, ok := seen[name]; ok {
+			return fmt.Errorf("Stream(%s) join upstream %s is duplicated", s.Name(), name)
+		}
+		seen[name] = struct{}{}
+
+		if name == s.parent.Name() {
+			hasParent = true
+			continue
+		}
+
+		up, ok := root.Get(name)
+		if !ok {
+			return fmt.Errorf("Stream(%s) join upstream %s is not found", s.Name(), name)
+		}
+		if _, ok := s.Get(name); ok {
+			return fmt.Errorf("Stream(%s) join upstream %s cannot be itself or its descendant", s.Name(), name)
+		}
+		up.joins = append(up.joins, s)
+	}
+
+	if !hasParent {
+		return fmt.Errorf("Stream(%s) join must wait for its parent %s", s.Name(), s.parent.Name())
+	}
+	return nil
+}
+
+// sortStreams 按照子节点和汇合节点的边进行拓扑排序, 汇合节点之间相互等待时返回错误
+func sortStreams(root *Stream) error {
+	var all []*Stream
+	indegree := map[*Stream]int{}
+	root.Walk(func(s *Stream) {
+		all = append(all, s)
+		for _, next := range s.downstreams() {
+			indegree[next]++
+		}
+	})
+
+	queue := []*Stream{root}
+	var order int
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		s.order = order
+		order++
+
+		for _, next := range s.downstreams() {
+			indegree[next]--
+			if indegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	if order < len(all) {
+		for _, s := range all {
+			if indegree[s] > 0 && s.config.Join != nil {
+				return fmt.Errorf("Stream(%s) join forms a cycle with its upstreams", s.Name())
+			}
+		}
+		return fmt.Errorf("Stream(%s) has a cycle", root.Name())
+	}
+	return nil
+}
+
+func (s *Stream) downstreams() []*Stream {
+	return append(append([]*Stream{}, s.childs...), s.joins...)
+}
+
+// joinState 一次运行中汇合节点已经到达的上游数据
+type joinState struct {
+	stream  *Stream
+	arrived map[string]item // key: 上游节点的名称
+}
+
+// join 暂存到达汇合节点的数据, 所有上游都到达后合并成一条数据发送给汇合节点
+// 暂存的数据保持运行的pending计数, 运行的其他数据都处理完成时由flushJoin处理
+func (c *execContext) join(s *Stream, it item) {
+	c.joinLock.Lock()
+	states, ok := c.joins[it.run]
+	if !ok {
+		states = map[string]*joinState{}
+		c.joins[it.run] = states
+	}
+	state, ok := states[s.Name()]
+	if !ok {
+		state = &joinState{stream: s, arrived: map[string]item{}}
+		states[s.Name()] = state
+	}
+	state.arrived[it.from] = it
+
+	if len(state.arrived) < len(s.config.Join.From) {
+		it.run.hold(1)
+		c.joinLock.Unlock()
+		return
+	}
+
+	delete(states, s.Name())
+	if len(states) == 0 {
+		delete(c.joins, it.run)
+	}
+	c.joinLock.Unlock()
+
+	it.run.hold(-int64(len(state.arrived) - 1))
+	c.fireJoin(state)
+}
+
+// flushJoin 运行中只剩下暂存的数据时, 按照拓扑顺序处理第一个汇合节点,
+// 被处理的汇合节点的下游可能会继续到达其他汇合节点, 因此每次只处理一个
+func (c *execContext) flushJoin(r *run) {
+	c.joinLock.Lock()
+	var state *joinState
+	for _, s := range c.joins[r] {
+		if state == nil || s.stream.order < state.stream.order {
+			state = s
+		}
+	}
+	if state == nil {
+		c.joinLock.Unlock()
+		return
+	}
+	delete(c.joins[r], state.stream.Name())
+	if len(c.joins[r]) == 0 {
+		delete(c.joins, r)
+	}
+	c.joinLock.Unlock()
+
+	r.hold(-int64(len(state.arrived)))
+	if state.stream.config.Join.Partial && !r.isCanceled() {
+		c.fireJoin(state)
+		return
+	}
+
+	var err error
+	if r.isCanceled() {
+		err = context.Canceled
+	} else {
+		c.monitor.With(state.stream.Name()).Add(METRICS_KEY_STREAM_DROP_COUNT, 1)
+	}
+	for _, it := range state.arrived {
+		it.run.finish(err)
+	}
+}
+
+// fireJoin 按照from的顺序合并已经到达的数据, 发送给汇合节点
+func (c *execContext) fireJoin(state *joinState) {
+	var (
+		merged item
+		injs   []inject.Injector
+	)
+	for _, name := range state.stream.config.Join.From {
+		it, ok := state.arrived[name]
+		if !ok {
+			continue
+		}
+
+		injs = append(injs, it.injector)
+		if merged.run == nil {
+			merged = it
+		} else {
+			it.run.finish(nil)
+		}
+	}
+
+	merged.injector = mergeInjectors(injs)
+	c.send(state.stream, merged)
+}
+
+// multiInjector 按照顺序在多个分支的injector中查找, 找到第一个即返回
+// 只作为parent使用, 除Get之外的方法由第一个分支处理
+type multiInjector struct {
+	inject.Injector
+	others []inject.Injector
+}
+
+func (m multiInjector) Get(t reflect.Type, name string) reflect.Value {
+	if v := m.Injector.Get(t, name); v.IsValid() {
+		return v
+	}
+
+	for _, inj := range m.others {
+		if v := inj.Get(t, name); v.IsValid() {
+			return v
+		}
+	}
+	return reflect.Value{}
+}
+
+func mergeInjectors(injs []inject.Injector) inject.Injector {
+	inj := inject.New()
+	inj.SetParent(multiInjector{Injector: injs[0], others: injs[1:]})
+	return inj
+}
@@ -0,0 +1,288 @@
+package pipeline
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+type routeBranch struct {
+	Branch string `inject:"Branch"`
+}
+
+type joinLeft struct {
+	Left string `inject:"Left"`
+}
+
+type joinRight struct {
+	Right string `inject:"Right"`
+}
+
+type joinRequest struct {
+	Left  string `inject:"Left"`
+	Right string `inject:"Right"`
+}
+
+// joinRecorder 记录processor收到的数据
+type joinRecorder struct {
+	lock   sync.Mutex
+	values []string
+}
+
+func (r *joinRecorder) add(v string) {
+	r.lock.Lock()
+	r.values = append(r.values, v)
+	r.lock.Unlock()
+}
+
+func (r *joinRecorder) reset() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	values := r.values
+	r.values = nil
+	return values
+}
+
+func newStreamPipeline(t *testing.T, name string, conf StreamConfig, procs ...Processor) Pipeliner {
+	processors := map[string]Processor{}
+	for _, proc := range procs {
+		processors[proc.Name] = proc
+	}
+	stream, err := NewStream(conf, processors)
+	assert.NilError(t, err)
+
+	p, err := New(
+		WithName(name),
+		WithProcessors(procs...),
+		WithStream(stream),
+		WithConfig(Config{Name: name, Schedule: "@yearly", Stream: conf}),
+	)
+	assert.NilError(t, err)
+	return p
+}
+
+func TestRoute(t *testing.T) {
+	var rec joinRecorder
+	root := Processor{Name: "test_route_root", Processor: func(r paramsRequest) routeBranch {
+		return routeBranch{Branch: r.Params["branch"]}
+	}}
+	alert := Processor{Name: "test_route_alert", Processor: func(r routeBranch) error {
+		rec.add("alert")
+		return nil
+	}}
+	archive := Processor{Name: "test_route_archive", Processor: func(r routeBranch) error {
+		rec.add("archive")
+		return nil
+	}}
+
+	p := newStreamPipeline(t, "test_route", StreamConfig{
+		Name:  root.Name,
+		Route: &RouteConfig{By: "Branch", Default: "archive"},
+		Childs: []StreamConfig{
+			{Name: alert.Name, Branch: "alert"},
+			{Name: archive.Name, Branch: "archive"},
+		},
+	}, root, alert, archive)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	for params, expected := range map[string]string{
+		"alert":   "alert",
+		"archive": "archive",
+		"unknown": "archive",
+	} {
+		res, err := p.Trigger(map[string]string{"branch": params})
+		assert.NilError(t, err)
+		assert.Equal(t, res.Status, RunStatusSucceeded)
+		assert.DeepEqual(t, rec.reset(), []string{expected})
+	}
+
+	var buf bytes.Buffer
+	assert.NilError(t, DotGrgphVisualizer(&buf, p))
+	assert.Assert(t, strings.Contains(buf.String(), `[label="archive (default)"]`))
+	assert.Assert(t, strings.Contains(buf.String(), "route by Branch"))
+}
+
+func TestJoin(t *testing.T) {
+	var rec joinRecorder
+	root := Processor{Name: "test_join_root", Processor: func(r paramsRequest) routeBranch {
+		return routeBranch{Branch: r.Params["drop"]}
+	}}
+	left := Processor{Name: "test_join_left", Processor: func(r routeBranch) joinLeft {
+		return joinLeft{Left: "l"}
+	}}
+	right := Processor{Name: "test_join_right", Processor: func(r routeBranch) (joinRight, error) {
+		if r.Branch == "right" {
+			return joinRight{}, ErrDrop
+		}
+		return joinRight{Right: "r"}, nil
+	}}
+	merge := Processor{Name: "test_join_merge", Processor: func(r joinRequest) error {
+		rec.add(r.Left + r.Right)
+		return nil
+	}}
+
+	conf := StreamConfig{
+		Name: root.Name,
+		Childs: []StreamConfig{
+			{
+				Name: left.Name,
+				Childs: []StreamConfig{
+					{Name: merge.Name, Join: &JoinConfig{From: []string{left.Name, right.Name}}},
+				},
+			},
+			{Name: right.Name},
+		},
+	}
+	p := newStreamPipeline(t, "test_join", conf, root, left, right, merge)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	for i := 0; i < 3; i++ {
+		res, err := p.Trigger(nil)
+		assert.NilError(t, err)
+		assert.Equal(t, res.Status, RunStatusSucceeded)
+	}
+	assert.DeepEqual(t, rec.reset(), []string{"lr", "lr", "lr"})
+
+	// 有上游丢弃数据时, 汇合节点不会执行, 运行仍然正常结束
+	res, err := p.Trigger(map[string]string{"drop": "right"})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusSucceeded)
+	assert.Equal(t, len(rec.reset()), 0)
+	assert.Equal(t, p.Monitor().With(merge.Name).Get(METRICS_KEY_STREAM_DROP_COUNT).String(), "1")
+
+	var buf bytes.Buffer
+	assert.NilError(t, DotGrgphVisualizer(&buf, p))
+	assert.Assert(t, strings.Contains(buf.String(), `"test_join_right" -> "test_join_merge" [style=dashed]`))
+}
+
+func TestJoinPartial(t *testing.T) {
+	var rec joinRecorder
+	root := Processor{Name: "test_join_partial_root", Processor: func(r paramsRequest) routeBranch {
+		return routeBranch{Branch: "right"}
+	}}
+	left := Processor{Name: "test_join_partial_left", Processor: func(r routeBranch) joinLeft {
+		return joinLeft{Left: "l"}
+	}}
+	right := Processor{Name: "test_join_partial_right", Processor: func(r routeBranch) (joinRight, error) {
+		return joinRight{}, ErrDrop
+	}}
+	merge := Processor{Name: "test_join_partial_merge", Processor: func(r joinLeft) error {
+		rec.add(r.Left)
+		return nil
+	}}
+
+	p := newStreamPipeline(t, "test_join_partial", StreamConfig{
+		Name: root.Name,
+		Childs: []StreamConfig{
+			{Name: left.Name},
+			{
+				Name: right.Name,
+				Childs: []StreamConfig{
+					{Name: merge.Name, Join: &JoinConfig{From: []string{left.Name, right.Name}, Partial: true}},
+				},
+			},
+		},
+	}, root, left, right, merge)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	res, err := p.Trigger(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusSucceeded)
+	assert.DeepEqual(t, rec.reset(), []string{"l"})
+}
+
+func TestStreamGraphValidation(t *testing.T) {
+	procs := map[string]Processor{}
+	for _, name := range []string{"a", "b", "b2", "c", "d"} {
+		procs[name] = Processor{Name: name, Processor: func(r ctxRequest) error { return nil }}
+	}
+
+	for _, tc := range []struct {
+		conf StreamConfig
+		err  string
+	}{
+		{
+			conf: StreamConfig{Name: "a", Route: &RouteConfig{By: "Branch"}},
+			err:  "route requires at least one child",
+		},
+		{
+			conf: StreamConfig{Name: "a", Route: &RouteConfig{By: "Branch", Default: "c"},
+				Childs: []StreamConfig{{Name: "b"}}},
+			err: "the default branch c of route is not found",
+		},
+		{
+			conf: StreamConfig{Name: "a", Childs: []StreamConfig{
+				{Name: "b", Childs: []StreamConfig{{Name: "d", Join: &JoinConfig{From: []string{"b"}}}}},
+			}},
+			err: "at least two upstreams",
+		},
+		{
+			conf: StreamConfig{Name: "a", Childs: []StreamConfig{
+				{Name: "b", Childs: []StreamConfig{{Name: "d", Join: &JoinConfig{From: []string{"a", "c"}}}}},
+				{Name: "c"},
+			}},
+			err: "join must wait for its parent b",
+		},
+		{
+			conf: StreamConfig{Name: "a", Childs: []StreamConfig{
+				{Name: "b", Childs: []StreamConfig{{Name: "d", Join: &JoinConfig{From: []string{"b", "x"}}}}},
+			}},
+			err: "join upstream x is not found",
+		},
+		{
+			conf: StreamConfig{Name: "a", Childs: []StreamConfig{
+				{Name: "b", Childs: []StreamConfig{{Name: "c", Join: &JoinConfig{From: []string{"b", "d"}},
+					Childs: []StreamConfig{{Name: "d"}}}}},
+			}},
+			err: "cannot be itself or its descendant",
+		},
+		{
+			conf: StreamConfig{Name: "a", Childs: []StreamConfig{
+				{Name: "b", Childs: []StreamConfig{{Name: "c", Join: &JoinConfig{From: []string{"b", "d"}}}}},
+				{Name: "b2", Childs: []StreamConfig{{Name: "d", Join: &JoinConfig{From: []string{"b2", "c"}}}}},
+			}},
+			err: "forms a cycle",
+		},
+	} {
+		_, err := NewStream(tc.conf, procs)
+		assert.ErrorContains(t, err, tc.err)
+	}
+}
+
+func TestCheckJoinDependence(t *testing.T) {
+	root := Processor{Name: "test_check_join_root", Processor: func(r ctxRequest) error { return nil }}
+	left := Processor{Name: "test_check_join_left", Processor: func(r ctxRequest) joinLeft { return joinLeft{} }}
+	right := Processor{Name: "test_check_join_right", Processor: func(r ctxRequest) joinRight { return joinRight{} }}
+	merge := Processor{Name: "test_check_join_merge", Processor: func(r joinRequest) error { return nil }}
+
+	// merge在right之前声明, 依赖的Right由right返回
+	stream, err := NewStream(StreamConfig{
+		Name:  root.Name,
+		Route: &RouteConfig{By: "Branch"},
+		Childs: []StreamConfig{
+			{Name: left.Name, Childs: []StreamConfig{
+				{Name: merge.Name, Join: &JoinConfig{From: []string{left.Name, right.Name}}},
+			}},
+			{Name: right.Name},
+		},
+	}, map[string]Processor{root.Name: root, left.Name: left, right.Name: right, merge.Name: merge})
+	assert.NilError(t, err)
+
+	_, err = New(
+		WithName("test_check_join"),
+		WithProcessors(root, left, right, merge),
+		WithStream(stream),
+		WithConfig(Config{Name: "test_check_join", Schedule: "@yearly"}),
+	)
+	assert.ErrorContains(t, err, "the route value Branch(string) is not returned")
+	assert.Assert(t, !strings.Contains(err.Error(), "Value not found"))
+}
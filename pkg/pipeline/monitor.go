@@ -0,0 +1,34 @@
+package pipeline
+
+const (
+	METRICS_KEY_PIPELINE_UPTIME           = "_pipeline_uptime"
+	METRICS_KEY_PIPELINE_STATE            = "_pipeline_state"
+	METRICS_KEY_PIPELINE_RUN_TIMES        = "_pipeline_run_times"
+	METRICS_KEY_PIPELINE_START_TIME       = "_pipeline_start_time"
+	METRICS_KEY_PIPELINE_EXIT_TIME        = "_pipeline_exit_time"
+	METRICS_KEY_PIPELINE_NEXT_RUN_TIME    = "_pipeline_next_run_time"
+	METRICS_KEY_PIPELINE_LAST_START_TIME  = "_pipeline_last_start_time"
+	METRICS_KEY_PIPELINE_LAST_END_TIME    = "_pipeline_last_end_time"
+	METRICS_KEY_PIPELINE_RUNNING          = "_pipeline_running_runs"
+	METRICS_KEY_PIPELINE_SKIP_TIMES       = "_pipeline_skip_times"
+	METRICS_KEY_PIPELINE_LAST_SKIP_TIME   = "_pipeline_last_skip_time"
+	METRICS_KEY_PIPELINE_LAST_SKIP_REASON = "_pipeline_last_skip_reason"
+
+	METRICS_KEY_STREAM_BUFFER_SIZE     = "_stream_buffer_size"
+	METRICS_KEY_STREAM_REPLICA         = "_stream_replica"
+	METRICS_KEY_STREAM_QUEUE_DEPTH     = "_stream_queue_depth"
+	METRICS_KEY_STREAM_RUN_TIMES       = "_stream_run_times"
+	METRICS_KEY_STREAM_RUNNING         = "_stream_running_replica"
+	METRICS_KEY_STREAM_START_TIME      = "_stream_start_time"
+	METRICS_KEY_STREAM_EXIT_TIME       = "_stream_exit_time"
+	METRICS_KEY_STREAM_LAST_START_TIME = "_stream_last_start_time"
+	METRICS_KEY_STREAM_LAST_END_TIME   = "_stream_last_end_time"
+	METRICS_KEY_STREAM_SUCCESS_COUNT   = "_stream_success_count"
+	METRICS_KEY_STREAM_ERROR_COUNT     = "_stream_error_count"
+	METRICS_KEY_STREAM_DROP_COUNT      = "_stream_drop_count"
+	METRICS_KEY_STREAM_ELAPSED         = "_stream_elapsed"
+	METRICS_KEY_STREAM_RETRY_COUNT     = "_stream_retry_count"
+	METRICS_KEY_STREAM_TIMEOUT_COUNT   = "_stream_timeout_count"
+	METRICS_KEY_STREAM_DEAD_LETTER     = "_stream_dead_letter_count"
+	METRICS_KEY_STREAM_DEAD_LETTER_ERR = "_stream_dead_letter_error_count"
+)
@@ -0,0 +1,98 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/shima-park/lotus/common/inject"
+)
+
+type Option func(*pipeliner)
+
+func WithContext(ctx context.Context) Option {
+	return func(p *pipeliner) {
+		ctx, cancel := context.WithCancel(ctx)
+		p.ctx = ctx
+		p.cancel = cancel
+	}
+}
+
+func WithComponents(components ...Component) Option {
+	return func(p *pipeliner) {
+		p.components = components
+	}
+}
+
+func WithProcessors(processors ...Processor) Option {
+	return func(p *pipeliner) {
+		// 关闭函数由stream持有, 这里只保留processor函数
+		p.processors = make([]Processor, len(processors))
+		for i, proc := range processors {
+			proc.Processor, _ = UnwrapProcessor(proc.Processor)
+			p.processors[i] = proc
+		}
+	}
+}
+
+func WithInjector(injector inject.Injector) Option {
+	return func(p *pipeliner) {
+		p.injector = injector
+	}
+}
+
+func WithStream(stream *Stream) Option {
+	return func(p *pipeliner) {
+		p.stream = stream
+	}
+}
+
+func WithName(name string) Option {
+	return func(p *pipeliner) {
+		p.name = name
+	}
+}
+
+func WithSchedule(s Schedule) Option {
+	return func(p *pipeliner) {
+		p.schedule = s
+	}
+}
+
+// withClock 替换调度使用的时钟
+func withClock(c clock) Option {
+	return func(p *pipeliner) {
+		p.clock = c
+	}
+}
+
+// WithStateStore 设置调度状态的持久化存储, 未设置时不会补跑停机期间错过的调度
+func WithStateStore(store StateStore) Option {
+	return func(p *pipeliner) {
+		p.store = store
+	}
+}
+
+// WithRunStore 设置运行记录的持久化存储
+func WithRunStore(store RunStore) Option {
+	return func(p *pipeliner) {
+		p.runStore = store
+	}
+}
+
+// WithRunListener 每次运行结束时调用f, f不能阻塞
+func WithRunListener(f func(RunResult)) Option {
+	return func(p *pipeliner) {
+		p.listeners = append(p.listeners, f)
+	}
+}
+
+func WithConfig(config Config) Option {
+	return func(p *pipeliner) {
+		p.config = config
+	}
+}
+
+func apply(p *pipeliner, opts []Option) {
+	for _, opt := range opts {
+		opt(p)
+	}
+}
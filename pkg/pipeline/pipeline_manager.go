@@ -0,0 +1,313 @@
+package pipeline
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"errors"
+
+	"github.com/shima-park/lotus/common/log"
+)
+
+type PipelinerManager interface {
+	AddPipeline(config Config) (Pipeliner, error)
+	RemovePipeline(name ...string) error
+	RecreatePipeline(config Config) (Pipeliner, error)
+	List() []Pipeliner
+	Find(name string) Pipeliner
+	Restart(name ...string) error
+	Start(name ...string) error
+	Stop(name ...string) error
+	Pause(name ...string) error
+	Resume(name ...string) error
+	Trigger(name string, params map[string]string) (RunResult, error)
+	Runs(name string) ([]RunResult, error)
+}
+
+type pipelinerManager struct {
+	rwlock    sync.RWMutex
+	pipelines map[string]Pipeliner // key: name value: Pipeliner
+	opts      []Option             // 创建每个pipeline时使用的公共选项
+
+	dagLock sync.Mutex
+	// key: 下游pipeline, value: 自上次触发以来已经满足条件的上游pipeline
+	satisfied map[string]map[string]struct{}
+}
+
+func NewPipelinerManager(opts ...Option) PipelinerManager {
+	pm := &pipelinerManager{
+		pipelines: map[string]Pipeliner{},
+		satisfied: map[string]map[string]struct{}{},
+	}
+	pm.opts = append(opts, WithRunListener(pm.onRunFinish))
+	return pm
+}
+
+func (p *pipelinerManager) List() []Pipeliner {
+	var ps []Pipeliner
+
+	p.rwlock.RLock()
+	for _, p := range p.pipelines {
+		ps = append(ps, p)
+	}
+	p.rwlock.RUnlock()
+
+	sort.Slice(ps, func(i, j int) bool {
+		return ps[i].Name() < ps[j].Name()
+	})
+
+	return ps
+}
+
+func (p *pipelinerManager) Find(name string) Pipeliner {
+	p.rwlock.Lock()
+	defer p.rwlock.Unlock()
+
+	return p.find(name)
+}
+
+func (p *pipelinerManager) find(name string) Pipeliner {
+	return p.pipelines[name]
+}
+
+func (p *pipelinerManager) AddPipeline(config Config) (Pipeliner, error) {
+	p.rwlock.Lock()
+	defer p.rwlock.Unlock()
+
+	return p.addPipeline(config)
+}
+
+func (p *pipelinerManager) addPipeline(config Config) (Pipeliner, error) {
+	_, ok := p.pipelines[config.Name]
+	if ok {
+		return nil, fmt.Errorf("Pipeline: %s is already register", config.Name)
+	}
+
+	if err := p.checkDependencyCycle(config); err != nil {
+		return nil, err
+	}
+
+	pipe, err := NewPipelineByConfig(config, p.opts...)
+	if err != nil {
+		return nil, err
+	}
+	p.pipelines[config.Name] = pipe
+	return pipe, nil
+}
+
+// checkDependencyCycle 检查用config替换同名pipeline之后是否存在循环依赖
+func (p *pipelinerManager) checkDependencyCycle(config Config) error {
+	configs := []Config{config}
+	for name, pipe := range p.pipelines {
+		if name != config.Name {
+			configs = append(configs, pipe.GetConfig())
+		}
+	}
+	return checkDependencyCycle(configs)
+}
+
+func (p *pipelinerManager) RemovePipeline(names ...string) error {
+	return p.doByName(false, names, p.removePipeline)
+}
+
+func (p *pipelinerManager) removePipeline(pipe Pipeliner) error {
+	pipe.Stop()
+	delete(p.pipelines, pipe.Name())
+
+	p.dagLock.Lock()
+	delete(p.satisfied, pipe.Name())
+	p.dagLock.Unlock()
+	return nil
+}
+
+func (p *pipelinerManager) RecreatePipeline(config Config) (Pipeliner, error) {
+	name := config.Name
+	var pipe Pipeliner
+	err := p.doByName(false, []string{name}, func(oldPipe Pipeliner) error {
+		// 先检查依赖, 避免停止了正在运行的pipeline之后才发现无法重建
+		err := p.checkDependencyCycle(config)
+		if err != nil {
+			return fmt.Errorf("Pipeline(%s) %v", name, err)
+		}
+
+		// 停止之后状态变为Exited, 需要在停止之前记录, 暂停中的pipeline重建之后保持暂停
+		state := oldPipe.State()
+		err = p.removePipeline(oldPipe)
+		if err != nil {
+			return fmt.Errorf("Pipeline(%s) %v", name, err)
+		}
+
+		pipe, err = p.addPipeline(config)
+		if err != nil {
+			return fmt.Errorf("Pipeline(%s) %v", name, err)
+		}
+
+		err = StartWithState(pipe, state)
+		if err != nil {
+			return fmt.Errorf("Pipeline(%s) %v", name, err)
+		}
+		return nil
+	})
+
+	return pipe, err
+}
+
+func (p *pipelinerManager) Restart(names ...string) error {
+	return p.doByName(false, names, func(oldPipe Pipeliner) error {
+		name := oldPipe.Name()
+		err := p.removePipeline(oldPipe)
+		if err != nil {
+			return fmt.Errorf("Pipeline(%s) %v", name, err)
+		}
+
+		pipe, err := p.addPipeline(oldPipe.GetConfig())
+		if err != nil {
+			return fmt.Errorf("Pipeline(%s) %v", name, err)
+		}
+
+		err = pipe.Start()
+		if err != nil {
+			return fmt.Errorf("Pipeline(%s) %v", name, err)
+		}
+		return nil
+	})
+}
+
+func (p *pipelinerManager) Start(names ...string) error {
+	return p.doByName(true, names, func(pipe Pipeliner) error {
+		if pipe.State() == Exited {
+			return fmt.Errorf("Pipeline(%s)'s state is exited, please try to restart it", pipe.Name())
+		}
+		return pipe.Start()
+	})
+}
+
+func (p *pipelinerManager) Stop(names ...string) error {
+	return p.doByName(true, names, func(pipe Pipeliner) error {
+		pipe.Stop()
+		return nil
+	})
+}
+
+func (p *pipelinerManager) Pause(names ...string) error {
+	return p.doByName(true, names, func(pipe Pipeliner) error {
+		return pipe.Pause()
+	})
+}
+
+func (p *pipelinerManager) Resume(names ...string) error {
+	return p.doByName(true, names, func(pipe Pipeliner) error {
+		return pipe.Resume()
+	})
+}
+
+func (p *pipelinerManager) doByName(isReadLock bool, names []string, callback func(pipe Pipeliner) error) error {
+	if isReadLock {
+		p.rwlock.RLock()
+		defer p.rwlock.RUnlock()
+	} else {
+		p.rwlock.Lock()
+		defer p.rwlock.Unlock()
+	}
+
+	var errs []string
+	for _, name := range names {
+		pipe := p.find(name)
+		if pipe == nil {
+			errs = append(errs, fmt.Sprintf("Pipeline: %s is not found", name))
+			continue
+		}
+
+		err := callback(pipe)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("Pipeline: %s %v", name, err))
+			continue
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ""))
+	}
+
+	return nil
+}
+
+func (p *pipelinerManager) Trigger(name string, params map[string]string) (RunResult, error) {
+	pipe := p.Find(name)
+	if pipe == nil {
+		return RunResult{}, fmt.Errorf("Pipeline: %s is not found", name)
+	}
+
+	// 运行可能持续较长时间, 不能持有锁等待
+	return pipe.Trigger(params)
+}
+
+func (p *pipelinerManager) Runs(name string) ([]RunResult, error) {
+	pipe := p.Find(name)
+	if pipe == nil {
+		return nil, fmt.Errorf("Pipeline: %s is not found", name)
+	}
+	return pipe.Runs()
+}
+
+// onRunFinish 在上游pipeline的执行goroutine中被调用, 不能阻塞也不能持有manager的锁
+func (p *pipelinerManager) onRunFinish(res RunResult) {
+	go p.triggerDownstreams(res)
+}
+
+func (p *pipelinerManager) triggerDownstreams(upstream RunResult) {
+	var ready []Pipeliner
+	p.rwlock.RLock()
+	p.dagLock.Lock()
+	for _, pipe := range p.pipelines {
+		deps := pipe.GetConfig().DependsOn
+		for _, dep := range deps {
+			if dep.Pipeline != upstream.Pipeline || !dep.match(upstream) {
+				continue
+			}
+
+			if _, ok := p.satisfied[pipe.Name()]; !ok {
+				p.satisfied[pipe.Name()] = map[string]struct{}{}
+			}
+			p.satisfied[pipe.Name()][upstream.Pipeline] = struct{}{}
+
+			if len(p.satisfied[pipe.Name()]) == len(upstreams(deps)) {
+				delete(p.satisfied, pipe.Name())
+				ready = append(ready, pipe)
+			}
+			break
+		}
+	}
+	p.dagLock.Unlock()
+	p.rwlock.RUnlock()
+
+	params := map[string]string{
+		"upstream_pipeline": upstream.Pipeline,
+		"upstream_run_id":   upstream.ID,
+	}
+	for _, pipe := range ready {
+		go func(pipe Pipeliner) {
+			var err error
+			if t, ok := pipe.(interface {
+				trigger(Trigger, map[string]string) (RunResult, error)
+			}); ok {
+				_, err = t.trigger(TriggerUpstream, params)
+			} else {
+				_, err = pipe.Trigger(params)
+			}
+			if err != nil {
+				log.Error("Pipeline: %s, Trigger by upstream %s error: %s", pipe.Name(), upstream.Pipeline, err)
+			}
+		}(pipe)
+	}
+}
+
+func upstreams(deps []Dependency) map[string]struct{} {
+	names := map[string]struct{}{}
+	for _, dep := range deps {
+		names[dep.Pipeline] = struct{}{}
+	}
+	return names
+}
@@ -0,0 +1,676 @@
+package pipeline
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"io"
+	"reflect"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/common/monitor"
+)
+
+type Pipeliner interface {
+	Name() string
+	Start() error
+	Stop()
+	// Pause 停止向stream中投递新的数据, 组件保持连接, 不等待正在处理的数据完成,
+	// 处理完成之前状态为Draining, 之后为Paused
+	Pause() error
+	// Resume 恢复被暂停的pipeline
+	Resume() error
+	State() State
+	ListComponents() []Component
+	ListProcessors() []Processor
+	Monitor() monitor.Monitor
+	GetConfig() Config
+	Visualize(w io.Writer, format string) error
+	CheckDependence() []error
+	// NextRunTimes 返回接下来n次的调度时间, 死循环调度返回nil
+	NextRunTimes(n int) []time.Time
+	// Trigger 忽略调度计划立即执行一次, 阻塞直到本次运行结束
+	Trigger(params map[string]string) (RunResult, error)
+	// Tap 实时采样processor的输入输出, ctx结束, 达到Limit或者pipeline停止时关闭返回的通道
+	Tap(ctx context.Context, opts TapOptions) (<-chan TapEvent, error)
+	// Runs 返回正在进行和已经结束的运行记录, 按照开始时间倒序
+	Runs() ([]RunResult, error)
+}
+
+type pipeliner struct {
+	config Config
+
+	name       string
+	components []Component
+	processors []Processor
+
+	ctx       context.Context
+	cancel    context.CancelFunc
+	schedule  Schedule
+	clock     clock
+	store     StateStore
+	runStore  RunStore
+	listeners []func(RunResult)
+	injector  inject.Injector
+	startTime time.Time
+
+	stream  *Stream
+	monitor monitor.Monitor
+
+	state        int32
+	runningWg    sync.WaitGroup
+	exec         atomic.Value // *execContext, Start之后可用
+	bootstrapped int32
+
+	taps *tapHub
+
+	pauseLock sync.Mutex
+	resumeC   chan struct{} // 暂停时创建, 恢复时关闭
+}
+
+func New(opts ...Option) (Pipeliner, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &pipeliner{
+		ctx:       ctx,
+		cancel:    cancel,
+		injector:  inject.New(),
+		clock:     realClock{},
+		startTime: time.Now(),
+	}
+
+	apply(p, opts)
+
+	if p.stream == nil {
+		return nil, fmt.Errorf("The pipeliner(%s) must have at least one stream", p.Name())
+	}
+
+	if p.name == "" {
+		return nil, fmt.Errorf("The pipeliner(%s)'s name cannot be empty", p.Name())
+	}
+
+	if err := checkStreamNames(p.stream); err != nil {
+		return nil, fmt.Errorf("Pipeline: %s %v", p.Name(), err)
+	}
+
+	if err := validatePolicies(p.config); err != nil {
+		return nil, fmt.Errorf("Pipeline: %s %v", p.Name(), err)
+	}
+
+	if p.schedule == nil && len(p.config.DependsOn) > 0 && p.config.Schedule == "" {
+		p.schedule = NeverSchedule{}
+	}
+
+	if p.schedule == nil {
+		var err error
+		p.schedule, err = ParseSchedule(p.config.Schedule, p.config.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Pipeline: %s %v", p.Name(), err)
+		}
+	}
+
+	// 死循环调度每次运行结束后立即开始下一次, 没有调度计划的pipeline不会被调度, 随机延迟没有意义
+	switch p.schedule.(type) {
+	case ConstantDelaySchedule, NeverSchedule:
+		if p.config.Jitter > 0 {
+			return nil, fmt.Errorf("Pipeline: %s jitter is only supported by cron schedules", p.Name())
+		}
+	}
+
+	p.monitor = monitor.NewMonitor(p.Name())
+	p.monitor.Set(METRICS_KEY_PIPELINE_STATE, expvar.Func(func() interface{} { return p.State() }))
+
+	p.injector.MapTo(p.monitor, "Monitor", (*monitor.Monitor)(nil))
+	p.injector.MapTo(p.ctx, "Context", (*context.Context)(nil))
+	// 每次运行会覆盖为本次运行的参数, 这里注入空值以便依赖检查通过
+	p.injector.Map(map[string]string{}, "Params")
+
+	distinct := map[reflect.Type]map[string]struct{}{}
+	for _, c := range p.components {
+		instance := c.Component.Instance()
+
+		if _, ok := distinct[instance.Type()]; !ok {
+			distinct[instance.Type()] = map[string]struct{}{}
+		}
+
+		if _, ok := distinct[instance.Type()][instance.Name()]; ok {
+			return nil, fmt.Errorf("Pipeline: %s, Component: %s, Type: %s, Name: %s is already registered",
+				p.Name(), c.Name, instance.Type(), instance.Name(),
+			)
+		}
+
+		distinct[instance.Type()][instance.Name()] = struct{}{}
+
+		p.injector.Set(instance.Type(), instance.Name(), instance.Value())
+	}
+
+	if errs := p.CheckDependence(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	if err := resolveDeadLetters(p.stream, p.components); err != nil {
+		return nil, fmt.Errorf("Pipeline: %s %v", p.Name(), err)
+	}
+
+	p.taps = newTapHub(p.components)
+
+	if err := resolveRateLimits(p.stream, p.components, p.config.ComponentRateLimits); err != nil {
+		return nil, fmt.Errorf("Pipeline: %s %v", p.Name(), err)
+	}
+
+	return p, nil
+}
+
+func NewPipelineByConfig(conf Config, opts ...Option) (Pipeliner, error) {
+	components, err := conf.NewComponents()
+	if err != nil {
+		return nil, fmt.Errorf("Pipeline: %s %v", conf.Name, err)
+	}
+
+	processors, err := conf.NewProcessors()
+	if err != nil {
+		return nil, fmt.Errorf("Pipeline: %s %v", conf.Name, err)
+	}
+
+	var pm = map[string]Processor{}
+	for _, p := range processors {
+		pm[p.Name] = p
+	}
+
+	stream, err := NewStream(conf.Stream, pm)
+	if err != nil {
+		closeProcessors(processors)
+		return nil, fmt.Errorf("Pipeline: %s %v", conf.Name, err)
+	}
+
+	pipe, err := New(
+		append(
+			[]Option{
+				WithName(conf.Name),
+				WithComponents(components...),
+				WithProcessors(processors...),
+				WithStream(stream),
+				WithConfig(conf),
+			},
+			opts...,
+		)...,
+	)
+	if err != nil {
+		closeProcessors(processors)
+		return nil, err
+	}
+	return pipe, nil
+}
+
+// checkStreamNames 每个节点拥有独立的输入队列, 同一个processor不能在stream中出现多次
+func checkStreamNames(s *Stream) error {
+	var err error
+	names := map[string]struct{}{}
+	s.Walk(func(s *Stream) {
+		if _, ok := names[s.Name()]; ok && err == nil {
+			err = fmt.Errorf("Stream(%s) is duplicated", s.Name())
+		}
+		names[s.Name()] = struct{}{}
+	})
+	return err
+}
+
+func (p *pipeliner) Name() string {
+	return p.name
+}
+
+func (p *pipeliner) CheckDependence() []error {
+	checkInj := inject.New()
+	checkInj.SetParent(p.injector)
+	return check(p.stream, checkInj)
+}
+
+func (p *pipeliner) Start() error {
+	return p.start(Running)
+}
+
+// start 以Running或者Paused状态启动, 以Paused状态启动时等待Resume之后才开始调度
+func (p *pipeliner) start(state State) error {
+	p.pauseLock.Lock()
+	if !atomic.CompareAndSwapInt32(&p.state, int32(Idle), int32(state)) {
+		p.pauseLock.Unlock()
+		return nil
+	}
+	if state == Paused {
+		p.resumeC = make(chan struct{})
+	}
+	p.pauseLock.Unlock()
+
+	for _, c := range p.components {
+		if err := c.Component.Start(); err != nil {
+			return err
+		}
+	}
+
+	c := newExecContext(p.ctx, p.Name(), p.injector, p.stream, p.monitor)
+	c.onFinish = p.onRunFinish
+	c.gate = func() bool { return p.State() == Running }
+	c.taps = p.taps
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	p.exec.Store(c)
+	p.monitor.Set(METRICS_KEY_PIPELINE_RUNNING, expvar.Func(func() interface{} { return c.Running() }))
+
+	p.runningWg.Add(1)
+	go func() {
+		defer p.runningWg.Done()
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-ticker.C:
+				p.monitor.Set(METRICS_KEY_PIPELINE_UPTIME, monitor.Elapsed(time.Since(p.startTime)))
+			}
+		}
+	}()
+
+	p.runningWg.Add(1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error("Pipeline: %s, Panic: %s, Stack: %s",
+					p.Name(), r, string(debug.Stack()))
+			}
+			c.Stop()
+
+			p.monitor.Set(METRICS_KEY_PIPELINE_EXIT_TIME, monitor.Time(time.Now()))
+
+			p.runningWg.Done()
+		}()
+
+		p.monitor.Set(METRICS_KEY_PIPELINE_START_TIME, monitor.Time(time.Now()))
+
+		p.catchUp(c)
+
+		next := p.schedule.Next(p.clock.Now())
+		if next.IsZero() {
+			// 没有调度计划, 只能通过手动或者上游触发
+			<-p.ctx.Done()
+			return
+		}
+
+		timer := p.clock.NewTimer(next.Sub(p.clock.Now()) + jitter(p.config.Jitter))
+		p.monitor.Set(METRICS_KEY_PIPELINE_NEXT_RUN_TIME, monitor.Time(next))
+
+		for {
+			select {
+			case <-p.ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C():
+				scheduled := next
+				next = p.schedule.Next(p.clock.Now())
+				if !next.IsZero() {
+					timer.Reset(next.Sub(p.clock.Now()) + jitter(p.config.Jitter))
+					p.monitor.Set(METRICS_KEY_PIPELINE_NEXT_RUN_TIME, monitor.Time(next))
+				}
+
+				p.fire(c, scheduled, p.scheduleTrigger())
+			}
+		}
+	}()
+
+	return nil
+}
+
+// 本进程中已经处理过错过的调度的pipeline
+var caughtUp sync.Map
+
+// catchUp 根据CatchUpPolicy处理服务停机期间错过的调度, 只在随进程启动的pipeline本进程第一次启动时处理,
+// 手动停止之后再启动或者重建pipeline不会补跑停止期间的调度
+func (p *pipeliner) catchUp(c *execContext) {
+	if p.store == nil || !p.config.Bootstrap {
+		return
+	}
+	if _, loaded := caughtUp.LoadOrStore(p.Name(), struct{}{}); loaded {
+		return
+	}
+
+	last, err := p.store.LastScheduleTime(p.Name())
+	if err != nil {
+		log.Error("Pipeline: %s, Load schedule state error: %s", p.Name(), err)
+		return
+	}
+
+	missed := missedRunTimes(p.schedule, last, p.clock.Now(), maxCatchUpRuns)
+	if len(missed) == 0 {
+		return
+	}
+
+	switch p.config.CatchUpPolicy {
+	case CatchUpPolicyRunOnce:
+		p.fire(c, missed[len(missed)-1], TriggerSchedule)
+	case CatchUpPolicyRunAll:
+		for _, t := range missed {
+			if p.isStopped() {
+				return
+			}
+			p.fire(c, t, TriggerSchedule)
+		}
+	default:
+		p.skip(fmt.Sprintf("missed %d runs while stopped, last at %s",
+			len(missed), missed[len(missed)-1].Format("2006-01-02 15:04:05")))
+		p.saveScheduleTime(missed[len(missed)-1])
+	}
+}
+
+// scheduleTrigger 随进程启动的pipeline第一次调度记为bootstrap
+func (p *pipeliner) scheduleTrigger() Trigger {
+	if p.config.Bootstrap && atomic.CompareAndSwapInt32(&p.bootstrapped, 0, 1) {
+		return TriggerBootstrap
+	}
+	return TriggerSchedule
+}
+
+// fire 根据ConcurrencyPolicy执行一次调度
+func (p *pipeliner) fire(c *execContext, scheduled time.Time, trigger Trigger) {
+	if s := p.State(); s == Paused || s == Draining {
+		if !isConstantDelay(p.schedule) {
+			p.skip("pipeline is paused")
+			p.saveScheduleTime(scheduled)
+			return
+		}
+
+		// 死循环调度等待恢复, 避免空转
+		if !p.waitResume() {
+			return
+		}
+	}
+
+	if c.Running() > 0 {
+		switch p.config.ConcurrencyPolicy {
+		case ConcurrencyPolicyForbid:
+			if !isConstantDelay(p.schedule) {
+				p.skip("previous run is still running")
+				p.saveScheduleTime(scheduled)
+				return
+			}
+			// 死循环调度没有固定的调度时间, 等待上一次运行结束即可
+			c.WaitRunning()
+		case ConcurrencyPolicyReplace:
+			c.CancelRunning()
+		}
+	}
+
+	p.monitor.Set(METRICS_KEY_PIPELINE_LAST_START_TIME, monitor.Time(time.Now()))
+	p.monitor.Add(METRICS_KEY_PIPELINE_RUN_TIMES, 1)
+
+	_, err := c.Run(trigger, nil)
+	if err != nil {
+		return
+	}
+	p.saveScheduleTime(scheduled)
+}
+
+func (p *pipeliner) Pause() error {
+	p.pauseLock.Lock()
+	if !atomic.CompareAndSwapInt32(&p.state, int32(Running), int32(Draining)) {
+		p.pauseLock.Unlock()
+		return fmt.Errorf("Pipeline(%s)'s state is %s, only running pipeline can be paused", p.Name(), p.State())
+	}
+	resumeC := make(chan struct{})
+	p.resumeC = resumeC
+	p.pauseLock.Unlock()
+
+	log.Info("Pipeline: %s, Draining in-flight runs", p.Name())
+
+	c, ok := p.exec.Load().(*execContext)
+	if !ok {
+		p.drained(resumeC)
+		return nil
+	}
+
+	// 暂停之后gate拒绝新的根节点调用, 排队中的运行直接结束,
+	// 根节点正在处理或者已经进入stream的数据需要处理完, processor缓存的数据也需要输出,
+	// 流式的根节点可能阻塞在没有数据的source上, 因此不在这里等待
+	go func() {
+		c.FlushDeferred()
+		c.WaitRunning()
+		p.drained(resumeC)
+	}()
+	return nil
+}
+
+// drained 进行中的运行结束之后由draining进入paused, 期间已经被恢复或者再次暂停时不修改状态
+func (p *pipeliner) drained(resumeC chan struct{}) {
+	p.pauseLock.Lock()
+	defer p.pauseLock.Unlock()
+
+	if p.resumeC == resumeC && atomic.CompareAndSwapInt32(&p.state, int32(Draining), int32(Paused)) {
+		log.Info("Pipeline: %s, Paused", p.Name())
+	}
+}
+
+func (p *pipeliner) Resume() error {
+	p.pauseLock.Lock()
+	defer p.pauseLock.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&p.state, int32(Paused), int32(Running)) &&
+		!atomic.CompareAndSwapInt32(&p.state, int32(Draining), int32(Running)) {
+		return fmt.Errorf("Pipeline(%s)'s state is %s, only paused pipeline can be resumed", p.Name(), p.State())
+	}
+	close(p.resumeC)
+
+	log.Info("Pipeline: %s, Resumed", p.Name())
+	return nil
+}
+
+// StartWithState 按照重建之前的状态启动pipeline, Running时启动, Paused和Draining时启动之后保持暂停,
+// 其他状态不启动
+func StartWithState(pipe Pipeliner, state State) error {
+	switch state {
+	case Running:
+		return pipe.Start()
+	case Paused, Draining:
+		if p, ok := pipe.(*pipeliner); ok {
+			return p.start(Paused)
+		}
+		if err := pipe.Start(); err != nil {
+			return err
+		}
+		return pipe.Pause()
+	}
+	return nil
+}
+
+// waitResume 阻塞直到pipeline被恢复, pipeline被停止时返回false
+func (p *pipeliner) waitResume() bool {
+	p.pauseLock.Lock()
+	resumeC := p.resumeC
+	p.pauseLock.Unlock()
+
+	if resumeC == nil {
+		return true
+	}
+
+	select {
+	case <-p.ctx.Done():
+		return false
+	case <-resumeC:
+		return true
+	}
+}
+
+func (p *pipeliner) Tap(ctx context.Context, opts TapOptions) (<-chan TapEvent, error) {
+	if _, ok := p.stream.Get(opts.Processor); !ok {
+		return nil, fmt.Errorf("Pipeline: %s, Processor: %s is not found in the stream", p.Name(), opts.Processor)
+	}
+
+	if p.isStopped() {
+		return nil, fmt.Errorf("Pipeline: %s is stopped", p.Name())
+	}
+
+	return p.taps.subscribe(ctx, opts)
+}
+
+func (p *pipeliner) Trigger(params map[string]string) (RunResult, error) {
+	return p.trigger(TriggerManual, params)
+}
+
+func (p *pipeliner) trigger(trigger Trigger, params map[string]string) (RunResult, error) {
+	if p.State() != Running {
+		return RunResult{}, fmt.Errorf("Pipeline(%s)'s state is %s, please start it first", p.Name(), p.State())
+	}
+
+	c, ok := p.exec.Load().(*execContext)
+	if !ok {
+		return RunResult{}, fmt.Errorf("Pipeline(%s) is not ready", p.Name())
+	}
+
+	log.Info("Pipeline: %s, Trigger run by %s with params: %v", p.Name(), trigger, params)
+
+	p.monitor.Set(METRICS_KEY_PIPELINE_LAST_START_TIME, monitor.Time(time.Now()))
+	p.monitor.Add(METRICS_KEY_PIPELINE_RUN_TIMES, 1)
+
+	r, err := c.Run(trigger, params)
+	if err != nil {
+		return r.Result(), err
+	}
+
+	<-r.Done()
+	return r.Result(), nil
+}
+
+func (p *pipeliner) onRunFinish(res RunResult) {
+	p.monitor.Set(METRICS_KEY_PIPELINE_LAST_END_TIME, monitor.Time(res.EndTime))
+
+	for _, listener := range p.listeners {
+		listener(res)
+	}
+
+	// 死循环调度的pipeline每处理一条数据就是一次运行, 只记录手动触发的运行
+	if p.runStore == nil || (isConstantDelay(p.schedule) && res.Trigger == TriggerSchedule) {
+		return
+	}
+
+	if err := p.runStore.Append(res); err != nil {
+		log.Error("Pipeline: %s, Save run %s error: %s", p.Name(), res.ID, err)
+	}
+}
+
+func (p *pipeliner) Runs() ([]RunResult, error) {
+	var runs []RunResult
+	if c, ok := p.exec.Load().(*execContext); ok {
+		runs = c.ListRunning()
+		sort.Slice(runs, func(i, j int) bool {
+			return runs[i].StartTime.After(runs[j].StartTime)
+		})
+	}
+
+	if p.runStore == nil {
+		return runs, nil
+	}
+
+	history, err := p.runStore.List(p.Name())
+	if err != nil {
+		return nil, err
+	}
+
+	// 运行结束时先保存记录再从正在进行的列表中移除, 这期间可能同时出现在两边
+	ids := map[string]struct{}{}
+	for _, r := range history {
+		ids[r.ID] = struct{}{}
+	}
+	var res []RunResult
+	for _, r := range runs {
+		if _, ok := ids[r.ID]; !ok {
+			res = append(res, r)
+		}
+	}
+	return append(res, history...), nil
+}
+
+func (p *pipeliner) skip(reason string) {
+	log.Info("Pipeline: %s, Skip run: %s", p.Name(), reason)
+	p.monitor.Add(METRICS_KEY_PIPELINE_SKIP_TIMES, 1)
+	p.monitor.Set(METRICS_KEY_PIPELINE_LAST_SKIP_TIME, monitor.Time(time.Now()))
+	p.monitor.Set(METRICS_KEY_PIPELINE_LAST_SKIP_REASON, monitor.String(reason))
+}
+
+func (p *pipeliner) saveScheduleTime(t time.Time) {
+	if p.store == nil || isConstantDelay(p.schedule) {
+		return
+	}
+
+	if err := p.store.SetLastScheduleTime(p.Name(), t); err != nil {
+		log.Error("Pipeline: %s, Save schedule state error: %s", p.Name(), err)
+	}
+}
+
+func (p *pipeliner) Stop() {
+	if p.isStopped() {
+		return
+	}
+
+	p.cancel()
+
+	p.runningWg.Wait()
+	p.taps.close()
+	closeStreams(p.Name(), p.stream)
+
+	for _, c := range p.components {
+		if err := c.Component.Stop(); err != nil {
+			log.Error("Failed to stop %s component error: %s", c.Component.Instance().Name(), err)
+		}
+	}
+
+	atomic.StoreInt32(&p.state, int32(Exited))
+}
+
+func (p *pipeliner) isStopped() bool {
+	select {
+	case <-p.ctx.Done():
+		return true
+	default:
+	}
+	return false
+}
+
+func (p *pipeliner) State() State {
+	return State(atomic.LoadInt32(&p.state))
+}
+
+func (p *pipeliner) ListComponents() []Component {
+	return p.components
+}
+
+func (p *pipeliner) ListProcessors() []Processor {
+	return p.processors
+}
+
+func (p *pipeliner) Visualize(w io.Writer, format string) error {
+	v, ok := visualizers[format]
+	if !ok {
+		return fmt.Errorf("Unsupported visualize type: %s, supported visualize types: %s",
+			format, supportedVisualizerTypes)
+	}
+
+	return v(w, p)
+}
+
+func (p *pipeliner) Monitor() monitor.Monitor {
+	return p.monitor
+}
+
+func (p *pipeliner) GetConfig() Config {
+	return p.config
+}
+
+func (p *pipeliner) NextRunTimes(n int) []time.Time {
+	return NextRunTimes(p.schedule, p.clock.Now(), n)
+}
@@ -0,0 +1,426 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type intervalSchedule time.Duration
+
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+type memoryStateStore struct {
+	lock  sync.Mutex
+	times map[string]time.Time
+}
+
+func (s *memoryStateStore) LastScheduleTime(name string) (time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.times[name], nil
+}
+
+func (s *memoryStateStore) SetLastScheduleTime(name string, t time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.times[name] = t
+	return nil
+}
+
+type ctxRequest struct {
+	Ctx context.Context `inject:"Context"`
+}
+
+func newTestPipeline(t *testing.T, conf Config, f func(ctxRequest) error, opts ...Option) Pipeliner {
+	proc := Processor{Name: "test_proc", Processor: f}
+	stream, err := NewStream(StreamConfig{Name: proc.Name}, map[string]Processor{proc.Name: proc})
+	assert.NilError(t, err)
+
+	p, err := New(append([]Option{
+		WithName(conf.Name),
+		WithProcessors(proc),
+		WithStream(stream),
+		WithConfig(conf),
+	}, opts...)...)
+	assert.NilError(t, err)
+	return p
+}
+
+// fakeClock 手动推进的时钟, 推进时触发到期的timer
+type fakeClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	c.lock.Lock()
+	c.timers = append(c.timers, t)
+	c.lock.Unlock()
+	t.Reset(d)
+	return t
+}
+
+// Advance 等待调度循环设置好timer后推进时钟
+func (c *fakeClock) Advance(t *testing.T, d time.Duration) {
+	t.Helper()
+	waitUntil(t, func() bool {
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		for _, timer := range c.timers {
+			if timer.active {
+				return true
+			}
+		}
+		return false
+	})
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	for _, timer := range c.timers {
+		if timer.active && !timer.deadline.After(c.now) {
+			timer.fire()
+		}
+	}
+}
+
+type fakeTimer struct {
+	clock    *fakeClock
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	active := t.active
+	t.deadline = t.clock.now.Add(d)
+	t.active = true
+	if d <= 0 {
+		t.fire()
+	}
+	return active
+}
+
+func (t *fakeTimer) fire() {
+	t.active = false
+	select {
+	case t.c <- t.clock.now:
+	default:
+	}
+}
+
+func waitUntil(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition is not satisfied in 5s")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func waitSignal(t *testing.T, c <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-c:
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal is not received in 5s")
+	}
+}
+
+func TestConcurrencyPolicyForbid(t *testing.T) {
+	var runs int32
+	started := make(chan struct{}, 10)
+	clock := newFakeClock(time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC))
+	p := newTestPipeline(t,
+		Config{Name: "test_forbid", ConcurrencyPolicy: ConcurrencyPolicyForbid},
+		func(r ctxRequest) error {
+			atomic.AddInt32(&runs, 1)
+			started <- struct{}{}
+			<-r.Ctx.Done()
+			return nil
+		},
+		WithSchedule(intervalSchedule(time.Minute)),
+		withClock(clock),
+	)
+
+	assert.NilError(t, p.Start())
+	clock.Advance(t, time.Minute)
+	waitSignal(t, started)
+
+	// 上一次运行还未结束, 之后的调度都被跳过
+	for i := 1; i <= 3; i++ {
+		clock.Advance(t, time.Minute)
+		waitUntil(t, func() bool {
+			return p.Monitor().Get(METRICS_KEY_PIPELINE_SKIP_TIMES).String() == strconv.Itoa(i)
+		})
+	}
+	p.Stop()
+
+	assert.Equal(t, atomic.LoadInt32(&runs), int32(1))
+	assert.Equal(t, p.Monitor().Get(METRICS_KEY_PIPELINE_LAST_SKIP_REASON).String(),
+		"previous run is still running")
+}
+
+func TestConcurrencyPolicyReplace(t *testing.T) {
+	var canceled int32
+	started := make(chan struct{}, 10)
+	clock := newFakeClock(time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC))
+	p := newTestPipeline(t,
+		Config{Name: "test_replace", ConcurrencyPolicy: ConcurrencyPolicyReplace},
+		func(r ctxRequest) error {
+			started <- struct{}{}
+			<-r.Ctx.Done()
+			atomic.AddInt32(&canceled, 1)
+			return nil
+		},
+		WithSchedule(intervalSchedule(time.Minute)),
+		withClock(clock),
+	)
+
+	assert.NilError(t, p.Start())
+	clock.Advance(t, time.Minute)
+	waitSignal(t, started)
+
+	// 每次调度都取消上一次的运行
+	for i := int32(1); i <= 3; i++ {
+		clock.Advance(t, time.Minute)
+		waitSignal(t, started)
+		waitUntil(t, func() bool { return atomic.LoadInt32(&canceled) == i })
+	}
+	p.Stop()
+}
+
+func TestCatchUpPolicyRunAll(t *testing.T) {
+	schedule, err := ParseSchedule("@hourly", "")
+	assert.NilError(t, err)
+
+	now := time.Date(2020, 1, 1, 10, 30, 0, 0, time.UTC)
+	store := &memoryStateStore{times: map[string]time.Time{
+		"test_catch_up": now.Add(-3*time.Hour - time.Minute),
+	}}
+
+	// 补跑的记录在进程内共享, 清除之前的测试留下的记录以便重复执行
+	caughtUp.Delete("test_catch_up")
+
+	var runs int32
+	finished := make(chan struct{}, 10)
+	p := newTestPipeline(t,
+		Config{Name: "test_catch_up", CatchUpPolicy: CatchUpPolicyRunAll, Bootstrap: true},
+		func(r ctxRequest) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+		WithSchedule(schedule),
+		WithStateStore(store),
+		WithRunListener(func(RunResult) { finished <- struct{}{} }),
+		withClock(newFakeClock(now)),
+	)
+
+	assert.NilError(t, p.Start())
+	for i := 0; i < 3; i++ {
+		waitSignal(t, finished)
+	}
+	p.Stop()
+
+	// 08:00, 09:00, 10:00三次调度被补跑
+	assert.Equal(t, atomic.LoadInt32(&runs), int32(3))
+	last, _ := store.LastScheduleTime("test_catch_up")
+	assert.Equal(t, last, time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC))
+
+	// 手动停止之后再启动不会补跑停止期间错过的调度
+	p = newTestPipeline(t,
+		Config{Name: "test_catch_up", CatchUpPolicy: CatchUpPolicyRunAll, Bootstrap: true},
+		func(r ctxRequest) error {
+			atomic.AddInt32(&runs, 1)
+			return nil
+		},
+		WithSchedule(schedule),
+		WithStateStore(store),
+		withClock(newFakeClock(now.Add(3*time.Hour))),
+	)
+	assert.NilError(t, p.Start())
+	time.Sleep(20 * time.Millisecond)
+	p.Stop()
+	assert.Equal(t, atomic.LoadInt32(&runs), int32(3))
+}
+
+func TestJitterRequiresCron(t *testing.T) {
+	proc := Processor{Name: "test_jitter", Processor: func(r ctxRequest) error { return nil }}
+	stream, err := NewStream(StreamConfig{Name: proc.Name}, map[string]Processor{proc.Name: proc})
+	assert.NilError(t, err)
+
+	for _, schedule := range []Schedule{ConstantDelaySchedule{}, NeverSchedule{}} {
+		_, err := New(
+			WithName("test_jitter"),
+			WithProcessors(proc),
+			WithStream(stream),
+			WithConfig(Config{Name: "test_jitter", Jitter: time.Second}),
+			WithSchedule(schedule),
+		)
+		assert.ErrorContains(t, err, "jitter is only supported by cron schedules")
+	}
+
+	schedule, err := ParseSchedule("@every 1m", "")
+	assert.NilError(t, err)
+	_, err = New(
+		WithName("test_jitter"),
+		WithProcessors(proc),
+		WithStream(stream),
+		WithConfig(Config{Name: "test_jitter", Jitter: time.Second}),
+		WithSchedule(schedule),
+	)
+	assert.NilError(t, err)
+}
+
+type paramsRequest struct {
+	Params map[string]string `inject:"Params"`
+}
+
+func TestTrigger(t *testing.T) {
+	proc := Processor{Name: "test_params", Processor: func(r paramsRequest) error {
+		if r.Params["date"] == "" {
+			return errors.New("date is required")
+		}
+		return nil
+	}}
+	stream, err := NewStream(StreamConfig{Name: proc.Name}, map[string]Processor{proc.Name: proc})
+	assert.NilError(t, err)
+
+	p, err := New(
+		WithName("test_trigger"),
+		WithProcessors(proc),
+		WithStream(stream),
+		WithConfig(Config{Name: "test_trigger", Schedule: "@yearly"}),
+	)
+	assert.NilError(t, err)
+
+	_, err = p.Trigger(nil)
+	assert.ErrorContains(t, err, "please start it first")
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	res, err := p.Trigger(map[string]string{"date": "2020-01-01"})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusSucceeded)
+
+	res, err = p.Trigger(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusFailed)
+	assert.Assert(t, strings.Contains(res.Error, "date is required"))
+}
+
+func TestPauseResume(t *testing.T) {
+	var runs int32
+	p := newTestPipeline(t,
+		Config{Name: "test_pause"},
+		func(r ctxRequest) error {
+			atomic.AddInt32(&runs, 1)
+			time.Sleep(time.Millisecond)
+			return nil
+		},
+		WithSchedule(ConstantDelaySchedule{}),
+	)
+
+	assert.ErrorContains(t, p.Resume(), "only paused pipeline can be resumed")
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	waitUntil(t, func() bool { return atomic.LoadInt32(&runs) > 0 })
+	assert.NilError(t, p.Pause())
+	waitUntil(t, func() bool { return p.State() == Paused })
+
+	paused := atomic.LoadInt32(&runs)
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, atomic.LoadInt32(&runs), paused)
+
+	_, err := p.Trigger(nil)
+	assert.ErrorContains(t, err, "state is paused")
+
+	assert.NilError(t, p.Resume())
+	assert.Equal(t, p.State(), Running)
+	waitUntil(t, func() bool { return atomic.LoadInt32(&runs) > paused })
+}
+
+func TestPauseDrainsInFlight(t *testing.T) {
+	var rec joinRecorder
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var calls int32
+	root := Processor{Name: "test_pause_drain_root", Processor: func(r ctxRequest) (joinLeft, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			entered <- struct{}{}
+			<-release
+		}
+		return joinLeft{Left: strconv.Itoa(int(n))}, nil
+	}}
+	child := Processor{Name: "test_pause_drain_child", Processor: func(r joinLeft) error {
+		rec.add(r.Left)
+		return nil
+	}}
+
+	conf := StreamConfig{Name: root.Name, Childs: []StreamConfig{{Name: child.Name}}}
+	stream, err := NewStream(conf, map[string]Processor{root.Name: root, child.Name: child})
+	assert.NilError(t, err)
+	p, err := New(
+		WithName("test_pause_drain"),
+		WithProcessors(root, child),
+		WithStream(stream),
+		WithSchedule(ConstantDelaySchedule{}),
+		WithConfig(Config{Name: "test_pause_drain", Stream: conf}),
+	)
+	assert.NilError(t, err)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	// 根节点处理第一条数据时暂停, 暂停不等待这条数据, 这条数据仍然需要被子节点处理
+	waitSignal(t, entered)
+	assert.NilError(t, p.Pause())
+	assert.Equal(t, p.State(), Draining)
+	close(release)
+	waitUntil(t, func() bool { return p.State() == Paused })
+
+	assert.DeepEqual(t, rec.reset(), []string{"1"})
+	assert.Equal(t, atomic.LoadInt32(&calls), int32(1))
+}
@@ -0,0 +1,131 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+
+	"golang.org/x/time/rate"
+)
+
+func (r RateLimit) newLimiter() (*rate.Limiter, error) {
+	if r.Rate <= 0 || math.IsInf(r.Rate, 0) || math.IsNaN(r.Rate) {
+		return nil, fmt.Errorf("Invalid rate limit %v, must be greater than 0", r.Rate)
+	}
+
+	burst := r.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(r.Rate))
+	}
+	return rate.NewLimiter(rate.Limit(r.Rate), burst), nil
+}
+
+func (r RateLimit) String() string {
+	if r.Burst > 0 {
+		return fmt.Sprintf("%g/s(burst %d)", r.Rate, r.Burst)
+	}
+	return fmt.Sprintf("%g/s", r.Rate)
+}
+
+// resolveRateLimits 为stream中的节点绑定令牌桶
+// 节点自身配置的限流和节点依赖的组件的限流都需要满足
+func resolveRateLimits(stream *Stream, components []Component, limits map[string]RateLimit) error {
+	instances := map[string]Component{}
+	for _, c := range components {
+		instances[c.Component.Instance().Name()] = c
+	}
+
+	var names []string
+	for name := range limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	componentLimiters := map[string]*rate.Limiter{}
+	for _, name := range names {
+		if _, ok := instances[name]; !ok {
+			return fmt.Errorf("Rate limit component %s not found", name)
+		}
+
+		limiter, err := limits[name].newLimiter()
+		if err != nil {
+			return fmt.Errorf("Component(%s) %v", name, err)
+		}
+		componentLimiters[name] = limiter
+	}
+
+	var err error
+	stream.Walk(func(s *Stream) {
+		if err != nil {
+			return
+		}
+
+		s.limiters = nil
+		if s.config.RateLimit != nil {
+			limiter, lerr := s.config.RateLimit.newLimiter()
+			if lerr != nil {
+				err = fmt.Errorf("Stream(%s) %v", s.Name(), lerr)
+				return
+			}
+			s.limiters = append(s.limiters, limiter)
+		}
+
+		for _, name := range injectNames(s.processor.Processor) {
+			if limiter, ok := componentLimiters[name]; ok {
+				s.limiters = append(s.limiters, limiter)
+			}
+		}
+	})
+	return err
+}
+
+// injectNames 返回processor请求参数中所有需要注入的名称
+func injectNames(p interface{}) []string {
+	t := reflect.TypeOf(p)
+	if t == nil || t.Kind() != reflect.Func {
+		return nil
+	}
+
+	seen := map[string]struct{}{}
+	var names []string
+	for i := 0; i < t.NumIn(); i++ {
+		argType := t.In(i)
+		for argType.Kind() == reflect.Ptr {
+			argType = argType.Elem()
+		}
+
+		if argType.Kind() != reflect.Struct {
+			continue
+		}
+
+		for j := 0; j < argType.NumField(); j++ {
+			field := argType.Field(j)
+			if field.Tag != "inject" && field.Tag.Get("inject") == "" {
+				continue
+			}
+
+			name := field.Tag.Get("inject")
+			if name == "" {
+				name = field.Name
+			}
+
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// wait 等待节点所有的令牌桶都获取到令牌
+func (s *Stream) wait(ctx context.Context) error {
+	for _, limiter := range s.limiters {
+		if err := limiter.Wait(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
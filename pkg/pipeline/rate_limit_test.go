@@ -0,0 +1,69 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+type rateLimitRequest struct {
+	Writer  interface{ Write([]byte) (int, error) } `inject:"rate_limit_writer"`
+	Message string                                  `inject:"Message"`
+}
+
+func TestRateLimit(t *testing.T) {
+	root := Processor{Name: "test_rate_limit_root", Processor: func() retryMessage {
+		return retryMessage{Message: "hello"}
+	}}
+	sink := Processor{Name: "test_rate_limit_sink", Processor: func(r rateLimitRequest) error {
+		_, err := r.Writer.Write([]byte(r.Message))
+		return err
+	}}
+
+	assert.DeepEqual(t, injectNames(sink.Processor), []string{"rate_limit_writer", "Message"})
+
+	stream, err := NewStream(StreamConfig{
+		Name:      root.Name,
+		RateLimit: &RateLimit{Rate: 1000},
+		Childs:    []StreamConfig{{Name: sink.Name}},
+	}, map[string]Processor{root.Name: root, sink.Name: sink})
+	assert.NilError(t, err)
+
+	var buf syncBuffer
+	newPipeline := func(limits map[string]RateLimit) (Pipeliner, error) {
+		return New(
+			WithName("test_rate_limit"),
+			WithComponents(newBufferComponent("rate_limit_writer", &buf)),
+			WithProcessors(root, sink),
+			WithStream(stream),
+			WithConfig(Config{Name: "test_rate_limit", Schedule: "@yearly", ComponentRateLimits: limits}),
+		)
+	}
+
+	_, err = newPipeline(map[string]RateLimit{"not_exists": {Rate: 1}})
+	assert.ErrorContains(t, err, "Rate limit component not_exists not found")
+
+	_, err = newPipeline(map[string]RateLimit{"rate_limit_writer": {Rate: 0}})
+	assert.ErrorContains(t, err, "Invalid rate limit")
+
+	p, err := newPipeline(map[string]RateLimit{"rate_limit_writer": {Rate: 20, Burst: 1}})
+	assert.NilError(t, err)
+
+	s, _ := stream.Get(sink.Name)
+	assert.Equal(t, len(s.limiters), 1)
+	assert.Equal(t, len(stream.limiters), 1)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		res, err := p.Trigger(nil)
+		assert.NilError(t, err)
+		assert.Equal(t, res.Status, RunStatusSucceeded)
+	}
+	// 第一个令牌立即可用, 之后每50ms产生一个
+	assert.Assert(t, time.Since(start) >= 190*time.Millisecond)
+	assert.Equal(t, string(buf.Bytes()), "hellohellohellohellohello")
+}
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+const (
+	defaultInitialBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff        = 10 * time.Second
+	defaultBackoffMultiplier = 2
+)
+
+// retrier 根据RetryPolicy判断失败后是否需要重试以及重试前的等待时间
+type retrier struct {
+	policy  RetryPolicy
+	retryOn []*regexp.Regexp
+}
+
+func newRetrier(policy *RetryPolicy) (*retrier, error) {
+	if policy == nil {
+		return nil, nil
+	}
+
+	if policy.MaxAttempts < 0 {
+		return nil, fmt.Errorf("Invalid max_attempts %d, must be greater than or equal to 0", policy.MaxAttempts)
+	}
+
+	r := &retrier{policy: *policy}
+	if r.policy.InitialBackoff <= 0 {
+		r.policy.InitialBackoff = defaultInitialBackoff
+	}
+	if r.policy.MaxBackoff <= 0 {
+		r.policy.MaxBackoff = defaultMaxBackoff
+	}
+	if r.policy.MaxBackoff < r.policy.InitialBackoff {
+		r.policy.MaxBackoff = r.policy.InitialBackoff
+	}
+	if r.policy.Multiplier < 1 {
+		r.policy.Multiplier = defaultBackoffMultiplier
+	}
+
+	for _, expr := range policy.RetryOn {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid retry_on %s: %v", expr, err)
+		}
+		r.retryOn = append(r.retryOn, re)
+	}
+	return r, nil
+}
+
+// maxAttempts 返回最大执行次数, 没有配置重试时只执行一次
+func (r *retrier) maxAttempts() int {
+	if r == nil || r.policy.MaxAttempts == 0 {
+		return 1
+	}
+	return r.policy.MaxAttempts
+}
+
+// retryable 判断错误是否可以重试, 没有配置retry_on时所有错误都可以重试
+func (r *retrier) retryable(err error) bool {
+	if r == nil || err == nil {
+		return false
+	}
+
+	if len(r.retryOn) == 0 {
+		return true
+	}
+
+	for _, re := range r.retryOn {
+		if re.MatchString(err.Error()) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff 返回第attempt(从1开始)次执行失败后需要等待的时间
+func (r *retrier) backoff(attempt int) time.Duration {
+	d := float64(r.policy.InitialBackoff)
+	for i := 1; i < attempt && d < float64(r.policy.MaxBackoff); i++ {
+		d *= r.policy.Multiplier
+	}
+
+	if d > float64(r.policy.MaxBackoff) {
+		return r.policy.MaxBackoff
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,215 @@
+package pipeline
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/component"
+	"gotest.tools/v3/assert"
+)
+
+func TestRetrierBackoff(t *testing.T) {
+	r, err := newRetrier(&RetryPolicy{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     5 * time.Second,
+	})
+	assert.NilError(t, err)
+
+	assert.Equal(t, r.backoff(1), time.Second)
+	assert.Equal(t, r.backoff(2), 2*time.Second)
+	assert.Equal(t, r.backoff(3), 4*time.Second)
+	assert.Equal(t, r.backoff(4), 5*time.Second)
+
+	var nilRetrier *retrier
+	assert.Equal(t, nilRetrier.maxAttempts(), 1)
+	assert.Assert(t, !nilRetrier.retryable(errors.New("any")))
+
+	r, err = newRetrier(&RetryPolicy{MaxAttempts: 3, RetryOn: []string{"timeout", "^connection refused"}})
+	assert.NilError(t, err)
+	assert.Assert(t, r.retryable(errors.New("Stream(x) timeout after 1s")))
+	assert.Assert(t, r.retryable(errors.New("connection refused")))
+	assert.Assert(t, !r.retryable(errors.New("invalid payload")))
+
+	_, err = newRetrier(&RetryPolicy{RetryOn: []string{"("}})
+	assert.ErrorContains(t, err, "Invalid retry_on")
+}
+
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+type bufferComponent struct {
+	instance component.Instance
+}
+
+func newBufferComponent(name string, w *syncBuffer) Component {
+	return Component{
+		Name: "buffer",
+		Component: &bufferComponent{
+			instance: component.NewInstance(
+				name, inject.InterfaceOf((*interface{ Write([]byte) (int, error) })(nil)), reflect.ValueOf(w), w,
+			),
+		},
+	}
+}
+
+func (c *bufferComponent) Instance() component.Instance { return c.instance }
+func (c *bufferComponent) Start() error                 { return nil }
+func (c *bufferComponent) Stop() error                  { return nil }
+
+type retryMessage struct {
+	Message string `inject:"Message"`
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	var attempts int32
+	root := Processor{Name: "test_retry_root", Processor: func() retryMessage {
+		return retryMessage{Message: "hello"}
+	}}
+	flaky := Processor{Name: "test_retry_flaky", Processor: func(r retryMessage) error {
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}}
+	broken := Processor{Name: "test_retry_broken", Processor: func(r retryMessage) error {
+		return errors.New("invalid payload")
+	}}
+
+	stream, err := NewStream(StreamConfig{
+		Name: root.Name,
+		Childs: []StreamConfig{
+			{
+				Name:  flaky.Name,
+				Retry: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryOn: []string{"refused"}},
+			},
+			{
+				Name:       broken.Name,
+				Retry:      &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryOn: []string{"refused"}},
+				DeadLetter: &DeadLetterConfig{Component: "dead_letter"},
+			},
+		},
+	}, map[string]Processor{root.Name: root, flaky.Name: flaky, broken.Name: broken})
+	assert.NilError(t, err)
+
+	var buf syncBuffer
+	p, err := New(
+		WithName("test_retry"),
+		WithComponents(newBufferComponent("dead_letter", &buf)),
+		WithProcessors(root, flaky, broken),
+		WithStream(stream),
+		WithConfig(Config{Name: "test_retry", Schedule: "@yearly"}),
+	)
+	assert.NilError(t, err)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	res, err := p.Trigger(map[string]string{"k": "v"})
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusFailed)
+	assert.ErrorContains(t, errors.New(res.Error), "invalid payload")
+	assert.Equal(t, atomic.LoadInt32(&attempts), int32(3))
+
+	var dl DeadLetter
+	assert.NilError(t, json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &dl))
+	assert.Equal(t, dl.Pipeline, "test_retry")
+	assert.Equal(t, dl.Processor, broken.Name)
+	assert.Equal(t, dl.RunID, res.ID)
+	assert.Equal(t, dl.Attempts, 1)
+	assert.Equal(t, dl.Error, "invalid payload")
+	assert.Equal(t, dl.Params["k"], "v")
+	assert.Equal(t, string(dl.Payload), `{"Message":"hello"}`)
+
+	moni := p.Monitor().With(flaky.Name)
+	assert.Equal(t, moni.Get(METRICS_KEY_STREAM_RETRY_COUNT).String(), "2")
+	assert.Equal(t, p.Monitor().With(broken.Name).Get(METRICS_KEY_STREAM_DEAD_LETTER).String(), "1")
+}
+
+func TestTimeout(t *testing.T) {
+	proc := Processor{Name: "test_timeout", Processor: func(r ctxRequest) error {
+		<-r.Ctx.Done()
+		return r.Ctx.Err()
+	}}
+	stream, err := NewStream(StreamConfig{Name: proc.Name, Timeout: 10 * time.Millisecond},
+		map[string]Processor{proc.Name: proc})
+	assert.NilError(t, err)
+
+	p, err := New(
+		WithName("test_timeout"),
+		WithProcessors(proc),
+		WithStream(stream),
+		WithConfig(Config{Name: "test_timeout", Schedule: "@yearly"}),
+	)
+	assert.NilError(t, err)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	res, err := p.Trigger(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusFailed)
+	assert.ErrorContains(t, errors.New(res.Error), "timeout after 10ms")
+}
+
+func TestTimeoutRetryWaitsForAttempt(t *testing.T) {
+	var active, overlapped, attempts int32
+	proc := Processor{Name: "test_timeout_retry", Processor: func(r ctxRequest) error {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.StoreInt32(&overlapped, 1)
+		}
+		defer atomic.AddInt32(&active, -1)
+
+		// 第一次执行超时之后才返回, 第二次执行成功
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			<-r.Ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			return r.Ctx.Err()
+		}
+		return nil
+	}}
+	stream, err := NewStream(StreamConfig{
+		Name:    proc.Name,
+		Timeout: 10 * time.Millisecond,
+		Retry:   &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	}, map[string]Processor{proc.Name: proc})
+	assert.NilError(t, err)
+
+	p, err := New(
+		WithName("test_timeout_retry"),
+		WithProcessors(proc),
+		WithStream(stream),
+		WithConfig(Config{Name: "test_timeout_retry", Schedule: "@yearly"}),
+	)
+	assert.NilError(t, err)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	res, err := p.Trigger(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, RunStatusSucceeded)
+	assert.Equal(t, atomic.LoadInt32(&attempts), int32(2))
+	assert.Equal(t, atomic.LoadInt32(&overlapped), int32(0))
+}
@@ -0,0 +1,70 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/shima-park/lotus/common/inject"
+)
+
+var stringType = reflect.TypeOf("")
+
+// BranchName 父节点配置了route时本节点所属的分支
+func (s *Stream) BranchName() string {
+	if s.config.Branch != "" {
+		return s.config.Branch
+	}
+	return s.Name()
+}
+
+func (s *Stream) resolveRoute() error {
+	route := s.config.Route
+	if route == nil {
+		return nil
+	}
+
+	if route.By == "" {
+		return fmt.Errorf("Stream(%s) the by of route is required", s.Name())
+	}
+
+	if len(s.childs) == 0 {
+		return fmt.Errorf("Stream(%s) route requires at least one child", s.Name())
+	}
+
+	if route.Default != "" && len(s.branch(route.Default)) == 0 {
+		return fmt.Errorf("Stream(%s) the default branch %s of route is not found", s.Name(), route.Default)
+	}
+	return nil
+}
+
+// branch 返回分支名称为name的子节点
+func (s *Stream) branch(name string) []*Stream {
+	var res []*Stream
+	for _, c := range s.childs {
+		if c.BranchName() == name {
+			res = append(res, c)
+		}
+	}
+	return res
+}
+
+// targets 返回执行成功后需要发送数据的下游节点, 没有匹配任何分支时dropped为true
+func (s *Stream) targets(inj inject.Injector) (targets []*Stream, dropped bool) {
+	childs := s.childs
+	if route := s.config.Route; route != nil {
+		var name string
+		if v := inj.Get(stringType, route.By); v.IsValid() {
+			name = v.String()
+		}
+
+		childs = s.branch(name)
+		if len(childs) == 0 && route.Default != "" {
+			childs = s.branch(route.Default)
+		}
+		dropped = len(childs) == 0
+	}
+
+	targets = append(targets, childs...)
+	targets = append(targets, s.joins...)
+	return targets, dropped
+}
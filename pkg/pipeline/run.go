@@ -0,0 +1,203 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/xid"
+)
+
+type RunStatus string
+
+const (
+	RunStatusRunning   RunStatus = "running"
+	RunStatusSucceeded RunStatus = "succeeded"
+	RunStatusFailed    RunStatus = "failed"
+	RunStatusCanceled  RunStatus = "canceled"
+)
+
+// Trigger 运行的触发方式
+type Trigger string
+
+const (
+	TriggerSchedule  Trigger = "schedule"
+	TriggerManual    Trigger = "manual"
+	TriggerBootstrap Trigger = "bootstrap"
+	TriggerUpstream  Trigger = "upstream"
+	// processor通过Emitter在定时器中产生的输出
+	TriggerTimer Trigger = "timer"
+)
+
+// ProcessorStat 一次运行中单个processor的执行统计
+type ProcessorStat struct {
+	Name    string        `yaml:"name"`
+	Calls   int           `yaml:"calls"`
+	Elapsed time.Duration `yaml:"elapsed"`
+}
+
+// RunResult 一次运行的结果
+type RunResult struct {
+	ID         string            `yaml:"id"`
+	Pipeline   string            `yaml:"pipeline"`
+	Trigger    Trigger           `yaml:"trigger"`
+	Status     RunStatus         `yaml:"status"`
+	StartTime  time.Time         `yaml:"start_time"`
+	EndTime    time.Time         `yaml:"end_time,omitempty"`
+	Error      string            `yaml:"error,omitempty"`
+	Params     map[string]string `yaml:"params,omitempty"`
+	Processors []ProcessorStat   `yaml:"processors,omitempty"`
+}
+
+// run 表示stream树的一次完整执行, 从根节点开始直到所有分支都执行完毕
+type run struct {
+	id        string
+	pipeline  string
+	trigger   Trigger
+	params    map[string]string
+	ctx       context.Context
+	cancel    context.CancelFunc
+	startTime time.Time
+	// 运行结束时调用, 在Done返回的通道关闭之前执行
+	onFinish func(RunResult)
+
+	// 还未处理完成的节点数, 归零时表示本次运行结束
+	pending int64
+	done    chan struct{}
+
+	// 汇合节点暂存的数据数, 包含在pending中, pending等于held时已经没有流转中的数据,
+	// 暂存的数据不会再等到其他上游, 此时调用onStall
+	holdLock sync.Mutex
+	held     int64
+	onStall  func()
+
+	lock       sync.Mutex
+	err        error
+	endTime    time.Time
+	processors map[string]*ProcessorStat
+}
+
+func newRun(parent context.Context, pipeline string, trigger Trigger, params map[string]string) *run {
+	ctx, cancel := context.WithCancel(parent)
+	return &run{
+		id:         xid.New().String(),
+		pipeline:   pipeline,
+		trigger:    trigger,
+		params:     params,
+		ctx:        ctx,
+		cancel:     cancel,
+		startTime:  time.Now(),
+		done:       make(chan struct{}),
+		processors: map[string]*ProcessorStat{},
+	}
+}
+
+func (r *run) add(delta int64) {
+	atomic.AddInt64(&r.pending, delta)
+}
+
+// observe 记录processor的一次执行耗时
+func (r *run) observe(name string, elapsed time.Duration) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	stat, ok := r.processors[name]
+	if !ok {
+		stat = &ProcessorStat{Name: name}
+		r.processors[name] = stat
+	}
+	stat.Calls++
+	stat.Elapsed += elapsed
+}
+
+// hold 汇合节点暂存或者释放数据
+func (r *run) hold(delta int64) {
+	r.holdLock.Lock()
+	r.held += delta
+	r.holdLock.Unlock()
+}
+
+// finish 标记一个节点处理完成, 只记录第一个错误
+func (r *run) finish(err error) {
+	if err != nil {
+		r.lock.Lock()
+		if r.err == nil {
+			r.err = err
+		}
+		r.lock.Unlock()
+	}
+
+	r.holdLock.Lock()
+	pending := atomic.AddInt64(&r.pending, -1)
+	stalled := pending > 0 && pending == r.held
+	r.holdLock.Unlock()
+
+	if stalled && r.onStall != nil {
+		r.onStall()
+	}
+
+	if pending == 0 {
+		r.lock.Lock()
+		r.endTime = time.Now()
+		r.lock.Unlock()
+		r.cancel()
+
+		if r.onFinish != nil {
+			r.onFinish(r.Result())
+		}
+		close(r.done)
+	}
+}
+
+func (r *run) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *run) isCanceled() bool {
+	select {
+	case <-r.ctx.Done():
+		return true
+	default:
+	}
+	return false
+}
+
+func (r *run) Result() RunResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	res := RunResult{
+		ID:        r.id,
+		Pipeline:  r.pipeline,
+		Trigger:   r.trigger,
+		StartTime: r.startTime,
+		EndTime:   r.endTime,
+		Params:    r.params,
+	}
+
+	if r.err != nil {
+		res.Error = r.err.Error()
+	}
+
+	switch {
+	case r.endTime.IsZero():
+		res.Status = RunStatusRunning
+	case r.err == nil:
+		res.Status = RunStatusSucceeded
+	case errors.Is(r.err, context.Canceled):
+		res.Status = RunStatusCanceled
+	default:
+		res.Status = RunStatusFailed
+	}
+
+	for _, stat := range r.processors {
+		res.Processors = append(res.Processors, *stat)
+	}
+	sort.Slice(res.Processors, func(i, j int) bool {
+		return res.Processors[i].Name < res.Processors[j].Name
+	})
+	return res
+}
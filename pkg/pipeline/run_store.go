@@ -0,0 +1,96 @@
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+)
+
+// 每个pipeline默认保留的运行记录数
+const defaultRunHistoryLimit = 100
+
+// RunStore 持久化pipeline的运行记录
+type RunStore interface {
+	Append(res RunResult) error
+	// List 按照开始时间倒序返回pipeline的运行记录
+	List(name string) ([]RunResult, error)
+}
+
+type fileRunStore struct {
+	lock  sync.Mutex
+	dir   string
+	limit int
+}
+
+// NewFileRunStore 每个pipeline的运行记录保存在dir下的{name}.yaml中, 最多保留limit条
+func NewFileRunStore(dir string, limit int) RunStore {
+	if limit <= 0 {
+		limit = defaultRunHistoryLimit
+	}
+	return &fileRunStore{dir: dir, limit: limit}
+}
+
+func (s *fileRunStore) path(name string) string {
+	return filepath.Join(s.dir, name+".yaml")
+}
+
+func (s *fileRunStore) Append(res RunResult) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	runs, err := s.load(res.Pipeline)
+	if err != nil {
+		return err
+	}
+
+	// 运行按结束顺序保存, 开始早的运行可能后结束, 按开始时间插入
+	i := sort.Search(len(runs), func(i int) bool {
+		return !runs[i].StartTime.After(res.StartTime)
+	})
+	runs = append(runs[:i], append([]RunResult{res}, runs[i:]...)...)
+	if len(runs) > s.limit {
+		runs = runs[:s.limit]
+	}
+
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(runs)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path(res.Pipeline) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(res.Pipeline))
+}
+
+func (s *fileRunStore) List(name string) ([]RunResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.load(name)
+}
+
+func (s *fileRunStore) load(name string) ([]RunResult, error) {
+	data, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var runs []RunResult
+	if err := yaml.Unmarshal(data, &runs); err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFileRunStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runs")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	store := NewFileRunStore(dir, 3)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		assert.NilError(t, store.Append(RunResult{
+			ID:        fmt.Sprint(i),
+			Pipeline:  "test_runs",
+			Trigger:   TriggerSchedule,
+			Status:    RunStatusSucceeded,
+			StartTime: start.Add(time.Duration(i) * time.Hour),
+			Processors: []ProcessorStat{
+				{Name: "test_proc", Calls: 1, Elapsed: time.Second},
+			},
+		}))
+	}
+
+	runs, err := store.List("test_runs")
+	assert.NilError(t, err)
+	assert.Equal(t, len(runs), 3)
+	assert.Equal(t, runs[0].ID, "4")
+	assert.Equal(t, runs[2].ID, "2")
+	assert.Equal(t, runs[0].Processors[0].Elapsed, time.Second)
+
+	// 开始早但后结束的运行按开始时间排列
+	assert.NilError(t, store.Append(RunResult{
+		ID:        "late",
+		Pipeline:  "test_runs",
+		StartTime: start.Add(3*time.Hour + time.Minute),
+	}))
+	runs, err = store.List("test_runs")
+	assert.NilError(t, err)
+	assert.Equal(t, runs[0].ID, "4")
+	assert.Equal(t, runs[1].ID, "late")
+	assert.Equal(t, runs[2].ID, "3")
+
+	runs, err = store.List("not_exists")
+	assert.NilError(t, err)
+	assert.Equal(t, len(runs), 0)
+}
+
+func TestRunHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "runs")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := newTestPipeline(t,
+		Config{Name: "test_history", Schedule: "@yearly"},
+		func(r ctxRequest) error { return nil },
+		WithRunStore(NewFileRunStore(dir, 0)),
+	)
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	res, err := p.Trigger(map[string]string{"k": "v"})
+	assert.NilError(t, err)
+
+	runs, err := p.Runs()
+	assert.NilError(t, err)
+	assert.Equal(t, len(runs), 1)
+	assert.Equal(t, runs[0].ID, res.ID)
+	assert.Equal(t, runs[0].Trigger, TriggerManual)
+	assert.Equal(t, runs[0].Status, RunStatusSucceeded)
+	assert.Equal(t, runs[0].Params["k"], "v")
+	assert.Equal(t, runs[0].Processors[0].Name, "test_proc")
+	assert.Equal(t, runs[0].Processors[0].Calls, 1)
+}
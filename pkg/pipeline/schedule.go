@@ -0,0 +1,193 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type ConcurrencyPolicy string
+
+const (
+	// 允许多次运行同时进行
+	ConcurrencyPolicyAllow ConcurrencyPolicy = "allow"
+	// 上一次运行未结束时跳过本次调度
+	ConcurrencyPolicyForbid ConcurrencyPolicy = "forbid"
+	// 取消正在进行的运行后开始本次调度
+	ConcurrencyPolicyReplace ConcurrencyPolicy = "replace"
+)
+
+type CatchUpPolicy string
+
+const (
+	// 忽略停机期间错过的调度
+	CatchUpPolicySkip CatchUpPolicy = "skip"
+	// 启动后立即补跑一次
+	CatchUpPolicyRunOnce CatchUpPolicy = "run_once"
+	// 启动后补跑所有错过的调度, 最多maxCatchUpRuns次
+	CatchUpPolicyRunAll CatchUpPolicy = "run_all"
+)
+
+const maxCatchUpRuns = 100
+
+var cronParser = cron.NewParser(
+	cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor,
+)
+
+type Schedule interface {
+	// Next returns the next activation time, later than the given time.
+	// Next is invoked initially, and then each time the job is run.
+	Next(time.Time) time.Time
+}
+
+// ConstantDelaySchedule 没有配置schedule时使用, 上一次运行被接收后立即开始下一次
+type ConstantDelaySchedule struct {
+}
+
+func (schedule ConstantDelaySchedule) Next(t time.Time) time.Time {
+	return t
+}
+
+// NeverSchedule 不会被调度, 用于只由上游pipeline触发的pipeline
+type NeverSchedule struct {
+}
+
+func (schedule NeverSchedule) Next(t time.Time) time.Time {
+	return time.Time{}
+}
+
+// ParseSchedule 解析schedule配置, 支持:
+// 1. 空字符串: 死循环调度
+// 2. 标准cron表达式, 可选的秒字段: "0 30 * * * *", "30 * * * *"
+// 3. 预定义的描述符: @every 1m, @hourly, @daily ...
+// 4. timezone不为空时按照对应的时区计算cron表达式
+func ParseSchedule(spec, timezone string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return ConstantDelaySchedule{}, nil
+	}
+
+	if timezone != "" && !strings.HasPrefix(spec, "TZ=") && !strings.HasPrefix(spec, "CRON_TZ=") {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, fmt.Errorf("Invalid timezone %s: %v", timezone, err)
+		}
+		spec = "CRON_TZ=" + timezone + " " + spec
+	}
+
+	s, err := cronParser.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid schedule %s: %v", spec, err)
+	}
+	return s, nil
+}
+
+func isConstantDelay(s Schedule) bool {
+	_, ok := s.(ConstantDelaySchedule)
+	return ok
+}
+
+// NextRunTimes 返回from之后的n次调度时间, 死循环调度没有确定的调度时间返回nil
+func NextRunTimes(s Schedule, from time.Time, n int) []time.Time {
+	if isConstantDelay(s) {
+		return nil
+	}
+
+	var times []time.Time
+	t := from
+	for i := 0; i < n; i++ {
+		t = s.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// missedRunTimes 返回(last, now]之间错过的调度时间, 最多返回limit个
+func missedRunTimes(s Schedule, last, now time.Time, limit int) []time.Time {
+	if isConstantDelay(s) || last.IsZero() {
+		return nil
+	}
+
+	var times []time.Time
+	for t := s.Next(last); !t.IsZero() && !t.After(now); t = s.Next(t) {
+		if len(times) >= limit {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// clock 调度使用的时钟, 测试中替换为手动推进的时钟
+type clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) timer
+}
+
+type timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max)))
+}
+
+func validatePolicies(conf Config) error {
+	switch conf.ConcurrencyPolicy {
+	case "", ConcurrencyPolicyAllow, ConcurrencyPolicyForbid, ConcurrencyPolicyReplace:
+	default:
+		return fmt.Errorf("Unsupported concurrency policy: %s", conf.ConcurrencyPolicy)
+	}
+
+	switch conf.CatchUpPolicy {
+	case "", CatchUpPolicySkip, CatchUpPolicyRunOnce, CatchUpPolicyRunAll:
+	default:
+		return fmt.Errorf("Unsupported catch up policy: %s", conf.CatchUpPolicy)
+	}
+
+	for _, dep := range conf.DependsOn {
+		if dep.Pipeline == "" {
+			return errors.New("The pipeline of depends_on cannot be empty")
+		}
+
+		switch dep.Condition {
+		case "", DependencyConditionSuccess, DependencyConditionAlways:
+		default:
+			return fmt.Errorf("Unsupported depends_on condition: %s", dep.Condition)
+		}
+	}
+
+	if conf.Jitter < 0 {
+		return fmt.Errorf("Jitter cannot be negative: %s", conf.Jitter)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseSchedule(t *testing.T) {
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := ParseSchedule("", "")
+	assert.NilError(t, err)
+	assert.Assert(t, NextRunTimes(s, from, 3) == nil)
+
+	// 带秒的cron表达式
+	s, err = ParseSchedule("30 */5 * * * *", "")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, NextRunTimes(s, from, 2), []time.Time{
+		from.Add(30 * time.Second),
+		from.Add(5*time.Minute + 30*time.Second),
+	})
+
+	s, err = ParseSchedule("@every 1m", "")
+	assert.NilError(t, err)
+	assert.Equal(t, s.Next(from), from.Add(time.Minute))
+
+	// 每天上海时间8点, 即UTC时间0点
+	s, err = ParseSchedule("0 8 * * *", "Asia/Shanghai")
+	assert.NilError(t, err)
+	assert.Assert(t, s.Next(from).Equal(from.Add(24*time.Hour)))
+
+	_, err = ParseSchedule("0 8 * * *", "Mars/Olympus")
+	assert.ErrorContains(t, err, "Invalid timezone")
+
+	_, err = ParseSchedule("not a cron", "")
+	assert.ErrorContains(t, err, "Invalid schedule")
+}
+
+func TestMissedRunTimes(t *testing.T) {
+	s, err := ParseSchedule("@hourly", "")
+	assert.NilError(t, err)
+
+	last := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := last.Add(5*time.Hour + 30*time.Minute)
+
+	assert.Equal(t, len(missedRunTimes(s, last, now, maxCatchUpRuns)), 5)
+	assert.Equal(t, len(missedRunTimes(s, last, now, 2)), 2)
+	assert.Equal(t, len(missedRunTimes(s, time.Time{}, now, maxCatchUpRuns)), 0)
+}
@@ -0,0 +1,30 @@
+package pipeline
+
+import "fmt"
+
+var (
+	Idle    State = 0
+	Running State = 1
+	Paused  State = 2
+	Exited  State = 3
+	// 已经暂停, 正在等待进行中的运行结束, 结束之后进入Paused
+	Draining State = 4
+)
+
+type State int32
+
+func (s State) String() string {
+	switch s {
+	case Idle:
+		return "idle"
+	case Running:
+		return "running"
+	case Paused:
+		return "paused"
+	case Exited:
+		return "exited"
+	case Draining:
+		return "draining"
+	}
+	return fmt.Sprintf("unknown(%d)", s)
+}
@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// StateStore 持久化pipeline的调度状态, 服务重启后用于计算错过的调度
+type StateStore interface {
+	LastScheduleTime(name string) (time.Time, error)
+	SetLastScheduleTime(name string, t time.Time) error
+}
+
+type scheduleState struct {
+	LastScheduleTime time.Time `yaml:"last_schedule_time"`
+}
+
+type fileStateStore struct {
+	lock sync.Mutex
+	dir  string
+}
+
+// NewFileStateStore 每个pipeline的状态保存在dir下的{name}.yaml中
+func NewFileStateStore(dir string) StateStore {
+	return &fileStateStore{dir: dir}
+}
+
+func (s *fileStateStore) path(name string) string {
+	return filepath.Join(s.dir, name+".yaml")
+}
+
+func (s *fileStateStore) LastScheduleTime(name string) (time.Time, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := ioutil.ReadFile(s.path(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	var state scheduleState
+	if err := yaml.Unmarshal(data, &state); err != nil {
+		return time.Time{}, err
+	}
+	return state.LastScheduleTime, nil
+}
+
+func (s *fileStateStore) SetLastScheduleTime(name string, t time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0750); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(scheduleState{LastScheduleTime: t})
+	if err != nil {
+		return err
+	}
+
+	// 先写临时文件再rename, 避免进程退出时留下不完整的文件
+	tmp := s.path(name) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(name))
+}
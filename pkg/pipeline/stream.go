@@ -0,0 +1,184 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/debug"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/common/log"
+	lotus "github.com/shima-park/lotus/pipeline"
+	"github.com/shima-park/lotus/processor"
+	"golang.org/x/time/rate"
+)
+
+type Component = lotus.Component
+
+type Processor = lotus.Processor
+
+type Stream struct {
+	processor Processor
+	parent    *Stream
+	childs    []*Stream
+	config    StreamConfig
+
+	// 除子节点之外, 执行成功后还需要发送数据的汇合节点
+	joins []*Stream
+	// 在stream图中的拓扑顺序, 汇合节点总是排在它的所有上游节点之后
+	order int
+
+	retrier    *retrier
+	deadLetter *deadLetterSink // pipeline创建时根据组件绑定
+	limiters   []*rate.Limiter // pipeline创建时根据节点和组件的限流配置绑定
+	closer     func() error    // processor由WithClose创建时, pipeline停止时调用
+}
+
+func NewStream(conf StreamConfig, processors map[string]Processor) (*Stream, error) {
+	s, err := newStream(conf, processors)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resolveStreamGraph(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newStream(conf StreamConfig, processors map[string]Processor) (*Stream, error) {
+	p, ok := processors[conf.Name]
+	if !ok {
+		return nil, fmt.Errorf("Not found processor %s", conf.Name)
+	}
+
+	if conf.Replica == 0 {
+		conf.Replica = 1
+	}
+
+	if conf.Timeout < 0 {
+		return nil, fmt.Errorf("Stream(%s) invalid timeout %s", conf.Name, conf.Timeout)
+	}
+
+	r, err := newRetrier(conf.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("Stream(%s) %v", conf.Name, err)
+	}
+
+	s := &Stream{
+		config:  conf,
+		retrier: r,
+	}
+	p.Processor, s.closer = UnwrapProcessor(p.Processor)
+	s.processor = p
+
+	for _, subConf := range conf.Childs {
+		subStream, err := newStream(subConf, processors)
+		if err != nil {
+			return nil, err
+		}
+		subStream.parent = s
+		s.childs = append(s.childs, subStream)
+	}
+
+	return s, nil
+}
+
+func (s *Stream) Name() string {
+	return s.processor.Name
+}
+
+func (s *Stream) Childs() []*Stream {
+	return s.childs
+}
+
+func (s *Stream) Get(name string) (*Stream, bool) {
+	if s == nil {
+		return nil, false
+	}
+
+	if s.Name() == name {
+		return s, true
+	}
+
+	for _, c := range s.childs {
+		if target, ok := c.Get(name); ok {
+			return target, true
+		}
+	}
+	return nil, false
+}
+
+// Walk 按照深度优先的顺序遍历stream树
+func (s *Stream) Walk(f func(s *Stream)) {
+	if s == nil {
+		return
+	}
+
+	f(s)
+	for _, c := range s.childs {
+		c.Walk(f)
+	}
+}
+
+func (s *Stream) Invoke(inj inject.Injector) (outVal reflect.Value, err error) {
+	defer s.Recover(func(r interface{}) {
+		err = fmt.Errorf("Stream(%s) panic: %v", s.Name(), r)
+	})
+
+	if s.processor.Processor == nil {
+		return
+	}
+
+	p := s.processor.Processor
+
+	err = processor.Validate(p)
+	if err != nil {
+		err = fmt.Errorf("Stream(%s) %v", s.Name(), err)
+		return
+	}
+
+	var vals []reflect.Value
+	vals, err = inj.Invoke(p)
+	if err != nil {
+		err = fmt.Errorf("Stream(%s) %v", s.Name(), err)
+		return
+	}
+
+	return tryGetValueAndError(vals)
+}
+
+func (s *Stream) Recover(f func(r interface{})) {
+	if r := recover(); r != nil {
+		log.Error("Stream: %s, Panic: %s, Stack: %s",
+			s.Name(), r, string(debug.Stack()))
+		if f != nil {
+			f(r)
+		}
+	}
+}
+
+func tryGetValueAndError(vals []reflect.Value) (outVal reflect.Value, err error) {
+	if len(vals) == 1 {
+		// 判断一个返回值时是否时error
+		if vals[0].Type().Implements(errorInterface) && !vals[0].IsNil() {
+			err = vals[0].Interface().(error)
+			return
+		}
+		// 不是error作为return value处理
+		outVal = vals[0]
+		return
+	}
+
+	if len(vals) == 2 {
+		// 返回值为两个时候，默认认为第一个为return value
+		outVal = vals[0]
+		// 第二个为error
+		if vals[1].Type().Implements(errorInterface) && !vals[1].IsNil() {
+			err = vals[1].Interface().(error)
+			return
+		}
+		return
+	}
+
+	return
+}
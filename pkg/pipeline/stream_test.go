@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shima-park/lotus/common/inject"
+	"gotest.tools/v3/assert"
+)
+
+type streamRequest struct {
+	Text string `inject:"Text"`
+}
+
+type streamResponse struct {
+	Upper string `inject:"Upper"`
+}
+
+func TestStream(t *testing.T) {
+	processors := map[string]Processor{}
+	for _, name := range []string{"root", "step0", "step1", "step1.5", "step2"} {
+		processors[name] = Processor{Name: name, Processor: func(r ctxRequest) error { return nil }}
+	}
+
+	conf := StreamConfig{Name: "root", Childs: []StreamConfig{
+		{Name: "step0"},
+		{Name: "step1", Childs: []StreamConfig{{Name: "step1.5"}}},
+		{Name: "step2"},
+	}}
+	s, err := NewStream(conf, processors)
+	assert.NilError(t, err)
+
+	var names []string
+	s.Walk(func(s *Stream) { names = append(names, s.Name()) })
+	assert.DeepEqual(t, names, []string{"root", "step0", "step1", "step1.5", "step2"})
+
+	step1, ok := s.Get("step1")
+	assert.Assert(t, ok)
+	assert.Equal(t, len(step1.Childs()), 1)
+	assert.Equal(t, step1.Childs()[0].Name(), "step1.5")
+
+	_, ok = s.Get("step3")
+	assert.Assert(t, !ok)
+
+	_, err = NewStream(StreamConfig{Name: "root", Childs: []StreamConfig{{Name: "step3"}}}, processors)
+	assert.ErrorContains(t, err, "Not found processor step3")
+}
+
+func TestStreamInvoke(t *testing.T) {
+	newStream := func(f interface{}) *Stream {
+		s, err := NewStream(StreamConfig{Name: "invoke"}, map[string]Processor{"invoke": {Name: "invoke", Processor: f}})
+		assert.NilError(t, err)
+		return s
+	}
+	inj := inject.New()
+	inj.Map("hello", "Text")
+
+	val, err := newStream(func(r streamRequest) (streamResponse, error) {
+		return streamResponse{Upper: r.Text + "!"}, nil
+	}).Invoke(inj)
+	assert.NilError(t, err)
+	assert.Equal(t, val.Interface().(streamResponse).Upper, "hello!")
+
+	_, err = newStream(func(r streamRequest) (streamResponse, error) {
+		return streamResponse{}, errors.New("failed")
+	}).Invoke(inj)
+	assert.Error(t, err, "failed")
+
+	// panic被转换为错误
+	_, err = newStream(func(r streamRequest) error {
+		panic("boom")
+	}).Invoke(inj)
+	assert.ErrorContains(t, err, "Stream(invoke) panic: boom")
+}
@@ -0,0 +1,354 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/shima-park/lotus/common/inject"
+)
+
+const (
+	DefaultTapLimit          = 100
+	MaxTapLimit              = 1000
+	DefaultTapMaxFieldLength = 256
+	// 每个pipeline同时存在的tap数上限
+	maxTaps = 8
+	// tap事件的缓冲, 消费过慢时丢弃事件, 不阻塞processor
+	tapBufferSize = 16
+	// 渲染时的最大嵌套深度和每个slice/map最多展示的元素个数
+	tapMaxDepth = 5
+	tapMaxItems = 20
+)
+
+// TapOptions 实时采样processor的输入输出
+type TapOptions struct {
+	Processor string
+	// 每Sample个数据采样一个, 小于等于1时全部采样
+	Sample int
+	// 最多输出的事件数, 达到后结束, 默认DefaultTapLimit, 不能超过MaxTapLimit
+	Limit int
+	// 字符串和[]byte字段的最大长度, 超过时截断, 默认DefaultTapMaxFieldLength
+	MaxFieldLength int
+}
+
+// TapEvent processor一次执行的输入输出
+type TapEvent struct {
+	Time      time.Time       `json:"time"`
+	Pipeline  string          `json:"pipeline"`
+	Processor string          `json:"processor"`
+	RunID     string          `json:"run_id"`
+	Elapsed   string          `json:"elapsed"`
+	Request   json.RawMessage `json:"request,omitempty"`
+	Response  json.RawMessage `json:"response,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type tap struct {
+	opts   TapOptions
+	seen   uint64
+	sent   int
+	events chan TapEvent
+}
+
+// tapHub 管理pipeline上的所有tap, 没有tap时processor的执行不受影响
+type tapHub struct {
+	lock   sync.Mutex
+	active int32
+	taps   map[*tap]struct{}
+	// 组件的注入名称, 渲染请求时只展示组件的类型
+	components map[string]struct{}
+}
+
+func newTapHub(components []Component) *tapHub {
+	h := &tapHub{
+		taps:       map[*tap]struct{}{},
+		components: map[string]struct{}{},
+	}
+	for _, c := range components {
+		h.components[c.Component.Instance().Name()] = struct{}{}
+	}
+	return h
+}
+
+// subscribe 创建一个tap, ctx结束或者达到Limit时关闭返回的通道
+func (h *tapHub) subscribe(ctx context.Context, opts TapOptions) (<-chan TapEvent, error) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultTapLimit
+	}
+	if opts.Limit > MaxTapLimit {
+		return nil, fmt.Errorf("Tap limit %d exceeds the maximum %d", opts.Limit, MaxTapLimit)
+	}
+	if opts.MaxFieldLength <= 0 {
+		opts.MaxFieldLength = DefaultTapMaxFieldLength
+	}
+
+	t := &tap{opts: opts, events: make(chan TapEvent, tapBufferSize)}
+
+	h.lock.Lock()
+	if len(h.taps) >= maxTaps {
+		h.lock.Unlock()
+		return nil, errors.New("Too many taps on this pipeline, please try again later")
+	}
+	h.taps[t] = struct{}{}
+	atomic.StoreInt32(&h.active, int32(len(h.taps)))
+	h.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		h.remove(t)
+	}()
+	return t.events, nil
+}
+
+func (h *tapHub) remove(t *tap) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, ok := h.taps[t]; !ok {
+		return
+	}
+	delete(h.taps, t)
+	atomic.StoreInt32(&h.active, int32(len(h.taps)))
+	close(t.events)
+}
+
+// close 关闭所有tap, pipeline停止时调用
+func (h *tapHub) close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for t := range h.taps {
+		delete(h.taps, t)
+		close(t.events)
+	}
+	atomic.StoreInt32(&h.active, 0)
+}
+
+// sample 返回需要采样本次执行的tap
+func (h *tapHub) sample(processor string) []*tap {
+	if h == nil || atomic.LoadInt32(&h.active) == 0 {
+		return nil
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	var res []*tap
+	for t := range h.taps {
+		if t.opts.Processor != processor {
+			continue
+		}
+		t.seen++
+		if t.opts.Sample > 1 && (t.seen-1)%uint64(t.opts.Sample) != 0 {
+			continue
+		}
+		res = append(res, t)
+	}
+	return res
+}
+
+// emit 非阻塞的发送事件, 达到Limit的tap会被关闭.
+// 渲染需要反射和json序列化, 在锁外进行, 避免阻塞其他processor的采样和tap的订阅
+func (h *tapHub) emit(taps []*tap, render func(maxFieldLength int) TapEvent) {
+	h.lock.Lock()
+	var live []*tap
+	for _, t := range taps {
+		if _, ok := h.taps[t]; ok {
+			live = append(live, t)
+		}
+	}
+	h.lock.Unlock()
+
+	rendered := map[int]TapEvent{} // key: MaxFieldLength
+	for _, t := range live {
+		if _, ok := rendered[t.opts.MaxFieldLength]; !ok {
+			rendered[t.opts.MaxFieldLength] = render(t.opts.MaxFieldLength)
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for _, t := range live {
+		// 渲染期间tap可能已经被关闭
+		if _, ok := h.taps[t]; !ok {
+			continue
+		}
+
+		select {
+		case t.events <- rendered[t.opts.MaxFieldLength]:
+			t.sent++
+		default:
+		}
+
+		if t.sent >= t.opts.Limit {
+			delete(h.taps, t)
+			close(t.events)
+		}
+	}
+	atomic.StoreInt32(&h.active, int32(len(h.taps)))
+}
+
+// renderRequest 以processor的请求参数的形式渲染注入的值, 组件, Context和Monitor只展示类型
+func (h *tapHub) renderRequest(p interface{}, inj inject.Injector, maxFieldLength int) json.RawMessage {
+	t := reflect.TypeOf(p)
+	if t == nil || t.Kind() != reflect.Func {
+		return nil
+	}
+
+	var args []interface{}
+	for i := 0; i < t.NumIn(); i++ {
+		argType := t.In(i)
+		for argType.Kind() == reflect.Ptr {
+			argType = argType.Elem()
+		}
+		if argType.Kind() != reflect.Struct {
+			continue
+		}
+
+		arg := map[string]interface{}{}
+		for j := 0; j < argType.NumField(); j++ {
+			field := argType.Field(j)
+			if field.Tag != "inject" && field.Tag.Get("inject") == "" {
+				continue
+			}
+
+			name := field.Tag.Get("inject")
+			if name == "" {
+				name = field.Name
+			}
+
+			if _, ok := h.components[name]; ok || name == "Context" || name == "Monitor" {
+				arg[field.Name] = fmt.Sprintf("<%s>", field.Type)
+				continue
+			}
+
+			arg[field.Name] = renderValue(inj.Get(field.Type, name), maxFieldLength, 0)
+		}
+		args = append(args, arg)
+	}
+
+	if len(args) == 1 {
+		return mustMarshalTap(args[0])
+	}
+	return mustMarshalTap(args)
+}
+
+func renderResponse(v reflect.Value, maxFieldLength int) json.RawMessage {
+	if !v.IsValid() {
+		return nil
+	}
+	return mustMarshalTap(renderValue(v, maxFieldLength, 0))
+}
+
+func mustMarshalTap(v interface{}) json.RawMessage {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprintf("<marshal error: %s>", err))
+	}
+	return data
+}
+
+// renderValue 将任意值转换为可以json序列化的结构, 截断过长的字段并限制嵌套深度
+func renderValue(v reflect.Value, maxFieldLength, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if depth > tapMaxDepth {
+		return fmt.Sprintf("<%s>", v.Type())
+	}
+
+	if v.CanInterface() {
+		switch val := v.Interface().(type) {
+		case time.Time:
+			return val.Format(time.RFC3339Nano)
+		case error:
+			if v.Kind() != reflect.Ptr || !v.IsNil() {
+				return truncate(val.Error(), maxFieldLength)
+			}
+		case json.RawMessage:
+			return truncate(string(val), maxFieldLength)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return renderValue(v.Elem(), maxFieldLength, depth+1)
+	case reflect.String:
+		return truncate(v.String(), maxFieldLength)
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			return truncate(string(b), maxFieldLength)
+		}
+
+		var res []interface{}
+		for i := 0; i < v.Len() && i < tapMaxItems; i++ {
+			res = append(res, renderValue(v.Index(i), maxFieldLength, depth+1))
+		}
+		if v.Len() > tapMaxItems {
+			res = append(res, fmt.Sprintf("...(%d more items)", v.Len()-tapMaxItems))
+		}
+		return res
+	case reflect.Map:
+		if v.IsNil() {
+			return nil
+		}
+		res := map[string]interface{}{}
+		iter := v.MapRange()
+		for i := 0; iter.Next(); i++ {
+			if i >= tapMaxItems {
+				res["..."] = fmt.Sprintf("(%d more items)", v.Len()-tapMaxItems)
+				break
+			}
+			res[fmt.Sprint(iter.Key())] = renderValue(iter.Value(), maxFieldLength, depth+1)
+		}
+		return res
+	case reflect.Struct:
+		res := map[string]interface{}{}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" { // 未导出的字段
+				continue
+			}
+			res[field.Name] = renderValue(v.Field(i), maxFieldLength, depth+1)
+		}
+		return res
+	default: // func, chan, unsafe.Pointer, complex
+		return fmt.Sprintf("<%s>", v.Type())
+	}
+}
+
+// truncate 截断超过max字节的字符串, 截断位置落在多字节字符中间时向前移动到字符的起始位置
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return fmt.Sprintf("%s...(%d bytes truncated)", s[:max], len(s)-max)
+}
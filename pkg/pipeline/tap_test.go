@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"unicode/utf8"
+
+	"gotest.tools/v3/assert"
+)
+
+type tapRequest struct {
+	Ctx     context.Context `inject:"Context"`
+	Message string          `inject:"Message"`
+}
+
+type tapResponse struct {
+	Length int
+	Tags   []string
+}
+
+func TestTap(t *testing.T) {
+	root := Processor{Name: "test_tap_root", Processor: func() retryMessage {
+		return retryMessage{Message: "hello world"}
+	}}
+	sink := Processor{Name: "test_tap_sink", Processor: func(r tapRequest) tapResponse {
+		return tapResponse{Length: len(r.Message), Tags: []string{"a", "b"}}
+	}}
+
+	stream, err := NewStream(StreamConfig{
+		Name:   root.Name,
+		Childs: []StreamConfig{{Name: sink.Name}},
+	}, map[string]Processor{root.Name: root, sink.Name: sink})
+	assert.NilError(t, err)
+
+	p, err := New(
+		WithName("test_tap"),
+		WithProcessors(root, sink),
+		WithStream(stream),
+		WithConfig(Config{Name: "test_tap", Schedule: "@yearly"}),
+	)
+	assert.NilError(t, err)
+
+	_, err = p.Tap(context.Background(), TapOptions{Processor: "not_exists"})
+	assert.ErrorContains(t, err, "is not found in the stream")
+
+	_, err = p.Tap(context.Background(), TapOptions{Processor: sink.Name, Limit: MaxTapLimit + 1})
+	assert.ErrorContains(t, err, "exceeds the maximum")
+
+	events, err := p.Tap(context.Background(), TapOptions{
+		Processor:      sink.Name,
+		Sample:         2,
+		Limit:          2,
+		MaxFieldLength: 5,
+	})
+	assert.NilError(t, err)
+
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	var ids []string
+	for i := 0; i < 4; i++ {
+		res, err := p.Trigger(nil)
+		assert.NilError(t, err)
+		ids = append(ids, res.ID)
+	}
+
+	var received []TapEvent
+	for event := range events {
+		received = append(received, event)
+	}
+
+	// 每2个采样1个, 达到limit后通道关闭
+	assert.Equal(t, len(received), 2)
+	assert.Equal(t, received[0].RunID, ids[0])
+	assert.Equal(t, received[1].RunID, ids[2])
+
+	var req map[string]interface{}
+	assert.NilError(t, json.Unmarshal(received[0].Request, &req))
+	assert.Equal(t, req["Ctx"], "<context.Context>")
+	assert.Equal(t, req["Message"], "hello...(6 bytes truncated)")
+	assert.Equal(t, string(received[0].Response), `{"Length":11,"Tags":["a","b"]}`)
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, truncate("hello", 5), "hello")
+	assert.Equal(t, truncate("hello world", 5), "hello...(6 bytes truncated)")
+	// 不会在多字节字符的中间截断
+	assert.Equal(t, truncate("你好世界", 4), "你...(9 bytes truncated)")
+	assert.Equal(t, truncate("你好世界", 2), "...(12 bytes truncated)")
+	assert.Assert(t, utf8.ValidString(truncate("a你好", 3)))
+}
@@ -0,0 +1,188 @@
+package pipeline
+
+import (
+	"bytes"
+	"expvar"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var (
+	visualizers = map[string]Visualizer{
+		"svg": DotVisualizer("svg"),
+		"png": DotVisualizer("png"),
+		"dot": DotGrgphVisualizer,
+	}
+	supportedVisualizerTypes []string
+)
+
+func init() {
+	for t := range visualizers {
+		supportedVisualizerTypes = append(supportedVisualizerTypes, t)
+	}
+}
+
+func AddVisualizer(name string, v Visualizer) error {
+	if _, ok := visualizers[name]; ok {
+		return fmt.Errorf("%s is a already register visualizer", name)
+	}
+
+	visualizers[name] = v
+
+	return nil
+}
+
+func ListVisualizer() map[string]Visualizer {
+	return visualizers
+}
+
+type Visualizer func(w io.Writer, pipeline Pipeliner) error
+
+func DotVisualizer(format string) Visualizer {
+	return func(w io.Writer, pipeline Pipeliner) error {
+		dotFile, err := ioutil.TempFile("", "dot")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(dotFile.Name())
+		defer dotFile.Close()
+
+		err = DotGrgphVisualizer(dotFile, pipeline)
+		if err != nil {
+			return err
+		}
+
+		outputFile, err := ioutil.TempFile("", format)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(outputFile.Name())
+		defer outputFile.Close()
+
+		err = exec.Command("dot", "-T"+format, dotFile.Name(), "-o", outputFile.Name()).Run()
+		if err != nil {
+			return err
+		}
+
+		b, err := ioutil.ReadAll(outputFile)
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(b)
+		return err
+	}
+}
+
+func DotGrgphVisualizer(w io.Writer, p Pipeliner) error {
+	var buffer bytes.Buffer
+	buffer.WriteString("digraph {\n")
+
+	buffer.WriteString(`node [shape=plaintext fontname="Sans serif" fontsize="24"];` + "\n")
+
+	buffer.WriteString(fmt.Sprintf(`%q [ label=<
+   <table border="1" cellborder="0" cellspacing="1">`+"\n",
+		p.Name(),
+	))
+
+	first := true
+	p.Monitor().Do(func(namespace string, kv expvar.KeyValue) {
+		if namespace != p.Name() {
+			return
+		}
+		if first {
+			first = false
+			buffer.WriteString("<tr><td align=\"left\"><b>" + p.Name() + "</b></td></tr>\n")
+		}
+
+		buffer.WriteString("<tr><td align=\"left\">" + kv.Key + ":" + kv.Value.String() + "</td></tr>\n")
+	})
+	buffer.WriteString("</table>>];\n")
+	buffer.WriteString("\n")
+
+	streams := map[string]StreamConfig{}
+	walkStreamConfig(p.GetConfig().Stream, func(c StreamConfig) {
+		streams[c.Name] = c
+	})
+
+	for _, proc := range p.ListProcessors() {
+		buffer.WriteString(fmt.Sprintf(`%q [ label=<
+   <table border="1" cellborder="0" cellspacing="1">`+"\n",
+			proc.Name,
+		))
+
+		first := true
+		p.Monitor().Do(func(namespace string, kv expvar.KeyValue) {
+			if namespace != proc.Name {
+				return
+			}
+			if first {
+				first = false
+				buffer.WriteString("<tr><td align=\"left\"><b>" + proc.Name + "</b></td></tr>\n")
+			}
+
+			buffer.WriteString("<tr><td align=\"left\">" + kv.Key + ":" + kv.Value.String() + "</td></tr>\n")
+		})
+
+		if c, ok := streams[proc.Name]; ok {
+			if c.Route != nil {
+				buffer.WriteString("<tr><td align=\"left\"><i>route by " + c.Route.By + "</i></td></tr>\n")
+			}
+			if c.Join != nil {
+				buffer.WriteString("<tr><td align=\"left\"><i>join " + strings.Join(c.Join.From, ", ") + "</i></td></tr>\n")
+			}
+		}
+
+		buffer.WriteString("</table>>];\n")
+		buffer.WriteString("\n")
+	}
+
+	buildRefRalationship(p.GetConfig().Stream, &buffer)
+
+	buffer.WriteString("}")
+	_, err := w.Write(buffer.Bytes())
+	return err
+}
+
+func buildRefRalationship(c StreamConfig, w io.Writer) {
+	if c.Name == "" {
+		return
+	}
+
+	for _, x := range c.Childs {
+		var attrs string
+		if c.Route != nil {
+			// 路由的边以分支名称标注
+			branch := x.Branch
+			if branch == "" {
+				branch = x.Name
+			}
+			if branch == c.Route.Default {
+				branch += " (default)"
+			}
+			attrs = fmt.Sprintf(" [label=%q]", branch)
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf("  %q %s %q%s;\n", c.Name, "->", x.Name, attrs)))
+
+		if x.Join != nil {
+			// 汇合节点其他上游的边以虚线表示
+			for _, from := range x.Join.From {
+				if from != c.Name {
+					_, _ = w.Write([]byte(fmt.Sprintf("  %q %s %q [style=dashed];\n", from, "->", x.Name)))
+				}
+			}
+		}
+		buildRefRalationship(x, w)
+	}
+}
+
+func walkStreamConfig(c StreamConfig, f func(c StreamConfig)) {
+	f(c)
+	for _, x := range c.Childs {
+		walkStreamConfig(x, f)
+	}
+}
@@ -0,0 +1,188 @@
+// Package batch 提供将多条数据合并成一批的processor
+package batch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	factory       processor.Factory = NewFactory()
+	defaultConfig                   = Config{
+		Input:    "Record",
+		Output:   "Records",
+		Size:     100,
+		Interval: 10 * time.Second,
+	}
+	description = "collect the injected values into batches by count or time, the runs of buffered items finish when their batch is emitted"
+)
+
+func init() {
+	if err := processor.Register("batch", factory); err != nil {
+		panic(err)
+	}
+}
+
+func NewFactory() processor.Factory {
+	return processor.NewFactory(
+		defaultConfig,
+		description,
+		func(c string) (processor.Processor, error) {
+			return New(c)
+		})
+}
+
+type Config struct {
+	Input string `yaml:"input"`
+	// 批次的注入名称, 类型为[]interface{}
+	Output string `yaml:"output"`
+	// 批次中的数据条数达到size时输出
+	Size int `yaml:"size"`
+	// 批次中第一条数据等待的时间达到interval时输出, 为0时只按照条数输出
+	Interval time.Duration `yaml:"interval"`
+}
+
+func (c Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// batcher 每个processor实例独立缓存批次, 输出批次的那条数据携带整个批次继续执行下游.
+// 其他数据的运行在批次输出之后以pipeline.ErrDrop结束, 因此批次输出之前停止pipeline时它们被标记为取消
+type batcher struct {
+	conf Config
+
+	lock sync.Mutex
+	cur  *batch
+}
+
+type batch struct {
+	entries []entry
+	started time.Time
+	timer   *time.Timer
+}
+
+// entry 批次中的一条数据, deferred为nil时数据的运行已经结束, 例如不是在pipeline中执行
+type entry struct {
+	value    interface{}
+	deferred *dynamic.Deferred
+}
+
+func New(rawConfig string) (processor.Processor, error) {
+	var conf Config
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Input == "" || conf.Output == "" {
+		return nil, fmt.Errorf("The input and output of batch are required")
+	}
+	if conf.Size <= 0 && conf.Interval <= 0 {
+		return nil, fmt.Errorf("The size or interval of batch is required")
+	}
+
+	b := &batcher{conf: conf}
+	outputs := []dynamic.Field{{Name: conf.Output, Type: dynamic.ListType}}
+	return dynamic.New([]string{conf.Input}, outputs, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+		items, ok := b.add(ctx, inputs[0], time.Now())
+		if !ok {
+			return nil, pipeline.ErrDrop
+		}
+		return []interface{}{items}, nil
+	}), nil
+}
+
+// add 将v加入当前批次, 批次已满或者超时时返回整个批次, 否则v的运行等待批次输出
+func (b *batcher) add(ctx context.Context, v interface{}, now time.Time) ([]interface{}, bool) {
+	b.lock.Lock()
+
+	if b.cur == nil {
+		cur := &batch{started: now}
+		if b.conf.Interval > 0 {
+			cur.timer = time.AfterFunc(b.conf.Interval, func() { b.expire(cur) })
+		}
+		b.cur = cur
+	}
+
+	full := b.conf.Size > 0 && len(b.cur.entries)+1 >= b.conf.Size
+	expired := b.conf.Interval > 0 && now.Sub(b.cur.started) >= b.conf.Interval
+	if !full && !expired {
+		e := entry{value: v}
+		if d, ok := dynamic.Defer(ctx); ok {
+			cur := b.cur
+			e.deferred = d
+			d.OnFlush(func() { b.expire(cur) })
+		}
+		b.cur.entries = append(b.cur.entries, e)
+		b.lock.Unlock()
+		return nil, false
+	}
+
+	cur := b.take()
+	b.lock.Unlock()
+
+	items := cur.finish(nil)
+	return append(items, v), true
+}
+
+// expire 定时器到期或者pipeline暂停时, 由批次中第一条还未结束的数据携带批次输出
+func (b *batcher) expire(cur *batch) {
+	b.lock.Lock()
+	if b.cur != cur {
+		b.lock.Unlock()
+		return
+	}
+
+	var carrier *dynamic.Deferred
+	for _, e := range cur.entries {
+		if e.deferred != nil && !e.deferred.Canceled() {
+			carrier = e.deferred
+			break
+		}
+	}
+	if carrier == nil {
+		// 没有可以携带批次的运行, 由下一条数据输出
+		b.lock.Unlock()
+		return
+	}
+	b.take()
+	b.lock.Unlock()
+
+	items := cur.finish(carrier)
+	carrier.Emit([]interface{}{items})
+}
+
+// take 取出当前批次, 调用时需要持有锁
+func (b *batcher) take() *batch {
+	cur := b.cur
+	b.cur = nil
+	if cur.timer != nil {
+		cur.timer.Stop()
+	}
+	return cur
+}
+
+// finish 返回批次中运行没有被取消的数据, 并结束除carrier之外的运行
+func (c *batch) finish(carrier *dynamic.Deferred) []interface{} {
+	var items []interface{}
+	for _, e := range c.entries {
+		if e.deferred == nil {
+			items = append(items, e.value)
+			continue
+		}
+		if e.deferred.Canceled() {
+			continue
+		}
+
+		items = append(items, e.value)
+		if e.deferred != carrier {
+			e.deferred.Drop()
+		}
+	}
+	return items
+}
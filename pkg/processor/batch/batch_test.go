@@ -0,0 +1,82 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+type record struct {
+	Record int `inject:"Record"`
+}
+
+func TestBatchBySize(t *testing.T) {
+	p, err := New("input: Record\noutput: Records\nsize: 3")
+	assert.NilError(t, err)
+	h := nezhatest.New(t)
+
+	var batches [][]interface{}
+	for i := 0; i < 7; i++ {
+		res := h.Run(p, record{Record: i})
+		if errors.Is(res.Err, pipeline.ErrDrop) {
+			continue
+		}
+		assert.NilError(t, res.Err)
+		batches = append(batches, res.Value.Field(0).Interface().([]interface{}))
+	}
+	assert.DeepEqual(t, batches, [][]interface{}{{0, 1, 2}, {3, 4, 5}})
+}
+
+func TestBatchByInterval(t *testing.T) {
+	b := &batcher{conf: Config{Size: 10, Interval: time.Second}}
+	ctx := context.Background()
+	now := time.Now()
+
+	_, ok := b.add(ctx, 1, now)
+	assert.Assert(t, !ok)
+	_, ok = b.add(ctx, 2, now.Add(500*time.Millisecond))
+	assert.Assert(t, !ok)
+
+	items, ok := b.add(ctx, 3, now.Add(time.Second))
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, items, []interface{}{1, 2, 3})
+
+	// 新的批次从下一条数据开始计时
+	_, ok = b.add(ctx, 4, now.Add(1900*time.Millisecond))
+	assert.Assert(t, !ok)
+
+	_, err := New("input: Record\noutput: Records")
+	assert.ErrorContains(t, err, "size or interval")
+}
+
+func TestBatchFlushByTimer(t *testing.T) {
+	source := pipeline.Processor{Name: "source", Processor: func(r struct {
+		Ctx context.Context `inject:"Context"`
+	}) record {
+		return record{Record: 1}
+	}}
+	b := nezhatest.NewProcessor(t, "batch", "input: Record\noutput: Records\nsize: 10\ninterval: 50ms")
+	b.Name = "batch"
+
+	var batches [][]interface{}
+	sink := pipeline.Processor{Name: "sink", Processor: func(r struct {
+		Records []interface{} `inject:"Records"`
+	}) struct{} {
+		batches = append(batches, r.Records)
+		return struct{}{}
+	}}
+
+	// 没有后续数据时批次由定时器输出, 运行在批次输出之后才结束
+	conf := pipeline.StreamConfig{Name: "source", Childs: []pipeline.StreamConfig{
+		{Name: "batch", Childs: []pipeline.StreamConfig{{Name: "sink"}}},
+	}}
+	res := nezhatest.New(t).RunStream(conf, source, b, sink)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Run.Status, pipeline.RunStatusSucceeded)
+	assert.DeepEqual(t, batches, [][]interface{}{{1}})
+}
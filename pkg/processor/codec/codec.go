@@ -0,0 +1,143 @@
+// Package codec 提供json, yaml, csv的解码和编码processor
+package codec
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	for name, f := range map[string]processor.Factory{
+		"json_decode": newDecodeFactory("json", decodeJSON),
+		"json_encode": newEncodeFactory("json", json.Marshal),
+		"yaml_decode": newDecodeFactory("yaml", decodeYAML),
+		"yaml_encode": newEncodeFactory("yaml", yaml.Marshal),
+		"csv_decode":  NewCSVDecodeFactory(),
+		"csv_encode":  NewCSVEncodeFactory(),
+	} {
+		if err := processor.Register(name, f); err != nil {
+			panic(err)
+		}
+	}
+}
+
+type DecodeConfig struct {
+	// 待解码的值的注入名称, 类型为string或者[]byte
+	Input string `yaml:"input"`
+	// 解码结果的注入名称, 类型为interface{}, 对象解码为map[string]interface{}, 数组解码为[]interface{}
+	Output string `yaml:"output"`
+}
+
+func (c DecodeConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+type EncodeConfig struct {
+	// 待编码的值的注入名称
+	Input string `yaml:"input"`
+	// 编码结果的注入名称
+	Output string `yaml:"output"`
+	// 编码结果的类型, bytes或者string, 默认bytes
+	Type string `yaml:"type"`
+}
+
+func (c EncodeConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func newDecodeFactory(format string, decode func([]byte) (interface{}, error)) processor.Factory {
+	return processor.NewFactory(
+		DecodeConfig{Input: "Message", Output: "Record"},
+		fmt.Sprintf("decode %s from the injected string or []byte", format),
+		func(rawConfig string) (processor.Processor, error) {
+			var conf DecodeConfig
+			if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+				return nil, err
+			}
+			if conf.Input == "" || conf.Output == "" {
+				return nil, fmt.Errorf("The input and output of %s_decode are required", format)
+			}
+
+			outputs := []dynamic.Field{{Name: conf.Output, Type: dynamic.AnyType}}
+			return dynamic.New([]string{conf.Input}, outputs, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+				text, err := dynamic.Text(inputs[0])
+				if err != nil {
+					return nil, fmt.Errorf("Failed to decode %s: %v", conf.Input, err)
+				}
+
+				v, err := decode([]byte(text))
+				if err != nil {
+					return nil, fmt.Errorf("Failed to decode %s: %v", conf.Input, err)
+				}
+				return []interface{}{v}, nil
+			}), nil
+		})
+}
+
+func newEncodeFactory(format string, encode func(interface{}) ([]byte, error)) processor.Factory {
+	return processor.NewFactory(
+		EncodeConfig{Input: "Record", Output: "Message", Type: "bytes"},
+		fmt.Sprintf("encode the injected value to %s", format),
+		func(rawConfig string) (processor.Processor, error) {
+			var conf EncodeConfig
+			if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+				return nil, err
+			}
+			return newEncoder(format, conf, func(v interface{}) ([]byte, error) {
+				return encode(v)
+			})
+		})
+}
+
+// newEncoder 按照配置的类型以string或者[]byte注入编码结果
+func newEncoder(format string, conf EncodeConfig, encode func(interface{}) ([]byte, error)) (processor.Processor, error) {
+	if conf.Input == "" || conf.Output == "" {
+		return nil, fmt.Errorf("The input and output of %s_encode are required", format)
+	}
+
+	var asString bool
+	switch conf.Type {
+	case "", "bytes":
+	case "string":
+		asString = true
+	default:
+		return nil, fmt.Errorf("Unsupported type %s of %s_encode, expected bytes or string", conf.Type, format)
+	}
+
+	outputs := []dynamic.Field{{Name: conf.Output, Type: dynamic.BytesType}}
+	if asString {
+		outputs[0].Type = dynamic.StringType
+	}
+
+	return dynamic.New([]string{conf.Input}, outputs, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+		data, err := encode(inputs[0])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode %s: %v", conf.Input, err)
+		}
+		if asString {
+			return []interface{}{string(data)}, nil
+		}
+		return []interface{}{data}, nil
+	}), nil
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func decodeYAML(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return dynamic.Normalize(v), nil
+}
@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"testing"
+
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+type message struct {
+	Message string `inject:"Message"`
+}
+
+type record struct {
+	Record interface{} `inject:"Record"`
+}
+
+func TestJSONAndYAML(t *testing.T) {
+	h := nezhatest.New(t)
+
+	for _, format := range []string{"json", "yaml"} {
+		decode := nezhatest.NewProcessor(t, format+"_decode", "input: Message\noutput: Record")
+		res := h.Run(decode.Processor, message{Message: `{"id": 1, "tags": ["a", "b"], "user": {"name": "nezha"}}`})
+		assert.NilError(t, res.Err)
+
+		m, ok := res.Value.Field(0).Interface().(map[string]interface{})
+		assert.Assert(t, ok, format)
+		assert.DeepEqual(t, m["tags"], []interface{}{"a", "b"})
+		assert.DeepEqual(t, m["user"], map[string]interface{}{"name": "nezha"})
+
+		encode := nezhatest.NewProcessor(t, format+"_encode", "input: Record\noutput: Message\ntype: string")
+		res = h.Run(encode.Processor, record{Record: map[string]interface{}{"id": 1}})
+		assert.NilError(t, res.Err)
+		assert.Equal(t, res.Value.Field(0).String(), map[string]string{"json": `{"id":1}`, "yaml": "id: 1\n"}[format])
+	}
+
+	decode := nezhatest.NewProcessor(t, "json_decode", "input: Message\noutput: Record")
+	assert.ErrorContains(t, h.Run(decode.Processor, message{Message: "{"}).Err, "Failed to decode Message")
+
+	_, err := NewCSVEncoder("input: Record\noutput: Message\ntype: int")
+	assert.ErrorContains(t, err, "Unsupported type int")
+}
+
+func TestCSV(t *testing.T) {
+	h := nezhatest.New(t)
+
+	decode, err := NewCSVDecoder("input: Message\noutput: Records\nheader: true")
+	assert.NilError(t, err)
+	res := h.Run(decode, message{Message: "id,name\n1,foo\n2,\"b,ar\"\n"})
+	assert.NilError(t, res.Err)
+	assert.DeepEqual(t, res.Value.Field(0).Interface(), []interface{}{
+		map[string]interface{}{"id": "1", "name": "foo"},
+		map[string]interface{}{"id": "2", "name": "b,ar"},
+	})
+
+	decode, err = NewCSVDecoder("input: Message\noutput: Records\ncomma: ';'")
+	assert.NilError(t, err)
+	res = h.Run(decode, message{Message: "1;foo"})
+	assert.NilError(t, res.Err)
+	assert.DeepEqual(t, res.Value.Field(0).Interface(), []interface{}{[]interface{}{"1", "foo"}})
+
+	encode, err := NewCSVEncoder("input: Record\noutput: Message\ntype: string\nheader: true\ncolumns: [id, name]")
+	assert.NilError(t, err)
+	res = h.Run(encode, record{Record: []map[string]interface{}{{"id": 1, "name": "foo"}, {"id": 2}}})
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.Field(0).String(), "id,name\n1,foo\n2,\n")
+
+	res = h.Run(encode, record{Record: []interface{}{1, "b,ar"}})
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.Field(0).String(), "id,name\n1,\"b,ar\"\n")
+}
@@ -0,0 +1,206 @@
+package codec
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+type CSVConfig struct {
+	Input  string `yaml:"input"`
+	Output string `yaml:"output"`
+	// 编码结果的类型, bytes或者string, 默认bytes, 只在csv_encode中使用
+	Type string `yaml:"type,omitempty"`
+	// 分隔符, 默认,
+	Comma string `yaml:"comma"`
+	// 解码时第一行是否为列名, 编码时是否输出列名
+	Header bool `yaml:"header"`
+	// 列名, 不为空时每一行解码为以列名为key的map, 编码map时按照列名的顺序输出
+	Columns []string `yaml:"columns,omitempty"`
+}
+
+func (c CSVConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func (c CSVConfig) comma() (rune, error) {
+	if c.Comma == "" {
+		return ',', nil
+	}
+	r, size := utf8.DecodeRuneInString(c.Comma)
+	if size != len(c.Comma) {
+		return 0, fmt.Errorf("Invalid csv comma: %q", c.Comma)
+	}
+	return r, nil
+}
+
+func NewCSVDecodeFactory() processor.Factory {
+	return processor.NewFactory(
+		CSVConfig{Input: "Message", Output: "Records", Comma: ",", Header: true},
+		"decode csv from the injected string or []byte to a list of records, records are maps keyed by columns or lists",
+		func(rawConfig string) (processor.Processor, error) {
+			return NewCSVDecoder(rawConfig)
+		})
+}
+
+func NewCSVEncodeFactory() processor.Factory {
+	return processor.NewFactory(
+		CSVConfig{Input: "Records", Output: "Message", Type: "bytes", Comma: ",", Header: true, Columns: []string{"id", "name"}},
+		"encode the injected record or list of records to csv",
+		func(rawConfig string) (processor.Processor, error) {
+			return NewCSVEncoder(rawConfig)
+		})
+}
+
+func NewCSVDecoder(rawConfig string) (processor.Processor, error) {
+	var conf CSVConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Input == "" || conf.Output == "" {
+		return nil, fmt.Errorf("The input and output of csv_decode are required")
+	}
+	comma, err := conf.comma()
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []dynamic.Field{{Name: conf.Output, Type: dynamic.ListType}}
+	return dynamic.New([]string{conf.Input}, outputs, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+		text, err := dynamic.Text(inputs[0])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode %s: %v", conf.Input, err)
+		}
+
+		r := csv.NewReader(strings.NewReader(text))
+		r.Comma = comma
+		r.FieldsPerRecord = -1
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("Failed to decode %s: %v", conf.Input, err)
+		}
+
+		columns := conf.Columns
+		if conf.Header && len(rows) > 0 {
+			if len(columns) == 0 {
+				columns = rows[0]
+			}
+			rows = rows[1:]
+		}
+
+		records := make([]interface{}, 0, len(rows))
+		for _, row := range rows {
+			if len(columns) == 0 {
+				record := make([]interface{}, 0, len(row))
+				for _, v := range row {
+					record = append(record, v)
+				}
+				records = append(records, record)
+				continue
+			}
+
+			record := make(map[string]interface{}, len(columns))
+			for i, v := range row {
+				if i < len(columns) {
+					record[columns[i]] = v
+				}
+			}
+			records = append(records, record)
+		}
+		return []interface{}{records}, nil
+	}), nil
+}
+
+func NewCSVEncoder(rawConfig string) (processor.Processor, error) {
+	var conf CSVConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	comma, err := conf.comma()
+	if err != nil {
+		return nil, err
+	}
+
+	return newEncoder("csv", EncodeConfig{Input: conf.Input, Output: conf.Output, Type: conf.Type}, func(v interface{}) ([]byte, error) {
+		records, err := csvRecords(v)
+		if err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Comma = comma
+		if conf.Header && len(conf.Columns) > 0 {
+			if err := w.Write(conf.Columns); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, record := range records {
+			row, err := csvRow(record, conf.Columns)
+			if err != nil {
+				return nil, err
+			}
+			if err := w.Write(row); err != nil {
+				return nil, err
+			}
+		}
+		w.Flush()
+		return buf.Bytes(), w.Error()
+	})
+}
+
+// csvRecords 元素为list或者map的list作为多行, 其他值作为一行
+func csvRecords(v interface{}) ([]interface{}, error) {
+	g, err := dynamic.Generic(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if list, ok := g.([]interface{}); ok {
+		if len(list) == 0 {
+			return nil, nil
+		}
+		switch list[0].(type) {
+		case []interface{}, map[string]interface{}:
+			return list, nil
+		}
+	}
+	return []interface{}{g}, nil
+}
+
+func csvRow(record interface{}, columns []string) ([]string, error) {
+	switch r := record.(type) {
+	case []interface{}:
+		row := make([]string, 0, len(r))
+		for _, v := range r {
+			row = append(row, csvField(v))
+		}
+		return row, nil
+	case map[string]interface{}:
+		if len(columns) == 0 {
+			return nil, fmt.Errorf("The columns are required to encode maps to csv")
+		}
+		row := make([]string, 0, len(columns))
+		for _, c := range columns {
+			row = append(row, csvField(r[c]))
+		}
+		return row, nil
+	default:
+		return []string{csvField(r)}, nil
+	}
+}
+
+func csvField(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
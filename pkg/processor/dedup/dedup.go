@@ -0,0 +1,186 @@
+// Package dedup 提供在一段时间内丢弃重复数据的processor.
+// key在数据发送给下游节点之前记录, 下游节点失败时同一条数据再次到达也会被丢弃, 即至多处理一次
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	factory       processor.Factory = NewFactory()
+	defaultConfig                   = Config{
+		Inputs: []string{"Record"},
+		Key:    "Record.id",
+		TTL:    time.Hour,
+	}
+	description = "drop items whose key has been seen within the ttl, keys are kept in memory or in redis. " +
+		"The key is recorded before the downstream processors run, so an item whose run fails is not retried (at-most-once)"
+)
+
+const defaultPrefix = "nezha:dedup:"
+
+func init() {
+	if err := processor.Register("dedup", factory); err != nil {
+		panic(err)
+	}
+}
+
+func NewFactory() processor.Factory {
+	return processor.NewFactory(
+		defaultConfig,
+		description,
+		func(c string) (processor.Processor, error) {
+			return New(c)
+		})
+}
+
+type Config struct {
+	Inputs []string `yaml:"inputs"`
+	// 去重的key, 以.分隔的路径, 第一段为inputs中的名称, 例如Record.user.id, 为空时以所有输入的json编码作为key
+	Key string `yaml:"key"`
+	// key的有效期, 有效期内重复的数据会被丢弃.
+	// key在下游节点执行之前记录, 下游失败之后重新投递的数据同样会被丢弃, 需要至少处理一次时不要使用dedup
+	TTL time.Duration `yaml:"ttl"`
+	// redis_client组件的名称, 不为空时key记录在redis中, 在多个pipeline和nezha实例之间共享, 否则记录在内存中
+	Redis string `yaml:"redis,omitempty"`
+	// redis中key的前缀, 默认nezha:dedup:
+	Prefix string `yaml:"prefix,omitempty"`
+}
+
+func (c Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// redisClient *redis.Client和*redis.ClusterClient都实现了SetNX
+type redisClient interface {
+	SetNX(key string, value interface{}, expiration time.Duration) *redis.BoolCmd
+}
+
+func New(rawConfig string) (processor.Processor, error) {
+	var conf Config
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if len(conf.Inputs) == 0 {
+		return nil, fmt.Errorf("The inputs of dedup are required")
+	}
+	if conf.TTL <= 0 {
+		return nil, fmt.Errorf("The ttl of dedup is required")
+	}
+	if conf.Prefix == "" {
+		conf.Prefix = defaultPrefix
+	}
+
+	var path []string
+	if conf.Key != "" {
+		path = strings.Split(conf.Key, ".")
+		if !contains(conf.Inputs, path[0]) {
+			return nil, fmt.Errorf("The key %s of dedup must start with one of the inputs %v", conf.Key, conf.Inputs)
+		}
+	}
+
+	inputs := conf.Inputs
+	if conf.Redis != "" {
+		inputs = append(append([]string{}, conf.Inputs...), conf.Redis)
+	}
+
+	mem := &memoryStore{seen: map[string]time.Time{}}
+	return dynamic.New(inputs, nil, func(ctx context.Context, values []interface{}) ([]interface{}, error) {
+		key, err := dedupKey(conf.Inputs, values[:len(conf.Inputs)], path)
+		if err != nil {
+			return nil, err
+		}
+
+		var first bool
+		if conf.Redis != "" {
+			client, ok := values[len(conf.Inputs)].(redisClient)
+			if !ok {
+				return nil, fmt.Errorf("The redis client %s of dedup is not injected", conf.Redis)
+			}
+			first, err = client.SetNX(conf.Prefix+key, 1, conf.TTL).Result()
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			first = mem.add(key, conf.TTL, time.Now())
+		}
+
+		if !first {
+			return nil, pipeline.ErrDrop
+		}
+		return nil, nil
+	}), nil
+}
+
+// dedupKey key的sha256, 避免过长的key
+func dedupKey(names []string, values []interface{}, path []string) (string, error) {
+	var v interface{} = values
+	if len(path) > 0 {
+		m := make(map[string]interface{}, len(names))
+		for i, name := range names {
+			m[name] = values[i]
+		}
+
+		var ok bool
+		if v, ok = dynamic.Lookup(m, path); !ok || v == nil {
+			return "", fmt.Errorf("The dedup key %s is not found", strings.Join(path, "."))
+		}
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode the dedup key: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryStore 每个processor实例独立记录key, 每隔ttl清理一次过期的key
+type memoryStore struct {
+	lock      sync.Mutex
+	seen      map[string]time.Time // value: 过期时间
+	lastSweep time.Time
+}
+
+// add key不存在或者已经过期时记录key并返回true
+func (s *memoryStore) add(key string, ttl time.Duration, now time.Time) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if now.Sub(s.lastSweep) >= ttl {
+		for k, expire := range s.seen {
+			if !now.Before(expire) {
+				delete(s.seen, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if expire, ok := s.seen[key]; ok && now.Before(expire) {
+		return false
+	}
+	s.seen[key] = now.Add(ttl)
+	return true
+}
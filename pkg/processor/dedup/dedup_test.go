@@ -0,0 +1,120 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+type event struct {
+	ID   int    `yaml:"id" json:"id"`
+	Text string `yaml:"text" json:"text"`
+}
+
+type eventInput struct {
+	Event event `inject:"Event"`
+}
+
+func runDedup(t *testing.T, h *nezhatest.Harness, rawConfig string, events ...event) []bool {
+	p, err := New(rawConfig)
+	assert.NilError(t, err)
+
+	var kept []bool
+	for _, e := range events {
+		res := h.Run(p, eventInput{Event: e})
+		if !errors.Is(res.Err, pipeline.ErrDrop) {
+			assert.NilError(t, res.Err)
+		}
+		kept = append(kept, res.Err == nil)
+	}
+	return kept
+}
+
+func TestDedup(t *testing.T) {
+	h := nezhatest.New(t)
+	events := []event{{ID: 1, Text: "a"}, {ID: 1, Text: "b"}, {ID: 2, Text: "a"}, {ID: 2, Text: "a"}}
+
+	kept := runDedup(t, h, "inputs: [Event]\nkey: Event.id\nttl: 1m", events...)
+	assert.DeepEqual(t, kept, []bool{true, false, true, false})
+
+	kept = runDedup(t, h, "inputs: [Event]\nttl: 1m", events...)
+	assert.DeepEqual(t, kept, []bool{true, true, true, false})
+
+	p, err := New("inputs: [Event]\nkey: Event.missing\nttl: 1m")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, h.Run(p, eventInput{}).Err, "Event.missing is not found")
+
+	_, err = New("inputs: [Event]\nkey: Other.id\nttl: 1m")
+	assert.ErrorContains(t, err, "must start with one of the inputs")
+}
+
+func TestDedupTTL(t *testing.T) {
+	s := &memoryStore{seen: map[string]time.Time{}}
+	now := time.Now()
+
+	assert.Assert(t, s.add("a", time.Minute, now))
+	assert.Assert(t, !s.add("a", time.Minute, now.Add(59*time.Second)))
+	assert.Assert(t, s.add("b", time.Minute, now.Add(59*time.Second)))
+	assert.Assert(t, s.add("a", time.Minute, now.Add(time.Minute)))
+	assert.Equal(t, len(s.seen), 2)
+
+	// 过期的key被清理
+	s.add("c", time.Minute, now.Add(3*time.Minute))
+	assert.Equal(t, len(s.seen), 1)
+}
+
+func TestDedupRedis(t *testing.T) {
+	server := nezhatest.NewRedisServer(t)
+	h := nezhatest.New(t).Use(server.Client("name: DedupRedis"))
+
+	conf := "inputs: [Event]\nkey: Event.id\nttl: 1m\nredis: DedupRedis"
+	kept := runDedup(t, h, conf, event{ID: 1}, event{ID: 1})
+	assert.DeepEqual(t, kept, []bool{true, false})
+
+	// 不同的processor实例之间共享
+	kept = runDedup(t, h, conf, event{ID: 1}, event{ID: 2})
+	assert.DeepEqual(t, kept, []bool{false, true})
+
+	keys := server.Keys()
+	assert.Equal(t, len(keys), 2)
+	assert.Assert(t, strings.HasPrefix(keys[0], "nezha:dedup:"))
+	assert.Assert(t, server.TTL(keys[0]) == time.Minute)
+
+	server.FastForward(time.Minute)
+	kept = runDedup(t, h, conf, event{ID: 1})
+	assert.DeepEqual(t, kept, []bool{true})
+}
+
+func TestDedupAtMostOnce(t *testing.T) {
+	source := pipeline.Processor{Name: "source", Processor: func(r struct {
+		Ctx context.Context `inject:"Context"`
+	}) eventInput {
+		return eventInput{Event: event{ID: 1}}
+	}}
+	dedup := nezhatest.NewProcessor(t, "dedup", "inputs: [Event]\nkey: Event.id\nttl: 1m")
+	var calls int
+	sink := pipeline.Processor{Name: "sink", Processor: func(r eventInput) error {
+		calls++
+		return errors.New("sink failed")
+	}}
+
+	conf := pipeline.StreamConfig{Name: "source", Childs: []pipeline.StreamConfig{
+		{Name: "dedup", Childs: []pipeline.StreamConfig{{Name: "sink"}}},
+	}}
+	h := nezhatest.New(t)
+	res := h.RunStream(conf, source, dedup, sink)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Run.Status, pipeline.RunStatusFailed)
+
+	// key在下游执行之前已经记录, 下游失败之后重新投递的数据同样被丢弃
+	res = h.RunStream(conf, source, dedup, sink)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Run.Status, pipeline.RunStatusSucceeded)
+	assert.Equal(t, calls, 1)
+}
@@ -0,0 +1,281 @@
+// Package dynamic 根据配置中的注入名称生成processor, 供内置的processor使用
+package dynamic
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+
+	AnyType     = reflect.TypeOf((*interface{})(nil)).Elem()
+	StringType  = reflect.TypeOf("")
+	BytesType   = reflect.TypeOf([]byte(nil))
+	ListType    = reflect.TypeOf([]interface{}(nil))
+	StringsType = reflect.TypeOf([]string(nil))
+)
+
+// types 配置中可以声明的输出类型
+var types = map[string]reflect.Type{
+	"":        AnyType,
+	"any":     AnyType,
+	"string":  StringType,
+	"bytes":   BytesType,
+	"int":     reflect.TypeOf(int(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"bool":    reflect.TypeOf(false),
+	"map":     reflect.TypeOf(map[string]interface{}(nil)),
+	"list":    ListType,
+}
+
+// TypeOf 返回配置中声明的类型名称对应的类型, 为空时是interface{}
+func TypeOf(name string) (reflect.Type, bool) {
+	t, ok := types[name]
+	return t, ok
+}
+
+// Field 返回值中的一个注入字段
+type Field struct {
+	Name string
+	Type reflect.Type
+}
+
+// Func inputs为按照配置顺序注入的值, 没有注入时为nil, 返回的值按照outputs的顺序注入到下游
+type Func func(ctx context.Context, inputs []interface{}) ([]interface{}, error)
+
+// New 以reflect.MakeFunc生成processor, 参数中的Context以及inputs中的名称以interface{}注入,
+// 因此可以注入任意类型的值, 包括component
+func New(inputs []string, outputs []Field, fn Func) processor.Processor {
+	in := []reflect.StructField{{Name: "Ctx", Type: contextType, Tag: `inject:"Context"`}}
+	for i, name := range inputs {
+		in = append(in, reflect.StructField{
+			Name: "In" + strconv.Itoa(i),
+			Type: AnyType,
+			Tag:  reflect.StructTag("inject:" + strconv.Quote(name)),
+		})
+	}
+
+	var out []reflect.StructField
+	for i, f := range outputs {
+		out = append(out, reflect.StructField{
+			Name: "Out" + strconv.Itoa(i),
+			Type: f.Type,
+			Tag:  reflect.StructTag("inject:" + strconv.Quote(f.Name)),
+		})
+	}
+	outType := reflect.StructOf(out)
+
+	fail := func(err error) []reflect.Value {
+		return []reflect.Value{reflect.New(outType).Elem(), reflect.ValueOf(&err).Elem()}
+	}
+
+	build := func(res []interface{}) (reflect.Value, error) {
+		val := reflect.New(outType).Elem()
+		for i, v := range res {
+			if i >= len(outputs) || v == nil {
+				continue
+			}
+
+			rv := reflect.ValueOf(v)
+			if !rv.Type().AssignableTo(outputs[i].Type) {
+				return val, fmt.Errorf("Can not assign %s to output %s(%s)", rv.Type(), outputs[i].Name, outputs[i].Type)
+			}
+			val.Field(i).Set(rv)
+		}
+		return val, nil
+	}
+
+	t := reflect.FuncOf([]reflect.Type{reflect.StructOf(in)}, []reflect.Type{outType, errorType}, false)
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		ctx := context.Background()
+		if c := args[0].Field(0); !c.IsNil() {
+			ctx = c.Interface().(context.Context)
+		}
+		ctx = context.WithValue(ctx, buildKey{}, build)
+
+		var values []interface{}
+		for i := range inputs {
+			values = append(values, args[0].Field(i+1).Interface())
+		}
+
+		res, err := fn(ctx, values)
+		if err != nil {
+			return fail(err)
+		}
+
+		val, err := build(res)
+		if err != nil {
+			return fail(err)
+		}
+		return []reflect.Value{val, reflect.Zero(errorType)}
+	}).Interface()
+}
+
+type buildKey struct{}
+
+// Deferred 在Func返回之后异步地输出结果, 见pipeline.Defer
+type Deferred struct {
+	*pipeline.Deferred
+	build func([]interface{}) (reflect.Value, error)
+}
+
+// Defer 在Func中以传入的ctx调用, 不是在pipeline中执行时返回false
+func Defer(ctx context.Context) (*Deferred, bool) {
+	build, ok := ctx.Value(buildKey{}).(func([]interface{}) (reflect.Value, error))
+	if !ok {
+		return nil, false
+	}
+
+	d, ok := pipeline.Defer(ctx)
+	if !ok {
+		return nil, false
+	}
+	return &Deferred{Deferred: d, build: build}, true
+}
+
+// Emit 将outputs按照顺序注入到下游
+func (d *Deferred) Emit(outputs []interface{}) {
+	val, err := d.build(outputs)
+	d.Resolve(val, err)
+}
+
+// Drop 丢弃数据, 数据所属的运行视为成功
+func (d *Deferred) Drop() {
+	d.Resolve(reflect.Value{}, pipeline.ErrDrop)
+}
+
+// Emitter 以新的运行将结果注入到下游, 见pipeline.NewEmitter
+type Emitter struct {
+	emitter *pipeline.Emitter
+	build   func([]interface{}) (reflect.Value, error)
+}
+
+// NewEmitter 在Func中以传入的ctx调用, 不是在pipeline中执行时返回false
+func NewEmitter(ctx context.Context) (*Emitter, bool) {
+	build, ok := ctx.Value(buildKey{}).(func([]interface{}) (reflect.Value, error))
+	if !ok {
+		return nil, false
+	}
+
+	e, ok := pipeline.NewEmitter(ctx)
+	if !ok {
+		return nil, false
+	}
+	return &Emitter{emitter: e, build: build}, true
+}
+
+// Emit 将outputs按照顺序注入到下游
+func (e *Emitter) Emit(outputs []interface{}) error {
+	val, err := e.build(outputs)
+	if err != nil {
+		return err
+	}
+	return e.emitter.Emit(val)
+}
+
+// Stopped pipeline是否已经停止
+func (e *Emitter) Stopped() bool {
+	return e.emitter.Stopped()
+}
+
+// Text 将string, []byte以及它们的指针转换成字符串
+func Text(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case *string:
+		if v != nil {
+			return *v, nil
+		}
+	case *[]byte:
+		if v != nil {
+			return string(*v), nil
+		}
+	case fmt.Stringer:
+		return v.String(), nil
+	case nil:
+	default:
+		return "", fmt.Errorf("Expected string or []byte, got %T", v)
+	}
+	return "", nil
+}
+
+// Generic 以yaml的规则将结构体等类型转换成由map[string]interface{}, []interface{}和基础类型组成的值
+func Generic(v interface{}) (interface{}, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var res interface{}
+	if err := yaml.Unmarshal(data, &res); err != nil {
+		return nil, err
+	}
+	return Normalize(res), nil
+}
+
+// Normalize 将yaml解码得到的map[interface{}]interface{}转换成map[string]interface{}
+func Normalize(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = Normalize(e)
+		}
+		return m
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = Normalize(e)
+		}
+		return v
+	case []interface{}:
+		for i, e := range v {
+			v[i] = Normalize(e)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+// Lookup 按照路径查找值, 例如Event.user.id拆分成的[Event user id], 第一段为注入的名称
+func Lookup(values map[string]interface{}, path []string) (interface{}, bool) {
+	var cur interface{} = values
+	for i, key := range path {
+		if i == 1 {
+			var err error
+			if cur, err = Generic(cur); err != nil {
+				return nil, false
+			}
+		}
+
+		switch c := cur.(type) {
+		case map[string]interface{}:
+			v, ok := c[key]
+			if !ok {
+				return nil, false
+			}
+			cur = v
+		case []interface{}:
+			n, err := strconv.Atoi(key)
+			if err != nil || n < 0 || n >= len(c) {
+				return nil, false
+			}
+			cur = c[n]
+		default:
+			return nil, false
+		}
+	}
+	return cur, true
+}
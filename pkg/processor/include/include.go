@@ -0,0 +1,12 @@
+package include
+
+import (
+	_ "github.com/shima-park/nezha/pkg/processor/batch"
+	_ "github.com/shima-park/nezha/pkg/processor/codec"
+	_ "github.com/shima-park/nezha/pkg/processor/dedup"
+	_ "github.com/shima-park/nezha/pkg/processor/io"
+	_ "github.com/shima-park/nezha/pkg/processor/sample"
+	_ "github.com/shima-park/nezha/pkg/processor/script"
+	_ "github.com/shima-park/nezha/pkg/processor/text"
+	_ "github.com/shima-park/nezha/pkg/processor/window"
+)
@@ -0,0 +1,113 @@
+// Package io 提供将数据写入注入的io.Writer的processor
+package io
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	writeFactory       processor.Factory = NewWriteFactory()
+	defaultWriteConfig                   = WriteConfig{
+		Writer:  "MyWriter",
+		Input:   "Message",
+		Format:  "raw",
+		Newline: true,
+	}
+	writeDescription = "write the injected value to an io.Writer component such as io_writer"
+)
+
+func init() {
+	if err := processor.Register("io_write", writeFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewWriteFactory() processor.Factory {
+	return processor.NewFactory(
+		defaultWriteConfig,
+		writeDescription,
+		func(c string) (processor.Processor, error) {
+			return NewWrite(c)
+		})
+}
+
+type WriteConfig struct {
+	// io.Writer组件的名称
+	Writer string `yaml:"writer"`
+	Input  string `yaml:"input"`
+	// raw: string和[]byte原样写入, 其他类型以json编码; json: 以json编码; yaml: 以yaml编码
+	Format string `yaml:"format"`
+	// 是否在每条数据之后写入换行符
+	Newline bool `yaml:"newline"`
+}
+
+func (c WriteConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// writeLocks 同一个io.Writer可能被多个processor和replica同时写入, 保证每条数据完整写入
+var writeLocks sync.Map
+
+func NewWrite(rawConfig string) (processor.Processor, error) {
+	var conf WriteConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Writer == "" || conf.Input == "" {
+		return nil, fmt.Errorf("The writer and input of io_write are required")
+	}
+
+	var encode func(interface{}) ([]byte, error)
+	switch conf.Format {
+	case "", "raw":
+		encode = encodeRaw
+	case "json":
+		encode = json.Marshal
+	case "yaml":
+		encode = yaml.Marshal
+	default:
+		return nil, fmt.Errorf("Unsupported format %s of io_write, expected raw, json or yaml", conf.Format)
+	}
+
+	return dynamic.New([]string{conf.Writer, conf.Input}, nil, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+		w, ok := inputs[0].(io.Writer)
+		if !ok {
+			return nil, fmt.Errorf("The io.Writer %s of io_write is not injected", conf.Writer)
+		}
+
+		data, err := encode(inputs[1])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode %s: %v", conf.Input, err)
+		}
+		if conf.Newline {
+			data = append(data, '\n')
+		}
+
+		if reflect.TypeOf(w).Comparable() {
+			lock, _ := writeLocks.LoadOrStore(w, &sync.Mutex{})
+			lock.(*sync.Mutex).Lock()
+			defer lock.(*sync.Mutex).Unlock()
+		}
+
+		_, err = w.Write(data)
+		return nil, err
+	}), nil
+}
+
+func encodeRaw(v interface{}) ([]byte, error) {
+	switch v.(type) {
+	case string, []byte, *string, *[]byte:
+		text, err := dynamic.Text(v)
+		return []byte(text), err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,31 @@
+package io
+
+import (
+	"testing"
+
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+type input struct {
+	Message interface{} `inject:"Message"`
+}
+
+func TestWrite(t *testing.T) {
+	w := nezhatest.NewWriter("Out")
+	h := nezhatest.New(t).Use(w)
+
+	raw := nezhatest.NewProcessor(t, "io_write", "writer: Out\ninput: Message\nnewline: true")
+	assert.NilError(t, h.Run(raw.Processor, input{Message: "hello"}).Err)
+	assert.NilError(t, h.Run(raw.Processor, input{Message: []byte("world")}).Err)
+	assert.NilError(t, h.Run(raw.Processor, input{Message: map[string]int{"n": 1}}).Err)
+
+	p, err := NewWrite("writer: Out\ninput: Message\nformat: yaml")
+	assert.NilError(t, err)
+	assert.NilError(t, h.Run(p, input{Message: map[string]int{"count": 2}}).Err)
+
+	assert.DeepEqual(t, w.Lines(), []string{"hello", "world", `{"n":1}`, "count: 2"})
+
+	_, err = NewWrite("writer: Out\ninput: Message\nformat: xml")
+	assert.ErrorContains(t, err, "Unsupported format xml")
+}
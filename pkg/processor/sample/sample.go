@@ -0,0 +1,73 @@
+// Package sample 提供按照比例或者间隔保留数据的processor
+package sample
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	factory       processor.Factory = NewFactory()
+	defaultConfig                   = Config{
+		Rate: 0.1,
+	}
+	description = "keep a random fraction of the items or every nth item, others are dropped"
+)
+
+func init() {
+	if err := processor.Register("sample", factory); err != nil {
+		panic(err)
+	}
+}
+
+func NewFactory() processor.Factory {
+	return processor.NewFactory(
+		defaultConfig,
+		description,
+		func(c string) (processor.Processor, error) {
+			return New(c)
+		})
+}
+
+type Config struct {
+	// 随机保留的比例, 取值范围(0, 1]
+	Rate float64 `yaml:"rate,omitempty"`
+	// 每every条数据保留第一条, 配置后忽略rate
+	Every int64 `yaml:"every,omitempty"`
+}
+
+func (c Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func New(rawConfig string) (processor.Processor, error) {
+	var conf Config
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Every <= 0 && (conf.Rate <= 0 || conf.Rate > 1) {
+		return nil, fmt.Errorf("The rate of sample must be in (0, 1] or every must be positive")
+	}
+
+	var n int64
+	return dynamic.New(nil, nil, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+		var keep bool
+		if conf.Every > 0 {
+			keep = (atomic.AddInt64(&n, 1)-1)%conf.Every == 0
+		} else {
+			keep = rand.Float64() < conf.Rate
+		}
+
+		if !keep {
+			return nil, pipeline.ErrDrop
+		}
+		return nil, nil
+	}), nil
+}
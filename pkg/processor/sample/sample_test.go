@@ -0,0 +1,39 @@
+package sample
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+func TestSample(t *testing.T) {
+	h := nezhatest.New(t)
+
+	p, err := New("every: 3")
+	assert.NilError(t, err)
+	var kept []int
+	for i := 0; i < 7; i++ {
+		if res := h.Run(p); res.Err == nil {
+			kept = append(kept, i)
+		} else {
+			assert.Assert(t, errors.Is(res.Err, pipeline.ErrDrop))
+		}
+	}
+	assert.DeepEqual(t, kept, []int{0, 3, 6})
+
+	p, err = New("rate: 0.5")
+	assert.NilError(t, err)
+	var n int
+	for i := 0; i < 1000; i++ {
+		if h.Run(p).Err == nil {
+			n++
+		}
+	}
+	assert.Assert(t, n > 350 && n < 650, n)
+
+	_, err = New("rate: 2")
+	assert.ErrorContains(t, err, "must be in (0, 1]")
+}
@@ -0,0 +1,191 @@
+package script
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shima-park/lotus/processor"
+	"gopkg.in/yaml.v2"
+)
+
+// filter, mapping和switch以lua表达式配置, 转换成脚本后由script processor执行, 共享沙箱, 超时以及编译缓存
+
+func init() {
+	if err := processor.Register("filter", NewFilterFactory()); err != nil {
+		panic(err)
+	}
+	if err := processor.Register("mapping", NewMappingFactory()); err != nil {
+		panic(err)
+	}
+	if err := processor.Register("switch", NewSwitchFactory()); err != nil {
+		panic(err)
+	}
+}
+
+type FilterConfig struct {
+	Inputs []string `yaml:"inputs"`
+	// lua表达式, 结果为false或者nil时丢弃当前数据
+	Expr    string        `yaml:"expr"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (c FilterConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func NewFilterFactory() processor.Factory {
+	return processor.NewFactory(
+		FilterConfig{
+			Inputs:  []string{"Record"},
+			Expr:    `inputs.Record.level == "error"`,
+			Timeout: defaultTimeout,
+		},
+		"drop items for which the lua expression is false or nil",
+		func(c string) (processor.Processor, error) {
+			return NewFilter(c)
+		})
+}
+
+func NewFilter(rawConfig string) (processor.Processor, error) {
+	var conf FilterConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(conf.Expr) == "" {
+		return nil, fmt.Errorf("The expr of filter is required")
+	}
+
+	return newProcessor(Config{
+		Inputs:  conf.Inputs,
+		Timeout: conf.Timeout,
+		Script:  fmt.Sprintf("if not (%s) then\n  return nil\nend\nreturn {}\n", conf.Expr),
+	})
+}
+
+type MappingConfig struct {
+	Inputs []string `yaml:"inputs"`
+	// 结果的注入名称, 类型为map[string]interface{}
+	Output string `yaml:"output"`
+	// key: 结果中的字段, value: 计算字段值的lua表达式, 结果为nil的字段不会出现在结果中
+	Fields  map[string]string `yaml:"fields"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+func (c MappingConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func NewMappingFactory() processor.Factory {
+	return processor.NewFactory(
+		MappingConfig{
+			Inputs: []string{"Record"},
+			Output: "Projection",
+			Fields: map[string]string{
+				"id":    "inputs.Record.id",
+				"title": "string.upper(inputs.Record.title)",
+			},
+			Timeout: defaultTimeout,
+		},
+		"project the injected values into a new map with a lua expression for each field",
+		func(c string) (processor.Processor, error) {
+			return NewMapping(c)
+		})
+}
+
+func NewMapping(rawConfig string) (processor.Processor, error) {
+	var conf MappingConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Output == "" {
+		return nil, fmt.Errorf("The output of mapping is required")
+	}
+
+	var names []string
+	for name := range conf.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("local record = {}\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "record[%s] = (%s)\n", strconv.Quote(name), conf.Fields[name])
+	}
+	fmt.Fprintf(&b, "return { [%s] = record }\n", strconv.Quote(conf.Output))
+
+	return newProcessor(Config{
+		Inputs:  conf.Inputs,
+		Outputs: map[string]string{conf.Output: "map"},
+		Timeout: conf.Timeout,
+		Script:  b.String(),
+	})
+}
+
+type SwitchConfig struct {
+	Inputs []string `yaml:"inputs"`
+	// 分支名称的注入名称, 类型为string, 在stream的route.by中使用
+	Output string `yaml:"output"`
+	// 按照顺序匹配, 第一个when为true的case的branch作为结果
+	Cases []SwitchCase `yaml:"cases"`
+	// 没有匹配的case时的分支名称, 为空时结果为空字符串, 由route的default决定去向
+	Default string        `yaml:"default,omitempty"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+type SwitchCase struct {
+	// lua表达式
+	When   string `yaml:"when"`
+	Branch string `yaml:"branch"`
+}
+
+func (c SwitchConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func NewSwitchFactory() processor.Factory {
+	return processor.NewFactory(
+		SwitchConfig{
+			Inputs: []string{"Record"},
+			Output: "Branch",
+			Cases: []SwitchCase{
+				{When: `inputs.Record.level == "error"`, Branch: "alert"},
+			},
+			Default: "archive",
+			Timeout: defaultTimeout,
+		},
+		"return the branch of the first case whose lua expression is true, used by the route of the stream",
+		func(c string) (processor.Processor, error) {
+			return NewSwitch(c)
+		})
+}
+
+func NewSwitch(rawConfig string) (processor.Processor, error) {
+	var conf SwitchConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Output == "" {
+		return nil, fmt.Errorf("The output of switch is required")
+	}
+
+	output := strconv.Quote(conf.Output)
+	var b strings.Builder
+	for i, c := range conf.Cases {
+		if strings.TrimSpace(c.When) == "" {
+			return nil, fmt.Errorf("The when of case %d of switch is required", i)
+		}
+		fmt.Fprintf(&b, "if (%s) then\n  return { [%s] = %s }\nend\n", c.When, output, strconv.Quote(c.Branch))
+	}
+	fmt.Fprintf(&b, "return { [%s] = %s }\n", output, strconv.Quote(conf.Default))
+
+	return newProcessor(Config{
+		Inputs:  conf.Inputs,
+		Outputs: map[string]string{conf.Output: "string"},
+		Timeout: conf.Timeout,
+		Script:  b.String(),
+	})
+}
@@ -0,0 +1,453 @@
+package script
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	factory       processor.Factory = NewFactory()
+	defaultConfig                   = Config{
+		Inputs:      []string{"Message"},
+		Outputs:     map[string]string{"Text": "string"},
+		Timeout:     time.Second,
+		MemoryLimit: defaultMemoryLimit,
+		Script: `local msg = inputs.Message
+if msg == "" then
+  return nil -- 返回nil时丢弃当前数据
+end
+return { Text = string.upper(msg) }
+`,
+	}
+	description = "run a lua script with the injected values as inputs and inject the returned table"
+)
+
+const (
+	defaultTimeout = time.Second
+	// 单次执行可以分配的内存, 单位MB
+	defaultMemoryLimit = 64
+	// 函数调用的最大深度, 超过时报错stack overflow
+	callStackSize = 200
+	// lua栈中每个值占用的内存, 用于由MemoryLimit计算栈的最大长度
+	registrySlotSize = 16
+)
+
+func init() {
+	if err := processor.Register("script", factory); err != nil {
+		panic(err)
+	}
+}
+
+func NewFactory() processor.Factory {
+	return processor.NewFactory(
+		defaultConfig,
+		description,
+		func(c string) (processor.Processor, error) {
+			return New(c)
+		})
+}
+
+type Config struct {
+	// 注入到脚本中的值的名称, 在脚本中以inputs.{名称}访问
+	Inputs []string `yaml:"inputs"`
+	// 脚本返回的table中的值的名称和类型, 以该名称和类型注入到下游processor中
+	// 类型可以是: string, bytes, int, int64, float64, bool, map, list, any, 为空时为any
+	Outputs map[string]string `yaml:"outputs"`
+	// 单次执行的超时时间, 默认1s
+	Timeout time.Duration `yaml:"timeout"`
+	// 单次执行可以分配的内存, 单位MB, 默认64
+	// lua虚拟机没有内存统计, 这是一个近似的限制: 限制lua栈的大小, 以及string.rep, string.format,
+	// string.gsub, table.concat生成的单个字符串的长度, 不限制..拼接的字符串和table占用的内存,
+	// 这些情况由Timeout兜底
+	MemoryLimit int `yaml:"memory_limit"`
+	// lua脚本, 返回table时作为输出, 返回nil时丢弃当前数据, 调用error()时返回错误
+	Script string `yaml:"script"`
+}
+
+func (c Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// key: 脚本的sha256, value: *lua.FunctionProto, 相同的脚本只编译一次
+var compiled sync.Map
+
+func compile(script string) (*lua.FunctionProto, error) {
+	key := sha256.Sum256([]byte(script))
+	if proto, ok := compiled.Load(key); ok {
+		return proto.(*lua.FunctionProto), nil
+	}
+
+	chunk, err := parse.Parse(strings.NewReader(script), "script")
+	if err != nil {
+		return nil, err
+	}
+	proto, err := lua.Compile(chunk, "script")
+	if err != nil {
+		return nil, err
+	}
+
+	compiled.Store(key, proto)
+	return proto, nil
+}
+
+type scriptProcessor struct {
+	conf    Config
+	proto   *lua.FunctionProto
+	outputs []dynamic.Field // 按照名称排序
+	states  sync.Pool
+}
+
+// New 生成参数为inputs, 返回值为outputs的processor
+func New(rawConfig string) (processor.Processor, error) {
+	var conf Config
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	return newProcessor(conf)
+}
+
+func newProcessor(conf Config) (processor.Processor, error) {
+	if conf.Timeout <= 0 {
+		conf.Timeout = defaultTimeout
+	}
+	if conf.MemoryLimit <= 0 {
+		conf.MemoryLimit = defaultMemoryLimit
+	}
+
+	proto, err := compile(conf.Script)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to compile script: %v", err)
+	}
+
+	p := &scriptProcessor{conf: conf, proto: proto}
+	p.states.New = func() interface{} { return newState(conf.MemoryLimit) }
+
+	var names []string
+	for name := range conf.Outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		t, ok := dynamic.TypeOf(conf.Outputs[name])
+		if !ok {
+			return nil, fmt.Errorf("Unsupported type %s of output %s", conf.Outputs[name], name)
+		}
+		p.outputs = append(p.outputs, dynamic.Field{Name: name, Type: t})
+	}
+
+	return dynamic.New(conf.Inputs, p.outputs, p.run), nil
+}
+
+// newState 创建沙箱化的lua虚拟机, 只开放base, table, string, math库, 并移除可以加载代码, 访问文件,
+// 以及修改其他环境的函数. 虚拟机的栈和生成字符串的库函数以memoryLimit(单位MB)为上限
+func newState(memoryLimit int) *lua.LState {
+	limit := memoryLimit << 20
+	L := lua.NewState(lua.Options{
+		SkipOpenLibs:    true,
+		CallStackSize:   callStackSize,
+		RegistrySize:    lua.RegistrySize,
+		RegistryMaxSize: limit / registrySlotSize,
+	})
+	for _, lib := range []struct {
+		name string
+		fn   lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+	} {
+		L.Push(L.NewFunction(lib.fn))
+		L.Push(lua.LString(lib.name))
+		L.Call(1, 0)
+	}
+
+	for _, name := range []string{
+		"_G", "getfenv", "setfenv", "rawset", "newproxy", "_printregs",
+		"dofile", "loadfile", "load", "loadstring", "require", "module", "collectgarbage", "print",
+	} {
+		L.SetGlobal(name, lua.LNil)
+	}
+
+	// 字符串的metatable在所有执行之间共享, 只允许获取table的metatable
+	L.SetGlobal("getmetatable", L.NewFunction(func(L *lua.LState) int {
+		if tbl, ok := L.CheckAny(1).(*lua.LTable); ok {
+			L.Push(tbl.Metatable)
+			return 1
+		}
+		L.Push(lua.LNil)
+		return 1
+	}))
+
+	exceeded := func(L *lua.LState, name string) {
+		L.RaiseError("%s result exceeded the memory limit of %dMB", name, memoryLimit)
+	}
+
+	str := L.GetGlobal(lua.StringLibName).(*lua.LTable)
+	L.SetField(str, "rep", L.NewFunction(func(L *lua.LState) int {
+		s, n := L.CheckString(1), L.CheckInt(2)
+		if n <= 0 {
+			L.Push(lua.LString(""))
+			return 1
+		}
+		if n > limit || len(s)*n > limit {
+			exceeded(L, "string.rep")
+		}
+		L.Push(lua.LString(strings.Repeat(s, n)))
+		return 1
+	}))
+
+	// format和gsub的结果长度无法预先计算, 在生成之后检查
+	for _, name := range []string{"format", "gsub"} {
+		name, fn := name, L.GetField(str, name).(*lua.LFunction).GFunction
+		L.SetField(str, name, L.NewFunction(func(L *lua.LState) int {
+			n := fn(L)
+			if s, ok := L.Get(L.GetTop() - n + 1).(lua.LString); ok && len(s) > limit {
+				exceeded(L, "string."+name)
+			}
+			return n
+		}))
+	}
+
+	tab := L.GetGlobal(lua.TabLibName).(*lua.LTable)
+	concat := L.GetField(tab, "concat").(*lua.LFunction).GFunction
+	L.SetField(tab, "concat", L.NewFunction(func(L *lua.LState) int {
+		tbl, sep := L.CheckTable(1), L.OptString(2, "")
+		size := 0
+		for i := L.OptInt(3, 1); i <= L.OptInt(4, tbl.Len()) && size <= limit; i++ {
+			size += len(lua.LVAsString(tbl.RawGetInt(i))) + len(sep)
+		}
+		if size > limit {
+			exceeded(L, "table.concat")
+		}
+		return concat(L)
+	}))
+	return L
+}
+
+// newEnv 每次执行使用独立的全局环境, 库函数所在的table也复制一份,
+// 脚本定义的全局变量以及对库函数的修改不会影响下一次执行
+func newEnv(L *lua.LState) *lua.LTable {
+	env := L.NewTable()
+	L.G.Global.ForEach(func(k, v lua.LValue) {
+		if lib, ok := v.(*lua.LTable); ok {
+			tbl := L.NewTable()
+			lib.ForEach(tbl.RawSet)
+			v = tbl
+		}
+		env.RawSet(k, v)
+	})
+	return env
+}
+
+func (p *scriptProcessor) run(ctx context.Context, values []interface{}) ([]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, p.conf.Timeout)
+	defer cancel()
+
+	L := p.states.Get().(*lua.LState)
+	L.SetContext(ctx)
+
+	inputs := L.NewTable()
+	for i, name := range p.conf.Inputs {
+		v, err := toLua(L, values[i])
+		if err != nil {
+			L.RemoveContext()
+			p.states.Put(L)
+			return nil, fmt.Errorf("Failed to convert input %s: %v", name, err)
+		}
+		L.SetField(inputs, name, v)
+	}
+
+	env := newEnv(L)
+	L.SetField(env, "inputs", inputs)
+
+	fn := L.NewFunctionFromProto(p.proto)
+	fn.Env = env
+	L.Push(fn)
+	err := L.PCall(0, 1, nil)
+	if err != nil {
+		// 超时或者出错后虚拟机的状态不确定, 不再复用
+		L.Close()
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("Script timeout after %s: %w", p.conf.Timeout, context.Cause(ctx))
+		}
+		return nil, err
+	}
+
+	ret := L.Get(-1)
+	L.Pop(1)
+	L.RemoveContext()
+	p.states.Put(L)
+
+	if ret == lua.LNil {
+		return nil, pipeline.ErrDrop
+	}
+
+	tbl, ok := ret.(*lua.LTable)
+	if !ok {
+		return nil, fmt.Errorf("Script must return a table or nil, got %s", ret.Type())
+	}
+
+	out := make([]interface{}, len(p.outputs))
+	var convErr error
+	tbl.ForEach(func(k, v lua.LValue) {
+		if convErr != nil {
+			return
+		}
+
+		name := k.String()
+		i := sort.Search(len(p.outputs), func(i int) bool { return p.outputs[i].Name >= name })
+		if i >= len(p.outputs) || p.outputs[i].Name != name {
+			convErr = fmt.Errorf("Script returned undeclared output %s", name)
+			return
+		}
+
+		val, err := fromLua(v, p.outputs[i].Type)
+		if err != nil {
+			convErr = fmt.Errorf("Failed to convert output %s: %v", name, err)
+			return
+		}
+		out[i] = val.Interface()
+	})
+	if convErr != nil {
+		return nil, convErr
+	}
+	return out, nil
+}
+
+// toLua 将注入的值转换成lua的值, 结构体等复杂类型先以yaml的规则转换成map和list
+func toLua(L *lua.LState, v interface{}) (lua.LValue, error) {
+	if v == nil {
+		return lua.LNil, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return lua.LString(rv.String()), nil
+	case reflect.Bool:
+		return lua.LBool(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return lua.LNumber(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(rv.Float()), nil
+	case reflect.Ptr, reflect.Interface:
+		if rv.IsNil() {
+			return lua.LNil, nil
+		}
+		return toLua(L, rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 && rv.Kind() == reflect.Slice {
+			return lua.LString(rv.Bytes()), nil
+		}
+		tbl := L.NewTable()
+		for i := 0; i < rv.Len(); i++ {
+			e, err := toLua(L, rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			tbl.Append(e)
+		}
+		return tbl, nil
+	case reflect.Map:
+		tbl := L.NewTable()
+		iter := rv.MapRange()
+		for iter.Next() {
+			e, err := toLua(L, iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			L.SetField(tbl, fmt.Sprint(iter.Key().Interface()), e)
+		}
+		return tbl, nil
+	case reflect.Struct:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var m map[string]interface{}
+		if err := yaml.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		return toLua(L, m)
+	default:
+		return nil, fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// fromLua 将脚本返回的值转换成输出字段的类型
+func fromLua(v lua.LValue, t reflect.Type) (reflect.Value, error) {
+	if v == lua.LNil {
+		return reflect.Zero(t), nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return reflect.ValueOf(lua.LVAsString(v)), nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return reflect.ValueOf([]byte(lua.LVAsString(v))), nil
+		}
+	case reflect.Bool:
+		return reflect.ValueOf(lua.LVAsBool(v)), nil
+	case reflect.Int, reflect.Int64, reflect.Float64:
+		n, ok := v.(lua.LNumber)
+		if !ok {
+			return reflect.Value{}, fmt.Errorf("expected number, got %s", v.Type())
+		}
+		return reflect.ValueOf(float64(n)).Convert(t), nil
+	}
+
+	val := toGo(v)
+	if val == nil {
+		return reflect.Zero(t), nil
+	}
+	rv := reflect.ValueOf(val)
+	if !rv.Type().AssignableTo(t) {
+		return reflect.Value{}, fmt.Errorf("expected %s, got %s", t, rv.Type())
+	}
+	return rv, nil
+}
+
+// toGo 数组形式的table转换成[]interface{}, 其他table转换成map[string]interface{}
+func toGo(v lua.LValue) interface{} {
+	switch v := v.(type) {
+	case lua.LString:
+		return string(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LBool:
+		return bool(v)
+	case *lua.LTable:
+		if n := v.Len(); n > 0 {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, toGo(v.RawGetInt(i)))
+			}
+			return list
+		}
+		m := map[string]interface{}{}
+		v.ForEach(func(k, e lua.LValue) {
+			m[k.String()] = toGo(e)
+		})
+		return m
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,220 @@
+package script
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+type event struct {
+	Level string `yaml:"level"`
+	Text  string `yaml:"text"`
+}
+
+type eventInput struct {
+	Event event `inject:"Event"`
+}
+
+func TestScript(t *testing.T) {
+	p := nezhatest.NewProcessor(t, "script", `
+inputs: [Event, Params]
+outputs:
+  Message: string
+  Size: int
+  Tags: list
+script: |
+  local e = inputs.Event
+  if e.level ~= "error" then
+    return nil
+  end
+  leaked = true
+  return { Message = e.text .. inputs.Params.suffix, Size = #e.text, Tags = { e.level, "alert" } }
+`)
+	h := nezhatest.New(t).WithParams(map[string]string{"suffix": "!"})
+
+	res := h.Run(p.Processor, eventInput{Event: event{Level: "error", Text: "disk full"}})
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.Field(0).String(), "disk full!")
+	assert.Equal(t, res.Value.Field(1).Int(), int64(9))
+	assert.DeepEqual(t, res.Value.Field(2).Interface(), []interface{}{"error", "alert"})
+
+	res = h.Run(p.Processor, eventInput{Event: event{Level: "info", Text: "ok"}})
+	assert.Assert(t, errors.Is(res.Err, pipeline.ErrDrop))
+}
+
+func TestScriptSandbox(t *testing.T) {
+	h := nezhatest.New(t)
+	for _, script := range []string{
+		`return { Ok = os == nil and io == nil and load == nil and require == nil and leaked == nil }`,
+		`return { Ok = pcall(string.rep, "x", 1e9) == false }`,
+		`return { Ok = _G == nil and getfenv == nil and setfenv == nil and rawset == nil and getmetatable("") == nil }`,
+	} {
+		p, err := New("outputs: {Ok: bool}\nscript: '" + script + "'")
+		assert.NilError(t, err)
+
+		res := h.Run(p)
+		assert.NilError(t, res.Err)
+		assert.Assert(t, res.Value.Field(0).Bool(), script)
+	}
+
+	// 对全局变量和库函数的修改不会影响同一个虚拟机的下一次执行
+	p, err := New(`
+outputs: {Ok: bool}
+script: |
+  if leaked then
+    return { Ok = false }
+  end
+  local ok = string.upper ~= nil and ("x"):upper() == "X" and math.max ~= nil
+  leaked = true
+  string.upper = nil
+  math.max = nil
+  return { Ok = ok }
+`)
+	assert.NilError(t, err)
+	for i := 0; i < 3; i++ {
+		res := h.Run(p)
+		assert.NilError(t, res.Err)
+		assert.Assert(t, res.Value.Field(0).Bool())
+	}
+
+	// 生成字符串的库函数和lua栈受memory_limit限制
+	for _, script := range []string{
+		`return { Text = string.rep("x", 2 * 1024 * 1024) }`,
+		`local t = {} for i = 1, 2048 do t[i] = string.rep("x", 1024) end return { Text = table.concat(t) }`,
+		`return { Text = string.gsub("ab", "a", string.rep("x", 1024 * 1024)) }`,
+		`return { Text = string.format("%s%s", string.rep("x", 1024 * 1024), "x") }`,
+	} {
+		p, err := New("timeout: 10s\nmemory_limit: 1\nscript: '" + script + "'")
+		assert.NilError(t, err)
+		assert.ErrorContains(t, h.Run(p).Err, "exceeded the memory limit of 1MB", script)
+	}
+
+	p, err = New("timeout: 10s\nmemory_limit: 1\nscript: 'local t = {} for i = 1, 100000 do t[i] = i end return { Text = tostring(#{unpack(t)}) }'")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, h.Run(p).Err, "registry overflow")
+
+	p, err = New("script: 'local function f(n) return 1 + f(n) end return f(1)'")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, h.Run(p).Err, "stack overflow")
+
+	p, err = New("timeout: 50ms\nscript: 'while true do end'")
+	assert.NilError(t, err)
+	res := h.Run(p)
+	assert.Assert(t, errors.Is(res.Err, context.DeadlineExceeded))
+
+	p, err = New("script: 'return { Unknown = 1 }'")
+	assert.NilError(t, err)
+	assert.ErrorContains(t, h.Run(p).Err, "undeclared output Unknown")
+
+	_, err = New("script: 'return {'")
+	assert.ErrorContains(t, err, "Failed to compile script")
+
+	_, err = New("outputs: {Ok: uint}\nscript: 'return {}'")
+	assert.ErrorContains(t, err, "Unsupported type uint")
+}
+
+func TestScriptDropInStream(t *testing.T) {
+	var called bool
+	source := pipeline.Processor{Name: "source", Processor: func(r struct {
+		Ctx context.Context `inject:"Context"`
+	}) eventInput {
+		return eventInput{Event: event{Level: "info"}}
+	}}
+	filter := nezhatest.NewProcessor(t, "script", `
+inputs: [Event]
+script: 'if inputs.Event.level ~= "error" then return nil end return {}'`)
+	filter.Name = "filter"
+	sink := pipeline.Processor{Name: "sink", Processor: func(r struct {
+		Ctx context.Context `inject:"Context"`
+	}) {
+		called = true
+	}}
+
+	conf := pipeline.StreamConfig{Name: "source", Childs: []pipeline.StreamConfig{
+		{Name: "filter", Childs: []pipeline.StreamConfig{{Name: "sink"}}},
+	}}
+	res := nezhatest.New(t).RunStream(conf, source, filter, sink)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Run.Status, pipeline.RunStatusSucceeded)
+	assert.Assert(t, !called)
+}
+
+func TestFilterAndMapping(t *testing.T) {
+	h := nezhatest.New(t)
+
+	filter := nezhatest.NewProcessor(t, "filter", "inputs: [Event]\nexpr: inputs.Event.level == \"error\"")
+	assert.NilError(t, h.Run(filter.Processor, eventInput{Event: event{Level: "error"}}).Err)
+	assert.Assert(t, errors.Is(h.Run(filter.Processor, eventInput{Event: event{Level: "info"}}).Err, pipeline.ErrDrop))
+
+	mapping := nezhatest.NewProcessor(t, "mapping", `
+inputs: [Event]
+output: Projection
+fields:
+  level: string.upper(inputs.Event.level)
+  size: "#inputs.Event.text"
+  missing: inputs.Event.missing
+`)
+	res := h.Run(mapping.Processor, eventInput{Event: event{Level: "error", Text: "disk full"}})
+	assert.NilError(t, res.Err)
+	assert.DeepEqual(t, res.Value.Field(0).Interface(), map[string]interface{}{"level": "ERROR", "size": float64(9)})
+
+	_, err := NewFilter("inputs: [Event]")
+	assert.ErrorContains(t, err, "expr of filter is required")
+	_, err = NewMapping("inputs: [Event]\noutput: Projection\nfields: {bad: 'inputs.Event.'}")
+	assert.ErrorContains(t, err, "Failed to compile script")
+}
+
+func TestSwitchInStream(t *testing.T) {
+	var branches []string
+	sink := func(name string) pipeline.Processor {
+		return pipeline.Processor{Name: name, Processor: func(r struct {
+			Branch string `inject:"Branch"`
+		}) error {
+			branches = append(branches, r.Branch)
+			return nil
+		}}
+	}
+
+	sw := nezhatest.NewProcessor(t, "switch", `
+inputs: [Event]
+output: Branch
+cases:
+  - when: inputs.Event.level == "error"
+    branch: alert
+  - when: inputs.Event.level == "warn"
+    branch: notify
+default: archive
+`)
+	sw.Name = "switch"
+
+	conf := pipeline.StreamConfig{Name: "source", Childs: []pipeline.StreamConfig{
+		{
+			Name:  "switch",
+			Route: &pipeline.RouteConfig{By: "Branch"},
+			Childs: []pipeline.StreamConfig{
+				{Name: "alert"},
+				{Name: "other", Branch: "archive"},
+			},
+		},
+	}}
+	for _, level := range []string{"error", "warn", "info"} {
+		level := level
+		source := pipeline.Processor{Name: "source", Processor: func(r struct {
+			Ctx context.Context `inject:"Context"`
+		}) eventInput {
+			return eventInput{Event: event{Level: level}}
+		}}
+		res := nezhatest.New(t).RunStream(conf, source, sw, sink("alert"), sink("other"))
+		assert.NilError(t, res.Err)
+		assert.Equal(t, res.Run.Status, pipeline.RunStatusSucceeded)
+	}
+	// warn没有对应的分支, 也没有配置default, 数据被丢弃
+	assert.DeepEqual(t, branches, []string{"alert", "archive"})
+
+	_, err := NewSwitch("inputs: [Event]\noutput: Branch\ncases: [{branch: alert}]")
+	assert.ErrorContains(t, err, "when of case 0 of switch is required")
+}
@@ -0,0 +1,105 @@
+// Package text 提供文本处理的processor
+package text
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	splitFactory       processor.Factory = NewSplitFactory()
+	defaultSplitConfig                   = SplitConfig{
+		Input:     "Message",
+		Output:    "Lines",
+		SkipEmpty: true,
+	}
+	splitDescription = "split the injected string or []byte into lines"
+)
+
+const maxLineLength = 1 << 20
+
+func init() {
+	if err := processor.Register("line_split", splitFactory); err != nil {
+		panic(err)
+	}
+}
+
+func NewSplitFactory() processor.Factory {
+	return processor.NewFactory(
+		defaultSplitConfig,
+		splitDescription,
+		func(c string) (processor.Processor, error) {
+			return NewSplit(c)
+		})
+}
+
+type SplitConfig struct {
+	Input string `yaml:"input"`
+	// 拆分结果的注入名称, 类型为[]string
+	Output string `yaml:"output"`
+	// 分隔符, 默认按行拆分, 兼容\r\n
+	Separator string `yaml:"separator,omitempty"`
+	// 是否去掉每一行首尾的空白
+	Trim bool `yaml:"trim"`
+	// 是否丢弃空行
+	SkipEmpty bool `yaml:"skip_empty"`
+}
+
+func (c SplitConfig) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+func NewSplit(rawConfig string) (processor.Processor, error) {
+	var conf SplitConfig
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Input == "" || conf.Output == "" {
+		return nil, fmt.Errorf("The input and output of line_split are required")
+	}
+
+	outputs := []dynamic.Field{{Name: conf.Output, Type: dynamic.StringsType}}
+	return dynamic.New([]string{conf.Input}, outputs, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+		text, err := dynamic.Text(inputs[0])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to split %s: %v", conf.Input, err)
+		}
+
+		parts, err := split(text, conf.Separator)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to split %s: %v", conf.Input, err)
+		}
+
+		lines := make([]string, 0, len(parts))
+		for _, line := range parts {
+			if conf.Trim {
+				line = strings.TrimSpace(line)
+			}
+			if conf.SkipEmpty && line == "" {
+				continue
+			}
+			lines = append(lines, line)
+		}
+		return []interface{}{lines}, nil
+	}), nil
+}
+
+func split(text, sep string) ([]string, error) {
+	if sep != "" {
+		return strings.Split(text, sep), nil
+	}
+
+	var lines []string
+	s := bufio.NewScanner(strings.NewReader(text))
+	s.Buffer(nil, maxLineLength)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	return lines, s.Err()
+}
@@ -0,0 +1,27 @@
+package text
+
+import (
+	"testing"
+
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+type message struct {
+	Message []byte `inject:"Message"`
+}
+
+func TestSplit(t *testing.T) {
+	h := nezhatest.New(t)
+
+	p := nezhatest.NewProcessor(t, "line_split", "input: Message\noutput: Lines\ntrim: true\nskip_empty: true")
+	res := h.Run(p.Processor, message{Message: []byte("a\r\n b \n\n c")})
+	assert.NilError(t, res.Err)
+	assert.DeepEqual(t, res.Value.Field(0).Interface(), []string{"a", "b", "c"})
+
+	sp, err := NewSplit("input: Message\noutput: Lines\nseparator: '|'")
+	assert.NilError(t, err)
+	res = h.Run(sp, message{Message: []byte("a||b")})
+	assert.NilError(t, res.Err)
+	assert.DeepEqual(t, res.Value.Field(0).Interface(), []string{"a", "", "b"})
+}
@@ -0,0 +1,220 @@
+package window
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+)
+
+const (
+	OpCount = "count"
+	OpSum   = "sum"
+	OpMin   = "min"
+	OpMax   = "max"
+	OpAvg   = "avg"
+	OpTop   = "top"
+)
+
+const defaultTopK = 10
+
+type Aggregation struct {
+	// 聚合结果的名称
+	Name string `yaml:"name"`
+	// count, sum, min, max, avg或者top
+	Op string `yaml:"op"`
+	// 聚合的字段, 以.分隔的路径, 第一段为inputs中的名称, count为空时统计数据条数, 否则统计字段存在的条数
+	Field string `yaml:"field,omitempty"`
+	// top返回出现次数最多的k个值, 默认10
+	K int `yaml:"k,omitempty"`
+}
+
+// aggregator 编译后的Aggregation
+type aggregator struct {
+	Aggregation
+	path []string
+}
+
+func newAggregator(a Aggregation, inputs []string) (*aggregator, error) {
+	if a.Name == "" {
+		return nil, fmt.Errorf("The name of the aggregation is required")
+	}
+
+	switch a.Op {
+	case OpCount:
+	case OpSum, OpMin, OpMax, OpAvg, OpTop:
+		if a.Field == "" {
+			return nil, fmt.Errorf("The field of the aggregation %s(%s) is required", a.Name, a.Op)
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported aggregation op %s of %s, expected count, sum, min, max, avg or top", a.Op, a.Name)
+	}
+	if a.Op == OpTop && a.K <= 0 {
+		a.K = defaultTopK
+	}
+
+	agg := &aggregator{Aggregation: a}
+	if a.Field != "" {
+		var err error
+		if agg.path, err = splitPath(a.Field, inputs); err != nil {
+			return nil, err
+		}
+	}
+	return agg, nil
+}
+
+// aggState 聚合的中间状态, 可以合并, 以json保存在Store中
+type aggState struct {
+	Count int64            `json:"count"`
+	Sum   float64          `json:"sum,omitempty"`
+	Min   *float64         `json:"min,omitempty"`
+	Max   *float64         `json:"max,omitempty"`
+	Top   map[string]int64 `json:"top,omitempty"`
+}
+
+// extract 查找聚合的字段, 数值类的聚合转换成float64, top转换成字符串, 字段不存在时ok为false
+func (a *aggregator) extract(values map[string]interface{}) (interface{}, bool, error) {
+	if a.path == nil {
+		return nil, true, nil
+	}
+
+	v, ok := dynamic.Lookup(values, a.path)
+	if !ok || v == nil {
+		return nil, false, nil
+	}
+
+	switch a.Op {
+	case OpCount:
+		return nil, true, nil
+	case OpTop:
+		return fmt.Sprint(v), true, nil
+	}
+
+	f, err := toFloat(v)
+	if err != nil {
+		return nil, false, fmt.Errorf("The field %s of aggregation %s is not a number: %v", a.Field, a.Name, err)
+	}
+	return f, true, nil
+}
+
+// add 累加extract的结果
+func (s *aggState) add(v interface{}) {
+	s.Count++
+	switch v := v.(type) {
+	case string:
+		if s.Top == nil {
+			s.Top = map[string]int64{}
+		}
+		s.Top[v]++
+	case float64:
+		s.Sum += v
+		if s.Min == nil || v < *s.Min {
+			s.Min = &v
+		}
+		if s.Max == nil || v > *s.Max {
+			s.Max = &v
+		}
+	}
+}
+
+// merge 会话窗口合并时合并聚合状态
+func (s *aggState) merge(o *aggState) {
+	s.Count += o.Count
+	s.Sum += o.Sum
+	if o.Min != nil && (s.Min == nil || *o.Min < *s.Min) {
+		s.Min = o.Min
+	}
+	if o.Max != nil && (s.Max == nil || *o.Max > *s.Max) {
+		s.Max = o.Max
+	}
+	for k, n := range o.Top {
+		if s.Top == nil {
+			s.Top = map[string]int64{}
+		}
+		s.Top[k] += n
+	}
+}
+
+func (a *aggregator) result(s *aggState) interface{} {
+	switch a.Op {
+	case OpCount:
+		return s.Count
+	case OpSum:
+		return s.Sum
+	case OpMin:
+		if s.Min == nil {
+			return nil
+		}
+		return *s.Min
+	case OpMax:
+		if s.Max == nil {
+			return nil
+		}
+		return *s.Max
+	case OpAvg:
+		if s.Count == 0 {
+			return nil
+		}
+		return s.Sum / float64(s.Count)
+	case OpTop:
+		return topK(s.Top, a.K)
+	}
+	return nil
+}
+
+// topK 按照次数倒序返回[{value: v, count: n}], 次数相同时按照值排序
+func topK(counts map[string]int64, k int) []interface{} {
+	values := make([]string, 0, len(counts))
+	for v := range counts {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if counts[values[i]] != counts[values[j]] {
+			return counts[values[i]] > counts[values[j]]
+		}
+		return values[i] < values[j]
+	})
+	if len(values) > k {
+		values = values[:k]
+	}
+
+	res := make([]interface{}, 0, len(values))
+	for _, v := range values {
+		res = append(res, map[string]interface{}{"value": v, "count": counts[v]})
+	}
+	return res
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), nil
+	case int8:
+		return float64(n), nil
+	case int16:
+		return float64(n), nil
+	case int32:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case uint:
+		return float64(n), nil
+	case uint8:
+		return float64(n), nil
+	case uint16:
+		return float64(n), nil
+	case uint32:
+		return float64(n), nil
+	case uint64:
+		return float64(n), nil
+	case float32:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(n), 64)
+	}
+	return 0, fmt.Errorf("Unexpected type %T", v)
+}
@@ -0,0 +1,283 @@
+package window
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	StoreMemory = "memory"
+	StoreLocal  = "local"
+)
+
+var (
+	windowBucket = []byte("windows")
+	metaBucket   = []byte("meta")
+	maxTimeKey   = []byte("max_time")
+)
+
+// Store 保存未过期的窗口以及已经到达的最大事件时间, 窗口的计算在内存中进行,
+// 每条数据处理完成后将变化的窗口交给Store, processor创建时从Store恢复
+type Store interface {
+	Load() ([]*window, time.Time, error)
+	// Save 记录变化的窗口, 由Store决定何时写入
+	Save(updated []*window, removed []string, maxTime time.Time) error
+	// Flush 立即写入记录的变化
+	Flush() error
+	// Close 写入记录的变化并释放Store
+	Close() error
+}
+
+// memoryStore 状态只保存在内存中, 进程重启后丢失
+type memoryStore struct{}
+
+func (memoryStore) Load() ([]*window, time.Time, error) {
+	return nil, time.Time{}, nil
+}
+
+func (memoryStore) Save(updated []*window, removed []string, maxTime time.Time) error {
+	return nil
+}
+
+func (memoryStore) Flush() error {
+	return nil
+}
+
+func (memoryStore) Close() error {
+	return nil
+}
+
+var (
+	stateLock sync.Mutex
+	stateDir  string
+	// stores 以路径为key复用打开的文件, bolt对文件加锁, pipeline重建时新的processor不能再次打开同一个文件
+	stores = map[string]*localStore{}
+)
+
+// SetStateDir 设置local store默认的目录, nezha server将其设置为metadata目录下的windows
+func SetStateDir(dir string) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	stateDir = dir
+}
+
+// CloseAll 写入所有local store中记录的变化并关闭文件, 在进程退出之前调用
+func CloseAll() {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	for path, s := range stores {
+		if err := s.close(); err != nil {
+			log.Error("Failed to close the window store %s: %s", path, err)
+		}
+		delete(stores, path)
+	}
+}
+
+// localStore 状态保存在本地的bolt文件中, 每个窗口为windows bucket中的一个key.
+// 变化先以编码后的形式记录在内存中, 每隔interval或者调用Flush时在一个事务中写入
+type localStore struct {
+	path     string
+	db       *bolt.DB
+	interval time.Duration
+	refs     int // 使用该文件的processor数, 由stateLock保护
+
+	lock    sync.Mutex
+	updated map[string][]byte
+	removed map[string]struct{}
+	maxTime []byte
+	timer   *time.Timer
+}
+
+// newLocalStore 状态保存在dir下的{id}.db中, dir为空时使用SetStateDir设置的目录
+func newLocalStore(dir, id string, interval time.Duration) (*localStore, error) {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if dir == "" {
+		dir = stateDir
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("The dir of the local store is required when running without nezha server")
+	}
+
+	path := filepath.Join(dir, id+".db")
+	if s, ok := stores[path]; ok {
+		s.refs++
+		s.lock.Lock()
+		s.interval = interval
+		s.lock.Unlock()
+		return s, nil
+	}
+
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open the local store %s: %v", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{windowBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &localStore{
+		path:     path,
+		db:       db,
+		interval: interval,
+		refs:     1,
+		updated:  map[string][]byte{},
+		removed:  map[string]struct{}{},
+	}
+	stores[path] = s
+	return s, nil
+}
+
+// Load 先写入之前的processor记录的变化, 再读取全部状态
+func (s *localStore) Load() ([]*window, time.Time, error) {
+	if err := s.Flush(); err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var (
+		windows []*window
+		maxTime time.Time
+	)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(metaBucket).Get(maxTimeKey); data != nil {
+			if err := maxTime.UnmarshalText(data); err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket(windowBucket).ForEach(func(k, v []byte) error {
+			var w window
+			if err := json.Unmarshal(v, &w); err != nil {
+				return fmt.Errorf("Failed to decode window %s: %v", k, err)
+			}
+			windows = append(windows, &w)
+			return nil
+		})
+	})
+	return windows, maxTime, err
+}
+
+// Save 编码变化的窗口, 调用方之后可以继续修改它们
+func (s *localStore) Save(updated []*window, removed []string, maxTime time.Time) error {
+	values := make(map[string][]byte, len(updated))
+	for _, w := range updated {
+		data, err := json.Marshal(w)
+		if err != nil {
+			return err
+		}
+		values[w.ID] = data
+	}
+
+	mt, err := maxTime.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range removed {
+		delete(s.updated, id)
+		s.removed[id] = struct{}{}
+	}
+	for id, data := range values {
+		s.updated[id] = data
+	}
+	s.maxTime = mt
+
+	if s.timer == nil {
+		s.timer = time.AfterFunc(s.interval, func() {
+			if err := s.Flush(); err != nil {
+				log.Error("Failed to save the window state %s: %s", s.path, err)
+			}
+		})
+	}
+	return nil
+}
+
+func (s *localStore) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.maxTime == nil {
+		return nil
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(windowBucket)
+		for id := range s.removed {
+			if err := b.Delete([]byte(id)); err != nil {
+				return err
+			}
+		}
+
+		for id, data := range s.updated {
+			if err := b.Put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBucket).Put(maxTimeKey, s.maxTime)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.updated = map[string][]byte{}
+	s.removed = map[string]struct{}{}
+	s.maxTime = nil
+	return nil
+}
+
+// Close 没有processor使用时关闭文件
+func (s *localStore) Close() error {
+	stateLock.Lock()
+	defer stateLock.Unlock()
+
+	if stores[s.path] != s {
+		// 已经被CloseAll关闭
+		return nil
+	}
+
+	s.refs--
+	if s.refs > 0 {
+		return s.Flush()
+	}
+	delete(stores, s.path)
+	return s.close()
+}
+
+func (s *localStore) close() error {
+	err := s.Flush()
+	if cerr := s.db.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
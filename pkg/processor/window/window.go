@@ -0,0 +1,614 @@
+// Package window 提供按照时间窗口聚合数据的processor
+package window
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	TypeTumbling = "tumbling"
+	TypeSliding  = "sliding"
+	TypeSession  = "session"
+)
+
+var (
+	factory       processor.Factory = NewFactory()
+	defaultConfig                   = Config{
+		Inputs: []string{"Record"},
+		Output: "WindowResults",
+		Type:   TypeTumbling,
+		Size:   time.Minute,
+		Key:    "Record.page",
+		Time:   "Record.timestamp",
+		Delay:  5 * time.Second,
+		Aggregations: []Aggregation{
+			{Name: "count", Op: OpCount},
+			{Name: "top_users", Op: OpTop, Field: "Record.user", K: 10},
+		},
+		Store: StoreMemory,
+	}
+	description = "aggregate the items in tumbling, sliding or session windows by key, " +
+		"items are dropped until a window is closed by the watermark and its result is emitted"
+)
+
+const (
+	defaultCheckpointInterval = time.Second
+	// pipeline暂停等原因导致定时器无法输出窗口时, 重试的间隔
+	emitRetryInterval = time.Second
+)
+
+// errLate 数据所属的窗口都已经超过了允许的延迟
+var errLate = fmt.Errorf("%w, the event is later than the allowed lateness", pipeline.ErrDrop)
+
+func init() {
+	if err := processor.Register("window", factory); err != nil {
+		panic(err)
+	}
+}
+
+func NewFactory() processor.Factory {
+	return processor.NewFactory(
+		defaultConfig,
+		description,
+		func(c string) (processor.Processor, error) {
+			return New(c)
+		})
+}
+
+type Config struct {
+	Inputs []string `yaml:"inputs"`
+	// 窗口结果的注入名称, 类型为[]interface{}, 每个元素为包含key, start, end, late以及各个聚合结果的map
+	Output string `yaml:"output"`
+	// tumbling, sliding或者session
+	Type string `yaml:"type"`
+	// tumbling和sliding窗口的长度
+	Size time.Duration `yaml:"size,omitempty"`
+	// sliding窗口的滑动间隔
+	Slide time.Duration `yaml:"slide,omitempty"`
+	// session窗口的超时时间, 同一个key的数据间隔超过gap时开始新的会话
+	Gap time.Duration `yaml:"gap,omitempty"`
+	// 分组的key, 以.分隔的路径, 第一段为inputs中的名称, 为空时所有数据在同一组
+	Key string `yaml:"key,omitempty"`
+	// 事件时间的路径, 为空时使用处理时间, 此时watermark也随时间推进, 没有新数据时窗口同样会被输出
+	Time string `yaml:"time,omitempty"`
+	// 事件时间的格式, 默认RFC3339, unix和unix_ms表示秒和毫秒时间戳, 其他值作为time.Parse的layout
+	TimeFormat string `yaml:"time_format,omitempty"`
+	// 允许的乱序时间, watermark为已经到达的最大事件时间减去delay, 结束时间不晚于watermark的窗口被输出
+	Delay time.Duration `yaml:"delay,omitempty"`
+	// 窗口输出后继续保留的时间, 期间到达的迟到数据会更新窗口并以late: true再次输出, 之后到达的数据被丢弃
+	Lateness time.Duration `yaml:"lateness,omitempty"`
+	// 聚合, 默认为{name: count, op: count}
+	Aggregations []Aggregation `yaml:"aggregations"`
+	// 状态的存储, memory或者local, local将状态保存在本地文件中, 重启后恢复未输出的窗口
+	Store string `yaml:"store,omitempty"`
+	// local store的名称, 状态保存在dir下的{id}.db中, 不同的window processor必须使用不同的id
+	ID string `yaml:"id,omitempty"`
+	// local store的目录, 默认为nezha server的metadata目录下的windows
+	Dir string `yaml:"dir,omitempty"`
+	// local store写入文件的间隔, 默认1s, 窗口输出时立即写入, 进程异常退出时最多丢失该时间内的状态
+	CheckpointInterval time.Duration `yaml:"checkpoint_interval,omitempty"`
+}
+
+func (c Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
+
+// window 一个key的一个窗口
+type window struct {
+	ID string `json:"id"`
+	// yaml编码的key
+	Key     string      `json:"key"`
+	Start   time.Time   `json:"start"`
+	End     time.Time   `json:"end"`
+	Emitted bool        `json:"emitted"`
+	Aggs    []*aggState `json:"aggs"`
+}
+
+// windower 所有窗口保存在内存中, 每条数据在锁内分配到窗口并推进watermark,
+// 被watermark关闭的窗口的结果随当前数据输出到下游, 否则当前数据以pipeline.ErrDrop结束.
+// 使用处理时间时, 定时器在窗口到期时推进watermark, 关闭的窗口以新的运行输出
+type windower struct {
+	conf     Config
+	keyPath  []string
+	timePath []string
+	aggs     []*aggregator
+	store    Store
+
+	lock    sync.Mutex
+	windows map[string]*window
+	maxTime time.Time
+	emitter *dynamic.Emitter // 最近一次执行所在的pipeline
+	timer   *time.Timer
+	timerAt time.Time
+	closed  bool
+}
+
+func New(rawConfig string) (processor.Processor, error) {
+	var conf Config
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+
+	w, err := newWindower(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := []dynamic.Field{{Name: conf.Output, Type: dynamic.ListType}}
+	return pipeline.WithClose(dynamic.New(conf.Inputs, outputs, func(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+		values := make(map[string]interface{}, len(conf.Inputs))
+		for i, name := range conf.Inputs {
+			values[name] = inputs[i]
+		}
+
+		results, err := w.add(ctx, values, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		if len(results) == 0 {
+			return nil, pipeline.ErrDrop
+		}
+		return []interface{}{results}, nil
+	}), w.close), nil
+}
+
+func newWindower(conf Config) (*windower, error) {
+	if len(conf.Inputs) == 0 || conf.Output == "" {
+		return nil, fmt.Errorf("The inputs and output of window are required")
+	}
+
+	switch conf.Type {
+	case TypeTumbling:
+		if conf.Size <= 0 {
+			return nil, fmt.Errorf("The size of the tumbling window is required")
+		}
+		conf.Slide = conf.Size
+	case TypeSliding:
+		if conf.Size <= 0 || conf.Slide <= 0 || conf.Slide > conf.Size {
+			return nil, fmt.Errorf("The size and slide of the sliding window are required, and slide must not be greater than size")
+		}
+	case TypeSession:
+		if conf.Gap <= 0 {
+			return nil, fmt.Errorf("The gap of the session window is required")
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported window type %s, expected tumbling, sliding or session", conf.Type)
+	}
+
+	if conf.Delay < 0 || conf.Lateness < 0 {
+		return nil, fmt.Errorf("The delay and lateness of window must not be negative")
+	}
+
+	if len(conf.Aggregations) == 0 {
+		conf.Aggregations = []Aggregation{{Name: "count", Op: OpCount}}
+	}
+	if conf.CheckpointInterval <= 0 {
+		conf.CheckpointInterval = defaultCheckpointInterval
+	}
+
+	w := &windower{conf: conf, windows: map[string]*window{}}
+
+	var err error
+	if conf.Key != "" {
+		if w.keyPath, err = splitPath(conf.Key, conf.Inputs); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Time != "" {
+		if w.timePath, err = splitPath(conf.Time, conf.Inputs); err != nil {
+			return nil, err
+		}
+	}
+
+	names := map[string]struct{}{"key": {}, "start": {}, "end": {}, "late": {}}
+	for _, a := range conf.Aggregations {
+		if _, ok := names[a.Name]; ok {
+			return nil, fmt.Errorf("The aggregation name %s is duplicated or reserved", a.Name)
+		}
+		names[a.Name] = struct{}{}
+
+		agg, err := newAggregator(a, conf.Inputs)
+		if err != nil {
+			return nil, err
+		}
+		w.aggs = append(w.aggs, agg)
+	}
+
+	switch conf.Store {
+	case "", StoreMemory:
+		w.store = memoryStore{}
+	case StoreLocal:
+		if conf.ID == "" {
+			return nil, fmt.Errorf("The id of window is required when using the local store")
+		}
+		if w.store, err = newLocalStore(conf.Dir, conf.ID, conf.CheckpointInterval); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported window store %s, expected memory or local", conf.Store)
+	}
+
+	windows, maxTime, err := w.store.Load()
+	if err != nil {
+		w.store.Close()
+		return nil, fmt.Errorf("Failed to load the window state: %v", err)
+	}
+	for _, win := range windows {
+		if len(win.Aggs) != len(w.aggs) {
+			w.store.Close()
+			// 聚合的配置发生了变化, 之前的状态无法继续使用
+			return nil, fmt.Errorf("The aggregations of window %s are changed, remove the state file or use another id", conf.ID)
+		}
+		w.windows[win.ID] = win
+	}
+	w.maxTime = maxTime
+	return w, nil
+}
+
+// close 在pipeline停止时停止定时器, 写入剩余的状态并释放store
+func (w *windower) close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.closed = true
+	if err := w.store.Close(); err != nil {
+		return fmt.Errorf("Failed to close the window store: %v", err)
+	}
+	return nil
+}
+
+// add 将数据加入所属的窗口, 返回被关闭的窗口和迟到数据更新的窗口的结果
+func (w *windower) add(ctx context.Context, values map[string]interface{}, now time.Time) ([]interface{}, error) {
+	key, err := w.key(values)
+	if err != nil {
+		return nil, err
+	}
+
+	ts := now
+	if w.timePath != nil {
+		v, ok := dynamic.Lookup(values, w.timePath)
+		if !ok || v == nil {
+			return nil, fmt.Errorf("The event time %s is not found", w.conf.Time)
+		}
+		if ts, err = w.parseTime(v); err != nil {
+			return nil, fmt.Errorf("Failed to parse the event time %s: %v", w.conf.Time, err)
+		}
+	}
+
+	fields := make([]interface{}, len(w.aggs))
+	present := make([]bool, len(w.aggs))
+	for i, agg := range w.aggs {
+		if fields[i], present[i], err = agg.extract(values); err != nil {
+			return nil, err
+		}
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return nil, fmt.Errorf("The window is closed")
+	}
+	if e, ok := dynamic.NewEmitter(ctx); ok {
+		w.emitter = e
+	}
+
+	updated := map[string]*window{}
+	var removed []string
+
+	targets := w.assign(key, ts, updated, &removed)
+	if len(targets) == 0 {
+		return nil, errLate
+	}
+	for _, win := range targets {
+		for i := range w.aggs {
+			if present[i] {
+				win.Aggs[i].add(fields[i])
+			}
+		}
+		updated[win.ID] = win
+	}
+
+	if ts.After(w.maxTime) {
+		w.maxTime = ts
+	}
+	results, err := w.advance(updated, removed, nil)
+	w.schedule(now)
+	return results, err
+}
+
+// advance 按照当前的watermark输出关闭的窗口以及updated中已经输出过的窗口, 删除超过lateness的窗口,
+// emit不为nil时由emit输出结果, 失败时窗口保持未输出的状态. 调用时需要持有锁
+func (w *windower) advance(updated map[string]*window, removed []string, emit func([]interface{}) error) ([]interface{}, error) {
+	watermark := w.watermark()
+
+	var emitted []*window
+	late := map[string]bool{}
+	for _, win := range w.windows {
+		if _, ok := updated[win.ID]; ok && win.Emitted {
+			late[win.ID] = true
+			emitted = append(emitted, win)
+		} else if !win.End.After(watermark) && !win.Emitted {
+			emitted = append(emitted, win)
+		}
+	}
+
+	sort.Slice(emitted, func(i, j int) bool {
+		a, b := emitted[i], emitted[j]
+		if !a.End.Equal(b.End) {
+			return a.End.Before(b.End)
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		return a.Start.Before(b.Start)
+	})
+
+	results := make([]interface{}, 0, len(emitted))
+	for _, win := range emitted {
+		results = append(results, w.result(win, late[win.ID]))
+	}
+	if emit != nil && len(results) > 0 {
+		if err := emit(results); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, win := range emitted {
+		win.Emitted = true
+		updated[win.ID] = win
+	}
+	for _, win := range w.windows {
+		if !win.End.Add(w.conf.Lateness).After(watermark) && win.Emitted {
+			delete(w.windows, win.ID)
+			delete(updated, win.ID)
+			removed = append(removed, win.ID)
+		}
+	}
+
+	changed := make([]*window, 0, len(updated))
+	for _, win := range updated {
+		changed = append(changed, win)
+	}
+	err := w.store.Save(changed, removed, w.maxTime)
+	if err == nil && (len(emitted) > 0 || len(removed) > 0) {
+		// 窗口输出之后立即写入, 避免重启后再次输出
+		err = w.store.Flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to save the window state: %v", err)
+	}
+	return results, nil
+}
+
+// schedule 使用处理时间时, 在下一个窗口关闭或者过期时推进watermark, 调用时需要持有锁
+func (w *windower) schedule(now time.Time) {
+	if w.timePath != nil || w.emitter == nil || w.emitter.Stopped() {
+		return
+	}
+
+	var next time.Time
+	for _, win := range w.windows {
+		at := win.End.Add(w.conf.Delay)
+		if win.Emitted {
+			at = at.Add(w.conf.Lateness)
+		}
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+	if next.IsZero() {
+		return
+	}
+	if !next.After(now) {
+		// 上一次输出失败
+		next = now.Add(emitRetryInterval)
+	}
+
+	if w.timer != nil {
+		if w.timerAt.Equal(next) {
+			return
+		}
+		w.timer.Stop()
+	}
+	w.timer = time.AfterFunc(next.Sub(now), w.tick)
+	w.timerAt = next
+}
+
+// tick 以当前时间推进watermark, 关闭的窗口以新的运行输出到下游
+func (w *windower) tick() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return
+	}
+	w.timer = nil
+	now := time.Now()
+	if now.After(w.maxTime) {
+		w.maxTime = now
+	}
+
+	_, err := w.advance(map[string]*window{}, nil, func(results []interface{}) error {
+		if w.emitter == nil {
+			return fmt.Errorf("Window is not running in a pipeline")
+		}
+		return w.emitter.Emit([]interface{}{results})
+	})
+	if err != nil {
+		log.Error("Failed to emit the closed windows: %s", err)
+	}
+	w.schedule(now)
+}
+
+// assign 返回数据所属的窗口, 不存在的窗口会被创建, 已经过期的窗口被忽略,
+// session窗口合并时被合并的窗口加入removed
+func (w *windower) assign(key string, ts time.Time, updated map[string]*window, removed *[]string) []*window {
+	watermark := w.watermark()
+	expired := func(end time.Time) bool {
+		return !w.maxTime.IsZero() && !end.Add(w.conf.Lateness).After(watermark)
+	}
+
+	if w.conf.Type == TypeSession {
+		start, end := ts, ts.Add(w.conf.Gap)
+		var merged []*window
+		for _, win := range w.windows {
+			if win.Key == key && win.Start.Before(end) && ts.Before(win.End) {
+				merged = append(merged, win)
+				if win.Start.Before(start) {
+					start = win.Start
+				}
+				if win.End.After(end) {
+					end = win.End
+				}
+			}
+		}
+		if expired(end) {
+			return nil
+		}
+
+		target := w.newWindow(key, start, end)
+		for _, win := range merged {
+			// 合并了已经输出的会话时, 新的会话作为迟到数据的更新再次输出
+			target.Emitted = target.Emitted || win.Emitted
+			for i, s := range win.Aggs {
+				target.Aggs[i].merge(s)
+			}
+			delete(w.windows, win.ID)
+			delete(updated, win.ID)
+			*removed = append(*removed, win.ID)
+		}
+		w.windows[target.ID] = target
+		return []*window{target}
+	}
+
+	var targets []*window
+	for start := ts.Truncate(w.conf.Slide); start.Add(w.conf.Size).After(ts); start = start.Add(-w.conf.Slide) {
+		end := start.Add(w.conf.Size)
+		if expired(end) {
+			continue
+		}
+
+		id := windowID(key, start)
+		win, ok := w.windows[id]
+		if !ok {
+			win = w.newWindow(key, start, end)
+			w.windows[id] = win
+		}
+		targets = append(targets, win)
+	}
+	return targets
+}
+
+func (w *windower) newWindow(key string, start, end time.Time) *window {
+	win := &window{ID: windowID(key, start), Key: key, Start: start, End: end}
+	for range w.aggs {
+		win.Aggs = append(win.Aggs, &aggState{})
+	}
+	return win
+}
+
+func (w *windower) watermark() time.Time {
+	return w.maxTime.Add(-w.conf.Delay)
+}
+
+func (w *windower) result(win *window, late bool) map[string]interface{} {
+	var key interface{}
+	if win.Key != "" {
+		_ = yaml.Unmarshal([]byte(win.Key), &key)
+		key = dynamic.Normalize(key)
+	}
+
+	res := map[string]interface{}{
+		"key":   key,
+		"start": win.Start,
+		"end":   win.End,
+		"late":  late,
+	}
+	for i, agg := range w.aggs {
+		res[agg.Name] = agg.result(win.Aggs[i])
+	}
+	return res
+}
+
+// key 以yaml编码key的值, 结果中再解码还原
+func (w *windower) key(values map[string]interface{}) (string, error) {
+	if w.keyPath == nil {
+		return "", nil
+	}
+
+	v, ok := dynamic.Lookup(values, w.keyPath)
+	if !ok || v == nil {
+		return "", fmt.Errorf("The window key %s is not found", w.conf.Key)
+	}
+
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("Failed to encode the window key: %v", err)
+	}
+	return string(data), nil
+}
+
+func (w *windower) parseTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case *time.Time:
+		if t != nil {
+			return *t, nil
+		}
+	}
+
+	switch w.conf.TimeFormat {
+	case "unix", "unix_ms":
+		f, err := toFloat(v)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if w.conf.TimeFormat == "unix_ms" {
+			return time.Unix(0, int64(f*float64(time.Millisecond))), nil
+		}
+		return time.Unix(0, int64(f*float64(time.Second))), nil
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return time.Time{}, fmt.Errorf("Expected string, got %T", v)
+		}
+
+		layout := w.conf.TimeFormat
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+		return time.Parse(layout, s)
+	}
+}
+
+func windowID(key string, start time.Time) string {
+	return key + "@" + strconv.FormatInt(start.UnixNano(), 10)
+}
+
+func splitPath(path string, inputs []string) ([]string, error) {
+	parts := strings.Split(path, ".")
+	for _, name := range inputs {
+		if parts[0] == name {
+			return parts, nil
+		}
+	}
+	return nil, fmt.Errorf("The path %s of window must start with one of the inputs %v", path, inputs)
+}
@@ -0,0 +1,290 @@
+package window
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/yaml.v2"
+	"gotest.tools/v3/assert"
+)
+
+type event struct {
+	Page  string `yaml:"page"`
+	User  string `yaml:"user"`
+	Cost  int    `yaml:"cost"`
+	Time  string `yaml:"time"`
+	Epoch int64  `yaml:"epoch"`
+}
+
+type eventInput struct {
+	Event event `inject:"Event"`
+}
+
+var base = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func at(page, user string, offset time.Duration) map[string]interface{} {
+	return map[string]interface{}{"Event": event{
+		Page: page,
+		User: user,
+		Cost: int(offset / time.Second),
+		Time: base.Add(offset).Format(time.RFC3339Nano),
+	}}
+}
+
+func newTestWindower(t *testing.T, rawConfig string) *windower {
+	var conf Config
+	assert.NilError(t, yaml.Unmarshal([]byte(rawConfig), &conf))
+	w, err := newWindower(conf)
+	assert.NilError(t, err)
+	return w
+}
+
+func add(t *testing.T, w *windower, values map[string]interface{}) []interface{} {
+	res, err := w.add(context.Background(), values, time.Now())
+	assert.NilError(t, err)
+	return res
+}
+
+func TestTumbling(t *testing.T) {
+	w := newTestWindower(t, `
+inputs: [Event]
+output: Results
+type: tumbling
+size: 1m
+key: Event.page
+time: Event.time
+delay: 10s
+aggregations:
+- {name: count, op: count}
+- {name: cost, op: sum, field: Event.cost}
+- {name: top_users, op: top, field: Event.user, k: 1}
+`)
+
+	assert.Equal(t, len(add(t, w, at("a", "u1", 0))), 0)
+	assert.Equal(t, len(add(t, w, at("a", "u2", 30*time.Second))), 0)
+	assert.Equal(t, len(add(t, w, at("b", "u2", 40*time.Second))), 0)
+	assert.Equal(t, len(add(t, w, at("a", "u2", 50*time.Second))), 0)
+	// watermark推进到1m, 第一个窗口的两个key被关闭
+	assert.Equal(t, len(add(t, w, at("a", "u1", 65*time.Second))), 0)
+	res := add(t, w, at("a", "u1", 70*time.Second))
+	assert.DeepEqual(t, res, []interface{}{
+		map[string]interface{}{
+			"key": "a", "start": base, "end": base.Add(time.Minute), "late": false,
+			"count": int64(3), "cost": float64(80),
+			"top_users": []interface{}{map[string]interface{}{"value": "u2", "count": int64(2)}},
+		},
+		map[string]interface{}{
+			"key": "b", "start": base, "end": base.Add(time.Minute), "late": false,
+			"count": int64(1), "cost": float64(40),
+			"top_users": []interface{}{map[string]interface{}{"value": "u2", "count": int64(1)}},
+		},
+	})
+
+	// 第一个窗口已经过期, 迟到的数据被丢弃
+	_, err := w.add(context.Background(), at("a", "u1", 5*time.Second), time.Now())
+	assert.Assert(t, errors.Is(err, pipeline.ErrDrop))
+}
+
+func TestSlidingAndLateness(t *testing.T) {
+	w := newTestWindower(t, `
+inputs: [Event]
+output: Results
+type: sliding
+size: 2m
+slide: 1m
+time: Event.time
+lateness: 1m
+`)
+
+	assert.Equal(t, len(add(t, w, at("a", "u", 90*time.Second))), 0)
+	res := add(t, w, at("a", "u", 150*time.Second))
+	// [0s, 2m)关闭
+	assert.Equal(t, len(res), 1)
+	assert.DeepEqual(t, res[0].(map[string]interface{})["count"], int64(1))
+	assert.DeepEqual(t, res[0].(map[string]interface{})["end"], base.Add(2*time.Minute))
+
+	// 迟到的数据在lateness之内, 更新已经输出的窗口并再次输出
+	res = add(t, w, at("a", "u", 100*time.Second))
+	assert.Equal(t, len(res), 1)
+	assert.DeepEqual(t, res[0].(map[string]interface{})["count"], int64(2))
+	assert.DeepEqual(t, res[0].(map[string]interface{})["late"], true)
+
+	res = add(t, w, at("a", "u", 190*time.Second))
+	assert.Equal(t, len(res), 1)
+	assert.DeepEqual(t, res[0].(map[string]interface{})["end"], base.Add(3*time.Minute))
+	assert.DeepEqual(t, res[0].(map[string]interface{})["count"], int64(3))
+}
+
+func TestSession(t *testing.T) {
+	w := newTestWindower(t, `
+inputs: [Event]
+output: Results
+type: session
+gap: 30s
+delay: 30s
+key: Event.user
+time: Event.time
+aggregations:
+- {name: first, op: min, field: Event.cost}
+- {name: last, op: max, field: Event.cost}
+`)
+
+	assert.Equal(t, len(add(t, w, at("a", "u1", 0))), 0)
+	assert.Equal(t, len(add(t, w, at("a", "u1", 40*time.Second))), 0)
+	// 20s的数据将[0s, 30s)和[40s, 70s)合并成一个会话
+	assert.Equal(t, len(add(t, w, at("a", "u1", 20*time.Second))), 0)
+	assert.Equal(t, len(w.windows), 1)
+
+	res := add(t, w, at("a", "u2", 100*time.Second))
+	assert.DeepEqual(t, res, []interface{}{
+		map[string]interface{}{
+			"key": "u1", "start": base, "end": base.Add(70 * time.Second), "late": false,
+			"first": float64(0), "last": float64(40),
+		},
+	})
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	rawConfig := `
+inputs: [Event]
+output: Results
+type: tumbling
+size: 1m
+time: Event.epoch
+time_format: unix
+store: local
+id: test
+dir: ` + dir
+
+	h := nezhatest.New(t)
+	epoch := func(offset time.Duration) eventInput {
+		return eventInput{Event: event{Epoch: base.Add(offset).Unix()}}
+	}
+
+	p, err := New(rawConfig)
+	assert.NilError(t, err)
+	for _, offset := range []time.Duration{0, 10 * time.Second} {
+		res := h.Run(p, epoch(offset))
+		assert.Assert(t, errors.Is(res.Err, pipeline.ErrDrop))
+	}
+
+	// 关闭之后的processor不再接收数据, 重新创建的processor从local store恢复未输出的窗口
+	_, closer := pipeline.UnwrapProcessor(p)
+	assert.NilError(t, closer())
+	res := h.Run(p, epoch(20*time.Second))
+	assert.ErrorContains(t, res.Err, "The window is closed")
+
+	p, err = New(rawConfig)
+	assert.NilError(t, err)
+	res = h.Run(p, epoch(time.Minute))
+	assert.NilError(t, res.Err)
+	results := res.Value.Field(0).Interface().([]interface{})
+	assert.Equal(t, len(results), 1)
+	assert.DeepEqual(t, results[0].(map[string]interface{})["count"], int64(2))
+	assert.Assert(t, results[0].(map[string]interface{})["start"].(time.Time).Equal(base))
+
+	_, err = New("inputs: [Event]\noutput: Results\ntype: tumbling\nsize: 1m\nstore: local\nid: test\naggregations: [{name: a, op: count}, {name: b, op: count}]\ndir: " + dir)
+	assert.ErrorContains(t, err, "aggregations of window test are changed")
+
+	_, err = New("inputs: [Event]\noutput: Results\ntype: hopping")
+	assert.ErrorContains(t, err, "Unsupported window type hopping")
+}
+
+func TestProcessingTimeTimer(t *testing.T) {
+	results := make(chan []interface{}, 1)
+	timerRuns := make(chan pipeline.RunResult, 1)
+	source := pipeline.Processor{Name: "source", Processor: func(r struct {
+		Ctx context.Context `inject:"Context"`
+	}) eventInput {
+		return eventInput{Event: event{Page: "a"}}
+	}}
+	win := nezhatest.NewProcessor(t, "window", "inputs: [Event]\noutput: Results\ntype: tumbling\nsize: 50ms\nkey: Event.page")
+	win.Name = "window"
+	sink := pipeline.Processor{Name: "sink", Processor: func(r struct {
+		Results []interface{} `inject:"Results"`
+	}) struct{} {
+		results <- r.Results
+		return struct{}{}
+	}}
+
+	conf := pipeline.StreamConfig{Name: "source", Childs: []pipeline.StreamConfig{
+		{Name: "window", Childs: []pipeline.StreamConfig{{Name: "sink"}}},
+	}}
+	stream, err := pipeline.NewStream(conf, map[string]pipeline.Processor{"source": source, "window": win, "sink": sink})
+	assert.NilError(t, err)
+	p, err := pipeline.New(
+		pipeline.WithName("test_window_timer"),
+		pipeline.WithProcessors(source, win, sink),
+		pipeline.WithStream(stream),
+		pipeline.WithConfig(pipeline.Config{Name: "test_window_timer", Schedule: "@yearly", Stream: conf}),
+		pipeline.WithRunListener(func(res pipeline.RunResult) {
+			if res.Trigger == pipeline.TriggerTimer {
+				timerRuns <- res
+			}
+		}),
+	)
+	assert.NilError(t, err)
+	assert.NilError(t, p.Start())
+	defer p.Stop()
+
+	res, err := p.Trigger(nil)
+	assert.NilError(t, err)
+	assert.Equal(t, res.Status, pipeline.RunStatusSucceeded)
+
+	// 没有新的数据, 窗口由定时器关闭并输出
+	select {
+	case r := <-results:
+		assert.Equal(t, len(r), 1)
+		assert.DeepEqual(t, r[0].(map[string]interface{})["count"], int64(1))
+	case <-time.After(5 * time.Second):
+		t.Fatal("the window is not emitted by the timer")
+	}
+
+	select {
+	case r := <-timerRuns:
+		assert.Equal(t, r.Status, pipeline.RunStatusSucceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run triggered by the timer is not finished")
+	}
+}
+
+func TestLocalStoreCheckpoint(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newLocalStore(dir, "checkpoint", time.Hour)
+	assert.NilError(t, err)
+
+	stored := func() int {
+		var n int
+		assert.NilError(t, s.db.View(func(tx *bolt.Tx) error {
+			n = tx.Bucket(windowBucket).Stats().KeyN
+			return nil
+		}))
+		return n
+	}
+
+	win := &window{ID: "a", Start: base, End: base.Add(time.Minute)}
+	assert.NilError(t, s.Save([]*window{win}, nil, base))
+	assert.Equal(t, stored(), 0)
+	assert.NilError(t, s.Flush())
+	assert.Equal(t, stored(), 1)
+
+	assert.NilError(t, s.Save(nil, []string{"a"}, base))
+	CloseAll()
+
+	// 关闭时写入剩余的变化并释放文件锁
+	db, err := bolt.Open(filepath.Join(dir, "checkpoint.db"), 0640, &bolt.Options{Timeout: 100 * time.Millisecond})
+	assert.NilError(t, err)
+	defer db.Close()
+	assert.NilError(t, db.View(func(tx *bolt.Tx) error {
+		assert.Equal(t, tx.Bucket(windowBucket).Stats().KeyN, 0)
+		return nil
+	}))
+	assert.NilError(t, s.Close())
+}
@@ -1,10 +1,16 @@
 package client
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
-	pipe "github.com/shima-park/lotus/pipeline"
+	pipe "github.com/shima-park/nezha/pkg/pipeline"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
 )
 
@@ -51,3 +57,76 @@ func (p *pipeline) GenerateConfig(name, schedule string, components, processors
 func (p *pipeline) Recreate(conf pipe.Config) error {
 	return PostYaml(p.api("/pipeline/recreate"), conf, nil)
 }
+
+func (p *pipeline) Trigger(req proto.PipelineTriggerRequest) (*proto.RunView, error) {
+	var res proto.RunView
+	err := PostJSON(p.api("/pipeline/trigger"), req, &res)
+	return &res, err
+}
+
+func (p *pipeline) Runs(name string) ([]proto.RunView, error) {
+	var res []proto.RunView
+	err := GetJSON(p.api("/pipeline/runs?"+url.Values{"name": []string{name}}.Encode()), &res)
+	return res, err
+}
+
+func (p *pipeline) DAG() ([]proto.DAGEdgeView, error) {
+	var res []proto.DAGEdgeView
+	err := GetJSON(p.api("/pipeline/dag"), &res)
+	return res, err
+}
+
+// Tap 读取服务端以换行分隔的json流, 服务端结束或者ctx结束时关闭返回的通道
+func (p *pipeline) Tap(ctx context.Context, req proto.PipelineTapRequest) (<-chan pipe.TapEvent, error) {
+	vals := url.Values{}
+	vals.Add("name", req.Name)
+	vals.Add("processor", req.Processor)
+	vals.Add("sample", strconv.Itoa(req.Sample))
+	vals.Add("limit", strconv.Itoa(req.Limit))
+	vals.Add("max_field_length", strconv.Itoa(req.MaxFieldLength))
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, p.api("/pipeline/tap?"+vals.Encode()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP status code: %d", resp.StatusCode)
+	}
+
+	// 参数错误时服务端返回普通的json结果
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/x-ndjson") {
+		defer resp.Body.Close()
+		if err := handleBody(resp.Body, nil); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("Unexpected response of tap")
+	}
+
+	events := make(chan pipe.TapEvent)
+	go func() {
+		defer close(events)
+		defer resp.Body.Close()
+
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var event pipe.TapEvent
+			if err := dec.Decode(&event); err != nil {
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
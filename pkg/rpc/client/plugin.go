@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"os"
 
 	"github.com/shima-park/nezha/pkg/rpc/proto"
@@ -20,6 +21,12 @@ func (c *plugin) List() ([]proto.PluginView, error) {
 	return res, err
 }
 
+func (c *plugin) Find(path string) (*proto.PluginDetailView, error) {
+	var res proto.PluginDetailView
+	err := GetJSON(c.api("/plugin?path="+url.QueryEscape(path)), &res)
+	return &res, err
+}
+
 func (c *plugin) Open(path string) error {
 	req := &proto.PluginOpenRequest{
 		Path: path,
@@ -27,50 +34,79 @@ func (c *plugin) Open(path string) error {
 	return PostJSON(c.api("/plugin/open"), req, nil)
 }
 
-func (c *plugin) Add(path string) error {
-	file, err := os.Open(path)
-	if err != nil {
+// Add 上传插件, Signature不为空时一起上传插件的签名文件
+func (c *plugin) Add(req proto.PluginAddRequest) error {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	if err := writeFormFile(writer, "plugin", req.Path); err != nil {
 		return err
 	}
-	fileContents, err := ioutil.ReadAll(file)
+	if req.Signature != "" {
+		if err := writeFormFile(writer, "signature", req.Signature); err != nil {
+			return err
+		}
+	}
+	for field, value := range map[string]string{"name": req.Name, "version": req.Version} {
+		if err := writer.WriteField(field, value); err != nil {
+			return err
+		}
+	}
+
+	err := writer.Close()
 	if err != nil {
 		return err
 	}
-	fi, err := file.Stat()
+
+	request, err := http.NewRequest("POST", c.api("/plugin/upload"), body)
 	if err != nil {
 		return err
 	}
-	file.Close()
+	request.Header.Add("Content-Type", writer.FormDataContentType())
 
-	body := new(bytes.Buffer)
-	writer := multipart.NewWriter(body)
-	part, err := writer.CreateFormFile("plugin", fi.Name())
+	client := &http.Client{}
+	resp, err := client.Do(request)
 	if err != nil {
 		return err
 	}
-	part.Write(fileContents)
+	defer resp.Body.Close()
 
-	err = writer.Close()
+	err = handleBody(resp.Body, nil)
 	if err != nil {
 		return err
 	}
+	return nil
+}
 
-	request, err := http.NewRequest("POST", c.api("/plugin/upload"), body)
+func (c *plugin) Upgrade(name, version string) ([]string, error) {
+	req := &proto.PluginUpgradeRequest{
+		Name:    name,
+		Version: version,
+	}
+	var res []string
+	err := PostJSON(c.api("/plugin/upgrade"), req, &res)
+	return res, err
+}
+
+func writeFormFile(writer *multipart.Writer, field, path string) error {
+	file, err := os.Open(path)
 	if err != nil {
 		return err
 	}
-	request.Header.Add("Content-Type", writer.FormDataContentType())
+	defer file.Close()
 
-	client := &http.Client{}
-	resp, err := client.Do(request)
+	fileContents, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	fi, err := file.Stat()
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
 
-	err = handleBody(resp.Body, nil)
+	part, err := writer.CreateFormFile(field, fi.Name())
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = part.Write(fileContents)
+	return err
 }
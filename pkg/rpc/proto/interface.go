@@ -1,7 +1,9 @@
 package proto
 
 import (
-	pipe "github.com/shima-park/lotus/pipeline"
+	"context"
+
+	pipe "github.com/shima-park/nezha/pkg/pipeline"
 )
 
 type Pipeline interface {
@@ -11,6 +13,11 @@ type Pipeline interface {
 	List() ([]PipelineView, error)
 	Find(name string) (*PipelineView, error)
 	Control(cmd ControlCommand, names []string) error
+	Trigger(req PipelineTriggerRequest) (*RunView, error)
+	Runs(name string) ([]RunView, error)
+	DAG() ([]DAGEdgeView, error)
+	// Tap 实时采样processor的输入输出, ctx结束或者达到Limit时关闭返回的通道
+	Tap(ctx context.Context, req PipelineTapRequest) (<-chan pipe.TapEvent, error)
 }
 
 type Component interface {
@@ -25,8 +32,13 @@ type Processor interface {
 
 type Plugin interface {
 	List() ([]PluginView, error)
+	// Find 返回插件注册的processor和component, 以及使用它们的pipeline
+	Find(path string) (*PluginDetailView, error)
 	Open(path string) error
-	Add(path string) error
+	Add(req PluginAddRequest) error
+	// Upgrade 将插件不带版本号的processor和component切换到version, 并重建依赖它们的pipeline,
+	// 任意一个pipeline重建失败时回滚到之前的版本, 返回被重建的pipeline
+	Upgrade(name, version string) ([]string, error)
 }
 
 type Server interface {
@@ -38,6 +50,9 @@ type FileType string
 const (
 	FileTypePlugin         FileType = "plugins"
 	FileTypePipelineConfig FileType = "pipelines"
+	FileTypePipelineState  FileType = "states"
+	FileTypePipelineRun    FileType = "runs"
+	FileTypeWindowState    FileType = "windows"
 )
 
 type Metadata interface {
@@ -47,4 +62,10 @@ type Metadata interface {
 	ExistsPath(ft FileType, path string) bool
 	ListPaths(ft FileType) []string
 	Overwrite(ft FileType, path string, data []byte) error
+	// SetChecksum GetChecksum 记录文件的sha256, 用于检测文件是否被篡改
+	SetChecksum(path, checksum string) error
+	GetChecksum(path string) string
+	// SetPluginVersion GetPluginVersion 记录不带版本号的processor和component使用的插件版本
+	SetPluginVersion(name, version string) error
+	GetPluginVersion(name string) string
 }
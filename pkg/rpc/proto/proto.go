@@ -6,6 +6,9 @@ const (
 	ControlCommandStart   ControlCommand = "start"
 	ControlCommandStop    ControlCommand = "stop"
 	ControlCommandRestart ControlCommand = "restart"
+	ControlCommandTrigger ControlCommand = "trigger"
+	ControlCommandPause   ControlCommand = "pause"
+	ControlCommandResume  ControlCommand = "resume"
 )
 
 type VisualizeFormat string
@@ -24,19 +27,84 @@ type Result struct {
 }
 
 type PipelineView struct {
-	Name          string          `json:"name"`
-	State         string          `json:"state"`
-	Schedule      string          `json:"schedule"`
-	Bootstrap     bool            `json:"bootstrap"`
-	StartTime     string          `json:"start_time"`
-	ExitTime      string          `json:"exit_time"`
-	RunTimes      string          `json:"run_times"`
-	NextRunTime   string          `json:"next_run_time"`
-	LastStartTime string          `json:"last_start_time"`
-	LastEndTime   string          `json:"last_end_time"`
-	Components    []ComponentView `json:"components,emitempty"`
-	Processors    []ProcessorView `json:"processors,emitempty"`
-	RawConfig     []byte          `json:"raw_config,emitempty"`
+	Name              string          `json:"name"`
+	State             string          `json:"state"`
+	Schedule          string          `json:"schedule"`
+	Timezone          string          `json:"timezone"`
+	Jitter            string          `json:"jitter"`
+	ConcurrencyPolicy string          `json:"concurrency_policy"`
+	CatchUpPolicy     string          `json:"catch_up_policy"`
+	DependsOn         []string        `json:"depends_on,omitempty"`
+	Bootstrap         bool            `json:"bootstrap"`
+	StartTime         string          `json:"start_time"`
+	ExitTime          string          `json:"exit_time"`
+	RunTimes          string          `json:"run_times"`
+	NextRunTime       string          `json:"next_run_time"`
+	NextRunTimes      []string        `json:"next_run_times,omitempty"`
+	LastStartTime     string          `json:"last_start_time"`
+	LastEndTime       string          `json:"last_end_time"`
+	SkipTimes         string          `json:"skip_times"`
+	LastSkipTime      string          `json:"last_skip_time"`
+	LastSkipReason    string          `json:"last_skip_reason"`
+	Components        []ComponentView `json:"components,emitempty"`
+	Processors        []ProcessorView `json:"processors,emitempty"`
+	Streams           []StreamView    `json:"streams,omitempty"`
+	RawConfig         []byte          `json:"raw_config,emitempty"`
+}
+
+// StreamView stream中单个节点的执行统计
+type StreamView struct {
+	Name            string `json:"name"`
+	Workers         int    `json:"workers"`
+	BufferSize      int    `json:"buffer_size"`
+	QueueDepth      string `json:"queue_depth"`
+	RateLimit       string `json:"rate_limit,omitempty"`
+	RunTimes        string `json:"run_times"`
+	SuccessCount    string `json:"success_count"`
+	ErrorCount      string `json:"error_count"`
+	DropCount       string `json:"drop_count"`
+	RetryCount      string `json:"retry_count"`
+	TimeoutCount    string `json:"timeout_count"`
+	DeadLetterCount string `json:"dead_letter_count"`
+	DeadLetterError string `json:"dead_letter_error_count"`
+}
+
+type PipelineTriggerRequest struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+type PipelineTapRequest struct {
+	Name           string `json:"name"`
+	Processor      string `json:"processor"`
+	Sample         int    `json:"sample"` // 每Sample个数据采样一个
+	Limit          int    `json:"limit"`
+	MaxFieldLength int    `json:"max_field_length"`
+}
+
+type RunView struct {
+	ID         string              `json:"id"`
+	Pipeline   string              `json:"pipeline"`
+	Trigger    string              `json:"trigger"`
+	Status     string              `json:"status"`
+	StartTime  string              `json:"start_time"`
+	EndTime    string              `json:"end_time"`
+	Elapsed    string              `json:"elapsed"`
+	Error      string              `json:"error,omitempty"`
+	Params     map[string]string   `json:"params,omitempty"`
+	Processors []ProcessorStatView `json:"processors,omitempty"`
+}
+
+type ProcessorStatView struct {
+	Name    string `json:"name"`
+	Calls   int    `json:"calls"`
+	Elapsed string `json:"elapsed"`
+}
+
+type DAGEdgeView struct {
+	From      string `json:"from"`
+	To        string `json:"to"`
+	Condition string `json:"condition"`
 }
 
 type ComponentView struct {
@@ -57,9 +125,38 @@ type ProcessorView struct {
 }
 
 type PluginView struct {
-	Path     string `json:"path"`
-	Module   string `json:"module"`
+	Path    string `json:"path"`
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+	// 不带版本号的processor和component是否使用该版本
+	Current bool   `json:"current"`
+	Module  string `json:"module"`
+	// go: .so插件, grpc: 独立进程运行的插件, wasm: 在沙箱中运行的WebAssembly模块
+	Mode     string `json:"mode"`
+	PID      int    `json:"pid,omitempty"`
+	Restarts int    `json:"restarts,omitempty"`
 	OpenTime string `json:"open_time"`
+	SHA256   string `json:"sha256,omitempty"`
+	// 构建插件时的go版本和主模块
+	GoVersion  string `json:"go_version,omitempty"`
+	MainModule string `json:"main_module,omitempty"`
+	// 与nezha共同依赖的模块, 格式为path@version
+	SharedDeps []string `json:"shared_deps,omitempty"`
+}
+
+// PluginDetailView 插件的详细信息, 包括插件注册的processor和component
+type PluginDetailView struct {
+	PluginView
+	Processors []PluginItemView `json:"processors"`
+	Components []PluginItemView `json:"components"`
+}
+
+type PluginItemView struct {
+	Name         string `json:"name"`
+	SampleConfig string `json:"sample_config"`
+	Description  string `json:"description"`
+	// 当前使用该processor或component的pipeline
+	Pipelines []string `json:"pipelines"`
 }
 
 type MetadataView struct {
@@ -71,3 +168,17 @@ type MetadataView struct {
 type PluginOpenRequest struct {
 	Path string `json:"path"`
 }
+
+type PluginAddRequest struct {
+	Path string `json:"path"`
+	// 插件的ed25519签名文件路径, 可以为空
+	Signature string `json:"signature"`
+	// 插件的名称和语义化版本, 为空时从插件的构建信息中获取
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type PluginUpgradeRequest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
@@ -9,6 +9,10 @@ var (
 type Options struct {
 	HTTPAddr     string
 	MetadataPath string
+	// 每个pipeline保留的运行记录数, 小于等于0时使用默认值
+	RunHistoryLimit int
+	// 信任的ed25519公钥文件, 配置之后插件必须带有其中一个公钥的签名
+	TrustedKeysPath string
 }
 
 type Option func(*Options)
@@ -24,3 +28,15 @@ func MetadataPath(path string) Option {
 		o.MetadataPath = path
 	}
 }
+
+func RunHistoryLimit(limit int) Option {
+	return func(o *Options) {
+		o.RunHistoryLimit = limit
+	}
+}
+
+func TrustedKeysPath(path string) Option {
+	return func(o *Options) {
+		o.TrustedKeysPath = path
+	}
+}
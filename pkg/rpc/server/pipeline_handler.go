@@ -1,10 +1,14 @@
 package server
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/shima-park/lotus/pipeline"
+	"github.com/shima-park/nezha/pkg/pipeline"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
 )
 
@@ -43,6 +47,83 @@ func (s *Server) ctrlPipeline(c *gin.Context) {
 	Success(c, nil)
 }
 
+func (s *Server) triggerPipeline(c *gin.Context) {
+	var req proto.PipelineTriggerRequest
+	if err := c.BindJSON(&req); err != nil {
+		Failed(c, err)
+		return
+	}
+
+	res, err := s.Pipeline.Trigger(req)
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	Success(c, res)
+}
+
+func (s *Server) listPipelineRuns(c *gin.Context) {
+	res, err := s.Pipeline.Runs(c.Query("name"))
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	Success(c, res)
+}
+
+func (s *Server) pipelineDAG(c *gin.Context) {
+	res, err := s.Pipeline.DAG()
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	Success(c, res)
+}
+
+// tapPipeline 以换行分隔的json流式返回采样的事件, 客户端断开或者达到limit时结束
+func (s *Server) tapPipeline(c *gin.Context) {
+	req := proto.PipelineTapRequest{
+		Name:      c.Query("name"),
+		Processor: c.Query("processor"),
+	}
+
+	for key, val := range map[string]*int{
+		"sample":           &req.Sample,
+		"limit":            &req.Limit,
+		"max_field_length": &req.MaxFieldLength,
+	} {
+		if c.Query(key) == "" {
+			continue
+		}
+
+		i, err := strconv.Atoi(c.Query(key))
+		if err != nil {
+			Failed(c, fmt.Errorf("Invalid %s: %s", key, c.Query(key)))
+			return
+		}
+		*val = i
+	}
+
+	events, err := s.Pipeline.Tap(c.Request.Context(), req)
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(c.Writer)
+	c.Stream(func(w io.Writer) bool {
+		event, ok := <-events
+		if !ok {
+			return false
+		}
+		return enc.Encode(event) == nil
+	})
+}
+
 func (s *Server) generateConfig(c *gin.Context) {
 	name := c.Query("name")
 	schedule := c.Query("schedule")
@@ -6,8 +6,8 @@ import (
 
 	"github.com/olekukonko/tablewriter"
 	"github.com/shima-park/lotus/common/inject"
-	"github.com/shima-park/lotus/pipeline"
 	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
 )
 
 func ASCIITableVisualizer(w io.Writer, pipeline pipeline.Pipeliner) error {
@@ -2,11 +2,13 @@ package server
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"github.com/gin-gonic/gin"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
+	"github.com/shima-park/nezha/pkg/rpc/server/service"
 )
 
 func (s *Server) listPlugins(c *gin.Context) {
@@ -19,6 +21,16 @@ func (s *Server) listPlugins(c *gin.Context) {
 	Success(c, res)
 }
 
+func (s *Server) findPlugin(c *gin.Context) {
+	res, err := s.Plugin.Find(c.Query("path"))
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	Success(c, res)
+}
+
 func (s *Server) openPlugin(c *gin.Context) {
 	var req proto.PluginOpenRequest
 	err := c.BindJSON(&req)
@@ -43,8 +55,33 @@ func (s *Server) uploadPlugin(c *gin.Context) {
 		return
 	}
 
+	dir := s.metadata.GetPath(proto.FileTypePlugin, "")
+	err = os.MkdirAll(dir, 0750)
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	// 先保存到临时文件, 从插件的构建信息中获取名称和版本后再移动到最终的路径
+	tmp, err := ioutil.TempFile(dir, ".upload-")
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+	_ = tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := c.SaveUploadedFile(pluginFile, tmp.Name()); err != nil {
+		Failed(c, err)
+		return
+	}
+
 	filename := filepath.Base(pluginFile.Filename)
-	path := s.metadata.GetPath(proto.FileTypePlugin, filename)
+	path, err := service.PluginPath(s.metadata, tmp.Name(), filename, c.PostForm("name"), c.PostForm("version"))
+	if err != nil {
+		Failed(c, err)
+		return
+	}
 	if s.metadata.ExistsPath(proto.FileTypePlugin, path) {
 		Failed(c, fmt.Errorf("The plugin name(%s) is exists", path))
 		return
@@ -56,12 +93,28 @@ func (s *Server) uploadPlugin(c *gin.Context) {
 		return
 	}
 
-	if err := c.SaveUploadedFile(pluginFile, path); err != nil {
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		Failed(c, err)
+		return
+	}
+
+	// gRPC插件需要作为可执行文件运行
+	if err := os.Chmod(path, 0750); err != nil {
 		Failed(c, err)
 		return
 	}
 
-	err = s.Plugin.Add(path)
+	var signature string
+	if sigFile, err := c.FormFile("signature"); err == nil {
+		signature = service.SignaturePath(path)
+		if err := c.SaveUploadedFile(sigFile, signature); err != nil {
+			_ = os.Remove(path)
+			Failed(c, err)
+			return
+		}
+	}
+
+	err = s.Plugin.Add(proto.PluginAddRequest{Path: path, Signature: signature})
 	if err != nil {
 		Failed(c, err)
 		return
@@ -69,3 +122,20 @@ func (s *Server) uploadPlugin(c *gin.Context) {
 
 	Success(c, nil)
 }
+
+func (s *Server) upgradePlugin(c *gin.Context) {
+	var req proto.PluginUpgradeRequest
+	err := c.BindJSON(&req)
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	res, err := s.Plugin.Upgrade(req.Name, req.Version)
+	if err != nil {
+		Failed(c, err)
+		return
+	}
+
+	Success(c, res)
+}
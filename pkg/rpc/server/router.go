@@ -13,6 +13,10 @@ func (s *Server) setRouter() {
 	r.POST("/pipeline/add", s.addPipeline)
 	r.POST("/pipeline/recreate", s.recreatePipeline)
 	r.GET("/pipeline/ctrl", s.ctrlPipeline)
+	r.POST("/pipeline/trigger", s.triggerPipeline)
+	r.GET("/pipeline/runs", s.listPipelineRuns)
+	r.GET("/pipeline/dag", s.pipelineDAG)
+	r.GET("/pipeline/tap", s.tapPipeline)
 	r.GET("/pipeline/list", s.listPipelines)
 	r.GET("/pipeline", s.findPipeline)
 
@@ -25,6 +29,8 @@ func (s *Server) setRouter() {
 	r.GET("/plugin/list", s.listPlugins)
 	r.POST("/plugin/upload", s.uploadPlugin)
 	r.POST("/plugin/open", s.openPlugin)
+	r.POST("/plugin/upgrade", s.upgradePlugin)
+	r.GET("/plugin", s.findPlugin)
 
 	r.GET("/metadata", func(c *gin.Context) {
 		Success(c, proto.MetadataView{
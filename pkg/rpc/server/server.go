@@ -5,8 +5,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/shima-park/lotus/common/log"
-	"github.com/shima-park/lotus/common/plugin"
-	"github.com/shima-park/lotus/pipeline"
+	"github.com/shima-park/nezha/pkg/grpcplugin"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/window"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
 	"github.com/shima-park/nezha/pkg/rpc/server/service"
 	"gopkg.in/yaml.v2"
@@ -28,9 +29,8 @@ type Server struct {
 
 func New(opts ...Option) (*Server, error) {
 	c := &Server{
-		options:         defaultOptions,
-		engine:          gin.Default(),
-		pipelineManager: pipeline.NewPipelinerManager(),
+		options: defaultOptions,
+		engine:  gin.Default(),
 	}
 
 	for _, opt := range opts {
@@ -47,18 +47,35 @@ func (c *Server) init() error {
 		return err
 	}
 
+	// window processor的local store默认保存在metadata目录下
+	window.SetStateDir(c.metadata.GetPath(proto.FileTypeWindowState, ""))
+
+	c.pipelineManager = pipeline.NewPipelinerManager(
+		pipeline.WithStateStore(
+			pipeline.NewFileStateStore(c.metadata.GetPath(proto.FileTypePipelineState, "")),
+		),
+		pipeline.WithRunStore(
+			pipeline.NewFileRunStore(c.metadata.GetPath(proto.FileTypePipelineRun, ""), c.options.RunHistoryLimit),
+		),
+	)
+
 	c.Pipeline = service.NewPipelineService(c.metadata, c.pipelineManager)
 	c.Component = service.NewComponentService()
 	c.Processor = service.NewProcessorService()
-	c.Plugin = service.NewPluginService(c.metadata)
-
-	for _, path := range c.metadata.ListPaths(proto.FileTypePlugin) {
-		err := plugin.LoadPlugins(path)
+	var keys service.TrustedKeys
+	if c.options.TrustedKeysPath != "" {
+		keys, err = service.LoadTrustedKeys(c.options.TrustedKeysPath)
 		if err != nil {
 			return err
 		}
 	}
 
+	c.Plugin = service.NewPluginService(c.metadata, c.pipelineManager, keys)
+
+	if err := service.ReloadPlugins(c.metadata, keys); err != nil {
+		return err
+	}
+
 	for _, path := range c.metadata.ListPaths(proto.FileTypePipelineConfig) {
 		err := loadPipelineFromFile(path, c.pipelineManager)
 		if err != nil {
@@ -111,4 +128,6 @@ func (c *Server) Stop() {
 	for _, p := range c.pipelineManager.List() {
 		p.Stop()
 	}
+	grpcplugin.CloseAll()
+	window.CloseAll()
 }
@@ -23,8 +23,19 @@ type metadata struct {
 	metapath string
 	metafile string
 
-	lock  sync.RWMutex
-	paths map[proto.FileType][]string
+	lock      sync.RWMutex
+	paths     map[proto.FileType][]string
+	checksums map[string]string
+	versions  map[string]string
+}
+
+// metadataFile 元数据文件的格式, 文件类型的路径列表位于顶层以兼容旧的元数据文件
+type metadataFile struct {
+	// key: 文件路径, value: sha256
+	Checksums map[string]string `yaml:"checksums,omitempty"`
+	// key: 插件名称, value: 不带版本号的processor和component使用的插件版本
+	PluginVersions map[string]string   `yaml:"plugin_versions,omitempty"`
+	Paths          map[string][]string `yaml:",inline"`
 }
 
 func NewMetadata(metapath string) (proto.Metadata, error) {
@@ -37,9 +48,11 @@ func NewMetadata(metapath string) (proto.Metadata, error) {
 	}
 
 	m := &metadata{
-		metapath: metapath,
-		metafile: filepath.Join(metapath, METADATA_FILENAME),
-		paths:    map[proto.FileType][]string{},
+		metapath:  metapath,
+		metafile:  filepath.Join(metapath, METADATA_FILENAME),
+		paths:     map[proto.FileType][]string{},
+		checksums: map[string]string{},
+		versions:  map[string]string{},
 	}
 
 	err := os.MkdirAll(metapath, 0750)
@@ -63,16 +76,32 @@ func NewMetadata(metapath string) (proto.Metadata, error) {
 			return nil, err
 		}
 
-		if err = yaml.Unmarshal(data, m.paths); err != nil {
+		var file metadataFile
+		if err = yaml.Unmarshal(data, &file); err != nil {
 			return nil, err
 		}
+
+		if file.Checksums != nil {
+			m.checksums = file.Checksums
+		}
+		if file.PluginVersions != nil {
+			m.versions = file.PluginVersions
+		}
+		for ft, paths := range file.Paths {
+			m.paths[proto.FileType(ft)] = paths
+		}
 	}
 
 	return m, nil
 }
 
 func (m *metadata) save() error {
-	data, err := yaml.Marshal(m.paths)
+	file := metadataFile{Checksums: m.checksums, PluginVersions: m.versions, Paths: map[string][]string{}}
+	for ft, paths := range m.paths {
+		file.Paths[string(ft)] = paths
+	}
+
+	data, err := yaml.Marshal(file)
 	if err != nil {
 		return err
 	}
@@ -107,6 +136,12 @@ func (m *metadata) GetPath(ft proto.FileType, filename string) string {
 		return filepath.Join(m.metapath, string(ft), filename)
 	case proto.FileTypePipelineConfig:
 		return filepath.Join(m.metapath, string(ft), filename)
+	case proto.FileTypePipelineState:
+		return filepath.Join(m.metapath, string(ft), filename)
+	case proto.FileTypePipelineRun:
+		return filepath.Join(m.metapath, string(ft), filename)
+	case proto.FileTypeWindowState:
+		return filepath.Join(m.metapath, string(ft), filename)
 	default:
 		panic(fmt.Sprintf("Unknown file type: %s", ft))
 	}
@@ -122,6 +157,7 @@ func (m *metadata) RemovePath(ft proto.FileType, path string) error {
 			break
 		}
 	}
+	delete(m.checksums, path)
 
 	err := os.Remove(path)
 	if err != nil {
@@ -200,6 +236,36 @@ func (m *metadata) addPath(path string, pattern string, ft proto.FileType) error
 	return m.save()
 }
 
+func (m *metadata) SetChecksum(path, checksum string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.checksums[path] = checksum
+	return m.save()
+}
+
+func (m *metadata) GetChecksum(path string) string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.checksums[path]
+}
+
+func (m *metadata) SetPluginVersion(name, version string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.versions[name] = version
+	return m.save()
+}
+
+func (m *metadata) GetPluginVersion(name string) string {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return m.versions[name]
+}
+
 func (m *metadata) Overwrite(ft proto.FileType, path string, data []byte) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -8,15 +9,18 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/shima-park/lotus/common/monitor"
 	"github.com/shima-park/lotus/component"
-	"github.com/shima-park/lotus/pipeline"
 	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
 	"gopkg.in/yaml.v2"
 )
 
 const (
 	defaultConfigSuffix = ".yaml"
+	// PipelineView中展示的后续调度时间个数
+	defaultNextRunTimes = 5
 )
 
 type pipelineService struct {
@@ -33,6 +37,10 @@ func NewPipelineService(metadata proto.Metadata,
 }
 
 func (s *pipelineService) GenerateConfig(name, schedule string, components, processors []string) (*pipeline.Config, error) {
+	if _, err := pipeline.ParseSchedule(schedule, ""); err != nil {
+		return nil, err
+	}
+
 	var componentConfigs []map[string]string
 	for _, name := range components {
 		name = strings.TrimSpace(name)
@@ -69,11 +77,13 @@ func (s *pipelineService) GenerateConfig(name, schedule string, components, proc
 	}
 
 	conf := &pipeline.Config{
-		Name:       name,
-		Schedule:   schedule,
-		Components: componentConfigs,
-		Processors: processorConfigs,
-		Stream:     *streamConfig,
+		Name:              name,
+		Schedule:          schedule,
+		ConcurrencyPolicy: pipeline.ConcurrencyPolicyAllow,
+		CatchUpPolicy:     pipeline.CatchUpPolicySkip,
+		Components:        componentConfigs,
+		Processors:        processorConfigs,
+		Stream:            *streamConfig,
 	}
 
 	return conf, nil
@@ -149,6 +159,9 @@ func (s *pipelineService) Control(cmd proto.ControlCommand, names []string) erro
 		proto.ControlCommandStart:   s.pipelineManager.Start,
 		proto.ControlCommandStop:    s.pipelineManager.Stop,
 		proto.ControlCommandRestart: s.pipelineManager.Restart,
+		proto.ControlCommandTrigger: s.trigger,
+		proto.ControlCommandPause:   s.pipelineManager.Pause,
+		proto.ControlCommandResume:  s.pipelineManager.Resume,
 	}
 
 	m, ok := methodMap[cmd]
@@ -163,6 +176,72 @@ func (s *pipelineService) Control(cmd proto.ControlCommand, names []string) erro
 	return nil
 }
 
+func (s *pipelineService) trigger(names ...string) error {
+	for _, name := range names {
+		res, err := s.pipelineManager.Trigger(name, nil)
+		if err != nil {
+			return err
+		}
+
+		if res.Error != "" {
+			return fmt.Errorf("Pipeline: %s run %s: %s", name, res.Status, res.Error)
+		}
+	}
+	return nil
+}
+
+func (s *pipelineService) Trigger(req proto.PipelineTriggerRequest) (*proto.RunView, error) {
+	res, err := s.pipelineManager.Trigger(req.Name, req.Params)
+	if err != nil {
+		return nil, err
+	}
+	return convertRunResult2RunView(res), nil
+}
+
+func (s *pipelineService) Runs(name string) ([]proto.RunView, error) {
+	runs, err := s.pipelineManager.Runs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []proto.RunView
+	for _, r := range runs {
+		res = append(res, *convertRunResult2RunView(r))
+	}
+	return res, nil
+}
+
+func (s *pipelineService) Tap(ctx context.Context, req proto.PipelineTapRequest) (<-chan pipeline.TapEvent, error) {
+	p := s.pipelineManager.Find(req.Name)
+	if p == nil {
+		return nil, fmt.Errorf("Pipeline: %s is not found", req.Name)
+	}
+
+	return p.Tap(ctx, pipeline.TapOptions{
+		Processor:      req.Processor,
+		Sample:         req.Sample,
+		Limit:          req.Limit,
+		MaxFieldLength: req.MaxFieldLength,
+	})
+}
+
+func (s *pipelineService) DAG() ([]proto.DAGEdgeView, error) {
+	var configs []pipeline.Config
+	for _, p := range s.pipelineManager.List() {
+		configs = append(configs, p.GetConfig())
+	}
+
+	var res []proto.DAGEdgeView
+	for _, e := range pipeline.DependencyEdges(configs) {
+		res = append(res, proto.DAGEdgeView{
+			From:      e.From,
+			To:        e.To,
+			Condition: string(e.Condition),
+		})
+	}
+	return res, nil
+}
+
 func (s *pipelineService) getConfigPath(name string) string {
 	if !strings.HasSuffix(name, defaultConfigSuffix) {
 		name = name + defaultConfigSuffix
@@ -172,21 +251,124 @@ func (s *pipelineService) getConfigPath(name string) string {
 }
 
 func convertPipeliner2PipelineView(p pipeline.Pipeliner) *proto.PipelineView {
+	conf := p.GetConfig()
+	var nextRunTimes []string
+	for _, t := range p.NextRunTimes(defaultNextRunTimes) {
+		nextRunTimes = append(nextRunTimes, t.Format("2006-01-02 15:04:05 MST"))
+	}
+
+	var dependsOn []string
+	for _, dep := range conf.DependsOn {
+		cond := dep.Condition
+		if cond == "" {
+			cond = pipeline.DependencyConditionSuccess
+		}
+		dependsOn = append(dependsOn, fmt.Sprintf("%s(%s)", dep.Pipeline, cond))
+	}
+
+	var jitter string
+	if conf.Jitter > 0 {
+		jitter = conf.Jitter.String()
+	}
+
 	return &proto.PipelineView{
-		Name:          p.Name(),
-		State:         p.State().String(),
-		Schedule:      p.GetConfig().Schedule,
-		Bootstrap:     p.GetConfig().Bootstrap,
-		StartTime:     p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_START_TIME).String(),
-		ExitTime:      p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_EXIT_TIME).String(),
-		RunTimes:      p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_RUN_TIMES).String(),
-		NextRunTime:   p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_NEXT_RUN_TIME).String(),
-		LastStartTime: p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_LAST_START_TIME).String(),
-		LastEndTime:   p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_LAST_END_TIME).String(),
-		Components:    convertComponents(p.ListComponents()),
-		Processors:    convertProcessors(p.ListProcessors()),
-		RawConfig:     mustMarshalConfig(p.GetConfig()),
+		Name:              p.Name(),
+		State:             p.State().String(),
+		Schedule:          conf.Schedule,
+		Timezone:          conf.Timezone,
+		Jitter:            jitter,
+		ConcurrencyPolicy: string(conf.ConcurrencyPolicy),
+		CatchUpPolicy:     string(conf.CatchUpPolicy),
+		DependsOn:         dependsOn,
+		Bootstrap:         conf.Bootstrap,
+		StartTime:         p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_START_TIME).String(),
+		ExitTime:          p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_EXIT_TIME).String(),
+		RunTimes:          p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_RUN_TIMES).String(),
+		NextRunTime:       p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_NEXT_RUN_TIME).String(),
+		NextRunTimes:      nextRunTimes,
+		LastStartTime:     p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_LAST_START_TIME).String(),
+		LastEndTime:       p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_LAST_END_TIME).String(),
+		SkipTimes:         p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_SKIP_TIMES).String(),
+		LastSkipTime:      p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_LAST_SKIP_TIME).String(),
+		LastSkipReason:    p.Monitor().Get(pipeline.METRICS_KEY_PIPELINE_LAST_SKIP_REASON).String(),
+		Components:        convertComponents(p.ListComponents()),
+		Processors:        convertProcessors(p.ListProcessors()),
+		Streams:           convertStreams(conf.Stream, p.Monitor()),
+		RawConfig:         mustMarshalConfig(conf),
+	}
+}
+
+// convertStreams 按照stream配置的顺序返回各节点的统计
+// 通过Do读取指标, 避免With创建namespace时清空其他pipeline同名节点的指标
+func convertStreams(conf pipeline.StreamConfig, moni monitor.Monitor) []proto.StreamView {
+	metrics := map[string]map[string]string{}
+	moni.Do(func(namespace string, kv monitor.KeyValue) {
+		if _, ok := metrics[namespace]; !ok {
+			metrics[namespace] = map[string]string{}
+		}
+		metrics[namespace][kv.Key] = kv.Value.String()
+	})
+
+	var res []proto.StreamView
+	var walk func(conf pipeline.StreamConfig)
+	walk = func(conf pipeline.StreamConfig) {
+		m := metrics[conf.Name]
+		workers := conf.Replica
+		if workers == 0 {
+			workers = 1
+		}
+		var rateLimit string
+		if conf.RateLimit != nil {
+			rateLimit = conf.RateLimit.String()
+		}
+
+		res = append(res, proto.StreamView{
+			Name:            conf.Name,
+			Workers:         workers,
+			BufferSize:      conf.BufferSize,
+			QueueDepth:      m[pipeline.METRICS_KEY_STREAM_QUEUE_DEPTH],
+			RateLimit:       rateLimit,
+			RunTimes:        m[pipeline.METRICS_KEY_STREAM_RUN_TIMES],
+			SuccessCount:    m[pipeline.METRICS_KEY_STREAM_SUCCESS_COUNT],
+			ErrorCount:      m[pipeline.METRICS_KEY_STREAM_ERROR_COUNT],
+			DropCount:       m[pipeline.METRICS_KEY_STREAM_DROP_COUNT],
+			RetryCount:      m[pipeline.METRICS_KEY_STREAM_RETRY_COUNT],
+			TimeoutCount:    m[pipeline.METRICS_KEY_STREAM_TIMEOUT_COUNT],
+			DeadLetterCount: m[pipeline.METRICS_KEY_STREAM_DEAD_LETTER],
+			DeadLetterError: m[pipeline.METRICS_KEY_STREAM_DEAD_LETTER_ERR],
+		})
+		for _, child := range conf.Childs {
+			walk(child)
+		}
+	}
+	walk(conf)
+	return res
+}
+
+func convertRunResult2RunView(res pipeline.RunResult) *proto.RunView {
+	v := &proto.RunView{
+		ID:        res.ID,
+		Pipeline:  res.Pipeline,
+		Trigger:   string(res.Trigger),
+		Status:    string(res.Status),
+		StartTime: monitor.Time(res.StartTime).String(),
+		Error:     res.Error,
+		Params:    res.Params,
+	}
+
+	if !res.EndTime.IsZero() {
+		v.EndTime = monitor.Time(res.EndTime).String()
+		v.Elapsed = res.EndTime.Sub(res.StartTime).String()
+	}
+
+	for _, stat := range res.Processors {
+		v.Processors = append(v.Processors, proto.ProcessorStatView{
+			Name:    stat.Name,
+			Calls:   stat.Calls,
+			Elapsed: stat.Elapsed.String(),
+		})
 	}
+	return v
 }
 
 func mustMarshalConfig(config pipeline.Config) []byte {
@@ -2,47 +2,246 @@ package service
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
 
-	"github.com/shima-park/lotus/common/plugin"
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/nezha/pkg/pipeline"
 	"github.com/shima-park/nezha/pkg/rpc/proto"
 )
 
 type pluginService struct {
-	metadata proto.Metadata
+	metadata        proto.Metadata
+	pipelineManager pipeline.PipelinerManager
+	keys            TrustedKeys
 }
 
-func NewPluginService(metadata proto.Metadata) proto.Plugin {
+// NewPluginService keys不为空时, 插件必须带有其中一个公钥的签名
+func NewPluginService(metadata proto.Metadata, pipelineManager pipeline.PipelinerManager, keys TrustedKeys) proto.Plugin {
 	return &pluginService{
-		metadata: metadata,
+		metadata:        metadata,
+		pipelineManager: pipelineManager,
+		keys:            keys,
 	}
 }
 
+// ReloadPlugins 加载元数据中记录的插件, 加载之前校验插件的sha256以及签名
+// 加载完成后恢复不带版本号的processor和component使用的插件版本
+func ReloadPlugins(metadata proto.Metadata, keys TrustedKeys) error {
+	for _, path := range metadata.ListPaths(proto.FileTypePlugin) {
+		if err := verifyChecksum(metadata, path); err != nil {
+			return err
+		}
+
+		if err := verifySignature(path, SignaturePath(path), keys); err != nil {
+			return err
+		}
+
+		if err := OpenPlugin(path); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range listPlugins() {
+		if metadata.GetPluginVersion(p.name) != p.version {
+			continue
+		}
+		if _, err := setCurrentVersion(p.name, p.version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *pluginService) List() ([]proto.PluginView, error) {
 	var res []proto.PluginView
-	for _, p := range plugin.List() {
-		res = append(res, proto.PluginView{
-			Path:     p.Path,
-			Module:   p.Module,
-			OpenTime: fmt.Sprint(p.OpenTime),
-		})
+	for _, p := range listPlugins() {
+		view := s.newPluginView(p)
+		for range p.processors {
+			view.Module = "processor"
+			res = append(res, view)
+		}
+		for range p.components {
+			view.Module = "component"
+			res = append(res, view)
+		}
 	}
 	return res, nil
 }
 
+// Find path可以是插件的完整路径, 文件名, name@version, 或者插件名称(当前版本)
+func (s *pluginService) Find(path string) (*proto.PluginDetailView, error) {
+	for _, p := range listPlugins() {
+		if !matchPlugin(p, path) {
+			continue
+		}
+
+		usages := s.usages()
+		current := isCurrentPlugin(p)
+		view := &proto.PluginDetailView{PluginView: s.newPluginView(p)}
+		for _, name := range p.processorNames() {
+			f := p.processors[name]
+			view.Processors = append(view.Processors, proto.PluginItemView{
+				Name:         name,
+				SampleConfig: f.SampleConfig(),
+				Description:  f.Description(),
+				Pipelines:    itemUsages(usages, "processor/", name, p.version, current),
+			})
+		}
+		for _, name := range p.componentNames() {
+			f := p.components[name]
+			view.Components = append(view.Components, proto.PluginItemView{
+				Name:         name,
+				SampleConfig: f.SampleConfig(),
+				Description:  f.Description(),
+				Pipelines:    itemUsages(usages, "component/", name, p.version, current),
+			})
+		}
+		return view, nil
+	}
+
+	return nil, fmt.Errorf("Plugin(%s) not found", path)
+}
+
+func matchPlugin(p *loadedPlugin, path string) bool {
+	return p.path == path || filepath.Base(p.path) == path || p.ref() == path ||
+		p.name == path && isCurrentPlugin(p)
+}
+
+// usages 统计每个processor和component被哪些pipeline使用, key: processor/name或component/name, name可以带有版本号
+func (s *pluginService) usages() map[string][]string {
+	res := map[string][]string{}
+	for _, p := range s.pipelineManager.List() {
+		conf := p.GetConfig()
+		for _, m := range conf.Processors {
+			for name := range m {
+				res["processor/"+name] = append(res["processor/"+name], conf.Name)
+			}
+		}
+		for _, m := range conf.Components {
+			for name := range m {
+				res["component/"+name] = append(res["component/"+name], conf.Name)
+			}
+		}
+	}
+	return res
+}
+
+// itemUsages 以name@version使用的pipeline, 插件是当前版本时还包括以不带版本号的名称使用的pipeline
+func itemUsages(usages map[string][]string, kind, name, version string, current bool) []string {
+	var res []string
+	if version != "" {
+		res = append(res, usages[kind+name+"@"+version]...)
+	}
+	if current {
+		res = append(res, usages[kind+name]...)
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (s *pluginService) newPluginView(p *loadedPlugin) proto.PluginView {
+	view := proto.PluginView{
+		Path:     p.path,
+		Name:     p.name,
+		Version:  p.version,
+		Current:  isCurrentPlugin(p),
+		Mode:     p.mode,
+		OpenTime: fmt.Sprint(p.openTime),
+	}
+	if p.client != nil {
+		view.PID, view.Restarts = p.client.PID(), p.client.Restarts()
+	}
+	return s.withChecksum(view)
+}
+
+func (s *pluginService) withChecksum(view proto.PluginView) proto.PluginView {
+	view.GoVersion, view.MainModule, view.SharedDeps = pluginBuildInfo(view.Path)
+	view.SHA256 = s.metadata.GetChecksum(view.Path)
+	return view
+}
+
 func (s *pluginService) Open(path string) error {
-	return plugin.LoadPlugins(path)
+	if err := verifySignature(path, SignaturePath(path), s.keys); err != nil {
+		return err
+	}
+	return OpenPlugin(path)
 }
 
-func (s *pluginService) Add(path string) error {
-	err := s.metadata.AddPath(proto.FileTypePlugin, path)
+// Add 校验签名并加载插件, 成功后在元数据中记录插件的sha256, 失败时删除插件和签名文件
+func (s *pluginService) Add(req proto.PluginAddRequest) error {
+	err := s.metadata.AddPath(proto.FileTypePlugin, req.Path)
 	if err != nil {
 		return err
 	}
 
-	err = plugin.LoadPlugins(path)
+	err = s.add(req.Path, req.Signature)
 	if err != nil {
-		_ = s.metadata.RemovePath(proto.FileTypePlugin, path)
+		_ = s.metadata.RemovePath(proto.FileTypePlugin, req.Path)
+		if req.Signature != "" {
+			_ = os.Remove(req.Signature)
+		}
 		return err
 	}
 	return nil
 }
+
+func (s *pluginService) add(path, signature string) error {
+	if signature == "" {
+		signature = SignaturePath(path)
+	}
+	if err := verifySignature(path, signature, s.keys); err != nil {
+		return err
+	}
+
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+
+	if err := OpenPlugin(path); err != nil {
+		return err
+	}
+	return s.metadata.SetChecksum(path, sum)
+}
+
+func (s *pluginService) Upgrade(name, version string) ([]string, error) {
+	version, err := normalizeVersion(version)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := setCurrentVersion(name, version)
+	if err != nil {
+		return nil, err
+	}
+	if old == version {
+		return nil, nil
+	}
+
+	type snapshot struct {
+		conf  pipeline.Config
+		state pipeline.State
+	}
+	var snapshots []snapshot
+	for _, p := range pluginDependents(s.pipelineManager, name) {
+		snapshots = append(snapshots, snapshot{conf: p.GetConfig(), state: p.State()})
+	}
+
+	var recreated []string
+	for i, snap := range snapshots {
+		if _, err := s.pipelineManager.RecreatePipeline(snap.conf); err != nil {
+			log.Error("Failed to upgrade plugin %s to %s: %v, rolling back to %s", name, version, err, old)
+			_, _ = setCurrentVersion(name, old)
+			for _, snap := range snapshots[:i+1] {
+				restorePipeline(s.pipelineManager, snap.conf, snap.state)
+			}
+			return nil, fmt.Errorf("Failed to upgrade plugin %s to %s, rolled back to %s: %v",
+				name, version, pluginRef(name, old), err)
+		}
+		recreated = append(recreated, snap.conf.Name)
+	}
+
+	return recreated, s.metadata.SetPluginVersion(name, version)
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// key: 插件路径, value: *debug.BuildInfo
+var pluginBuildInfos sync.Map
+
+// IncompatiblePluginError 插件的构建信息与nezha不一致
+type IncompatiblePluginError struct {
+	Path     string
+	Problems []string
+}
+
+func (e *IncompatiblePluginError) Error() string {
+	return fmt.Sprintf("Plugin(%s) is incompatible with the server:\n  %s", e.Path, strings.Join(e.Problems, "\n  "))
+}
+
+// checkPlugin 读取插件的构建信息并与nezha进行比较
+// go插件要求go版本、平台以及共同依赖的模块版本完全一致, gRPC插件运行在独立的进程中, 只要求平台一致
+func checkPlugin(path string, goPlugin bool) error {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil {
+		if goPlugin {
+			return fmt.Errorf("Failed to read build info of plugin(%s): %v", path, err)
+		}
+		// gRPC插件可以不是go实现的
+		return nil
+	}
+
+	if server, ok := debug.ReadBuildInfo(); ok {
+		if problems := compareBuildInfo(info, server, goPlugin); len(problems) > 0 {
+			return &IncompatiblePluginError{Path: path, Problems: problems}
+		}
+	}
+
+	pluginBuildInfos.Store(path, info)
+	return nil
+}
+
+func compareBuildInfo(plugin, server *debug.BuildInfo, strict bool) []string {
+	var problems []string
+	for _, key := range []string{"GOOS", "GOARCH"} {
+		p, s := buildSetting(plugin, key), buildSetting(server, key)
+		if p != "" && s != "" && p != s {
+			problems = append(problems, fmt.Sprintf("%s: plugin %s, server %s", key, p, s))
+		}
+	}
+
+	if !strict {
+		return problems
+	}
+
+	if plugin.GoVersion != server.GoVersion {
+		problems = append(problems, fmt.Sprintf("go version: plugin %s, server %s", plugin.GoVersion, server.GoVersion))
+	}
+
+	for _, dep := range sharedDeps(plugin, server) {
+		if dep.plugin != dep.server {
+			problems = append(problems, fmt.Sprintf("module %s: plugin %s, server %s", dep.path, dep.plugin, dep.server))
+		}
+	}
+	return problems
+}
+
+func buildSetting(info *debug.BuildInfo, key string) string {
+	for _, s := range info.Settings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+type sharedDep struct {
+	path   string
+	plugin string
+	server string
+}
+
+// sharedDeps 插件与nezha共同依赖的模块
+func sharedDeps(plugin, server *debug.BuildInfo) []sharedDep {
+	versions := map[string]string{}
+	for _, dep := range server.Deps {
+		versions[dep.Path] = moduleVersion(dep)
+	}
+
+	var res []sharedDep
+	for _, dep := range plugin.Deps {
+		if v, ok := versions[dep.Path]; ok {
+			res = append(res, sharedDep{path: dep.Path, plugin: moduleVersion(dep), server: v})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].path < res[j].path })
+	return res
+}
+
+// moduleVersion 被replace的模块以替换后的模块为准
+func moduleVersion(m *debug.Module) string {
+	if m.Replace != nil {
+		switch {
+		case m.Replace.Version == "":
+			return m.Replace.Path
+		case m.Replace.Path == m.Path:
+			return m.Replace.Version
+		default:
+			return m.Replace.Path + "@" + m.Replace.Version
+		}
+	}
+	return m.Version
+}
+
+// pluginBuildInfo 返回插件的go版本, 主模块以及与nezha共同依赖的模块
+func pluginBuildInfo(path string) (goVersion, mainModule string, deps []string) {
+	v, ok := pluginBuildInfos.Load(path)
+	if !ok {
+		return
+	}
+
+	info := v.(*debug.BuildInfo)
+	goVersion, mainModule = info.GoVersion, info.Main.Path
+	if server, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range sharedDeps(info, server) {
+			deps = append(deps, dep.path+"@"+dep.plugin)
+		}
+	}
+	return
+}
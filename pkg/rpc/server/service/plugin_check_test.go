@@ -0,0 +1,58 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCompareBuildInfo(t *testing.T) {
+	server := &debug.BuildInfo{
+		GoVersion: "go1.26.0",
+		Deps: []*debug.Module{
+			{Path: "github.com/shima-park/lotus", Version: "v1.0.2"},
+			{Path: "gopkg.in/yaml.v2", Version: "v2.4.0"},
+			{Path: "github.com/spf13/cobra", Version: "v1.10.2"},
+		},
+		Settings: []debug.BuildSetting{{Key: "GOOS", Value: "linux"}, {Key: "GOARCH", Value: "amd64"}},
+	}
+	plugin := &debug.BuildInfo{
+		GoVersion: "go1.25.0",
+		Deps: []*debug.Module{
+			{Path: "github.com/shima-park/lotus", Version: "v1.0.1"},
+			{Path: "gopkg.in/yaml.v2", Version: "v2.3.0", Replace: &debug.Module{Path: "gopkg.in/yaml.v2", Version: "v2.4.0"}},
+			{Path: "github.com/spf13/cobra", Version: "v1.10.2", Replace: &debug.Module{Path: "../cobra"}},
+			{Path: "github.com/foo/bar", Version: "v0.1.0"},
+		},
+		Settings: []debug.BuildSetting{{Key: "GOOS", Value: "darwin"}, {Key: "GOARCH", Value: "amd64"}},
+	}
+
+	assert.DeepEqual(t, compareBuildInfo(plugin, server, true), []string{
+		"GOOS: plugin darwin, server linux",
+		"go version: plugin go1.25.0, server go1.26.0",
+		"module github.com/shima-park/lotus: plugin v1.0.1, server v1.0.2",
+		"module github.com/spf13/cobra: plugin ../cobra, server v1.10.2",
+	})
+
+	// gRPC插件只检查平台
+	assert.DeepEqual(t, compareBuildInfo(plugin, server, false), []string{
+		"GOOS: plugin darwin, server linux",
+	})
+}
+
+func TestCheckPlugin(t *testing.T) {
+	// 测试二进制与自身的构建信息一致
+	assert.NilError(t, checkPlugin(os.Args[0], true))
+	goVersion, _, _ := pluginBuildInfo(os.Args[0])
+	assert.Equal(t, goVersion, runtime.Version())
+
+	path := filepath.Join(t.TempDir(), "plugin.so")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("not a go binary"), 0644))
+	assert.ErrorContains(t, checkPlugin(path, true), "Failed to read build info")
+	assert.NilError(t, checkPlugin(path, false))
+}
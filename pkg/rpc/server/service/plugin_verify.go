@@ -0,0 +1,161 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/nezha/pkg/rpc/proto"
+)
+
+// TrustedKeys 信任的ed25519公钥, 配置之后插件必须带有其中一个公钥的签名才能被加载
+type TrustedKeys []ed25519.PublicKey
+
+// LoadTrustedKeys 从文件中读取公钥, 支持PEM格式的公钥(例如: openssl pkey -in key.pem -pubout),
+// 以及每行一个base64编码的32字节原始公钥, 空行和#开头的行会被忽略
+func LoadTrustedKeys(path string) (TrustedKeys, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys TrustedKeys
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid trusted key in %s: %v", path, err)
+		}
+		key, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("Invalid trusted key in %s: %T is not an ed25519 public key", path, pub)
+		}
+		keys = append(keys, key)
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := base64.StdEncoding.DecodeString(line)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("Invalid trusted key in %s: %s", path, line)
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("No trusted key found in %s", path)
+	}
+	return keys, nil
+}
+
+// Verify sig是否是其中一个公钥对data的签名
+func (keys TrustedKeys) Verify(data, sig []byte) bool {
+	for _, key := range keys {
+		if ed25519.Verify(key, data, sig) {
+			return true
+		}
+	}
+	return false
+}
+
+// SignaturePath 插件的签名文件与插件保存在同一个目录下
+func SignaturePath(path string) string {
+	return path + ".sig"
+}
+
+// readSignature 签名文件可以是64字节的原始签名(例如: openssl pkeyutl -sign -rawin), 也可以是base64编码的签名
+func readSignature(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) == ed25519.SignatureSize {
+		return data, nil
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("Invalid signature file %s", path)
+	}
+	return sig, nil
+}
+
+// verifySignature 使用信任的公钥校验插件的签名, 没有配置信任的公钥时不校验
+func verifySignature(path, sigPath string, keys TrustedKeys) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if _, err := os.Stat(sigPath); os.IsNotExist(err) {
+		return fmt.Errorf("Plugin(%s) must be signed by a trusted key, signature %s not found", path, sigPath)
+	}
+
+	sig, err := readSignature(sigPath)
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if !keys.Verify(data, sig) {
+		return fmt.Errorf("Plugin(%s) signature verification failed, it is not signed by any trusted key", path)
+	}
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// verifyChecksum 校验插件的sha256与元数据中记录的是否一致, 没有记录时(旧的元数据)记录当前的sha256
+func verifyChecksum(metadata proto.Metadata, path string) error {
+	sum, err := fileChecksum(path)
+	if err != nil {
+		return err
+	}
+
+	expected := metadata.GetChecksum(path)
+	if expected == "" {
+		log.Warn("No checksum recorded for plugin: %s, record sha256: %s", path, sum)
+		return metadata.SetChecksum(path, sum)
+	}
+
+	if sum != expected {
+		return fmt.Errorf("Plugin(%s) checksum mismatch, expected sha256: %s, got: %s, the file may have been tampered with",
+			path, expected, sum)
+	}
+	return nil
+}
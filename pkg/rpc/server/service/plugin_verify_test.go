@@ -0,0 +1,79 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/shima-park/nezha/pkg/rpc/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestVerifySignature(t *testing.T) {
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NilError(t, err)
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	assert.NilError(t, err)
+	keysPath := filepath.Join(dir, "trusted_keys")
+	keysFile := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})) +
+		"# other key\n" + base64.StdEncoding.EncodeToString(other) + "\n"
+	assert.NilError(t, ioutil.WriteFile(keysPath, []byte(keysFile), 0644))
+
+	keys, err := LoadTrustedKeys(keysPath)
+	assert.NilError(t, err)
+	assert.Equal(t, len(keys), 2)
+
+	path := filepath.Join(dir, "plugin.so")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("plugin"), 0644))
+
+	// 没有配置信任的公钥时不校验
+	assert.NilError(t, verifySignature(path, SignaturePath(path), nil))
+	assert.ErrorContains(t, verifySignature(path, SignaturePath(path), keys), "must be signed by a trusted key")
+
+	sig := ed25519.Sign(priv, []byte("plugin"))
+	assert.NilError(t, ioutil.WriteFile(SignaturePath(path), sig, 0644))
+	assert.NilError(t, verifySignature(path, SignaturePath(path), keys))
+
+	assert.NilError(t, ioutil.WriteFile(SignaturePath(path), []byte(base64.StdEncoding.EncodeToString(sig)+"\n"), 0644))
+	assert.NilError(t, verifySignature(path, SignaturePath(path), keys))
+
+	assert.NilError(t, ioutil.WriteFile(path, []byte("tampered"), 0644))
+	assert.ErrorContains(t, verifySignature(path, SignaturePath(path), keys), "signature verification failed")
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	dir := t.TempDir()
+	metadata, err := NewMetadata(dir)
+	assert.NilError(t, err)
+
+	path := filepath.Join(dir, "plugin.so")
+	assert.NilError(t, ioutil.WriteFile(path, []byte("plugin"), 0644))
+	assert.NilError(t, metadata.AddPath(proto.FileTypePlugin, path))
+
+	// 没有记录时记录当前的sha256
+	assert.NilError(t, verifyChecksum(metadata, path))
+	sum := metadata.GetChecksum(path)
+	assert.Assert(t, sum != "")
+
+	// 重新加载元数据, 路径和sha256都被保留
+	metadata, err = NewMetadata(dir)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, metadata.ListPaths(proto.FileTypePlugin), []string{path})
+	assert.Equal(t, metadata.GetChecksum(path), sum)
+	assert.NilError(t, verifyChecksum(metadata, path))
+
+	assert.NilError(t, ioutil.WriteFile(path, []byte("tampered"), 0644))
+	assert.ErrorContains(t, verifyChecksum(metadata, path), "checksum mismatch")
+
+	assert.NilError(t, metadata.RemovePath(proto.FileTypePlugin, path))
+	assert.Equal(t, metadata.GetChecksum(path), "")
+}
@@ -0,0 +1,536 @@
+package service
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/common/plugin"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/grpcplugin"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/rpc/proto"
+	"github.com/shima-park/nezha/pkg/wasmplugin"
+	"golang.org/x/mod/semver"
+)
+
+// loadedPlugin 已加载的插件以及它注册的processor和component
+type loadedPlugin struct {
+	path       string
+	name       string
+	version    string
+	mode       string // go: .so插件, grpc: 独立进程运行的插件, wasm: 在沙箱中运行的WebAssembly模块
+	openTime   time.Time
+	client     *grpcplugin.Client
+	processors map[string]processor.Factory
+	components map[string]component.Factory
+}
+
+func (p *loadedPlugin) ref() string {
+	return pluginRef(p.name, p.version)
+}
+
+func (p *loadedPlugin) processorNames() []string {
+	var names []string
+	for name := range p.processors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (p *loadedPlugin) componentNames() []string {
+	var names []string
+	for name := range p.components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func pluginRef(name, version string) string {
+	if version == "" {
+		return name
+	}
+	return name + "@" + version
+}
+
+var (
+	pluginsLock sync.RWMutex
+	plugins     []*loadedPlugin
+	// key: 插件名称, value: 不带版本号的processor和component当前使用的插件版本
+	currentVersions = map[string]string{}
+	// key: processor/{名称}或component/{名称}, value: 以不带版本号的名称注册的gRPC或wasm插件
+	pluginOwners = map[string]string{}
+)
+
+// OpenPlugin 加载插件, .so文件作为go插件加载到nezha进程中, .wasm文件作为WebAssembly模块在沙箱中运行,
+// 其他可执行文件作为gRPC插件在独立的进程中运行. 加载之前会检查go插件和gRPC插件的构建信息是否与nezha兼容
+// 带版本号的插件提供的processor和component同时以name@version的名称注册, pipeline可以以此固定使用的版本
+func OpenPlugin(path string) error {
+	goPlugin := filepath.Ext(path) == ".so"
+	wasmPlugin := filepath.Ext(path) == ".wasm"
+	if !wasmPlugin {
+		if err := checkPlugin(path, goPlugin); err != nil {
+			return err
+		}
+	}
+
+	name, version := pluginIdentity(path)
+
+	pluginsLock.Lock()
+	defer pluginsLock.Unlock()
+
+	for _, p := range plugins {
+		if p.name == name && p.version == version {
+			return fmt.Errorf("Plugin %s is already loaded from %s", p.ref(), p.path)
+		}
+		// 同一个go插件的不同版本具有相同的包路径, go运行时不允许重复加载
+		if goPlugin && p.name == name && p.mode == "go" {
+			return fmt.Errorf("Go plugin %s is already loaded, different versions of a go plugin can't be loaded side by side, use a gRPC plugin instead", p.ref())
+		}
+	}
+
+	p := &loadedPlugin{
+		path:       path,
+		name:       name,
+		version:    version,
+		openTime:   time.Now(),
+		processors: map[string]processor.Factory{},
+		components: map[string]component.Factory{},
+	}
+
+	var err error
+	switch {
+	case goPlugin:
+		err = openGoPlugin(p)
+	case wasmPlugin:
+		err = openWasmPlugin(p)
+	default:
+		err = openGRPCPlugin(p)
+	}
+	if err != nil {
+		return err
+	}
+
+	plugins = append(plugins, p)
+	if _, ok := currentVersions[name]; !ok {
+		currentVersions[name] = version
+	}
+	return nil
+}
+
+// openGoPlugin go插件由lotus以不带版本号的名称注册
+func openGoPlugin(p *loadedPlugin) error {
+	p.mode = "go"
+	if err := plugin.LoadPlugins(p.path); err != nil {
+		return err
+	}
+
+	for _, e := range plugin.List() {
+		if e.Path != p.path {
+			continue
+		}
+
+		switch e.Module {
+		case "processor":
+			if f, err := processor.GetFactory(e.Name); err == nil {
+				p.processors[e.Name] = f
+			}
+		case "component":
+			if f, err := component.GetFactory(e.Name); err == nil {
+				p.components[e.Name] = f
+			}
+		}
+	}
+
+	if p.version == "" {
+		return nil
+	}
+
+	for name, f := range p.processors {
+		if err := processor.Register(name+"@"+p.version, f); err != nil {
+			return err
+		}
+	}
+	for name, f := range p.components {
+		if err := component.Register(name+"@"+p.version, f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openGRPCPlugin gRPC插件的不同版本可以同时加载, 不带版本号的名称使用插件的当前版本
+func openGRPCPlugin(p *loadedPlugin) error {
+	p.mode = "grpc"
+	c, err := grpcplugin.Start(p.path)
+	if err != nil {
+		return err
+	}
+	p.client = c
+
+	for _, info := range c.Processors() {
+		p.processors[info.Name] = c.ProcessorFactory(info)
+	}
+	for _, info := range c.Components() {
+		p.components[info.Name] = c.ComponentFactory(info)
+	}
+
+	if err := registerPlugin(p); err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+// openWasmPlugin 与gRPC插件一样, wasm插件的不同版本可以同时加载
+func openWasmPlugin(p *loadedPlugin) error {
+	p.mode = "wasm"
+	w, err := wasmplugin.Open(p.path)
+	if err != nil {
+		return err
+	}
+
+	for _, info := range w.Processors() {
+		p.processors[info.Name] = w.ProcessorFactory(info)
+	}
+	return registerPlugin(p)
+}
+
+// registerPlugin 注册gRPC和wasm插件, 先检查所有名称是否冲突, 避免只注册了一部分
+func registerPlugin(p *loadedPlugin) error {
+	check := func(kind, name string, exists func(string) bool) error {
+		if p.version != "" && exists(name+"@"+p.version) {
+			return fmt.Errorf("Error registering %s '%v': already registered", kind, name+"@"+p.version)
+		}
+		if owner, ok := pluginOwners[kind+"/"+name]; exists(name) && (!ok || owner != p.name) {
+			return fmt.Errorf("Error registering %s '%v': already registered", kind, name)
+		}
+		return nil
+	}
+
+	for name := range p.processors {
+		if err := check("processor", name, processorExists); err != nil {
+			return err
+		}
+	}
+	for name := range p.components {
+		if err := check("component", name, componentExists); err != nil {
+			return err
+		}
+	}
+
+	for name, f := range p.processors {
+		if p.version != "" {
+			if err := processor.Register(name+"@"+p.version, f); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := pluginOwners["processor/"+name]; !ok {
+			if err := processor.Register(name, &currentProcessor{plugin: p.name, name: name}); err != nil {
+				return err
+			}
+			pluginOwners["processor/"+name] = p.name
+		}
+	}
+
+	for name, f := range p.components {
+		if p.version != "" {
+			if err := component.Register(name+"@"+p.version, f); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := pluginOwners["component/"+name]; !ok {
+			if err := component.Register(name, &currentComponent{plugin: p.name, name: name}); err != nil {
+				return err
+			}
+			pluginOwners["component/"+name] = p.name
+		}
+	}
+	return nil
+}
+
+func processorExists(name string) bool {
+	_, err := processor.GetFactory(name)
+	return err == nil
+}
+
+func componentExists(name string) bool {
+	_, err := component.GetFactory(name)
+	return err == nil
+}
+
+// findPlugin 调用方需要持有锁
+func findPlugin(name, version string) *loadedPlugin {
+	for _, p := range plugins {
+		if p.name == name && p.version == version {
+			return p
+		}
+	}
+	return nil
+}
+
+func listPlugins() []*loadedPlugin {
+	pluginsLock.RLock()
+	defer pluginsLock.RUnlock()
+
+	var res []*loadedPlugin
+	res = append(res, plugins...)
+	return res
+}
+
+func isCurrentPlugin(p *loadedPlugin) bool {
+	pluginsLock.RLock()
+	defer pluginsLock.RUnlock()
+
+	return currentVersions[p.name] == p.version
+}
+
+// currentPlugin 返回插件的当前版本
+func currentPlugin(name string) (*loadedPlugin, error) {
+	pluginsLock.RLock()
+	defer pluginsLock.RUnlock()
+
+	version := currentVersions[name]
+	p := findPlugin(name, version)
+	if p == nil {
+		return nil, fmt.Errorf("Plugin %s is not loaded", pluginRef(name, version))
+	}
+	return p, nil
+}
+
+// currentProcessor 以不带版本号的名称注册的processor, 创建时使用插件当前版本的实现
+type currentProcessor struct {
+	plugin string
+	name   string
+}
+
+func (f *currentProcessor) factory() (processor.Factory, error) {
+	p, err := currentPlugin(f.plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, ok := p.processors[f.name]
+	if !ok {
+		return nil, fmt.Errorf("Processor(%s) is not provided by plugin %s", f.name, p.ref())
+	}
+	return factory, nil
+}
+
+func (f *currentProcessor) SampleConfig() string {
+	factory, err := f.factory()
+	if err != nil {
+		return ""
+	}
+	return factory.SampleConfig()
+}
+
+func (f *currentProcessor) Description() string {
+	factory, err := f.factory()
+	if err != nil {
+		return err.Error()
+	}
+	return factory.Description()
+}
+
+func (f *currentProcessor) New(config string) (processor.Processor, error) {
+	factory, err := f.factory()
+	if err != nil {
+		return nil, err
+	}
+	return factory.New(config)
+}
+
+// currentComponent 以不带版本号的名称注册的component, 创建时使用插件当前版本的实现
+type currentComponent struct {
+	plugin string
+	name   string
+}
+
+func (f *currentComponent) factory() (component.Factory, error) {
+	p, err := currentPlugin(f.plugin)
+	if err != nil {
+		return nil, err
+	}
+
+	factory, ok := p.components[f.name]
+	if !ok {
+		return nil, fmt.Errorf("Component(%s) is not provided by plugin %s", f.name, p.ref())
+	}
+	return factory, nil
+}
+
+func (f *currentComponent) SampleConfig() string {
+	factory, err := f.factory()
+	if err != nil {
+		return ""
+	}
+	return factory.SampleConfig()
+}
+
+func (f *currentComponent) Description() string {
+	factory, err := f.factory()
+	if err != nil {
+		return err.Error()
+	}
+	return factory.Description()
+}
+
+func (f *currentComponent) New(config string) (component.Component, error) {
+	factory, err := f.factory()
+	if err != nil {
+		return nil, err
+	}
+	return factory.New(config)
+}
+
+// setCurrentVersion 切换不带版本号的processor和component使用的插件版本, 返回之前的版本
+func setCurrentVersion(name, version string) (string, error) {
+	pluginsLock.Lock()
+	defer pluginsLock.Unlock()
+
+	p := findPlugin(name, version)
+	if p == nil {
+		return "", fmt.Errorf("Plugin %s is not loaded", pluginRef(name, version))
+	}
+
+	old := currentVersions[name]
+	if old != version {
+		if o := findPlugin(name, old); o != nil && o.mode == "go" {
+			return "", fmt.Errorf("Go plugin %s can't be switched to another version without restarting the server", o.ref())
+		}
+	}
+	currentVersions[name] = version
+	return old, nil
+}
+
+// pluginDependents 返回以不带版本号的名称使用插件的pipeline
+func pluginDependents(pm pipeline.PipelinerManager, name string) []pipeline.Pipeliner {
+	pluginsLock.RLock()
+	owned := map[string]bool{}
+	for key, owner := range pluginOwners {
+		if owner == name {
+			owned[key] = true
+		}
+	}
+	pluginsLock.RUnlock()
+
+	var res []pipeline.Pipeliner
+	for _, p := range pm.List() {
+		conf := p.GetConfig()
+		uses := false
+		for _, m := range conf.Processors {
+			for item := range m {
+				uses = uses || owned["processor/"+item]
+			}
+		}
+		for _, m := range conf.Components {
+			for item := range m {
+				uses = uses || owned["component/"+item]
+			}
+		}
+		if uses {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// pluginIdentity 插件的名称和版本, 依次从以下位置获取:
+// 1. 上传时保存的路径{name}/{version}/{filename}
+// 2. 插件构建信息中主模块的路径和版本
+// 3. 不带扩展名的文件名, 没有版本
+func pluginIdentity(path string) (name, version string) {
+	dir := filepath.Dir(path)
+	if v := filepath.Base(dir); semver.IsValid(v) {
+		return filepath.Base(filepath.Dir(dir)), v
+	}
+
+	name, version = buildIdentity(path)
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	return name, version
+}
+
+func buildIdentity(path string) (name, version string) {
+	info, err := buildinfo.ReadFile(path)
+	if err != nil || info.Main.Path == "" {
+		return "", ""
+	}
+
+	if semver.IsValid(info.Main.Version) {
+		version = info.Main.Version
+	}
+	return pathpkg.Base(info.Main.Path), version
+}
+
+// PluginPath 返回上传的插件保存的路径, 带版本号的插件保存在{name}/{version}/目录下, 允许同一个插件的多个版本同时存在
+// name和version为空时从上传的文件upload的构建信息中获取
+func PluginPath(metadata proto.Metadata, upload, filename, name, version string) (string, error) {
+	n, v := buildIdentity(upload)
+	if version == "" {
+		version = v
+	}
+	if version == "" {
+		if name != "" {
+			return "", fmt.Errorf("The version of plugin %s is required", name)
+		}
+		return metadata.GetPath(proto.FileTypePlugin, filename), nil
+	}
+
+	version, err := normalizeVersion(version)
+	if err != nil {
+		return "", err
+	}
+
+	if name == "" {
+		name = n
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	if name != filepath.Base(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("Invalid plugin name: %s", name)
+	}
+	return metadata.GetPath(proto.FileTypePlugin, filepath.Join(name, version, filename)), nil
+}
+
+// normalizeVersion 版本号需要符合语义化版本, 允许省略前缀v
+func normalizeVersion(version string) (string, error) {
+	if !strings.HasPrefix(version, "v") {
+		version = "v" + version
+	}
+	if !semver.IsValid(version) {
+		return "", fmt.Errorf("Invalid semantic version: %s", version)
+	}
+	return version, nil
+}
+
+// restorePipeline 将pipeline恢复成conf和升级之前的状态, 重建失败时pipeline可能已经被删除
+func restorePipeline(pm pipeline.PipelinerManager, conf pipeline.Config, state pipeline.State) {
+	var err error
+	if pm.Find(conf.Name) != nil {
+		_, err = pm.RecreatePipeline(conf)
+	} else {
+		var pipe pipeline.Pipeliner
+		pipe, err = pm.AddPipeline(conf)
+		if err == nil {
+			err = pipeline.StartWithState(pipe, state)
+		}
+	}
+	if err != nil {
+		log.Error("Failed to restore pipeline(%s): %v", conf.Name, err)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/grpcplugin"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+// 测试二进制以插件的方式被启动时, 作为插件进程提供服务, 插件的版本为所在目录的名称
+func TestMain(m *testing.M) {
+	if os.Getenv(grpcplugin.MagicCookieKey) == grpcplugin.MagicCookieValue {
+		if err := grpcplugin.Serve(versionServeConfig()); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	code := m.Run()
+	grpcplugin.CloseAll()
+	os.Exit(code)
+}
+
+type versionRequest struct {
+	Ctx context.Context `inject:"Context"`
+}
+
+type versionResponse struct {
+	Version string `inject:"Version"`
+}
+
+func versionServeConfig() grpcplugin.ServeConfig {
+	version := filepath.Base(filepath.Dir(os.Args[0]))
+	conf := grpcplugin.ServeConfig{Processors: map[string]processor.Factory{}}
+	// v1.2.0不再提供service_test_version, 用于测试升级失败时的回滚
+	if version != "v1.2.0" {
+		conf.Processors["service_test_version"] = processor.NewFactoryWithProcessor("", "",
+			func(req versionRequest) versionResponse {
+				return versionResponse{Version: version}
+			})
+	}
+	return conf
+}
+
+func openVersionedPlugin(t *testing.T, dir, version string) {
+	data, err := ioutil.ReadFile(os.Args[0])
+	assert.NilError(t, err)
+
+	path := filepath.Join(dir, "versioned", version, "versioned")
+	assert.NilError(t, os.MkdirAll(filepath.Dir(path), 0750))
+	assert.NilError(t, ioutil.WriteFile(path, data, 0750))
+	assert.NilError(t, OpenPlugin(path))
+}
+
+func runVersion(t *testing.T, name string) string {
+	f, err := processor.GetFactory(name)
+	assert.NilError(t, err)
+	p, err := f.New("")
+	assert.NilError(t, err)
+
+	res := nezhatest.New(t).Run(p)
+	assert.NilError(t, res.Err)
+	return res.Value.FieldByName("Version").String()
+}
+
+func TestPluginUpgrade(t *testing.T) {
+	dir := t.TempDir()
+	metadata, err := NewMetadata(filepath.Join(dir, "meta"))
+	assert.NilError(t, err)
+	pm := pipeline.NewPipelinerManager()
+	s := NewPluginService(metadata, pm, nil)
+
+	for _, version := range []string{"v1.0.0", "v1.1.0", "v1.2.0"} {
+		openVersionedPlugin(t, dir, version)
+	}
+	assert.ErrorContains(t, OpenPlugin(filepath.Join(dir, "versioned", "v1.0.0", "versioned")), "already loaded")
+
+	// 不带版本号的名称使用第一个加载的版本
+	assert.Equal(t, runVersion(t, "service_test_version"), "v1.0.0")
+	assert.Equal(t, runVersion(t, "service_test_version@v1.1.0"), "v1.1.0")
+
+	_, err = pm.AddPipeline(pipeline.Config{
+		Name:       "versioned_pipe",
+		Schedule:   "@yearly",
+		Processors: []map[string]string{{"service_test_version": ""}},
+		Stream:     pipeline.StreamConfig{Name: "service_test_version"},
+	})
+	assert.NilError(t, err)
+
+	view, err := s.Find("versioned@v1.0.0")
+	assert.NilError(t, err)
+	assert.Assert(t, view.Current)
+	assert.DeepEqual(t, view.Processors[0].Pipelines, []string{"versioned_pipe"})
+
+	// 升级和回滚之后正在运行的pipeline仍然处于运行状态
+	assert.NilError(t, pm.Start("versioned_pipe"))
+	defer func() { _ = pm.Stop("versioned_pipe") }()
+
+	pipelines, err := s.Upgrade("versioned", "1.1.0")
+	assert.NilError(t, err)
+	assert.DeepEqual(t, pipelines, []string{"versioned_pipe"})
+	assert.Equal(t, pm.Find("versioned_pipe").State(), pipeline.Running)
+	assert.Equal(t, runVersion(t, "service_test_version"), "v1.1.0")
+	assert.Equal(t, metadata.GetPluginVersion("versioned"), "v1.1.0")
+
+	// v1.2.0中没有pipeline使用的processor, 重建失败后回滚到v1.1.0
+	_, err = s.Upgrade("versioned", "v1.2.0")
+	assert.ErrorContains(t, err, "rolled back to versioned@v1.1.0")
+	assert.Equal(t, runVersion(t, "service_test_version"), "v1.1.0")
+	assert.Equal(t, metadata.GetPluginVersion("versioned"), "v1.1.0")
+	assert.Assert(t, pm.Find("versioned_pipe") != nil)
+	assert.Equal(t, pm.Find("versioned_pipe").State(), pipeline.Running)
+
+	// 暂停中的pipeline升级之后保持暂停
+	assert.NilError(t, pm.Pause("versioned_pipe"))
+	_, err = s.Upgrade("versioned", "v1.0.0")
+	assert.NilError(t, err)
+	assert.Equal(t, pm.Find("versioned_pipe").State(), pipeline.Paused)
+	assert.Equal(t, runVersion(t, "service_test_version"), "v1.0.0")
+
+	_, err = s.Upgrade("versioned", "v2.0.0")
+	assert.ErrorContains(t, err, "not loaded")
+}
+
+func TestPluginPath(t *testing.T) {
+	dir := t.TempDir()
+	metadata, err := NewMetadata(dir)
+	assert.NilError(t, err)
+
+	upload := filepath.Join(dir, "upload")
+	assert.NilError(t, ioutil.WriteFile(upload, []byte("not a go binary"), 0644))
+
+	path, err := PluginPath(metadata, upload, "split.so", "", "")
+	assert.NilError(t, err)
+	assert.Equal(t, path, filepath.Join(dir, "plugins", "split.so"))
+
+	path, err = PluginPath(metadata, upload, "split.so", "", "1.2.0")
+	assert.NilError(t, err)
+	assert.Equal(t, path, filepath.Join(dir, "plugins", "split", "v1.2.0", "split.so"))
+
+	name, version := pluginIdentity(path)
+	assert.Equal(t, name, "split")
+	assert.Equal(t, version, "v1.2.0")
+
+	_, err = PluginPath(metadata, upload, "split.so", "split", "")
+	assert.ErrorContains(t, err, "version of plugin split is required")
+	_, err = PluginPath(metadata, upload, "split.so", "", "latest")
+	assert.ErrorContains(t, err, "Invalid semantic version")
+	_, err = PluginPath(metadata, upload, "split.so", "../split", "v1.0.0")
+	assert.ErrorContains(t, err, "Invalid plugin name")
+}
@@ -0,0 +1,25 @@
+// Package nezhatest 用于processor的单元测试
+//
+// Harness以注入名称声明组件或者任意对象, 单独执行一个processor或者执行完整的StreamConfig,
+// 并记录每个processor的返回值和错误:
+//
+//	w := nezhatest.NewWriter("MyWriter")
+//	h := nezhatest.New(t).Use(w)
+//	res := h.Run(myProcessor, upstreamOutput{Message: "hello"})
+//	assert.NilError(t, res.Err)
+//	assert.Equal(t, w.String(), "hello")
+//
+// 内置组件的fake:
+//   - io_writer, io_reader: NewWriter, NewReader
+//   - kafka_producer: NewSyncProducer
+//   - kafka_consumer: NewKafkaBroker
+//   - amqp_consumer, amqp_publisher: NewAMQPBroker
+//   - redis_client, redis_queue, redis_stream_consumer: NewRedisServer
+//   - nats_conn, nats_publisher, nats_subscriber: NewNATSServer
+//   - mqtt_client: NewMQTTBroker
+//   - s3_client, s3_watcher: NewS3Server
+//   - es_client: NewESServer
+//   - gin_server: NewGin
+//
+// 连接外部服务的fake在内存中启动对应的服务, 返回的是指向该服务的真实组件, 注入的类型与线上一致
+package nezhatest
@@ -0,0 +1,34 @@
+package nezhatest
+
+import (
+	"testing"
+
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/nezha/pkg/component/amqp"
+	"github.com/shima-park/nezha/pkg/component/amqp/amqptest"
+)
+
+// AMQPBroker 进程内的amqp broker, 用于创建指向它的amqp_consumer, amqp_publisher
+type AMQPBroker struct {
+	*amqptest.Broker
+	t testing.TB
+}
+
+func NewAMQPBroker(t testing.TB) *AMQPBroker {
+	t.Helper()
+	b := amqptest.NewBroker()
+	t.Cleanup(b.Close)
+	return &AMQPBroker{Broker: b, t: t}
+}
+
+// Consumer 创建连接到当前broker的amqp_consumer, rawConfig中的url会被忽略, 消费的队列需要先通过DeclareQueue声明
+func (b *AMQPBroker) Consumer(rawConfig string) component.Component {
+	c, err := amqp.NewConsumer(rawConfig, amqp.WithDialer(b.Dial))
+	return mustNew(b.t, "amqp_consumer", c, err)
+}
+
+// Publisher 创建连接到当前broker的amqp_publisher, rawConfig中的url会被忽略
+func (b *AMQPBroker) Publisher(rawConfig string) component.Component {
+	c, err := amqp.NewPublisher(rawConfig, amqp.WithDialer(b.Dial))
+	return mustNew(b.t, "amqp_publisher", c, err)
+}
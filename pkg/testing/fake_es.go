@@ -0,0 +1,94 @@
+package nezhatest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/nezha/pkg/component/es"
+)
+
+// ESRequest fake es收到的请求
+type ESRequest struct {
+	Method string
+	Path   string
+	Body   string
+}
+
+// ESServer 记录请求的fake es, 用于创建指向它的es_client
+// 默认对所有请求返回成功, 可以通过Handle自定义返回
+type ESServer struct {
+	*httptest.Server
+	t        testing.TB
+	lock     sync.Mutex
+	requests []ESRequest
+	handler  func(ESRequest) (int, interface{})
+}
+
+func NewESServer(t testing.TB) *ESServer {
+	s := &ESServer{t: t}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Handle 自定义请求的返回, 返回值为http状态码和json序列化的body
+func (s *ESServer) Handle(f func(ESRequest) (int, interface{})) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.handler = f
+}
+
+// Requests 返回除了嗅探和健康检查以外的请求
+func (s *ESServer) Requests() []ESRequest {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]ESRequest(nil), s.requests...)
+}
+
+func (s *ESServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	switch r.URL.Path {
+	case "/":
+		fmt.Fprint(w, `{"name":"nezhatest","version":{"number":"7.0.0"},"tagline":"You Know, for Search"}`)
+		return
+	case "/_nodes/http":
+		fmt.Fprintf(w, `{"nodes":{"nezhatest":{"name":"nezhatest","http":{"publish_address":"%s"}}}}`,
+			strings.TrimPrefix(s.URL, "http://"))
+		return
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	req := ESRequest{Method: r.Method, Path: r.URL.Path, Body: string(body)}
+
+	s.lock.Lock()
+	s.requests = append(s.requests, req)
+	handler := s.handler
+	s.lock.Unlock()
+
+	code, resp := http.StatusOK, interface{}(map[string]interface{}{
+		"acknowledged": true,
+		"errors":       false,
+		"items":        []interface{}{},
+		"result":       "created",
+	})
+	if handler != nil {
+		code, resp = handler(req)
+	}
+
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// Client 创建名称为name的es_client
+func (s *ESServer) Client(name string) component.Component {
+	c, err := es.NewClient(fmt.Sprintf("name: %s\naddr: %s", name, s.URL))
+	return mustNew(s.t, "es_client", c, err)
+}
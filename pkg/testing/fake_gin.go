@@ -0,0 +1,39 @@
+package nezhatest
+
+import (
+	"net/http/httptest"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Gin gin_server的fake, 以*gin.Engine注入, 启动后通过URL访问processor注册的路由
+type Gin struct {
+	*fakeComponent
+	Engine *gin.Engine
+	server *httptest.Server
+}
+
+func NewGin(name string) *Gin {
+	gin.SetMode(gin.TestMode)
+	g := &Gin{Engine: gin.New()}
+	g.fakeComponent = NewComponent(name, g.Engine, nil).(*fakeComponent)
+	g.fakeComponent.start = func() error {
+		g.server = httptest.NewServer(g.Engine)
+		return nil
+	}
+	g.fakeComponent.stop = func() error {
+		if g.server != nil {
+			g.server.Close()
+		}
+		return nil
+	}
+	return g
+}
+
+// URL 返回服务的地址, 例如: http://127.0.0.1:8080, 启动之前为空
+func (g *Gin) URL() string {
+	if g.server == nil {
+		return ""
+	}
+	return g.server.URL
+}
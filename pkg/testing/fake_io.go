@@ -0,0 +1,54 @@
+package nezhatest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Writer io_writer的fake, 以io.Writer注入, 写入的内容保存在内存中
+type Writer struct {
+	*fakeComponent
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func NewWriter(name string) *Writer {
+	w := &Writer{}
+	w.fakeComponent = NewComponent(name, w, (*io.Writer)(nil)).(*fakeComponent)
+	return w
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.Write(p)
+}
+
+func (w *Writer) String() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	return w.buf.String()
+}
+
+// Lines 按行返回写入的内容, 忽略最后的空行
+func (w *Writer) Lines() []string {
+	s := strings.TrimSuffix(w.String(), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// Reader io_reader的fake, 以io.Reader注入, 读取data的内容
+type Reader struct {
+	*fakeComponent
+	*strings.Reader
+}
+
+func NewReader(name, data string) *Reader {
+	r := &Reader{Reader: strings.NewReader(data)}
+	r.fakeComponent = NewComponent(name, r.Reader, (*io.Reader)(nil)).(*fakeComponent)
+	return r
+}
@@ -0,0 +1,194 @@
+package nezhatest
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/nezha/pkg/component/kafka"
+	"gopkg.in/yaml.v2"
+)
+
+// SyncProducer kafka_producer的fake, 以sarama.SyncProducer注入, 记录发送的消息
+type SyncProducer struct {
+	*fakeComponent
+	lock     sync.Mutex
+	messages []*sarama.ProducerMessage
+	err      error
+	closed   bool
+}
+
+func NewSyncProducer(name string) *SyncProducer {
+	p := &SyncProducer{}
+	p.fakeComponent = NewComponent(name, p, (*sarama.SyncProducer)(nil)).(*fakeComponent)
+	return p
+}
+
+// SetError 设置之后发送消息时返回的错误, 为nil时恢复正常
+func (p *SyncProducer) SetError(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.err = err
+}
+
+// Messages 返回已经发送的消息
+func (p *SyncProducer) Messages() []*sarama.ProducerMessage {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return append([]*sarama.ProducerMessage(nil), p.messages...)
+}
+
+func (p *SyncProducer) SendMessage(msg *sarama.ProducerMessage) (int32, int64, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.err != nil {
+		return -1, -1, p.err
+	}
+	if p.closed {
+		return -1, -1, sarama.ErrClosedClient
+	}
+
+	msg.Offset = int64(len(p.messages))
+	p.messages = append(p.messages, msg)
+	return msg.Partition, msg.Offset, nil
+}
+
+func (p *SyncProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	for _, msg := range msgs {
+		if _, _, err := p.SendMessage(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *SyncProducer) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.closed = true
+	return nil
+}
+
+// KafkaBroker 内存中的kafka broker, 用于创建指向它的kafka_consumer
+// 每个topic只有一个分区, 消费者以follower的身份加入group并分到通过Consumer声明的全部topic,
+// 提交的offset不会保存, 消费者总是从offsets_initial开始消费
+type KafkaBroker struct {
+	*sarama.MockBroker
+	t testing.TB
+
+	lock     sync.Mutex
+	groups   map[string]struct{}
+	messages map[string][][]byte
+}
+
+func NewKafkaBroker(t testing.TB) *KafkaBroker {
+	t.Helper()
+	b := &KafkaBroker{
+		MockBroker: sarama.NewMockBroker(t, 1),
+		t:          t,
+		groups:     map[string]struct{}{},
+		messages:   map[string][][]byte{},
+	}
+	// 没有数据时fetch会立即返回, 避免消费者空转
+	b.SetLatency(10 * time.Millisecond)
+	b.setHandler()
+	t.Cleanup(b.Close)
+	return b
+}
+
+// Produce 向topic的分区中追加一条消息
+func (b *KafkaBroker) Produce(topic string, value []byte) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.messages[topic] = append(b.messages[topic], value)
+	b.setHandler()
+}
+
+// Consumer 创建kafka_consumer, rawConfig中的addrs会被替换
+func (b *KafkaBroker) Consumer(rawConfig string) component.Component {
+	b.t.Helper()
+	rawConfig, err := withValues(rawConfig, yaml.MapSlice{{Key: "addrs", Value: []string{b.Addr()}}})
+	if err != nil {
+		b.t.Fatalf("nezhatest: invalid kafka config: %s", err)
+	}
+
+	var conf kafka.ConsumerConfig
+	if err := yaml.Unmarshal([]byte(kafka.NewConsumerFactory().SampleConfig()), &conf); err != nil {
+		b.t.Fatalf("nezhatest: invalid kafka config: %s", err)
+	}
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		b.t.Fatalf("nezhatest: invalid kafka config: %s", err)
+	}
+
+	b.lock.Lock()
+	b.groups[conf.ConsumerGroup] = struct{}{}
+	for _, topic := range conf.Topics {
+		if _, ok := b.messages[topic]; !ok {
+			b.messages[topic] = nil
+		}
+	}
+	b.setHandler()
+	b.lock.Unlock()
+
+	c, err := kafka.NewConsumer(rawConfig)
+	return mustNew(b.t, "kafka_consumer", c, err)
+}
+
+// setHandler MockResponse不能并发修改, 数据变化时重新生成全部的响应
+func (b *KafkaBroker) setHandler() {
+	metadata := sarama.NewMockMetadataResponse(b.t).
+		SetBroker(b.Addr(), b.BrokerID()).
+		SetController(b.BrokerID())
+	coordinator := sarama.NewMockFindCoordinatorResponse(b.t)
+	offsetFetch := sarama.NewMockOffsetFetchResponse(b.t)
+	offset := sarama.NewMockOffsetResponse(b.t)
+	fetch := sarama.NewMockFetchResponse(b.t, 100).SetVersion(1)
+
+	assignment := &sarama.SyncGroupRequest{}
+	topics := map[string][]int32{}
+	for topic, messages := range b.messages {
+		topics[topic] = []int32{0}
+		metadata.SetLeader(topic, 0, b.BrokerID())
+		offset.SetOffset(topic, 0, sarama.OffsetOldest, 0).
+			SetOffset(topic, 0, sarama.OffsetNewest, int64(len(messages)))
+		fetch.SetHighWaterMark(topic, 0, int64(len(messages)))
+		for i, msg := range messages {
+			fetch.SetMessage(topic, 0, int64(i), sarama.ByteEncoder(msg))
+		}
+		for group := range b.groups {
+			offsetFetch.SetOffset(group, topic, 0, -1, "", sarama.ErrNoError)
+		}
+	}
+	for group := range b.groups {
+		coordinator.SetCoordinator(sarama.CoordinatorGroup, group, b.MockBroker)
+	}
+	if err := assignment.AddGroupAssignmentMember("nezhatest", &sarama.ConsumerGroupMemberAssignment{
+		Topics: topics,
+	}); err != nil {
+		b.t.Fatalf("nezhatest: encode kafka assignment error: %s", err)
+	}
+
+	b.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest":        metadata,
+		"FindCoordinatorRequest": coordinator,
+		"JoinGroupRequest": sarama.NewMockWrapper(&sarama.JoinGroupResponse{
+			GenerationId:  1,
+			GroupProtocol: "range",
+			LeaderId:      "nezhatest-leader",
+			MemberId:      "nezhatest",
+		}),
+		"SyncGroupRequest": sarama.NewMockWrapper(&sarama.SyncGroupResponse{
+			MemberAssignment: assignment.GroupAssignments["nezhatest"],
+		}),
+		"HeartbeatRequest":    sarama.NewMockWrapper(&sarama.HeartbeatResponse{}),
+		"LeaveGroupRequest":   sarama.NewMockWrapper(&sarama.LeaveGroupResponse{}),
+		"OffsetFetchRequest":  offsetFetch,
+		"OffsetRequest":       offset,
+		"FetchRequest":        fetch,
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(b.t),
+	})
+}
@@ -0,0 +1,55 @@
+package nezhatest
+
+import (
+	"testing"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/nezha/pkg/component/mqtt"
+	"gopkg.in/yaml.v2"
+)
+
+// MQTTBroker 内存中允许所有连接的mqtt broker, 用于创建指向它的mqtt_client
+type MQTTBroker struct {
+	*mochi.Server
+	t    testing.TB
+	addr string
+}
+
+func NewMQTTBroker(t testing.TB) *MQTTBroker {
+	t.Helper()
+	s := mochi.New(nil)
+	if err := s.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatalf("nezhatest: new mqtt broker error: %s", err)
+	}
+
+	l := listeners.NewTCP(listeners.Config{ID: "nezhatest", Address: "127.0.0.1:0"})
+	if err := s.AddListener(l); err != nil {
+		t.Fatalf("nezhatest: new mqtt broker error: %s", err)
+	}
+	if err := s.Serve(); err != nil {
+		t.Fatalf("nezhatest: new mqtt broker error: %s", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return &MQTTBroker{Server: s, t: t, addr: "tcp://" + l.Address()}
+}
+
+// Addr 返回broker的地址, 例如: tcp://127.0.0.1:1883
+func (b *MQTTBroker) Addr() string {
+	return b.addr
+}
+
+// Client 创建mqtt_client, rawConfig中的brokers会被替换
+func (b *MQTTBroker) Client(rawConfig string) component.Component {
+	b.t.Helper()
+	conf, err := withValues(rawConfig, yaml.MapSlice{{Key: "brokers", Value: []string{b.addr}}})
+	if err != nil {
+		b.t.Fatalf("nezhatest: invalid mqtt config: %s", err)
+	}
+
+	c, err := mqtt.NewClient(conf)
+	return mustNew(b.t, "mqtt_client", c, err)
+}
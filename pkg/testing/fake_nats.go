@@ -0,0 +1,64 @@
+package nezhatest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/nezha/pkg/component/nats"
+	"gopkg.in/yaml.v2"
+)
+
+// NATSServer 内存中开启了jetstream的nats, 用于创建指向它的nats_conn, nats_publisher, nats_subscriber
+type NATSServer struct {
+	*server.Server
+	t testing.TB
+}
+
+func NewNATSServer(t testing.TB) *NATSServer {
+	t.Helper()
+	s, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("nezhatest: new nats server error: %s", err)
+	}
+
+	go s.Start()
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nezhatest: nats server is not ready")
+	}
+	t.Cleanup(s.Shutdown)
+	return &NATSServer{Server: s, t: t}
+}
+
+func (s *NATSServer) config(rawConfig string) string {
+	s.t.Helper()
+	conf, err := withValues(rawConfig, yaml.MapSlice{{Key: "urls", Value: []string{s.ClientURL()}}})
+	if err != nil {
+		s.t.Fatalf("nezhatest: invalid nats config: %s", err)
+	}
+	return conf
+}
+
+// Conn 创建nats_conn, rawConfig中的urls会被替换
+func (s *NATSServer) Conn(rawConfig string) component.Component {
+	c, err := nats.NewConn(s.config(rawConfig))
+	return mustNew(s.t, "nats_conn", c, err)
+}
+
+// Publisher 创建nats_publisher, rawConfig中的urls会被替换
+func (s *NATSServer) Publisher(rawConfig string) component.Component {
+	c, err := nats.NewPublisher(s.config(rawConfig))
+	return mustNew(s.t, "nats_publisher", c, err)
+}
+
+// Subscriber 创建nats_subscriber, rawConfig中的urls会被替换
+func (s *NATSServer) Subscriber(rawConfig string) component.Component {
+	c, err := nats.NewSubscriber(s.config(rawConfig))
+	return mustNew(s.t, "nats_subscriber", c, err)
+}
@@ -0,0 +1,47 @@
+package nezhatest
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/nezha/pkg/component/redis"
+	"gopkg.in/yaml.v2"
+)
+
+// RedisServer 内存中的redis, 用于创建指向它的redis_client, redis_queue, redis_stream_consumer
+type RedisServer struct {
+	*miniredis.Miniredis
+	t testing.TB
+}
+
+func NewRedisServer(t testing.TB) *RedisServer {
+	return &RedisServer{Miniredis: miniredis.RunT(t), t: t}
+}
+
+func (s *RedisServer) config(rawConfig string) string {
+	s.t.Helper()
+	conf, err := withValues(rawConfig, yaml.MapSlice{{Key: "addr", Value: s.Addr()}})
+	if err != nil {
+		s.t.Fatalf("nezhatest: invalid redis config: %s", err)
+	}
+	return conf
+}
+
+// Client 创建redis_client, rawConfig中的addr会被替换
+func (s *RedisServer) Client(rawConfig string) component.Component {
+	c, err := redis.NewClient(s.config(rawConfig))
+	return mustNew(s.t, "redis_client", c, err)
+}
+
+// Queue 创建redis_queue, rawConfig中的addr会被替换
+func (s *RedisServer) Queue(rawConfig string) component.Component {
+	c, err := redis.NewQueue(s.config(rawConfig))
+	return mustNew(s.t, "redis_queue", c, err)
+}
+
+// StreamConsumer 创建redis_stream_consumer, rawConfig中的addr会被替换
+func (s *RedisServer) StreamConsumer(rawConfig string) component.Component {
+	c, err := redis.NewStreamConsumer(s.config(rawConfig))
+	return mustNew(s.t, "redis_stream_consumer", c, err)
+}
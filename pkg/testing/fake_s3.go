@@ -0,0 +1,72 @@
+package nezhatest
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/nezha/pkg/component/s3"
+	"gopkg.in/yaml.v2"
+)
+
+// S3Server 内存中的s3, 用于创建指向它的s3_client, s3_watcher
+type S3Server struct {
+	*s3mem.Backend
+	t        testing.TB
+	endpoint string
+}
+
+// NewS3Server 启动内存中的s3并创建buckets
+func NewS3Server(t testing.TB, buckets ...string) *S3Server {
+	t.Helper()
+	backend := s3mem.New()
+	for _, bucket := range buckets {
+		if err := backend.CreateBucket(bucket); err != nil {
+			t.Fatalf("nezhatest: create bucket %s error: %s", bucket, err)
+		}
+	}
+
+	ts := httptest.NewServer(gofakes3.New(backend).Server())
+	t.Cleanup(ts.Close)
+
+	return &S3Server{
+		Backend:  backend,
+		t:        t,
+		endpoint: strings.TrimPrefix(ts.URL, "http://"),
+	}
+}
+
+// Endpoint 返回不带协议的地址
+func (s *S3Server) Endpoint() string {
+	return s.endpoint
+}
+
+func (s *S3Server) config(rawConfig string) string {
+	s.t.Helper()
+	conf, err := withValues(rawConfig, yaml.MapSlice{
+		{Key: "endpoint", Value: s.endpoint},
+		{Key: "access_key", Value: "nezhatest"},
+		{Key: "secret_key", Value: "nezhatest"},
+		{Key: "secure", Value: false},
+		{Key: "path_style", Value: true},
+	})
+	if err != nil {
+		s.t.Fatalf("nezhatest: invalid s3 config: %s", err)
+	}
+	return conf
+}
+
+// Client 创建s3_client, rawConfig中的连接配置会被替换
+func (s *S3Server) Client(rawConfig string) component.Component {
+	c, err := s3.NewClient(s.config(rawConfig))
+	return mustNew(s.t, "s3_client", c, err)
+}
+
+// Watcher 创建s3_watcher, rawConfig中的连接配置会被替换
+func (s *S3Server) Watcher(rawConfig string) component.Component {
+	c, err := s3.NewWatcher(s.config(rawConfig))
+	return mustNew(s.t, "s3_watcher", c, err)
+}
@@ -0,0 +1,116 @@
+package nezhatest
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	cluster "github.com/bsm/sarama-cluster"
+	"github.com/gin-gonic/gin"
+	"github.com/olivere/elastic/v7"
+	"github.com/shima-park/nezha/pkg/component/amqp"
+	"github.com/shima-park/nezha/pkg/component/redis"
+	"gotest.tools/v3/assert"
+)
+
+func TestESServer(t *testing.T) {
+	s := NewESServer(t)
+	h := New(t).Use(s.Client("MyES"))
+
+	res := h.Run(func(r struct {
+		Client *elastic.Client `inject:"MyES"`
+	}) error {
+		_, err := r.Client.Index().Index("articles").Id("1").BodyString(`{"title":"hello"}`).Do(context.Background())
+		return err
+	})
+	assert.NilError(t, res.Err)
+
+	reqs := s.Requests()
+	assert.Equal(t, len(reqs), 1)
+	assert.Equal(t, reqs[0].Path, "/articles/_doc/1")
+	assert.Equal(t, reqs[0].Body, `{"title":"hello"}`)
+}
+
+func TestRedisServer(t *testing.T) {
+	s := NewRedisServer(t)
+	q := s.Queue("name: Jobs\npop_keys: [jobs]\npush_key: jobs\ntimeout: 100ms")
+	h := New(t).Use(q)
+
+	res := h.Run(func(r struct {
+		Queue *redis.Queue `inject:"Jobs"`
+	}) error {
+		return r.Queue.Push("a")
+	})
+	assert.NilError(t, res.Err)
+
+	select {
+	case m := <-q.(*redis.Queue).Messages():
+		assert.Equal(t, m.Value, "a")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for queue message")
+	}
+}
+
+func TestGin(t *testing.T) {
+	g := NewGin("MyGin")
+	h := New(t).Use(g)
+
+	res := h.Run(func(r struct {
+		Engine *gin.Engine `inject:"MyGin"`
+	}) error {
+		r.Engine.GET("/ping", func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+		return nil
+	})
+	assert.NilError(t, res.Err)
+
+	resp, err := http.Get(g.URL() + "/ping")
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NilError(t, err)
+	assert.Equal(t, string(body), "pong")
+}
+
+func TestKafkaBroker(t *testing.T) {
+	b := NewKafkaBroker(t)
+	b.Produce("events", []byte("a"))
+	c := b.Consumer("name: MyKafka\nconsumer_group: g\ntopics: [events]\noffsets_initial: -2")
+	New(t).Use(c)
+	b.Produce("events", []byte("b"))
+
+	consumer := c.Instance().Interface().(*cluster.Consumer)
+	for _, expected := range []string{"a", "b"} {
+		select {
+		case m := <-consumer.Messages():
+			assert.Equal(t, string(m.Value), expected)
+			consumer.MarkOffset(m, "")
+		case <-time.After(10 * time.Second):
+			t.Fatal("timeout waiting for kafka message")
+		}
+	}
+}
+
+func TestAMQPBroker(t *testing.T) {
+	b := NewAMQPBroker(t)
+	b.DeclareQueue("jobs")
+	c := b.Consumer("name: MyConsumer\nqueue: jobs")
+	p := b.Publisher("name: MyPublisher\nexchange: ''\nrouting_key: jobs")
+	h := New(t).Use(c, p)
+
+	res := h.Run(func(r struct {
+		Publisher *amqp.Publisher `inject:"MyPublisher"`
+	}) error {
+		return r.Publisher.Publish(context.Background(), []byte("a"))
+	})
+	assert.NilError(t, res.Err)
+
+	select {
+	case d := <-c.(*amqp.Consumer).Deliveries():
+		assert.Equal(t, string(d.Body), "a")
+		assert.NilError(t, d.Ack(false))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for amqp delivery")
+	}
+}
@@ -0,0 +1,339 @@
+package nezhatest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/shima-park/lotus/common/inject"
+	"github.com/shima-park/lotus/common/monitor"
+	"github.com/shima-park/lotus/component"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"gopkg.in/yaml.v2"
+)
+
+var errorInterface = reflect.TypeOf((*error)(nil)).Elem()
+
+// Harness 管理测试中使用的组件, 组件在Use时启动, 测试结束时停止
+type Harness struct {
+	t          testing.TB
+	ctx        context.Context
+	components []component.Component
+	params     map[string]string
+}
+
+func New(t testing.TB) *Harness {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	return &Harness{
+		t:      t,
+		ctx:    ctx,
+		params: map[string]string{},
+	}
+}
+
+// Use 启动组件并以组件的注入名称和类型注入到processor中
+func (h *Harness) Use(comps ...component.Component) *Harness {
+	h.t.Helper()
+	for _, c := range comps {
+		if err := c.Start(); err != nil {
+			h.t.Fatalf("nezhatest: start component %s error: %s", c.Instance().Name(), err)
+		}
+
+		c := c
+		h.t.Cleanup(func() { _ = c.Stop() })
+		h.components = append(h.components, c)
+	}
+	return h
+}
+
+// Map 以val的类型和name注入
+func (h *Harness) Map(name string, val interface{}) *Harness {
+	return h.Use(NewComponent(name, val, nil))
+}
+
+// MapTo 以ifacePtr指向的接口类型和name注入, 例如: MapTo("MyWriter", &buf, (*io.Writer)(nil))
+func (h *Harness) MapTo(name string, val interface{}, ifacePtr interface{}) *Harness {
+	return h.Use(NewComponent(name, val, ifacePtr))
+}
+
+// WithParams 设置注入到processor中的Params
+func (h *Harness) WithParams(params map[string]string) *Harness {
+	h.params = params
+	return h
+}
+
+func (h *Harness) injector() inject.Injector {
+	inj := inject.New()
+	for _, c := range h.components {
+		instance := c.Instance()
+		inj.Set(instance.Type(), instance.Name(), instance.Value())
+	}
+	inj.MapTo(h.ctx, "Context", (*context.Context)(nil))
+	inj.MapTo(monitor.NewMonitor("nezhatest"), "Monitor", (*monitor.Monitor)(nil))
+	inj.Map(h.params, "Params")
+	return inj
+}
+
+// Result processor一次执行的返回值和错误
+type Result struct {
+	Value reflect.Value
+	Err   error
+}
+
+// Decode 将返回值赋值给out, out必须是指向返回值类型的指针
+func (r Result) Decode(out interface{}) error {
+	if !r.Value.IsValid() {
+		return fmt.Errorf("nezhatest: the processor has no return value")
+	}
+
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("nezhatest: out must be a non-nil pointer, got %T", out)
+	}
+
+	val := r.Value
+	if !val.Type().AssignableTo(v.Elem().Type()) && val.Kind() == reflect.Ptr {
+		val = val.Elem()
+	}
+
+	if !val.Type().AssignableTo(v.Elem().Type()) {
+		return fmt.Errorf("nezhatest: can not assign %s to %s", r.Value.Type(), v.Elem().Type())
+	}
+	v.Elem().Set(val)
+	return nil
+}
+
+// Run 以inputs作为上游processor的返回值执行processor
+func (h *Harness) Run(p processor.Processor, inputs ...interface{}) Result {
+	inj := inject.New()
+	inj.SetParent(h.injector())
+	for _, in := range inputs {
+		if err := inj.MapValues(reflect.ValueOf(in)); err != nil {
+			return Result{Err: err}
+		}
+	}
+
+	const name = "nezhatest"
+	stream, err := pipeline.NewStream(
+		pipeline.StreamConfig{Name: name},
+		map[string]pipeline.Processor{name: {Name: name, Processor: p}},
+	)
+	if err != nil {
+		return Result{Err: err}
+	}
+
+	val, err := stream.Invoke(inj)
+	return Result{Value: val, Err: err}
+}
+
+// StreamResult 一次完整运行的结果
+type StreamResult struct {
+	Run pipeline.RunResult
+	// key: processor名称, value: 按照执行顺序记录的返回值
+	Outputs map[string][]Result
+	// 创建或者启动pipeline时的错误, 不为空时Run无效
+	Err error
+}
+
+// Output 返回processor第一次执行的结果
+func (r StreamResult) Output(name string) (Result, bool) {
+	if len(r.Outputs[name]) == 0 {
+		return Result{}, false
+	}
+	return r.Outputs[name][0], true
+}
+
+// RunStream 使用conf和processors创建pipeline并运行一次, 等待所有节点执行完成
+func (h *Harness) RunStream(conf pipeline.StreamConfig, processors ...pipeline.Processor) StreamResult {
+	var lock sync.Mutex
+	res := StreamResult{Outputs: map[string][]Result{}}
+
+	pm := map[string]pipeline.Processor{}
+	var wrapped []pipeline.Processor
+	for _, p := range processors {
+		name := p.Name
+		p.Processor = record(p.Processor, func(r Result) {
+			lock.Lock()
+			res.Outputs[name] = append(res.Outputs[name], r)
+			lock.Unlock()
+		})
+		pm[p.Name] = p
+		wrapped = append(wrapped, p)
+	}
+
+	stream, err := pipeline.NewStream(conf, pm)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	// 组件的生命周期由Harness管理
+	var comps []pipeline.Component
+	for _, c := range h.components {
+		comps = append(comps, pipeline.Component{
+			Name:      c.Instance().Name(),
+			Component: unmanaged{c},
+		})
+	}
+
+	p, err := pipeline.New(
+		pipeline.WithName("nezhatest"),
+		pipeline.WithComponents(comps...),
+		pipeline.WithProcessors(wrapped...),
+		pipeline.WithStream(stream),
+		pipeline.WithConfig(pipeline.Config{Name: "nezhatest", Stream: conf}),
+		// 只由Trigger运行
+		pipeline.WithSchedule(pipeline.NeverSchedule{}),
+	)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+
+	if err := p.Start(); err != nil {
+		res.Err = err
+		return res
+	}
+	defer p.Stop()
+
+	run, err := p.Trigger(h.params)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.Run = run
+
+	lock.Lock()
+	defer lock.Unlock()
+	outputs := map[string][]Result{}
+	for k, v := range res.Outputs {
+		outputs[k] = v
+	}
+	res.Outputs = outputs
+	return res
+}
+
+// record 返回与p签名相同的函数, 调用p后记录返回值
+func record(p processor.Processor, f func(Result)) processor.Processor {
+	inner, closer := pipeline.UnwrapProcessor(p)
+	fn := reflect.ValueOf(inner)
+	if fn.Kind() != reflect.Func {
+		return p
+	}
+
+	recorded := reflect.MakeFunc(fn.Type(), func(args []reflect.Value) []reflect.Value {
+		outs := fn.Call(args)
+
+		var r Result
+		for _, out := range outs {
+			if out.Type().Implements(errorInterface) {
+				if !out.IsNil() {
+					r.Err = out.Interface().(error)
+				}
+				continue
+			}
+			r.Value = out
+		}
+		f(r)
+		return outs
+	}).Interface()
+	if closer != nil {
+		return pipeline.WithClose(recorded, closer)
+	}
+	return recorded
+}
+
+// NewProcessor 使用已注册的processor工厂创建processor, processor持有的资源在测试结束时释放
+func NewProcessor(t testing.TB, name, rawConfig string) pipeline.Processor {
+	t.Helper()
+	f, err := processor.GetFactory(name)
+	if err != nil {
+		t.Fatalf("nezhatest: %s", err)
+	}
+
+	p, err := f.New(rawConfig)
+	if err != nil {
+		t.Fatalf("nezhatest: new processor %s error: %s", name, err)
+	}
+	if _, closer := pipeline.UnwrapProcessor(p); closer != nil {
+		t.Cleanup(func() { _ = closer() })
+	}
+	return pipeline.Processor{Name: name, RawConfig: rawConfig, Processor: p}
+}
+
+// fakeComponent 将任意对象包装为组件
+type fakeComponent struct {
+	instance component.Instance
+	start    func() error
+	stop     func() error
+}
+
+// NewComponent 将val包装为组件, ifacePtr不为空时以其指向的接口类型注入
+func NewComponent(name string, val interface{}, ifacePtr interface{}) component.Component {
+	typ := reflect.TypeOf(val)
+	if ifacePtr != nil {
+		typ = inject.InterfaceOf(ifacePtr)
+	}
+	return &fakeComponent{
+		instance: component.NewInstance(name, typ, reflect.ValueOf(val), val),
+	}
+}
+
+func (c *fakeComponent) Instance() component.Instance {
+	return c.instance
+}
+
+func (c *fakeComponent) Start() error {
+	if c.start != nil {
+		return c.start()
+	}
+	return nil
+}
+
+func (c *fakeComponent) Stop() error {
+	if c.stop != nil {
+		return c.stop()
+	}
+	return nil
+}
+
+type unmanaged struct {
+	component.Component
+}
+
+func (unmanaged) Start() error { return nil }
+func (unmanaged) Stop() error  { return nil }
+
+// withValues 在rawConfig的基础上覆盖kv中的配置, 未覆盖的配置保持组件的默认值
+func withValues(rawConfig string, kv yaml.MapSlice) (string, error) {
+	var conf yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return "", err
+	}
+
+Loop:
+	for _, item := range kv {
+		for i := range conf {
+			if conf[i].Key == item.Key {
+				conf[i].Value = item.Value
+				continue Loop
+			}
+		}
+		conf = append(conf, item)
+	}
+
+	data, err := yaml.Marshal(conf)
+	return string(data), err
+}
+
+func mustNew(t testing.TB, kind string, c component.Component, err error) component.Component {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("nezhatest: new %s error: %s", kind, err)
+	}
+	return c
+}
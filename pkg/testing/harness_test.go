@@ -0,0 +1,97 @@
+package nezhatest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"gotest.tools/v3/assert"
+)
+
+type message struct {
+	Text string `inject:"Text"`
+}
+
+type writeRequest struct {
+	Writer io.Writer `inject:"MyWriter"`
+	Text   string    `inject:"Text"`
+}
+
+type produceRequest struct {
+	Producer sarama.SyncProducer `inject:"MyProducer"`
+	Params   map[string]string   `inject:"Params"`
+	Text     string              `inject:"Text"`
+}
+
+func TestRun(t *testing.T) {
+	w := NewWriter("MyWriter")
+	h := New(t).Use(w)
+
+	res := h.Run(func(r writeRequest) (message, error) {
+		_, err := fmt.Fprintln(r.Writer, r.Text)
+		return message{Text: "written"}, err
+	}, message{Text: "hello"})
+	assert.NilError(t, res.Err)
+	assert.DeepEqual(t, w.Lines(), []string{"hello"})
+
+	var out message
+	assert.NilError(t, res.Decode(&out))
+	assert.Equal(t, out.Text, "written")
+
+	var wrong int
+	assert.ErrorContains(t, res.Decode(&wrong), "can not assign")
+
+	// 缺少上游的输入
+	res = h.Run(func(r writeRequest) error { return nil })
+	assert.ErrorContains(t, res.Err, "Value not found for type: string name: Text")
+}
+
+func TestRunStream(t *testing.T) {
+	producer := NewSyncProducer("MyProducer")
+	h := New(t).Use(producer).WithParams(map[string]string{"topic": "articles"})
+
+	source := pipeline.Processor{Name: "source", Processor: func(r struct {
+		Ctx context.Context `inject:"Context"`
+	}) message {
+		return message{Text: "hello"}
+	}}
+	produce := pipeline.Processor{Name: "produce", Processor: func(r produceRequest) error {
+		_, _, err := r.Producer.SendMessage(&sarama.ProducerMessage{
+			Topic: r.Params["topic"],
+			Value: sarama.StringEncoder(r.Text),
+		})
+		return err
+	}}
+
+	conf := pipeline.StreamConfig{Name: "source", Childs: []pipeline.StreamConfig{{Name: "produce"}}}
+	res := h.RunStream(conf, source, produce)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Run.Status, pipeline.RunStatusSucceeded)
+
+	out, ok := res.Output("source")
+	assert.Assert(t, ok)
+	var msg message
+	assert.NilError(t, out.Decode(&msg))
+	assert.Equal(t, msg.Text, "hello")
+
+	msgs := producer.Messages()
+	assert.Equal(t, len(msgs), 1)
+	assert.Equal(t, msgs[0].Topic, "articles")
+	assert.Equal(t, msgs[0].Value, sarama.Encoder(sarama.StringEncoder("hello")))
+
+	producer.SetError(errors.New("broker is down"))
+	res = h.RunStream(conf, source, produce)
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Run.Status, pipeline.RunStatusFailed)
+	out, ok = res.Output("produce")
+	assert.Assert(t, ok)
+	assert.ErrorContains(t, out.Err, "broker is down")
+
+	// 缺少依赖时创建pipeline失败
+	res = New(t).RunStream(conf, source, produce)
+	assert.ErrorContains(t, res.Err, "MyProducer")
+}
@@ -0,0 +1,61 @@
+//go:build wasip1
+
+package guest
+
+import (
+	"encoding/json"
+	"unsafe"
+)
+
+// buffers 持有分配给nezha的内存, 避免被回收
+var buffers = map[uint32][]byte{}
+
+//go:wasmexport nezha_malloc
+func malloc(size uint32) uint32 {
+	buf := make([]byte, size+1)
+	ptr := uint32(uintptr(unsafe.Pointer(&buf[0])))
+	buffers[ptr] = buf
+	return ptr
+}
+
+//go:wasmexport nezha_describe
+func describe() uint64 {
+	return output(Describe())
+}
+
+//go:wasmexport nezha_process
+func process(ptr, size uint32) uint64 {
+	buf := buffers[ptr]
+	delete(buffers, ptr)
+
+	var req ProcessRequest
+	if buf == nil || int(size) >= len(buf) {
+		return output(ProcessResponse{Error: "Invalid request buffer"})
+	}
+	if err := json.Unmarshal(buf[:size], &req); err != nil {
+		return output(ProcessResponse{Error: "Failed to decode request: " + err.Error()})
+	}
+	return output(Process(req))
+}
+
+// output 将v以json编码写入新分配的内存, 返回地址和长度
+func output(v interface{}) uint64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(ProcessResponse{Error: err.Error()})
+	}
+
+	ptr := malloc(uint32(len(data)))
+	copy(buffers[ptr], data)
+	return uint64(ptr)<<32 | uint64(len(data))
+}
+
+//go:wasmimport nezha log
+func hostLog(level, ptr, size uint32)
+
+func writeLog(level uint32, msg string) {
+	if msg == "" {
+		return
+	}
+	hostLog(level, uint32(uintptr(unsafe.Pointer(unsafe.StringData(msg)))), uint32(len(msg)))
+}
@@ -0,0 +1,157 @@
+// Package guest 用于以go编写wasm processor, 编译为wasip1的reactor模块后作为插件上传到nezha:
+//
+//	GOOS=wasip1 GOARCH=wasm go build -buildmode=c-shared -o upper.wasm
+//
+//	func init() {
+//		guest.Register(guest.ProcessorInfo{
+//			Name:    "upper",
+//			Inputs:  []string{"Message"},
+//			Outputs: []guest.Field{{Name: "Text", Type: "string"}},
+//		}, func(config string, inputs map[string]json.RawMessage) (map[string]interface{}, error) {
+//			var msg string
+//			if err := json.Unmarshal(inputs["Message"], &msg); err != nil {
+//				return nil, err
+//			}
+//			return map[string]interface{}{"Text": strings.ToUpper(msg)}, nil
+//		})
+//	}
+//
+//	func main() {}
+//
+// 其他语言实现的wasm模块需要遵循以下ABI, 请求和响应均为json编码:
+//
+//	导出 memory
+//	导出 nezha_malloc(size i32) i32         分配size字节的内存, nezha将请求写入其中
+//	导出 nezha_describe() i64               返回DescribeResponse, 高32位为地址, 低32位为长度
+//	导出 nezha_process(ptr i32, len i32) i64 处理ProcessRequest, 返回ProcessResponse
+//	导入 nezha.log(level i32, ptr i32, len i32) 以nezha的日志输出一条消息
+//
+// 模块以wasip1运行, 但不能访问文件系统, 环境变量和网络. 每次调用都在新的实例中执行, 调用之间不共享状态.
+package guest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+const (
+	ExportMalloc   = "nezha_malloc"
+	ExportDescribe = "nezha_describe"
+	ExportProcess  = "nezha_process"
+
+	HostModule = "nezha"
+	HostLog    = "log"
+)
+
+// 日志级别
+const (
+	LogInfo uint32 = iota
+	LogWarn
+	LogError
+)
+
+// ErrDrop processor返回ErrDrop时丢弃当前数据, 下游的processor不再执行
+var ErrDrop = errors.New("Item dropped")
+
+// Field processor输出的一个inject字段
+type Field struct {
+	Name string `json:"name"`
+	// 类型可以是: string, bytes, int, int64, float64, bool, map, list, any, 为空时为any
+	Type string `json:"type"`
+}
+
+type ProcessorInfo struct {
+	Name         string `json:"name"`
+	SampleConfig string `json:"sample_config"`
+	Description  string `json:"description"`
+	// 注入到processor中的值的名称, 以json编码传入
+	Inputs  []string `json:"inputs"`
+	Outputs []Field  `json:"outputs"`
+}
+
+type DescribeResponse struct {
+	Processors []ProcessorInfo `json:"processors"`
+}
+
+type ProcessRequest struct {
+	Processor string                     `json:"processor"`
+	Config    string                     `json:"config"`
+	Inputs    map[string]json.RawMessage `json:"inputs"`
+}
+
+type ProcessResponse struct {
+	Outputs map[string]json.RawMessage `json:"outputs"`
+	// processor返回的错误, 与调用失败区分开
+	Error string `json:"error"`
+	// 为true时丢弃当前数据
+	Drop bool `json:"drop"`
+}
+
+// Func 处理json编码的输入, 返回的值以json编码后注入到下游
+type Func func(config string, inputs map[string]json.RawMessage) (map[string]interface{}, error)
+
+type registered struct {
+	info ProcessorInfo
+	fn   Func
+}
+
+var processors = map[string]registered{}
+
+// Register 注册processor, 名称重复时panic
+func Register(info ProcessorInfo, fn Func) {
+	if _, ok := processors[info.Name]; ok {
+		panic(fmt.Sprintf("Error registering processor '%v': already registered", info.Name))
+	}
+	processors[info.Name] = registered{info: info, fn: fn}
+}
+
+// Describe 返回所有注册的processor
+func Describe() DescribeResponse {
+	var res DescribeResponse
+	for _, p := range processors {
+		res.Processors = append(res.Processors, p.info)
+	}
+	sort.Slice(res.Processors, func(i, j int) bool {
+		return res.Processors[i].Name < res.Processors[j].Name
+	})
+	return res
+}
+
+// Process 调用注册的processor, panic会被转换为错误
+func Process(req ProcessRequest) (resp ProcessResponse) {
+	p, ok := processors[req.Processor]
+	if !ok {
+		return ProcessResponse{Error: fmt.Sprintf("Processor(%s) not found", req.Processor)}
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			resp = ProcessResponse{Error: fmt.Sprintf("Processor(%s) panic: %v", req.Processor, r)}
+		}
+	}()
+
+	outputs, err := p.fn(req.Config, req.Inputs)
+	if errors.Is(err, ErrDrop) {
+		return ProcessResponse{Drop: true}
+	}
+	if err != nil {
+		return ProcessResponse{Error: err.Error()}
+	}
+
+	resp.Outputs = map[string]json.RawMessage{}
+	for name, v := range outputs {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return ProcessResponse{Error: fmt.Sprintf("Failed to encode %s: %v", name, err)}
+		}
+		resp.Outputs[name] = data
+	}
+	return resp
+}
+
+// Log 以nezha的日志输出一条消息
+func Log(level uint32, format string, args ...interface{}) {
+	writeLog(level, fmt.Sprintf(format, args...))
+}
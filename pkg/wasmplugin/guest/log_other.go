@@ -0,0 +1,13 @@
+//go:build !wasip1
+
+package guest
+
+import (
+	"fmt"
+	"os"
+)
+
+// writeLog 不在wasm中运行时, 例如单元测试, 输出到标准错误
+func writeLog(level uint32, msg string) {
+	fmt.Fprintln(os.Stderr, msg)
+}
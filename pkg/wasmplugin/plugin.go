@@ -0,0 +1,208 @@
+// Package wasmplugin 以WebAssembly模块的形式运行插件中的processor, 模块在纯go实现的wazero中执行.
+//
+// 与go的.so插件不同, wasm插件不要求与nezha使用相同的go版本和依赖版本, 可以使用任意能编译为wasm的语言实现;
+// 与gRPC插件不同, wasm插件不需要独立的进程, 并且运行在沙箱中: 不能访问文件系统, 环境变量和网络,
+// 每次调用都在新的实例中执行, 使用的内存和执行时间受到processor配置的限制.
+// ABI的定义以及go的实现见guest包.
+package wasmplugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/shima-park/lotus/common/log"
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/wasmplugin/guest"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+const (
+	DefaultTimeout = time.Second
+	// DefaultMemoryLimit 单次调用可以使用的内存, 单位MB
+	DefaultMemoryLimit = 64
+
+	describeTimeout = 10 * time.Second
+	wasmPageSize    = 64 << 10
+)
+
+var (
+	pluginsLock sync.RWMutex
+	plugins     []*Plugin
+
+	// 所有插件共享编译缓存, processor使用各自的运行时时不需要重复编译
+	compilationCache = wazero.NewCompilationCache()
+)
+
+// Plugin 一个wasm模块以及它提供的processor
+type Plugin struct {
+	path     string
+	openTime time.Time
+	binary   []byte
+	info     guest.DescribeResponse
+}
+
+// Open 编译wasm模块并获取它提供的processor, 由调用方通过ProcessorFactory注册
+func Open(path string) (*Plugin, error) {
+	log.Info("loading wasm plugin: %s", path)
+
+	binary, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &Plugin{path: path, openTime: time.Now(), binary: binary}
+
+	// 编译耗时与模块大小有关, 超时只限制describe的执行
+	rt, compiled, err := p.compile(context.Background(), DefaultMemoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	defer rt.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), describeTimeout)
+	defer cancel()
+
+	if err := invoke(ctx, rt, compiled, guest.ExportDescribe, nil, &p.info); err != nil {
+		return nil, fmt.Errorf("Plugin(%s) failed to describe: %v", path, err)
+	}
+
+	pluginsLock.Lock()
+	plugins = append(plugins, p)
+	pluginsLock.Unlock()
+	return p, nil
+}
+
+// List 返回所有打开的wasm插件
+func List() []*Plugin {
+	pluginsLock.RLock()
+	defer pluginsLock.RUnlock()
+
+	var res []*Plugin
+	res = append(res, plugins...)
+	return res
+}
+
+func (p *Plugin) Path() string {
+	return p.path
+}
+
+func (p *Plugin) OpenTime() time.Time {
+	return p.openTime
+}
+
+func (p *Plugin) Processors() []guest.ProcessorInfo {
+	return p.info.Processors
+}
+
+// ProcessorFactory 创建wasm模块中的processor的factory
+func (p *Plugin) ProcessorFactory(info guest.ProcessorInfo) processor.Factory {
+	return processor.NewFactory(sampleConfig(info), info.Description, func(config string) (processor.Processor, error) {
+		return p.newProcessor(info, config)
+	})
+}
+
+// compile 创建内存受限的运行时并编译模块, 运行时中提供wasip1以及nezha的host函数
+func (p *Plugin) compile(ctx context.Context, memoryLimit int) (wazero.Runtime, wazero.CompiledModule, error) {
+	rt := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithCompilationCache(compilationCache).
+		WithMemoryLimitPages(uint32(memoryLimit<<20/wasmPageSize)).
+		WithCloseOnContextDone(true))
+
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, rt); err != nil {
+		_ = rt.Close(ctx)
+		return nil, nil, err
+	}
+
+	_, err := rt.NewHostModuleBuilder(guest.HostModule).
+		NewFunctionBuilder().WithFunc(p.hostLog).Export(guest.HostLog).
+		Instantiate(ctx)
+	if err != nil {
+		_ = rt.Close(ctx)
+		return nil, nil, err
+	}
+
+	compiled, err := rt.CompileModule(ctx, p.binary)
+	if err != nil {
+		_ = rt.Close(ctx)
+		return nil, nil, fmt.Errorf("Failed to compile wasm plugin(%s): %v", p.path, err)
+	}
+	return rt, compiled, nil
+}
+
+func (p *Plugin) hostLog(ctx context.Context, m api.Module, level, ptr, size uint32) {
+	data, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		return
+	}
+
+	switch level {
+	case guest.LogWarn:
+		log.Warn("Plugin(%s): %s", p.path, data)
+	case guest.LogError:
+		log.Error("Plugin(%s): %s", p.path, data)
+	default:
+		log.Info("Plugin(%s): %s", p.path, data)
+	}
+}
+
+// invoke 在新的实例中调用导出的函数fn, req不为nil时以json编码写入实例的内存中作为参数,
+// 返回的地址和长度指向的json解码到resp中, 调用结束后实例被销毁
+func invoke(ctx context.Context, rt wazero.Runtime, compiled wazero.CompiledModule, fn string, req, resp interface{}) error {
+	mod, err := rt.InstantiateModule(ctx, compiled, wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize").
+		WithSysWalltime().
+		WithSysNanotime())
+	if err != nil {
+		return err
+	}
+	defer mod.Close(ctx)
+
+	f := mod.ExportedFunction(fn)
+	if f == nil {
+		return fmt.Errorf("Wasm module does not export %s", fn)
+	}
+
+	var params []uint64
+	if req != nil {
+		data, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+
+		malloc := mod.ExportedFunction(guest.ExportMalloc)
+		if malloc == nil {
+			return fmt.Errorf("Wasm module does not export %s", guest.ExportMalloc)
+		}
+		res, err := malloc.Call(ctx, uint64(len(data)))
+		if err != nil {
+			return err
+		}
+
+		ptr := uint32(res[0])
+		if !mod.Memory().Write(ptr, data) {
+			return fmt.Errorf("Wasm module returned an invalid buffer from %s", guest.ExportMalloc)
+		}
+		params = []uint64{uint64(ptr), uint64(len(data))}
+	}
+
+	res, err := f.Call(ctx, params...)
+	if err != nil {
+		return err
+	}
+	if len(res) != 1 {
+		return fmt.Errorf("Wasm function %s must return an i64", fn)
+	}
+
+	data, ok := mod.Memory().Read(uint32(res[0]>>32), uint32(res[0]))
+	if !ok {
+		return fmt.Errorf("Wasm function %s returned an invalid buffer", fn)
+	}
+	return json.Unmarshal(data, resp)
+}
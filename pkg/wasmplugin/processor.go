@@ -0,0 +1,136 @@
+package wasmplugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	"github.com/shima-park/nezha/pkg/processor/dynamic"
+	"github.com/shima-park/nezha/pkg/wasmplugin/guest"
+	"github.com/tetratelabs/wazero"
+	"gopkg.in/yaml.v2"
+)
+
+// Config wasm processor的配置, 其中config原样传给wasm模块中的processor
+type Config struct {
+	// 单次调用的超时时间, 默认1s
+	Timeout time.Duration `yaml:"timeout"`
+	// 单次调用可以使用的内存, 单位MB, 默认64
+	MemoryLimit int `yaml:"memory_limit"`
+	// wasm模块中的processor的配置
+	Config string `yaml:"config"`
+}
+
+func sampleConfig(info guest.ProcessorInfo) string {
+	data, err := yaml.Marshal(Config{
+		Timeout:     DefaultTimeout,
+		MemoryLimit: DefaultMemoryLimit,
+		Config:      info.SampleConfig,
+	})
+	if err != nil {
+		return info.SampleConfig
+	}
+	return string(data)
+}
+
+// wasmProcessor 执行wasm模块中的一个processor, 每个processor使用独立的运行时以应用自己的内存限制
+type wasmProcessor struct {
+	info     guest.ProcessorInfo
+	conf     Config
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	outputs  []dynamic.Field
+}
+
+func (p *Plugin) newProcessor(info guest.ProcessorInfo, rawConfig string) (processor.Processor, error) {
+	var conf Config
+	if err := yaml.Unmarshal([]byte(rawConfig), &conf); err != nil {
+		return nil, err
+	}
+	if conf.Timeout <= 0 {
+		conf.Timeout = DefaultTimeout
+	}
+	if conf.MemoryLimit <= 0 {
+		conf.MemoryLimit = DefaultMemoryLimit
+	}
+
+	var outputs []dynamic.Field
+	for _, f := range info.Outputs {
+		t, ok := dynamic.TypeOf(f.Type)
+		if !ok {
+			return nil, fmt.Errorf("Unsupported type %s of output %s", f.Type, f.Name)
+		}
+		outputs = append(outputs, dynamic.Field{Name: f.Name, Type: t})
+	}
+
+	rt, compiled, err := p.compile(context.Background(), conf.MemoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	wp := &wasmProcessor{
+		info:     info,
+		conf:     conf,
+		runtime:  rt,
+		compiled: compiled,
+		outputs:  outputs,
+	}
+	// 运行时只被生成的processor引用, pipeline停止时关闭
+	return pipeline.WithClose(dynamic.New(info.Inputs, outputs, wp.process), wp.close), nil
+}
+
+func (p *wasmProcessor) close() error {
+	return p.runtime.Close(context.Background())
+}
+
+func (p *wasmProcessor) process(ctx context.Context, inputs []interface{}) ([]interface{}, error) {
+	req := guest.ProcessRequest{
+		Processor: p.info.Name,
+		Config:    p.conf.Config,
+		Inputs:    map[string]json.RawMessage{},
+	}
+	for i, name := range p.info.Inputs {
+		data, err := json.Marshal(inputs[i])
+		if err != nil {
+			return nil, fmt.Errorf("Failed to encode %s: %v", name, err)
+		}
+		req.Inputs[name] = data
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.conf.Timeout)
+	defer cancel()
+
+	var resp guest.ProcessResponse
+	if err := invoke(ctx, p.runtime, p.compiled, guest.ExportProcess, &req, &resp); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("Wasm processor(%s) timeout after %s: %w", p.info.Name, p.conf.Timeout, ctx.Err())
+		}
+		return nil, fmt.Errorf("Wasm processor(%s) failed: %v", p.info.Name, err)
+	}
+	if resp.Drop {
+		return nil, pipeline.ErrDrop
+	}
+	if resp.Error != "" {
+		return nil, errors.New(resp.Error)
+	}
+
+	res := make([]interface{}, len(p.outputs))
+	for i, f := range p.outputs {
+		raw, ok := resp.Outputs[f.Name]
+		if !ok {
+			continue
+		}
+
+		ptr := reflect.New(f.Type)
+		if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("Failed to decode %s(%s): %v", f.Name, p.info.Outputs[i].Type, err)
+		}
+		res[i] = ptr.Elem().Interface()
+	}
+	return res, nil
+}
@@ -0,0 +1,49 @@
+// 测试用的wasm processor, 由测试编译为wasip1模块
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/shima-park/nezha/pkg/wasmplugin/guest"
+)
+
+var sink [][]byte
+
+func init() {
+	guest.Register(guest.ProcessorInfo{
+		Name:         "wasm_test_upper",
+		SampleConfig: "suffix: '!'",
+		Description:  "upper case the message",
+		Inputs:       []string{"Message"},
+		Outputs:      []guest.Field{{Name: "Text", Type: "string"}, {Name: "Size", Type: "int"}},
+	}, func(config string, inputs map[string]json.RawMessage) (map[string]interface{}, error) {
+		var msg string
+		if err := json.Unmarshal(inputs["Message"], &msg); err != nil {
+			return nil, err
+		}
+
+		switch msg {
+		case "":
+			return nil, guest.ErrDrop
+		case "error":
+			return nil, errors.New("bad message")
+		case "loop":
+			for {
+			}
+		case "alloc":
+			for {
+				sink = append(sink, make([]byte, 1<<20))
+			}
+		}
+
+		guest.Log(guest.LogInfo, "upper %s", msg)
+		return map[string]interface{}{
+			"Text": strings.ToUpper(msg) + strings.TrimPrefix(config, "suffix: "),
+			"Size": len(msg),
+		}, nil
+	})
+}
+
+func main() {}
@@ -0,0 +1,122 @@
+package wasmplugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/shima-park/lotus/processor"
+	"github.com/shima-park/nezha/pkg/pipeline"
+	nezhatest "github.com/shima-park/nezha/pkg/testing"
+	"gotest.tools/v3/assert"
+)
+
+var echoWasm string
+
+// 编译testdata/echo为wasip1模块, 没有可用的go工具链时跳过测试
+func TestMain(m *testing.M) {
+	if !supportWasip1() {
+		fmt.Fprintln(os.Stderr, "go toolchain with wasip1 support not found, skip wasm plugin tests")
+		os.Exit(m.Run())
+	}
+
+	dir, err := ioutil.TempDir("", "wasmplugin")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	echoWasm = filepath.Join(dir, "echo.wasm")
+	cmd := exec.Command("go", "build", "-buildmode=c-shared", "-o", echoWasm, "./testdata/echo")
+	cmd.Env = append(os.Environ(), "GOOS=wasip1", "GOARCH=wasm", "CGO_ENABLED=0")
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to build wasm module:", err)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func supportWasip1() bool {
+	out, err := exec.Command("go", "tool", "dist", "list").Output()
+	if err != nil {
+		return false
+	}
+	return strings.Contains(string(out), "wasip1/wasm")
+}
+
+type message struct {
+	Message string `inject:"Message"`
+}
+
+func newUpper(t *testing.T, config string) processor.Processor {
+	if echoWasm == "" {
+		t.Skip("wasm module is not built")
+	}
+
+	p, err := Open(echoWasm)
+	assert.NilError(t, err)
+	assert.Equal(t, len(p.Processors()), 1)
+
+	f := p.ProcessorFactory(p.Processors()[0])
+	assert.Assert(t, f.Description() == "upper case the message")
+
+	proc, err := f.New(config)
+	assert.NilError(t, err)
+
+	// 运行时在pipeline停止时关闭, 测试中直接调用时由测试关闭
+	_, closer := pipeline.UnwrapProcessor(proc)
+	assert.Assert(t, closer != nil)
+	t.Cleanup(func() { assert.NilError(t, closer()) })
+	return proc
+}
+
+func TestWasmProcessor(t *testing.T) {
+	proc := newUpper(t, "timeout: 1m\nconfig: 'suffix: !'")
+	h := nezhatest.New(t)
+
+	res := h.Run(proc, message{Message: "hello"})
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.Field(0).String(), "HELLO!")
+	assert.Equal(t, res.Value.Field(1).Int(), int64(5))
+
+	res = h.Run(proc, message{Message: ""})
+	assert.Assert(t, errors.Is(res.Err, pipeline.ErrDrop))
+
+	res = h.Run(proc, message{Message: "error"})
+	assert.Error(t, res.Err, "bad message")
+
+	// 出错不影响下一次调用
+	res = h.Run(proc, message{Message: "again"})
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.Field(0).String(), "AGAIN!")
+}
+
+func TestWasmProcessorLimits(t *testing.T) {
+	h := nezhatest.New(t)
+
+	// 死循环一定会超时
+	proc := newUpper(t, "timeout: 100ms")
+	res := h.Run(proc, message{Message: "loop"})
+	assert.Assert(t, errors.Is(res.Err, context.DeadlineExceeded), res.Err)
+
+	// 超时时间足够长, 只会因为内存超过限制失败
+	proc = newUpper(t, "timeout: 1m\nmemory_limit: 32")
+	res = h.Run(proc, message{Message: "alloc"})
+	assert.ErrorContains(t, res.Err, "Wasm processor(wasm_test_upper) failed")
+	assert.Assert(t, !errors.Is(res.Err, context.DeadlineExceeded), res.Err)
+
+	res = h.Run(proc, message{Message: "ok"})
+	assert.NilError(t, res.Err)
+	assert.Equal(t, res.Value.Field(0).String(), "OK")
+}